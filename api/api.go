@@ -6,6 +6,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/jobs"
 	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
 )
 
 type ClientService interface {
@@ -14,7 +15,15 @@ type ClientService interface {
 	ListImages(flux.InstanceID, flux.ServiceSpec) ([]flux.ImageStatus, error)
 	PostRelease(flux.InstanceID, jobs.ReleaseJobParams) (jobs.JobID, error)
 	GetRelease(flux.InstanceID, jobs.JobID) (jobs.Job, error)
-	Automate(flux.InstanceID, flux.ServiceID) error
+	ApproveRelease(flux.InstanceID, jobs.JobID, flux.Approval) (jobs.JobID, error)
+	RejectRelease(flux.InstanceID, jobs.JobID, flux.Approval) error
+	CancelRelease(flux.InstanceID, jobs.JobID) error
+	ListJobs(flux.InstanceID, jobs.JobFilter) ([]jobs.Job, error)
+	// FollowJob sends the job on the channel given each time it
+	// changes, until it's done or the stop channel is closed.
+	FollowJob(inst flux.InstanceID, id jobs.JobID, updates chan<- jobs.Job, stop <-chan struct{}) error
+	Promote(inst flux.InstanceID, from, to string, cause flux.ReleaseCause) ([]jobs.JobID, error)
+	Automate(flux.InstanceID, flux.ServiceID, flux.TagFilter) error
 	Deautomate(flux.InstanceID, flux.ServiceID) error
 	Lock(flux.InstanceID, flux.ServiceID) error
 	Unlock(flux.InstanceID, flux.ServiceID) error
@@ -31,7 +40,12 @@ type DaemonService interface {
 	IsDaemonConnected(flux.InstanceID) error
 }
 
+type RegistryService interface {
+	ImagePushed(inst flux.InstanceID, secret string, push registry.Push) error
+}
+
 type FluxService interface {
 	ClientService
 	DaemonService
+	RegistryService
 }
@@ -1,6 +1,7 @@
 package automator
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -47,12 +48,19 @@ func (a *Automator) checkAll(errorLogger log.Logger) {
 		errorLogger.Log("err", err)
 		return
 	}
+	now := time.Now()
 	for _, inst := range insts {
+		for _, schedule := range inst.Config.Settings.Release.Schedules {
+			if err := a.scheduleRelease(inst.ID, schedule, now); err != nil {
+				errorLogger.Log("instance", inst.ID, "schedule", schedule.Name, "err", err)
+			}
+		}
+
 		if !a.hasAutomatedServices(inst.Config.Services) {
 			continue
 		}
 
-		_, err := a.cfg.Jobs.PutJob(inst.ID, automatedInstanceJob(inst.ID, time.Now()))
+		_, err := a.cfg.Jobs.PutJob(inst.ID, automatedInstanceJob(inst.ID, now))
 		if err != nil && err != jobs.ErrJobAlreadyQueued {
 			errorLogger.Log("err", errors.Wrapf(err, "queueing automated instance job"))
 		}
@@ -68,7 +76,7 @@ func (a *Automator) hasAutomatedServices(services map[flux.ServiceID]instance.Se
 	return false
 }
 
-func (a *Automator) Handle(j *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
+func (a *Automator) Handle(_ context.Context, j *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
 	logger := log.NewContext(a.cfg.Logger).With("job", j.ID)
 	switch j.Method {
 	case jobs.AutomatedInstanceJob:
@@ -79,8 +87,13 @@ func (a *Automator) Handle(j *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, er
 }
 
 func (a *Automator) handleAutomatedInstanceJob(logger log.Logger, job *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
-	followUps := []jobs.Job{automatedInstanceJob(job.Instance, time.Now())}
 	params := job.Params.(jobs.AutomatedInstanceJobParams)
+	followUps := []jobs.Job{automatedInstanceJob(job.Instance, time.Now())}
+	// A job for a single repository is a one-off; the regular check
+	// carries on regardless.
+	if params.Repository != "" {
+		followUps = nil
+	}
 
 	config, err := a.cfg.InstanceDB.GetConfig(params.InstanceID)
 	if err != nil {
@@ -136,6 +149,14 @@ func (a *Automator) handleAutomatedInstanceJob(logger log.Logger, job *jobs.Job,
 		return nil, fmt.Errorf("no automated service(s) %s exist in config or running system", automatedServiceIDs)
 	}
 
+	if params.Repository != "" {
+		updates = usingRepository(updates, params.Repository)
+		if len(updates) == 0 {
+			logInJob("no automated services use images from %s", params.Repository)
+			return followUps, nil
+		}
+	}
+
 	// Get the images available for each automated service.
 	images, err := release.CollectAvailableImages(rc.Instance, updates)
 	if err != nil {
@@ -161,8 +182,18 @@ func (a *Automator) handleAutomatedInstanceJob(logger log.Logger, job *jobs.Job,
 				logInJob("error parsing image in service %s container %s (%q): %s", update.Service.ID, container.Name, container.Image, err)
 				return followUps, errors.Wrapf(err, "calculating image updates for %s", container.Name)
 			}
-			if latest := images.LatestImage(currentImageID.Repository()); latest != nil && latest.ID != currentImageID {
-				imageServices[latest.ID] = append(imageServices[latest.ID], flux.ServiceSpec(update.ServiceID))
+			if params.Repository != "" && currentImageID.Repository() != params.Repository {
+				continue
+			}
+			filter := config.Services[update.ServiceID].TagFilter
+			latest := images.LatestImage(currentImageID.Repository(), filter)
+			if latest == nil {
+				continue
+			}
+			// A service pinned by digest gets released whenever the
+			// tag's digest changes, so it can track a fixed tag.
+			if target := instance.ReleaseTarget(currentImageID, latest.ID, false); target != currentImageID {
+				imageServices[target] = append(imageServices[target], flux.ServiceSpec(update.ServiceID))
 			}
 		}
 	}
@@ -198,6 +229,45 @@ func (a *Automator) handleAutomatedInstanceJob(logger log.Logger, job *jobs.Job,
 	return followUps, nil
 }
 
+// usingRepository gives just those updates for services with a
+// container using an image from the repository given.
+func usingRepository(updates []*release.ServiceUpdate, repository string) []*release.ServiceUpdate {
+	var using []*release.ServiceUpdate
+	for _, update := range updates {
+		for _, container := range update.Service.ContainersOrNil() {
+			id, err := flux.ParseImageID(container.Image)
+			if err == nil && id.Repository() == repository {
+				using = append(using, update)
+				break
+			}
+		}
+	}
+	return using
+}
+
+// RepositoryJob gives a job that checks, straight away, just the
+// automated services using images from the repository given (in the
+// form given by `flux.ImageID.Repository()`).
+func RepositoryJob(instanceID flux.InstanceID, repository string, now time.Time) jobs.Job {
+	return jobs.Job{
+		Queue: jobs.AutomatedInstanceJob,
+		// Key stops us getting two jobs for the same repository, if
+		// there's a flurry of pushes
+		Key: strings.Join([]string{
+			jobs.AutomatedInstanceJob,
+			string(instanceID),
+			repository,
+		}, "|"),
+		Method:   jobs.AutomatedInstanceJob,
+		Priority: jobs.PriorityInteractive,
+		Params: jobs.AutomatedInstanceJobParams{
+			InstanceID: instanceID,
+			Repository: repository,
+		},
+		ScheduledAt: now.UTC(),
+	}
+}
+
 func automatedInstanceJob(instanceID flux.InstanceID, now time.Time) jobs.Job {
 	return jobs.Job{
 		Queue: jobs.AutomatedInstanceJob,
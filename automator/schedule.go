@@ -0,0 +1,95 @@
+package automator
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/cron"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// ScheduleKey gives the key for the jobs of a recurring release, so
+// there's only ever one waiting. It changes when the schedule does,
+// so a changed schedule starts afresh.
+func ScheduleKey(instanceID flux.InstanceID, schedule flux.ReleaseSchedule) string {
+	h := fnv.New64a()
+	json.NewEncoder(h).Encode(schedule)
+	return strings.Join([]string{
+		jobs.ReleaseJob,
+		string(instanceID),
+		"schedule",
+		schedule.Name,
+		fmt.Sprintf("%x", h.Sum64()),
+	}, "|")
+}
+
+// ScheduledReleaseJob gives the job for the first time the schedule
+// falls after the time given.
+func ScheduledReleaseJob(instanceID flux.InstanceID, schedule flux.ReleaseSchedule, after time.Time) (jobs.Job, error) {
+	when, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	spec, err := schedule.ReleaseSpec()
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	at := when.Next(after)
+	if at.IsZero() {
+		return jobs.Job{}, errors.Errorf("cron schedule %q never falls", schedule.Cron)
+	}
+	return jobs.Job{
+		Queue:    jobs.ReleaseJob,
+		Key:      ScheduleKey(instanceID, schedule),
+		Method:   jobs.ReleaseJob,
+		Priority: jobs.PriorityBackground,
+		Params: jobs.ReleaseJobParams{
+			ReleaseSpec: spec,
+			Cause: flux.ReleaseCause{
+				User:    flux.UserScheduled,
+				Message: fmt.Sprintf("scheduled release %q", schedule.Name),
+			},
+			At:       at,
+			Schedule: schedule.Name,
+		},
+		ScheduledAt: at,
+	}, nil
+}
+
+// scheduleRelease makes sure there's a job waiting for the next time
+// the schedule falls, once the last one has been and gone.
+func (a *Automator) scheduleRelease(instanceID flux.InstanceID, schedule flux.ReleaseSchedule, now time.Time) error {
+	latest, err := a.cfg.Jobs.ListJobs(instanceID, jobs.JobFilter{
+		Key:   ScheduleKey(instanceID, schedule),
+		Limit: 1,
+	})
+	if err != nil {
+		return errors.Wrap(err, "finding scheduled releases")
+	}
+	after := now
+	if len(latest) > 0 {
+		switch latest[0].State() {
+		case jobs.JobQueued, jobs.JobRunning:
+			return nil
+		}
+		// Don't repeat a time that's been had already, e.g., by
+		// cancelling the release ahead of time.
+		if latest[0].ScheduledAt.After(after) {
+			after = latest[0].ScheduledAt
+		}
+	}
+	job, err := ScheduledReleaseJob(instanceID, schedule, after)
+	if err != nil {
+		return err
+	}
+	if _, err = a.cfg.Jobs.PutJob(instanceID, job); err != nil && err != jobs.ErrJobAlreadyQueued {
+		return errors.Wrap(err, "queueing scheduled release")
+	}
+	return nil
+}
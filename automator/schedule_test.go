@@ -0,0 +1,85 @@
+package automator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+// jobList is just enough of a job store to schedule releases with.
+type jobList struct {
+	jobs.JobReadPusher
+	jobs []jobs.Job
+}
+
+func (l *jobList) ListJobs(_ flux.InstanceID, filter jobs.JobFilter) ([]jobs.Job, error) {
+	var found []jobs.Job
+	for i := len(l.jobs) - 1; i >= 0 && len(found) < filter.Limit; i-- {
+		if l.jobs[i].Key == filter.Key {
+			found = append(found, l.jobs[i])
+		}
+	}
+	return found, nil
+}
+
+func (l *jobList) PutJob(_ flux.InstanceID, job jobs.Job) (jobs.JobID, error) {
+	job.ID = jobs.NewJobID()
+	l.jobs = append(l.jobs, job)
+	return job.ID, nil
+}
+
+func TestScheduleRelease(t *testing.T) {
+	store := &jobList{}
+	a := &Automator{cfg: Config{Jobs: store, Logger: log.NewNopLogger()}}
+
+	schedule := flux.ReleaseSchedule{
+		Name:      "nightly",
+		Cron:      "0 2 * * *",
+		Namespace: "staging",
+	}
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	tonight := time.Date(2017, 3, 2, 2, 0, 0, 0, time.UTC)
+
+	if err := a.scheduleRelease("inst", schedule, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.jobs) != 1 {
+		t.Fatalf("expected one release to be queued, got %d", len(store.jobs))
+	}
+	job := store.jobs[0]
+	params := job.Params.(jobs.ReleaseJobParams)
+	if !job.ScheduledAt.Equal(tonight) || params.Schedule != "nightly" || params.Namespaces[0] != "staging" {
+		t.Errorf("expected a release of staging tonight, got %#v", job)
+	}
+
+	// While it's waiting, nothing more is queued
+	if err := a.scheduleRelease("inst", schedule, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.jobs) != 1 {
+		t.Fatalf("expected no more releases while one is waiting, got %d", len(store.jobs))
+	}
+
+	// If it's cancelled ahead of time, the next one is tomorrow night
+	store.jobs[0].Done = true
+	store.jobs[0].Finished = now
+	if err := a.scheduleRelease("inst", schedule, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.jobs) != 2 || !store.jobs[1].ScheduledAt.Equal(tonight.AddDate(0, 0, 1)) {
+		t.Fatalf("expected a release tomorrow night, got %#v", store.jobs[1:])
+	}
+
+	// A changed schedule starts afresh
+	schedule.Cron = "0 3 * * *"
+	if err := a.scheduleRelease("inst", schedule, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.jobs) != 3 || !store.jobs[2].ScheduledAt.Equal(tonight.Add(time.Hour)) {
+		t.Fatalf("expected a release at 3am tonight, got %#v", store.jobs[2:])
+	}
+}
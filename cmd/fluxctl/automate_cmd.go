@@ -8,7 +8,8 @@ import (
 
 type serviceAutomateOpts struct {
 	*serviceOpts
-	service string
+	service   string
+	tagFilter string
 }
 
 func newServiceAutomate(parent *serviceOpts) *serviceAutomateOpts {
@@ -21,10 +22,12 @@ func (opts *serviceAutomateOpts) Command() *cobra.Command {
 		Short: "Turn on automatic deployment for a service.",
 		Example: makeExample(
 			"fluxctl automate --service=helloworld",
+			"fluxctl automate --service=helloworld --tag-filter='semver:~1.4'",
 		),
 		RunE: opts.RunE,
 	}
 	cmd.Flags().StringVarP(&opts.service, "service", "s", "", "Service to automate")
+	cmd.Flags().StringVar(&opts.tagFilter, "tag-filter", "", "Only release image tags matching this filter, e.g., semver:~1.4, glob:prod-* or regexp:^v\\d+")
 	return cmd
 }
 
@@ -41,5 +44,10 @@ func (opts *serviceAutomateOpts) RunE(_ *cobra.Command, args []string) error {
 		return err
 	}
 
-	return opts.API.Automate(noInstanceID, serviceID)
+	filter, err := flux.ParseTagFilter(opts.tagFilter)
+	if err != nil {
+		return newUsageError(err.Error())
+	}
+
+	return opts.API.Automate(noInstanceID, serviceID, filter)
 }
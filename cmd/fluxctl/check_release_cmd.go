@@ -98,31 +98,8 @@ func (opts *serviceCheckReleaseOpts) RunE(cmd *cobra.Command, args []string) err
 		lastSucceeded = time.Now()
 	)
 
-	for range time.Tick(time.Second) {
-		if retryCount > 0 {
-			fmt.Fprintf(w, "Last status (%s): %s\n", lastSucceeded.Format(time.Kitchen), prevStatus)
-			fmt.Fprintf(w, "Service unavailable. Retrying (#%d) ...\n", retryCount)
-		}
-
-		job, err = opts.API.GetRelease(noInstanceID, jobs.JobID(opts.releaseID))
-		if err != nil {
-			if err, ok := errors.Cause(err).(*httperror.APIError); ok && err.IsUnavailable() {
-				if time.Since(lastSucceeded) > retryTimeout {
-					stop()
-					fmt.Fprintln(os.Stdout, "Giving up; you can try again with")
-					fmt.Fprintf(os.Stdout, "    fluxctl check-release -r %s\n", opts.releaseID)
-					fmt.Fprintln(os.Stdout)
-					break
-				}
-				retryCount++
-				continue
-			}
-			fmt.Fprintf(w, "Status: error querying release.\n") // error will get printed below
-			break
-		}
-
-		lastSucceeded = time.Now()
-		retryCount = 0
+	// showStatus prints the job's status, if it's changed.
+	showStatus := func(job jobs.Job) {
 		status := "Waiting for job to be claimed..."
 		if job.Status != "" {
 			status = job.Status
@@ -147,9 +124,42 @@ func (opts *serviceCheckReleaseOpts) RunE(cmd *cobra.Command, args []string) err
 			fmt.Fprintf(w, "Status: %s\n", status)
 		}
 		prevStatus = status
+	}
+
+	// Follow the release as it goes, if the service can send updates
+	// as they happen. If it can't (e.g., it's an older version), or
+	// the connection is lost, fall back to asking every second.
+	job, followErr := opts.follow(showStatus)
+	if followErr != nil || !job.Done {
+		for range time.Tick(time.Second) {
+			if retryCount > 0 {
+				fmt.Fprintf(w, "Last status (%s): %s\n", lastSucceeded.Format(time.Kitchen), prevStatus)
+				fmt.Fprintf(w, "Service unavailable. Retrying (#%d) ...\n", retryCount)
+			}
 
-		if job.Done {
-			break
+			job, err = opts.API.GetRelease(noInstanceID, jobs.JobID(opts.releaseID))
+			if err != nil {
+				if err, ok := errors.Cause(err).(*httperror.APIError); ok && err.IsUnavailable() {
+					if time.Since(lastSucceeded) > retryTimeout {
+						stop()
+						fmt.Fprintln(os.Stdout, "Giving up; you can try again with")
+						fmt.Fprintf(os.Stdout, "    fluxctl check-release -r %s\n", opts.releaseID)
+						fmt.Fprintln(os.Stdout)
+						break
+					}
+					retryCount++
+					continue
+				}
+				fmt.Fprintf(w, "Status: error querying release.\n") // error will get printed below
+				break
+			}
+
+			lastSucceeded = time.Now()
+			retryCount = 0
+			showStatus(job)
+			if job.Done {
+				break
+			}
 		}
 	}
 	stop()
@@ -166,6 +176,15 @@ func (opts *serviceCheckReleaseOpts) RunE(cmd *cobra.Command, args []string) err
 		for i, msg := range job.Log {
 			fmt.Fprintf(os.Stdout, " %d) %s\n", i+1, msg)
 		}
+	} else if spec.PendingApproval() {
+		fmt.Fprintf(os.Stdout, "This release needs approving before it is carried out (%d of %d approvals so far). Here's the plan:\n", len(spec.Approval.Approvals), spec.Approval.Required)
+		release.PrintResults(os.Stdout, job.Result.(flux.ReleaseResult), opts.verbose)
+		fmt.Fprintf(os.Stdout, "\nTo approve or reject it, run\n")
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "\tfluxctl release approve %s\n", opts.releaseID)
+		fmt.Fprintf(os.Stdout, "\tfluxctl release reject %s\n", opts.releaseID)
+		fmt.Fprintf(os.Stdout, "\n")
+		return nil
 	} else if spec.Kind == flux.ReleaseKindPlan {
 		fmt.Fprintf(os.Stdout, "Here's the plan:\n")
 		release.PrintResults(os.Stdout, job.Result.(flux.ReleaseResult), opts.verbose)
@@ -183,3 +202,29 @@ func (opts *serviceCheckReleaseOpts) RunE(cmd *cobra.Command, args []string) err
 	}
 	return nil
 }
+
+// follow shows the status of the release each time it changes, until
+// it's done, if the service can send updates as they happen.
+func (opts *serviceCheckReleaseOpts) follow(showStatus func(jobs.Job)) (jobs.Job, error) {
+	updates := make(chan jobs.Job)
+	stop := make(chan struct{})
+	defer close(stop)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- opts.API.FollowJob(noInstanceID, jobs.JobID(opts.releaseID), updates, stop)
+	}()
+
+	var job jobs.Job
+	for {
+		select {
+		case job = <-updates:
+			if job.Method != jobs.ReleaseJob {
+				// Let GetRelease say what's wrong
+				return job, errors.New("job is not a release")
+			}
+			showStatus(job)
+		case err := <-errc:
+			return job, err
+		}
+	}
+}
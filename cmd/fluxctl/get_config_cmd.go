@@ -37,7 +37,7 @@ func (opts *getConfigOpts) Command() *cobra.Command {
 		RunE: opts.RunE,
 	}
 	cmd.Flags().StringVarP(&opts.output, "output", "o", "yaml", `The format to output ("yaml" or "json")`)
-	cmd.Flags().StringVar(&opts.fingerprint, "fingerprint", "", `Show a fingerprint of the public key, using the hash given ("md5" or "sha256")`)
+	cmd.Flags().StringVar(&opts.fingerprint, "fingerprint", "", `Show a fingerprint of the public key, and of the git host's pinned key, using the hash given ("md5" or "sha256")`)
 	return cmd
 }
 
@@ -57,6 +57,11 @@ func (opts *getConfigOpts) RunE(_ *cobra.Command, args []string) error {
 	default:
 		return errors.New("unknown output format " + opts.output)
 	}
+	switch opts.fingerprint {
+	case "", "md5", "sha256":
+	default:
+		return errors.New("unknown fingerprint hash " + opts.fingerprint)
+	}
 
 	config, err := opts.API.GetConfig(noInstanceID)
 
@@ -69,21 +74,22 @@ func (opts *getConfigOpts) RunE(_ *cobra.Command, args []string) error {
 		if err != nil {
 			config.Git.Key = "unable to parse public key"
 		} else {
-			switch opts.fingerprint {
-			case "md5":
-				hash := md5.Sum(pk.Marshal())
-				fingerprint := ""
-				for i, b := range hash {
-					fingerprint = fmt.Sprintf("%s%0.2x", fingerprint, b)
-					if i < len(hash)-1 {
-						fingerprint = fingerprint + ":"
-					}
-				}
-				config.Git.Key = fingerprint
-			case "sha256":
-				hash := sha256.Sum256(pk.Marshal())
-				config.Git.Key = strings.TrimRight(base64.StdEncoding.EncodeToString(hash[:]), "=")
+			config.Git.Key = fingerprint(pk, opts.fingerprint)
+		}
+	}
+
+	// Show the fingerprint of each host key pinned for the git host,
+	// so it can be checked against that published by the host
+	if opts.fingerprint != "" && config.Git.KnownHosts != "" {
+		hostKeys, err := config.Git.HostKeys()
+		if err != nil {
+			config.Git.KnownHosts = "unable to parse known hosts"
+		} else {
+			var lines []string
+			for _, hostKey := range hostKeys {
+				lines = append(lines, fmt.Sprintf("%s %s %s", strings.Join(hostKey.Hosts, ","), hostKey.Key.Type(), fingerprint(hostKey.Key, opts.fingerprint)))
 			}
+			config.Git.KnownHosts = strings.Join(lines, "\n")
 		}
 	}
 
@@ -95,3 +101,21 @@ func (opts *getConfigOpts) RunE(_ *cobra.Command, args []string) error {
 	os.Stdout.Write(bytes)
 	return nil
 }
+
+// fingerprint gives the fingerprint of the key, using the hash
+// given ("md5" or "sha256").
+func fingerprint(pk ssh.PublicKey, hash string) string {
+	if hash == "md5" {
+		sum := md5.Sum(pk.Marshal())
+		fingerprint := ""
+		for i, b := range sum {
+			fingerprint = fmt.Sprintf("%s%0.2x", fingerprint, b)
+			if i < len(sum)-1 {
+				fingerprint = fingerprint + ":"
+			}
+		}
+		return fingerprint
+	}
+	sum := sha256.Sum256(pk.Marshal())
+	return strings.TrimRight(base64.StdEncoding.EncodeToString(sum[:]), "=")
+}
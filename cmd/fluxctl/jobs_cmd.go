@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/jobs"
+)
+
+type jobsOpts struct {
+	*serviceOpts
+	method string
+	state  string
+	key    string
+	since  time.Duration
+	limit  int
+	offset int
+}
+
+func newJobs(parent *serviceOpts) *jobsOpts {
+	return &jobsOpts{serviceOpts: parent}
+}
+
+func (opts *jobsOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jobs",
+		Short: "List the jobs queued, running and recently finished.",
+		Example: makeExample(
+			"fluxctl jobs",
+			"fluxctl jobs --method=release --status=failed --since=24h",
+			"fluxctl jobs --limit=20 --offset=20",
+		),
+		RunE: opts.RunE,
+	}
+	cmd.Flags().StringVar(&opts.method, "method", "", "only list jobs of this kind, e.g., release, sync")
+	cmd.Flags().StringVar(&opts.state, "status", "", "only list jobs that are queued, running, succeeded, failed, pending-approval or rejected")
+	cmd.Flags().StringVar(&opts.key, "key", "", "only list jobs with this key")
+	cmd.Flags().DurationVar(&opts.since, "since", 0, "only list jobs submitted within this long, e.g., 1h")
+	cmd.Flags().IntVar(&opts.limit, "limit", jobs.DefaultListLimit, "list at most this many jobs")
+	cmd.Flags().IntVar(&opts.offset, "offset", 0, "skip this many jobs, to see the next page")
+	return cmd
+}
+
+func (opts *jobsOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	filter := jobs.JobFilter{
+		Method: opts.method,
+		Key:    opts.key,
+		Limit:  opts.limit,
+		Offset: opts.offset,
+	}
+	if opts.state != "" {
+		state, err := jobs.ParseJobState(opts.state)
+		if err != nil {
+			return newUsageError(err.Error())
+		}
+		filter.State = state
+	}
+	now := time.Now().UTC()
+	if opts.since > 0 {
+		filter.Since = now.Add(-opts.since)
+	}
+
+	js, err := opts.API.ListJobs(noInstanceID, filter)
+	if err != nil {
+		return err
+	}
+
+	out := newTabwriter()
+	fmt.Fprintln(out, "ID\tMETHOD\tSTATE\tPOSITION\tSUBMITTED\tCLAIMED\tHEARTBEAT\tSTATUS")
+	for _, job := range js {
+		position := "-"
+		if job.QueuePosition > 0 {
+			position = fmt.Sprint(job.QueuePosition)
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			job.ID, job.Method, job.State(), position,
+			age(now, job.Submitted), age(now, job.Claimed), age(now, job.Heartbeat),
+			job.Status)
+	}
+	out.Flush()
+	return nil
+}
+
+// age says how long ago the time given was, or "-" if it's not set.
+func age(now, t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	d := now.Sub(t)
+	if d < 0 {
+		d = 0
+	}
+	return (d / time.Second * time.Second).String() + " ago"
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/jobs"
+)
+
+func jobsArgs(t *testing.T, args []string, shouldErr bool, errMsg string) *genericMockRoundTripper {
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewRouter().Get("ListJobs"): []jobs.Job{
+				{ID: "1", Method: jobs.ReleaseJob, Status: "Queued.", QueuePosition: 2, Submitted: time.Now()},
+				{ID: "2", Method: jobs.ReleaseJob, Status: "Executing...", Claimed: time.Now()},
+			},
+		},
+	}
+	cmd := newJobs(mockServiceOpts(svc)).Command()
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); (err == nil) == shouldErr {
+		if errMsg != "" {
+			t.Fatal(errMsg)
+		} else {
+			t.Fatal(err)
+		}
+	}
+	return svc
+}
+
+func TestJobsCommand(t *testing.T) {
+	svc := jobsArgs(t, []string{"--method=release", "--status=failed", "--since=1h", "--limit=10", "--offset=20"}, false, "")
+	method := "ListJobs"
+	if calledURL(method, svc.requestHistory) == nil {
+		t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+	}
+	vars := calledRequest(method, svc.requestHistory).Vars
+	assertString(t, "release", vars["method"])
+	assertString(t, "failed", vars["state"])
+	assertString(t, "10", vars["limit"])
+	assertString(t, "20", vars["offset"])
+	since, err := time.Parse(time.RFC3339Nano, vars["since"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ago := time.Since(since); ago < time.Hour || ago > time.Hour+time.Minute {
+		t.Errorf("expected since to be an hour ago, got %s", since)
+	}
+
+	jobsArgs(t, []string{"--status=exploded"}, true, "Should error when given an unknown status")
+	jobsArgs(t, []string{"extra"}, true, "Should error when given args")
+}
@@ -51,6 +51,7 @@ func (opts *serviceShowOpts) RunE(_ *cobra.Command, args []string) error {
 
 	out := newTabwriter()
 
+	var filtered bool
 	fmt.Fprintln(out, "SERVICE\tCONTAINER\tIMAGE\tCREATED")
 	for _, service := range services {
 		if len(service.Containers) == 0 {
@@ -62,7 +63,7 @@ func (opts *serviceShowOpts) RunE(_ *cobra.Command, args []string) error {
 		var lineCount int
 		for _, container := range service.Containers {
 			containerName := container.Name
-			reg, repo, currentTag := container.Current.ID.Components()
+			reg, repo, _ := container.Current.ID.Components()
 			if reg != "" {
 				reg += "/"
 			}
@@ -71,7 +72,8 @@ func (opts *serviceShowOpts) RunE(_ *cobra.Command, args []string) error {
 			for _, available := range container.Available {
 				running := "|  "
 				_, _, tag := available.ID.Components()
-				if currentTag == tag {
+				current := isCurrent(container.Current.ID, available.ID)
+				if current {
 					running = "'->"
 					foundRunning = true
 				} else if foundRunning {
@@ -82,7 +84,7 @@ func (opts *serviceShowOpts) RunE(_ *cobra.Command, args []string) error {
 				var printEllipsis, printLine bool
 				if opts.limit <= 0 || lineCount <= opts.limit {
 					printEllipsis, printLine = false, true
-				} else if container.Current.ID == available.ID {
+				} else if current {
 					printEllipsis, printLine = lineCount > (opts.limit+1), true
 				}
 				if printEllipsis {
@@ -93,6 +95,11 @@ func (opts *serviceShowOpts) RunE(_ *cobra.Command, args []string) error {
 					if available.CreatedAt != nil {
 						createdAt = available.CreatedAt.Format(time.RFC822)
 					}
+					// Mark the tags the automator would consider
+					if service.TagFilter != flux.TagFilterNone && service.TagFilter.Matches(tag) {
+						tag += " *"
+						filtered = true
+					}
 					fmt.Fprintf(out, "\t\t%s %s\t%s\n", running, tag, createdAt)
 				}
 			}
@@ -100,9 +107,22 @@ func (opts *serviceShowOpts) RunE(_ *cobra.Command, args []string) error {
 		}
 	}
 	out.Flush()
+	if filtered {
+		fmt.Println("* matches the service's tag filter")
+	}
 	return nil
 }
 
+// isCurrent says whether an available image is the one running. If
+// the running image is pinned by digest, it's whichever has that
+// digest, since the tag may have moved on.
+func isCurrent(running, available flux.ImageID) bool {
+	if running.Pinned() {
+		return running.Digest == available.Digest
+	}
+	return running.Tag == available.Tag
+}
+
 type imageStatusByName []flux.ImageStatus
 
 func (s imageStatusByName) Len() int {
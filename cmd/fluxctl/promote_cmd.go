@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+)
+
+type promoteOpts struct {
+	*serviceOpts
+	from    string
+	to      string
+	user    string
+	message string
+}
+
+func newPromote(parent *serviceOpts) *promoteOpts {
+	return &promoteOpts{serviceOpts: parent}
+}
+
+func (opts *promoteOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "promote",
+		Short: "Promote the latest successful release in one instance to another.",
+		Long: `Promote the latest successful release in one instance to another,
+following the promotion given in the instance config. Instances are
+referred to by their ID, or the name given in the promotion config;
+the instance this is run against must be one of the two.`,
+		Example: makeExample(
+			"fluxctl promote --to=production",
+			"fluxctl promote --from=staging --to=production -m 'passed QA'",
+		),
+		RunE: opts.RunE,
+	}
+
+	username := ""
+	user, err := user.Current()
+	if err == nil {
+		username = user.Username
+	}
+	cmd.Flags().StringVar(&opts.from, "from", "", "instance to promote from; defaults to this instance")
+	cmd.Flags().StringVar(&opts.to, "to", "", "instance to promote to")
+	cmd.Flags().StringVarP(&opts.message, "message", "m", "", "attach a message to the releases")
+	cmd.Flags().StringVar(&opts.user, "user", username, "override the user reported as initiating the releases")
+	return cmd
+}
+
+func (opts *promoteOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 0 {
+		return errorWantedNoArgs
+	}
+	if opts.to == "" {
+		return newUsageError("--to is required")
+	}
+
+	releases, err := opts.API.Promote(noInstanceID, opts.from, opts.to, flux.ReleaseCause{
+		User:    opts.user,
+		Message: opts.message,
+	})
+	if err != nil {
+		return err
+	}
+	if len(releases) == 0 {
+		fmt.Fprintf(os.Stdout, "Nothing to promote to %s.\n", opts.to)
+		return nil
+	}
+
+	fmt.Fprintf(os.Stdout, "Promoted to %s, as releases:\n", opts.to)
+	fmt.Fprintf(os.Stdout, "\n")
+	for _, id := range releases {
+		fmt.Fprintf(os.Stdout, "\t%s\n", id)
+	}
+	fmt.Fprintf(os.Stdout, "\n")
+	fmt.Fprintf(os.Stdout, "To check on them, run `fluxctl check-release --release-id=<id>` against %s.\n", opts.to)
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/jobs"
+)
+
+func promoteArgs(t *testing.T, args []string, shouldErr bool, errMsg string) *genericMockRoundTripper {
+	svc := &genericMockRoundTripper{
+		mockResponses: map[*mux.Route]interface{}{
+			transport.NewRouter().Get("Promote"): transport.PromoteResponse{
+				Releases: []jobs.JobID{"1", "2"},
+			},
+		},
+	}
+	cmd := newPromote(mockServiceOpts(svc)).Command()
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); (err == nil) == shouldErr {
+		if errMsg != "" {
+			t.Fatal(errMsg)
+		} else {
+			t.Fatal(err)
+		}
+	}
+	return svc
+}
+
+func TestPromoteCommand(t *testing.T) {
+	svc := promoteArgs(t, []string{"--from=staging", "--to=production", "--user=alice", "-m", "passed QA"}, false, "")
+	method := "Promote"
+	if calledURL(method, svc.requestHistory) == nil {
+		t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+	}
+	vars := calledRequest(method, svc.requestHistory).Vars
+	assertString(t, "staging", vars["from"])
+	assertString(t, "production", vars["to"])
+	assertString(t, "alice", vars["user"])
+	assertString(t, "passed QA", vars["message"])
+
+	promoteArgs(t, []string{"--from=staging"}, true, "Should error when not given --to")
+	promoteArgs(t, []string{"--to=production", "extra"}, true, "Should error when given args")
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+type releaseApproveOpts struct {
+	*serviceOpts
+	reject  bool
+	user    string
+	message string
+	serviceReleaseOutputOpts
+}
+
+func newReleaseApprove(parent *serviceOpts) *releaseApproveOpts {
+	return &releaseApproveOpts{serviceOpts: parent}
+}
+
+func newReleaseReject(parent *serviceOpts) *releaseApproveOpts {
+	return &releaseApproveOpts{serviceOpts: parent, reject: true}
+}
+
+func (opts *releaseApproveOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approve <release-id>",
+		Short: "Approve a release that is waiting for approval.",
+		Example: makeExample(
+			"fluxctl release approve 12345678-1234-5678-1234-567812345678",
+			"fluxctl release approve -m 'checked in staging' 12345678-1234-5678-1234-567812345678",
+		),
+		RunE: opts.RunE,
+	}
+	if opts.reject {
+		cmd.Use = "reject <release-id>"
+		cmd.Short = "Reject a release that is waiting for approval, so it is not carried out."
+		cmd.Example = makeExample(
+			"fluxctl release reject -m 'not during the freeze' 12345678-1234-5678-1234-567812345678",
+		)
+	} else {
+		cmd.Flags().BoolVar(&opts.noFollow, "no-follow", false, "just approve the release, don't invoke check-release on the approved release")
+		cmd.Flags().BoolVar(&opts.noTty, "no-tty", false, "if not --no-follow, forces simpler, non-TTY status output")
+		cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "include ignored services in output")
+	}
+
+	username := ""
+	user, err := user.Current()
+	if err == nil {
+		username = user.Username
+	}
+	cmd.Flags().StringVarP(&opts.message, "message", "m", "", "attach a message to the approval or rejection")
+	cmd.Flags().StringVar(&opts.user, "user", username, "override the user reported as approving or rejecting the release (ignored if the service knows who you are logged in as, and refused if it doesn't but the instance requires approvals)")
+	return cmd
+}
+
+func (opts *releaseApproveOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("please give the ID of the release")
+	}
+	id := jobs.JobID(args[0])
+	approval := flux.Approval{
+		User:    opts.user,
+		Message: opts.message,
+	}
+
+	if opts.reject {
+		if err := opts.API.RejectRelease(noInstanceID, id, approval); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Release %s rejected.\n", id)
+		return nil
+	}
+
+	releaseID, err := opts.API.ApproveRelease(noInstanceID, id, approval)
+	if err != nil {
+		return err
+	}
+	if releaseID == "" {
+		fmt.Fprintf(os.Stdout, "Release %s approved; it needs more approvals before it is carried out.\n", id)
+		return nil
+	}
+
+	fmt.Fprintf(os.Stdout, "Release %s approved, and submitted as release %s\n", id, releaseID)
+	if opts.noFollow {
+		fmt.Fprintf(os.Stdout, "To check the status of this release job, run\n")
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "\tfluxctl check-release --release-id=%s\n", releaseID)
+		fmt.Fprintf(os.Stdout, "\n")
+		return nil
+	}
+
+	return (&serviceCheckReleaseOpts{
+		serviceOpts:              opts.serviceOpts,
+		releaseID:                string(releaseID),
+		serviceReleaseOutputOpts: opts.serviceReleaseOutputOpts,
+	}).RunE(cmd, nil)
+}
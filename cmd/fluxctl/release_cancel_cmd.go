@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/jobs"
+)
+
+type releaseCancelOpts struct {
+	*serviceOpts
+}
+
+func newReleaseCancel(parent *serviceOpts) *releaseCancelOpts {
+	return &releaseCancelOpts{serviceOpts: parent}
+}
+
+func (opts *releaseCancelOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cancel <release-id>",
+		Short: "Cancel a release that hasn't finished.",
+		Example: makeExample(
+			"fluxctl release cancel 12345678-1234-5678-1234-567812345678",
+		),
+		RunE: opts.RunE,
+	}
+	return cmd
+}
+
+func (opts *releaseCancelOpts) RunE(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return newUsageError("please give the ID of the release")
+	}
+	id := jobs.JobID(args[0])
+	if err := opts.API.CancelRelease(noInstanceID, id); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stdout, "Release %s cancelled. If it was already running, it will stop before pushing any changes; to see how it finished, run\n", id)
+	fmt.Fprintf(os.Stdout, "\n")
+	fmt.Fprintf(os.Stdout, "\tfluxctl check-release --release-id=%s\n", id)
+	fmt.Fprintf(os.Stdout, "\n")
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -22,6 +23,7 @@ type serviceReleaseOpts struct {
 	dryRun      bool
 	user        string
 	message     string
+	at          string
 	serviceReleaseOutputOpts
 }
 
@@ -38,6 +40,7 @@ func (opts *serviceReleaseOpts) Command() *cobra.Command {
 			"fluxctl release --all --update-image=library/hello:v2",
 			"fluxctl release --service=default/foo --update-all-images",
 			"fluxctl release --service=default/foo --no-update",
+			"fluxctl release --all --update-all-images --at=2017-11-01T02:00Z",
 		),
 		RunE: opts.RunE,
 	}
@@ -60,6 +63,14 @@ func (opts *serviceReleaseOpts) Command() *cobra.Command {
 	cmd.Flags().BoolVarP(&opts.verbose, "verbose", "v", false, "include ignored services in output")
 	cmd.Flags().StringVarP(&opts.message, "message", "m", "", "attach a message to the release job")
 	cmd.Flags().StringVar(&opts.user, "user", username, "override the user reported as initating the release job")
+	cmd.Flags().StringVar(&opts.at, "at", "", "carry out the release at this time, e.g., 2017-11-01T02:00Z, rather than straight away")
+
+	cmd.AddCommand(
+		newReleaseApprove(opts.serviceOpts).Command(),
+		newReleaseReject(opts.serviceOpts).Command(),
+		newReleaseCancel(opts.serviceOpts).Command(),
+		newReleaseScheduled(opts.serviceOpts).Command(),
+	)
 	return cmd
 }
 
@@ -118,6 +129,13 @@ func (opts *serviceReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 		excludes = append(excludes, s)
 	}
 
+	var at time.Time
+	if opts.at != "" {
+		if at, err = parseReleaseTime(opts.at); err != nil {
+			return err
+		}
+	}
+
 	if opts.dryRun {
 		fmt.Fprintf(os.Stdout, "Submitting dry-run release job...\n")
 	} else {
@@ -135,11 +153,22 @@ func (opts *serviceReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 			User:    opts.user,
 			Message: opts.message,
 		},
+		At: at,
 	})
 	if err != nil {
 		return err
 	}
 
+	if !at.IsZero() {
+		fmt.Fprintf(os.Stdout, "Release job scheduled for %s, ID %s\n", at.UTC().Format(time.RFC3339), id)
+		fmt.Fprintf(os.Stdout, "To see the releases waiting for their time, or cancel this one, run\n")
+		fmt.Fprintf(os.Stdout, "\n")
+		fmt.Fprintf(os.Stdout, "\tfluxctl release scheduled\n")
+		fmt.Fprintf(os.Stdout, "\tfluxctl release cancel %s\n", id)
+		fmt.Fprintf(os.Stdout, "\n")
+		return nil
+	}
+
 	fmt.Fprintf(os.Stdout, "Release job submitted, ID %s\n", id)
 	if opts.noFollow {
 		fmt.Fprintf(os.Stdout, "To check the status of this release job, run\n")
@@ -156,3 +185,19 @@ func (opts *serviceReleaseOpts) RunE(cmd *cobra.Command, args []string) error {
 		serviceReleaseOutputOpts: opts.serviceReleaseOutputOpts,
 	}).RunE(cmd, nil)
 }
+
+// The layouts accepted for --at; minutes are precise enough, and the
+// zone must be given so there's no doubt about when.
+var releaseTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+}
+
+func parseReleaseTime(s string) (time.Time, error) {
+	for _, layout := range releaseTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, newUsageError(fmt.Sprintf("cannot read %q as a time; give it like 2017-11-01T02:00Z, or with an offset like 2017-11-01T02:00+01:00", s))
+}
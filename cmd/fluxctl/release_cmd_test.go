@@ -91,6 +91,74 @@ func TestReleaseCommand_InputFailures(t *testing.T) {
 
 }
 
+func TestReleaseCommand_Approve(t *testing.T) {
+	svc := testArgs(t, []string{"approve", "--user=alice", "-m", "looks good", "1"}, false, "")
+	method := "ApproveRelease"
+	if calledURL(method, svc.requestHistory) == nil {
+		t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+	}
+	vars := calledRequest(method, svc.requestHistory).Vars
+	assertString(t, "1", vars["id"])
+	assertString(t, "alice", vars["user"])
+	assertString(t, "looks good", vars["message"])
+
+	// The approved release is followed
+	if calledURL("GetRelease", svc.requestHistory) == nil {
+		t.Fatalf("Expecting fluxctl to follow the approved release, but did not.")
+	}
+}
+
+func TestReleaseCommand_Reject(t *testing.T) {
+	svc := testArgs(t, []string{"reject", "--user=bob", "1"}, false, "")
+	method := "RejectRelease"
+	if calledURL(method, svc.requestHistory) == nil {
+		t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+	}
+	assertString(t, "bob", calledRequest(method, svc.requestHistory).Vars["user"])
+
+	testArgs(t, []string{"reject"}, true, "Should error when not given a release ID")
+}
+
+func TestReleaseCommand_Cancel(t *testing.T) {
+	svc := testArgs(t, []string{"cancel", "1"}, false, "")
+	method := "CancelRelease"
+	if calledURL(method, svc.requestHistory) == nil {
+		t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+	}
+	assertString(t, "1", calledRequest(method, svc.requestHistory).Vars["id"])
+
+	testArgs(t, []string{"cancel"}, true, "Should error when not given a release ID")
+}
+
+func TestReleaseCommand_At(t *testing.T) {
+	svc := testArgs(t, []string{"--update-all-images", "--all", "--at=2017-11-01T02:00+01:00"}, false, "")
+	method := "PostRelease"
+	if calledURL(method, svc.requestHistory) == nil {
+		t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+	}
+	assertString(t, "2017-11-01T02:00:00+01:00", calledRequest(method, svc.requestHistory).Vars["at"])
+	// A release for later isn't followed
+	if calledURL("GetRelease", svc.requestHistory) != nil {
+		t.Fatalf("Shouldn't have followed a release scheduled for later")
+	}
+
+	testArgs(t, []string{"--update-all-images", "--all", "--at=tomorrow"}, true, "Should error when given a time it can't read")
+}
+
+func TestReleaseCommand_Scheduled(t *testing.T) {
+	svc := testArgs(t, []string{"scheduled"}, false, "")
+	method := "ListJobs"
+	if calledURL(method, svc.requestHistory) == nil {
+		t.Fatalf("Expecting fluxctl to request %q, but did not.", method)
+	}
+	vars := calledRequest(method, svc.requestHistory).Vars
+	assertString(t, jobs.ReleaseJob, vars["method"])
+	assertString(t, string(jobs.JobQueued), vars["state"])
+	if vars["scheduledAfter"] == "" {
+		t.Errorf("expected to ask for releases scheduled for later")
+	}
+}
+
 // The mocked service is actually a mocked http.RoundTripper
 func newMockService() *genericMockRoundTripper {
 	return &genericMockRoundTripper{
@@ -99,6 +167,26 @@ func newMockService() *genericMockRoundTripper {
 				Status:    "ok",
 				ReleaseID: "1",
 			},
+			transport.NewRouter().Get("ApproveRelease"): transport.PostReleaseResponse{
+				Status:    flux.ApprovalApproved,
+				ReleaseID: "2",
+			},
+			transport.NewRouter().Get("RejectRelease"): nil,
+			transport.NewRouter().Get("CancelRelease"): nil,
+			transport.NewRouter().Get("ListJobs"): []jobs.Job{
+				{
+					ID:     "3",
+					Method: jobs.ReleaseJob,
+					Params: jobs.ReleaseJobParams{
+						ReleaseSpec: flux.ReleaseSpec{
+							ServiceSpecs: []flux.ServiceSpec{flux.ServiceSpecAll},
+							ImageSpec:    flux.ImageSpecLatest,
+							Namespaces:   []string{"default"},
+						},
+						Schedule: "nightly",
+					},
+				},
+			},
 			transport.NewRouter().Get("GetRelease"): jobs.Job{
 				Done: true,
 				ID:   "1",
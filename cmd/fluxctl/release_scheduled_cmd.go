@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/weaveworks/flux/jobs"
+)
+
+type releaseScheduledOpts struct {
+	*serviceOpts
+}
+
+func newReleaseScheduled(parent *serviceOpts) *releaseScheduledOpts {
+	return &releaseScheduledOpts{serviceOpts: parent}
+}
+
+func (opts *releaseScheduledOpts) Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scheduled",
+		Short: "List the releases waiting for their time, including those from release schedules.",
+		Example: makeExample(
+			"fluxctl release scheduled",
+		),
+		RunE: opts.RunE,
+	}
+	return cmd
+}
+
+func (opts *releaseScheduledOpts) RunE(_ *cobra.Command, args []string) error {
+	if len(args) > 0 {
+		return errorWantedNoArgs
+	}
+
+	js, err := opts.API.ListJobs(noInstanceID, jobs.JobFilter{
+		Method:         jobs.ReleaseJob,
+		State:          jobs.JobQueued,
+		ScheduledAfter: time.Now().UTC(),
+		Limit:          jobs.MaxListLimit,
+	})
+	if err != nil {
+		return err
+	}
+
+	out := newTabwriter()
+	fmt.Fprintln(out, "ID\tAT\tSCHEDULE\tSERVICES\tIMAGE\tUSER")
+	for _, job := range js {
+		params, ok := job.Params.(jobs.ReleaseJobParams)
+		if !ok {
+			continue
+		}
+		schedule := params.Schedule
+		if schedule == "" {
+			schedule = "-"
+		}
+		var services []string
+		for _, spec := range params.ServiceSpecs {
+			services = append(services, spec.String())
+		}
+		if len(params.Namespaces) > 0 {
+			services = append(services, "in "+strings.Join(params.Namespaces, ","))
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			job.ID, job.ScheduledAt.UTC().Format(time.RFC3339), schedule,
+			strings.Join(services, " "), params.ImageSpec, params.Cause.User)
+	}
+	out.Flush()
+	return nil
+}
@@ -75,10 +75,12 @@ func (opts *rootOpts) Command() *cobra.Command {
 		newServiceRelease(svcopts).Command(),
 		newServiceCheckRelease(svcopts).Command(),
 		newServiceHistory(svcopts).Command(),
+		newJobs(svcopts).Command(),
 		newServiceAutomate(svcopts).Command(),
 		newServiceDeautomate(svcopts).Command(),
 		newServiceLock(svcopts).Command(),
 		newServiceUnlock(svcopts).Command(),
+		newPromote(svcopts).Command(),
 		newGetConfig(opts).Command(),
 		newSetConfig(opts).Command(),
 		newSave(opts).Command(),
@@ -207,6 +207,12 @@ func abbreviateKind(kind string) string {
 		return "rc"
 	case "Deployment":
 		return "dep"
+	case "DaemonSet":
+		return "ds"
+	case "StatefulSet":
+		return "sts"
+	case "CronJob":
+		return "cronjob"
 	default:
 		return kind
 	}
@@ -19,11 +19,13 @@ import (
 	instancedb "github.com/weaveworks/flux/instance/sql"
 	"github.com/weaveworks/flux/jobs"
 	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/promote"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 )
@@ -65,7 +67,8 @@ func setup() {
 
 	// Job store.
 	s, _ := jobs.NewDatabaseStore(dbDriver, databaseSource, time.Hour)
-	jobStore = jobs.InstrumentedJobStore(s)
+	hub := jobs.NewHub()
+	jobStore = jobs.PublishingJobStore(jobs.InstrumentedJobStore(s), hub)
 
 	// Message bus
 	messageBus := platform.NewStandaloneMessageBus(platform.BusMetricsImpl)
@@ -127,8 +130,16 @@ func setup() {
 		}
 	}
 
+	// Promoter
+	promoter, _ := promote.New(promote.Config{
+		Jobs:       jobStore,
+		InstanceDB: instanceDB,
+		Instancer:  instancer,
+		Logger:     log.NewNopLogger(),
+	})
+
 	// Server
-	apiServer := server.New(ver, instancer, instanceDB, messageBus, jobStore, log.NewNopLogger())
+	apiServer := server.New(ver, instancer, instanceDB, messageBus, jobStore, hub, nil, promoter, log.NewNopLogger())
 	router = transport.NewRouter()
 	handler := httpserver.NewHandler(apiServer, router, log.NewNopLogger())
 	ts = httptest.NewServer(handler)
@@ -263,12 +274,84 @@ func TestFluxsvc_Release(t *testing.T) {
 	}
 }
 
+func TestFluxsvc_FollowJob(t *testing.T) {
+	setup()
+	defer teardown()
+
+	r, err := apiClient.PostRelease("", jobs.ReleaseJobParams{
+		ReleaseSpec: flux.ReleaseSpec{
+			ImageSpec:    "alpine:latest",
+			Kind:         "execute",
+			ServiceSpecs: []flux.ServiceSpec{helloWorldSvc},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := make(chan jobs.Job)
+	stop := make(chan struct{})
+	defer close(stop)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- apiClient.FollowJob("", r, updates, stop)
+	}()
+	next := func() jobs.Job {
+		select {
+		case j := <-updates:
+			return j
+		case err := <-errc:
+			t.Fatalf("expected an update, but following stopped: %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an update")
+		}
+		return jobs.Job{}
+	}
+
+	// First, the job as it is
+	j := next()
+	if j.ID != r || j.Status != jobs.StatusQueued {
+		t.Fatalf("expected the queued job %s, got %#v", r, j)
+	}
+
+	// Then each update, with the whole log
+	expectedLog := append(j.Log, "one", "two", "three")
+	j.Status = "Working."
+	j.Log = expectedLog[:len(expectedLog)-1]
+	if err := jobStore.UpdateJob(j); err != nil {
+		t.Fatal(err)
+	}
+	j.Log = expectedLog
+	if err := jobStore.UpdateJob(j); err != nil {
+		t.Fatal(err)
+	}
+	for j = next(); len(j.Log) < len(expectedLog); j = next() {
+	}
+	if !reflect.DeepEqual(j.Log, expectedLog) || j.Status != "Working." {
+		t.Fatalf("expected the job as updated, got %#v", j)
+	}
+
+	// Until it's done
+	j.Done, j.Success, j.Status = true, true, "Complete."
+	if err := jobStore.UpdateJob(j); err != nil {
+		t.Fatal(err)
+	}
+	for j = next(); !j.Done; j = next() {
+	}
+	if j.Finished.IsZero() {
+		t.Error("expected the finished job to have its finishing time")
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestFluxsvc_Automate(t *testing.T) {
 	setup()
 	defer teardown()
 
 	// Test Automate
-	err := apiClient.Automate("", helloWorldSvc)
+	err := apiClient.Automate("", helloWorldSvc, flux.TagFilterNone)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -6,6 +6,7 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 
 	"github.com/weaveworks/flux/automator"
 	"github.com/weaveworks/flux/db"
+	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/history"
 	historysql "github.com/weaveworks/flux/history/sql"
 	transport "github.com/weaveworks/flux/http"
@@ -24,9 +26,13 @@ import (
 	"github.com/weaveworks/flux/jobs"
 	"github.com/weaveworks/flux/platform"
 	"github.com/weaveworks/flux/platform/rpc/nats"
+	"github.com/weaveworks/flux/promote"
 	"github.com/weaveworks/flux/registry"
+	registrysql "github.com/weaveworks/flux/registry/sql"
 	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/scanner"
 	"github.com/weaveworks/flux/server"
+	"github.com/weaveworks/flux/sync"
 )
 
 const shutdownTimeout = 30 * time.Second
@@ -52,9 +58,20 @@ func main() {
 		memcachedHostname           = fs.String("memcached-hostname", "", "Hostname for memcached service to use when caching chunks. If empty, no memcached will be used.")
 		memcachedTimeout            = fs.Duration("memcached-timeout", 100*time.Millisecond, "Maximum time to wait before giving up on memcached requests.")
 		memcachedService            = fs.String("memcached-service", "memcached", "SRV service used to discover memcache servers.")
+		registryCache               = fs.String("registry-cache", "", `Where to cache registry metadata: "memcached", "memory", "sql" (the database), or "none"; the default is memcached if --memcached-hostname is given, and memory otherwise`)
+		registryCacheSize           = fs.Int("registry-cache-size", 10000, "Maximum number of entries in the in-memory registry cache")
 		registryCacheExpiry         = fs.Duration("registry-cache-expiry", 20*time.Minute, "Duration to keep cached registry tag info. Must be < 1 month.")
+		registryScanInterval        = fs.Duration("registry-scan-interval", scanner.DefaultInterval, "How often to scan registries for the images each instance uses")
+		registryRPS                 = fs.Float64("registry-rps", 10, "Maximum average rate of requests to each registry host, across all instances; 0 means no limit")
+		registryBurst               = fs.Int("registry-burst", 20, "Maximum number of requests to each registry host in a burst")
+		registryCredentialHelpers   = fs.StringSlice("registry-credential-helpers", nil, `Docker credential helpers instances may use to get registry credentials, by name (e.g., "ecr-login" for docker-credential-ecr-login); they are run on this host, so none are allowed unless given here`)
 		releaseJobWorkers           = fs.Int(jobs.ReleaseJob+"-workers", 1, "Number of workers to process release jobs")
 		automatedInstanceJobWorkers = fs.Int(jobs.AutomatedInstanceJob+"-workers", 1, "Number of workers to process automated_instance jobs")
+		syncJobWorkers              = fs.Int(jobs.SyncJob+"-workers", 1, "Number of workers to process sync jobs")
+		promoteJobWorkers           = fs.Int(jobs.PromoteJob+"-workers", 1, "Number of workers to process promote jobs")
+		registryScanJobWorkers      = fs.Int(jobs.RegistryScanJob+"-workers", 1, "Number of workers to process registry_scan jobs")
+		gitMirrorDir                = fs.String("git-mirror-dir", filepath.Join(os.TempDir(), "flux-git-mirrors"), "Directory in which to keep a mirror of each config repo, to check out working copies from; if empty, repos are cloned afresh each time")
+		gitMirrorMaxAge             = fs.Duration("git-mirror-max-age", 24*time.Hour, "How long to keep a git mirror that isn't being used")
 		versionFlag                 = fs.Bool("version", false, "Get version number")
 	)
 	fs.Parse(os.Args)
@@ -130,19 +147,77 @@ func main() {
 		instanceDB = instance.InstrumentedDB(db)
 	}
 
-	var memcacheClient registry.MemcacheClient
-	if *memcachedHostname != "" {
-		memcacheClient = registry.NewMemcacheClient(registry.MemcacheConfig{
-			Host:           *memcachedHostname,
-			Service:        *memcachedService,
-			Timeout:        *memcachedTimeout,
-			UpdateInterval: 1 * time.Minute,
-			Logger:         log.NewContext(logger).With("component", "memcached"),
-		})
-		memcacheClient = registry.InstrumentMemcacheClient(memcacheClient)
-		defer memcacheClient.Stop()
+	// Cache for registry metadata; may be left nil, meaning no
+	// caching.
+	var cacheBackend registry.CacheBackend
+	{
+		backend := *registryCache
+		if backend == "" {
+			backend = "memory"
+			if *memcachedHostname != "" {
+				backend = "memcached"
+			}
+		}
+		switch backend {
+		case "memcached":
+			if *memcachedHostname == "" {
+				logger.Log("component", "registry cache", "err", "--memcached-hostname must be given to use memcached")
+				os.Exit(1)
+			}
+			var memcacheClient registry.MemcacheClient
+			memcacheClient = registry.NewMemcacheClient(registry.MemcacheConfig{
+				Host:           *memcachedHostname,
+				Service:        *memcachedService,
+				Timeout:        *memcachedTimeout,
+				UpdateInterval: 1 * time.Minute,
+				Logger:         log.NewContext(logger).With("component", "memcached"),
+			})
+			memcacheClient = registry.InstrumentMemcacheClient(memcacheClient)
+			defer memcacheClient.Stop()
+			cacheBackend = registry.NewMemcacheBackend(memcacheClient)
+		case "memory":
+			cacheBackend = registry.NewLRUBackend(*registryCacheSize)
+		case "sql":
+			cache, err := registrysql.NewCache(dbDriver, *databaseSource)
+			if err != nil {
+				logger.Log("component", "registry cache", "err", err)
+				os.Exit(1)
+			}
+			cacheBackend = cache
+		case "none":
+			break
+		default:
+			logger.Log("component", "registry cache", "err", fmt.Sprintf("unknown registry cache %q", backend))
+			os.Exit(1)
+		}
+		logger.Log("component", "registry cache", "type", backend)
+	}
+
+	// The index of images used by each instance, kept up to date by
+	// the scanner.
+	var imageIndex registry.Index
+	{
+		index, err := registrysql.New(dbDriver, *databaseSource)
+		if err != nil {
+			logger.Log("component", "image index", "err", err)
+			os.Exit(1)
+		}
+		imageIndex = index
+	}
+
+	// Mirrors of the config repos, if we're keeping them
+	var gitMirrors *git.Mirrors
+	if *gitMirrorDir != "" {
+		var err error
+		gitMirrors, err = git.NewMirrors(*gitMirrorDir)
+		if err != nil {
+			logger.Log("component", "git mirrors", "err", err)
+			os.Exit(1)
+		}
 	}
 
+	registry.AllowCredentialHelpers(*registryCredentialHelpers)
+
 	var instancer instance.Instancer
 	{
 		// Instancer, for the instancing of operations
@@ -151,20 +226,29 @@ func main() {
 			Connecter:           messageBus,
 			Logger:              logger,
 			History:             historyDB,
-			MemcacheClient:      memcacheClient,
+			RegistryCache:       cacheBackend,
 			RegistryCacheExpiry: *registryCacheExpiry,
+			RegistryLimits:      registry.NewRateLimits(*registryRPS, *registryBurst),
+			Index:               imageIndex,
+			// Allow for a scan or two failing before going back to
+			// the registries
+			IndexMaxAge: 3 * *registryScanInterval,
+			GitMirrors:  gitMirrors,
 		}
 	}
 
-	// Job store.
+	// Job store. Updates to jobs are also published on the hub, so
+	// they can be followed as they happen.
 	var jobStore jobs.JobStore
+	hub := jobs.NewHub()
 	{
 		s, err := jobs.NewDatabaseStore(dbDriver, *databaseSource, time.Hour)
 		if err != nil {
 			logger.Log("component", "release job store", "err", err)
 			os.Exit(1)
 		}
-		jobStore = jobs.InstrumentedJobStore(s)
+		s.WeighInstances(instance.NewJobWeigher(instanceDB, time.Minute))
+		jobStore = jobs.PublishingJobStore(jobs.InstrumentedJobStore(s), hub)
 	}
 
 	// Automator component.
@@ -187,6 +271,60 @@ func main() {
 
 	go auto.Start(log.NewContext(logger).With("component", "automator"))
 
+	// Syncer component.
+	var syncer *sync.Syncer
+	{
+		var err error
+		syncer, err = sync.New(sync.Config{
+			Jobs:       jobStore,
+			InstanceDB: instanceDB,
+			Instancer:  instancer,
+			Logger:     log.NewContext(logger).With("component", "syncer"),
+		})
+		if err != nil {
+			logger.Log("component", "syncer", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	go syncer.Start(log.NewContext(logger).With("component", "syncer"))
+
+	// Promoter component.
+	var promoter *promote.Promoter
+	{
+		var err error
+		promoter, err = promote.New(promote.Config{
+			Jobs:       jobStore,
+			InstanceDB: instanceDB,
+			Instancer:  instancer,
+			Logger:     log.NewContext(logger).With("component", "promoter"),
+		})
+		if err != nil {
+			logger.Log("component", "promoter", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	// Scanner component.
+	var imageScanner *scanner.Scanner
+	{
+		var err error
+		imageScanner, err = scanner.New(scanner.Config{
+			Jobs:       jobStore,
+			InstanceDB: instanceDB,
+			Instancer:  instancer,
+			Index:      imageIndex,
+			Logger:     log.NewContext(logger).With("component", "scanner"),
+			Interval:   *registryScanInterval,
+		})
+		if err != nil {
+			logger.Log("component", "scanner", "err", err)
+			os.Exit(1)
+		}
+	}
+
+	go imageScanner.Start(log.NewContext(logger).With("component", "scanner"))
+
 	// Job workers.
 	//
 	// Doing one worker (and one queue) for each job type for now. This way slow
@@ -197,6 +335,9 @@ func main() {
 		jobs.DefaultQueue:         1, // Backwards compatibility...
 		jobs.ReleaseJob:           *releaseJobWorkers,
 		jobs.AutomatedInstanceJob: *automatedInstanceJobWorkers,
+		jobs.SyncJob:              *syncJobWorkers,
+		jobs.PromoteJob:           *promoteJobWorkers,
+		jobs.RegistryScanJob:      *registryScanJobWorkers,
 	} {
 		logger := log.NewContext(logger).With("component", "worker", "queues", fmt.Sprint([]string{queue}))
 		// create i workers for this queue
@@ -206,6 +347,9 @@ func main() {
 			// All workers understand all job types, because I'm a lazy coder.
 			worker.Register(jobs.AutomatedInstanceJob, auto)
 			worker.Register(jobs.ReleaseJob, release.NewReleaser(instancer))
+			worker.Register(jobs.SyncJob, syncer)
+			worker.Register(jobs.PromoteJob, promoter)
+			worker.Register(jobs.RegistryScanJob, imageScanner)
 
 			defer func() {
 				logger.Log("stopping", "true")
@@ -225,8 +369,22 @@ func main() {
 		go cleaner.Clean(cleanTicker.C)
 	}
 
+	// Git mirror GC
+	if gitMirrors != nil {
+		logger := log.NewContext(logger).With("component", "git mirrors")
+		gcTicker := time.NewTicker(time.Hour)
+		defer gcTicker.Stop()
+		go func() {
+			for range gcTicker.C {
+				if err := gitMirrors.GC(*gitMirrorMaxAge); err != nil {
+					logger.Log("err", err)
+				}
+			}
+		}()
+	}
+
 	// The server.
-	server := server.New(version, instancer, instanceDB, messageBus, jobStore, logger)
+	server := server.New(version, instancer, instanceDB, messageBus, jobStore, hub, cacheBackend, promoter, logger)
 
 	// Mechanical components.
 	errc := make(chan error)
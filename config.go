@@ -4,8 +4,11 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"io"
 	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -19,7 +22,16 @@ type GitConfig struct {
 	URL    string `json:"URL" yaml:"URL"`
 	Path   string `json:"path" yaml:"path"`
 	Branch string `json:"branch" yaml:"branch"`
-	Key    string `json:"key" yaml:"key"`
+	// The private deploy key, for a repo reached over SSH
+	Key string `json:"key" yaml:"key"`
+	// The username and password, or personal access token, for a
+	// repo reached over HTTPS
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	// The SSH host key(s) to expect from the git host, in known_hosts
+	// format. If empty, the key presented the next time the repo is
+	// used is pinned here.
+	KnownHosts string `json:"knownHosts,omitempty" yaml:"knownHosts,omitempty"`
 }
 
 // NotifierConfig is the config used to set up a notifier.
@@ -29,21 +41,348 @@ type NotifierConfig struct {
 	ReleaseTemplate string `json:"releaseTemplate" yaml:"releaseTemplate"`
 }
 
+// The kinds of notifier that can be given in the list of notifiers
+// (Slack has its own section, for backward compatibility).
+const (
+	NotifierWebhook = "webhook"
+	NotifierTeams   = "teams"
+	NotifierSMTP    = "smtp"
+	NotifierNATS    = "nats"
+)
+
+// NotifierSpec is the config for one of the list of notifiers. Which
+// fields are used depends on the type of notifier.
+type NotifierSpec struct {
+	Type string `json:"type" yaml:"type"`
+	// Where to send notifications: the URL to POST to for webhook
+	// and teams; the host:port of the server for smtp; and the URL
+	// of the server for nats.
+	URL string `json:"URL" yaml:"URL"`
+	// For webhook, the key used to sign payloads; the signature is
+	// given in the X-Flux-Signature header.
+	Secret string `json:"secret,omitempty" yaml:"secret,omitempty"`
+	// For smtp, the credentials (if any) and addresses to use.
+	Username string   `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string   `json:"password,omitempty" yaml:"password,omitempty"`
+	From     string   `json:"from,omitempty" yaml:"from,omitempty"`
+	To       []string `json:"to,omitempty" yaml:"to,omitempty"`
+	// For smtp, the subject line; for nats, the subject to publish
+	// to.
+	Subject string `json:"subject,omitempty" yaml:"subject,omitempty"`
+	// The types of event to announce, e.g., "release" and "sync". If
+	// empty, only releases are announced.
+	Events []string `json:"events,omitempty" yaml:"events,omitempty"`
+	// Templates for the text of the notifications, overriding the
+	// defaults. The release template is given the release; the event
+	// template is given the event.
+	ReleaseTemplate string `json:"releaseTemplate,omitempty" yaml:"releaseTemplate,omitempty"`
+	EventTemplate   string `json:"eventTemplate,omitempty" yaml:"eventTemplate,omitempty"`
+}
+
+// Wants says whether the notifier should announce events of the type
+// given.
+func (n NotifierSpec) Wants(eventType string) bool {
+	if len(n.Events) == 0 {
+		return eventType == EventRelease
+	}
+	for _, t := range n.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (n NotifierSpec) HideSecrets() NotifierSpec {
+	if n.Secret != "" {
+		n.Secret = secretReplacement
+	}
+	if n.Password != "" {
+		n.Password = secretReplacement
+	}
+	return n
+}
+
 type RegistryConfig struct {
 	// Map of index host to Basic auth string (base64 encoded
 	// username:password), to make it easy to copypasta from docker
 	// config.
 	Auths map[string]Auth `json:"auths" yaml:"auths"`
+	// Map of index host to where to get credentials for it, for
+	// registries that hand out tokens that expire. The host may be
+	// a glob pattern, e.g., `*.dkr.ecr.us-east-1.amazonaws.com`.
+	CredentialProviders map[string]CredentialProviderConfig `json:"credentialProviders,omitempty" yaml:"credentialProviders,omitempty"`
+	// Shared secret that registry webhooks must supply (as the
+	// `secret` query parameter) to be accepted. Webhooks are
+	// refused if this is empty.
+	WebhookSecret string `json:"webhookSecret" yaml:"webhookSecret"`
 }
 
 type Auth struct {
 	Auth string `json:"auth" yaml:"auth"`
 }
 
+// The kinds of credential provider.
+const (
+	CredentialProviderECR    = "ecr"
+	CredentialProviderGCR    = "gcr"
+	CredentialProviderACR    = "acr"
+	CredentialProviderHelper = "helper"
+)
+
+// CredentialProviderConfig says how to get registry credentials,
+// rather than giving them outright. Which fields are needed depends
+// on the type.
+type CredentialProviderConfig struct {
+	// One of "ecr", "gcr", "acr" or "helper"
+	Type string `json:"type" yaml:"type"`
+
+	// ECR: the AWS credentials to get a token with, and the region
+	// (if not the region in the registry host)
+	AccessKeyID     string `json:"accessKeyID,omitempty" yaml:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty" yaml:"secretAccessKey,omitempty"`
+	Region          string `json:"region,omitempty" yaml:"region,omitempty"`
+
+	// GCR: a service account key, as the JSON downloaded from the
+	// Google Cloud console
+	ServiceAccountKey string `json:"serviceAccountKey,omitempty" yaml:"serviceAccountKey,omitempty"`
+
+	// ACR: the Azure AD service principal to get a token with
+	TenantID     string `json:"tenantID,omitempty" yaml:"tenantID,omitempty"`
+	ClientID     string `json:"clientID,omitempty" yaml:"clientID,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty" yaml:"clientSecret,omitempty"`
+
+	// helper: the docker credential helper to run; e.g., "gcr"
+	// means `docker-credential-gcr`, which must be installed
+	// alongside flux
+	Helper string `json:"helper,omitempty" yaml:"helper,omitempty"`
+
+	// Where to ask for tokens, if not the usual place for the type
+	// of provider
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+}
+
+func (p CredentialProviderConfig) HideSecrets() CredentialProviderConfig {
+	if p.SecretAccessKey != "" {
+		p.SecretAccessKey = secretReplacement
+	}
+	if p.ServiceAccountKey != "" {
+		p.ServiceAccountKey = secretReplacement
+	}
+	if p.ClientSecret != "" {
+		p.ClientSecret = secretReplacement
+	}
+	return p
+}
+
+// ReleaseConfig says what to do once the changes in a release have
+// been applied.
+type ReleaseConfig struct {
+	// How long to wait for the released services to become ready,
+	// as a duration like "5m". Empty means the default (five
+	// minutes); "0s" means don't wait at all.
+	VerifyTimeout string `json:"verifyTimeout" yaml:"verifyTimeout"`
+	// Whether to put back the previous definitions of any services
+	// that don't become ready.
+	Rollback bool `json:"rollback" yaml:"rollback"`
+	// How many approvals a release must get before it is carried
+	// out. Zero means releases are carried out straight away.
+	Approvals int `json:"approvals" yaml:"approvals"`
+	// The namespaces in which releases need approval; if empty,
+	// releases to any namespace do.
+	ApprovalNamespaces []string `json:"approvalNamespaces" yaml:"approvalNamespaces"`
+	// Releases to carry out regularly
+	Schedules []ReleaseSchedule `json:"schedules,omitempty" yaml:"schedules,omitempty"`
+	// If set, releases push their changes to a branch of their own
+	// and open a pull request against the config repo's branch,
+	// rather than pushing to it; they're carried out once the pull
+	// request is merged.
+	PullRequest *PullRequestConfig `json:"pullRequest,omitempty" yaml:"pullRequest,omitempty"`
+}
+
+// PullRequestConfig says how to open pull requests for releases. Only
+// config repos hosted on GitHub are supported.
+type PullRequestConfig struct {
+	// A GitHub token with permission to open pull requests against
+	// the config repo. The release's branch is pushed with the git
+	// credentials, as usual.
+	Token string `json:"token" yaml:"token"`
+	// How often to check whether the pull request has been merged,
+	// as a duration like "1m". Empty means use the default.
+	PollInterval string `json:"pollInterval,omitempty" yaml:"pollInterval,omitempty"`
+}
+
+func (p PullRequestConfig) HideSecrets() PullRequestConfig {
+	if p.Token != "" {
+		p.Token = secretReplacement
+	}
+	return p
+}
+
+// ReleaseSchedule is a release carried out regularly, e.g., updating
+// all the images in a namespace every night.
+type ReleaseSchedule struct {
+	// Names the schedule, so it can be changed or removed
+	Name string `json:"name" yaml:"name"`
+	// When to release, in cron syntax, in UTC; e.g., "0 2 * * *" for
+	// 2am every day
+	Cron string `json:"cron" yaml:"cron"`
+	// The services to release, as for `fluxctl release --service`,
+	// or "<all>"; or, the namespace in which to release all services
+	Services  []string `json:"services,omitempty" yaml:"services,omitempty"`
+	Namespace string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// The image to release, as for `fluxctl release --update-image`;
+	// or "<all latest>", the default; or "<no updates>"
+	Image   string   `json:"image,omitempty" yaml:"image,omitempty"`
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
+// ReleaseSpec gives the release to carry out each time the schedule
+// falls.
+func (s ReleaseSchedule) ReleaseSpec() (ReleaseSpec, error) {
+	spec := ReleaseSpec{
+		ImageSpec: ImageSpecLatest,
+		Kind:      ReleaseKindExecute,
+	}
+	switch {
+	case len(s.Services) > 0 && s.Namespace != "":
+		return spec, errors.New("give either services or a namespace, not both")
+	case len(s.Services) > 0:
+		for _, service := range s.Services {
+			serviceSpec, err := ParseServiceSpec(service)
+			if err != nil {
+				return spec, errors.Wrapf(err, "parsing service %q", service)
+			}
+			spec.ServiceSpecs = append(spec.ServiceSpecs, serviceSpec)
+		}
+	case s.Namespace != "":
+		spec.ServiceSpecs = []ServiceSpec{ServiceSpecAll}
+		spec.Namespaces = []string{s.Namespace}
+	default:
+		return spec, errors.New("give the services or the namespace to release")
+	}
+	if s.Image != "" {
+		image, err := ParseImageSpec(s.Image)
+		if err != nil {
+			return spec, errors.Wrapf(err, "parsing image %q", s.Image)
+		}
+		spec.ImageSpec = image
+	}
+	for _, exclude := range s.Exclude {
+		id, err := ParseServiceID(exclude)
+		if err != nil {
+			return spec, errors.Wrapf(err, "parsing excluded service %q", exclude)
+		}
+		spec.Excludes = append(spec.Excludes, id)
+	}
+	return spec, nil
+}
+
+// NeedsApproval says whether releasing any of the services given
+// needs approval.
+func (c ReleaseConfig) NeedsApproval(services []ServiceID) bool {
+	if c.Approvals < 1 {
+		return false
+	}
+	if len(c.ApprovalNamespaces) == 0 {
+		return len(services) > 0
+	}
+	for _, id := range services {
+		namespace, _ := id.Components()
+		for _, ns := range c.ApprovalNamespaces {
+			if ns == namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SyncConfig says whether to keep the platform in sync with the
+// config repo; i.e., whether to apply each new commit, including
+// deleting the resources whose files have been removed.
+type SyncConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+}
+
+// PromotionConfig says where releases made in this instance are
+// promoted to (e.g., from staging to production), and which instances
+// may promote releases to this one. A promotion only goes ahead if
+// the source has an edge to the target, and the target accepts
+// promotions from the source.
+type PromotionConfig struct {
+	// A name for this instance, so it can be referred to in
+	// promotions; e.g., "staging".
+	Name string `json:"name" yaml:"name"`
+	// The IDs of the instances that may promote releases to this
+	// one.
+	AcceptFrom []InstanceID `json:"acceptFrom" yaml:"acceptFrom"`
+	// Where to promote releases to.
+	To []PromotionEdge `json:"to" yaml:"to"`
+}
+
+// PromotionEdge says where to promote releases to, and when.
+type PromotionEdge struct {
+	// The ID of the instance to promote to.
+	Instance InstanceID `json:"instance" yaml:"instance"`
+	// A name for the instance, to refer to it by; e.g.,
+	// "production".
+	Name string `json:"name" yaml:"name"`
+	// How long a release must have been in place before it is
+	// promoted, as a duration like "1h". Empty means promote straight
+	// away.
+	SoakTime string `json:"soakTime" yaml:"soakTime"`
+	// Whether the released services must be ready for the release to
+	// be promoted.
+	RequireReady bool `json:"requireReady" yaml:"requireReady"`
+	// Whether to promote only when asked (with `fluxctl promote`),
+	// rather than after every successful release.
+	Manual bool `json:"manual" yaml:"manual"`
+}
+
+// Soak gives the soak time as a duration.
+func (e PromotionEdge) Soak() (time.Duration, error) {
+	if e.SoakTime == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(e.SoakTime)
+}
+
+// Edge finds the promotion edge to the instance given, by name or by
+// ID.
+func (c PromotionConfig) Edge(to string) (PromotionEdge, bool) {
+	if to == "" {
+		return PromotionEdge{}, false
+	}
+	for _, edge := range c.To {
+		if edge.Name == to || string(edge.Instance) == to {
+			return edge, true
+		}
+	}
+	return PromotionEdge{}, false
+}
+
+// Accepts says whether promotions from the instance given are
+// accepted.
+func (c PromotionConfig) Accepts(from InstanceID) bool {
+	for _, id := range c.AcceptFrom {
+		if id == from {
+			return true
+		}
+	}
+	return false
+}
+
 type InstanceConfig struct {
 	Git      GitConfig      `json:"git" yaml:"git"`
 	Slack    NotifierConfig `json:"slack" yaml:"slack"`
 	Registry RegistryConfig `json:"registry" yaml:"registry"`
+	Release  ReleaseConfig  `json:"release" yaml:"release"`
+	Sync     SyncConfig     `json:"sync" yaml:"sync"`
+
+	Promotion PromotionConfig `json:"promotion" yaml:"promotion"`
+
+	Notifiers []NotifierSpec `json:"notifiers,omitempty" yaml:"notifiers,omitempty"`
 }
 
 // As a safeguard, we make the default behaviour to hide secrets when
@@ -57,10 +396,31 @@ func (c InstanceConfig) MarshalJSON() ([]byte, error) {
 }
 
 func (c InstanceConfig) HideSecrets() SafeInstanceConfig {
-	c.Git = c.Git.HideKey()
+	c.Git = c.Git.HideSecrets()
 	for host, auth := range c.Registry.Auths {
 		c.Registry.Auths[host] = auth.HidePassword()
 	}
+	if c.Registry.CredentialProviders != nil {
+		providers := map[string]CredentialProviderConfig{}
+		for host, p := range c.Registry.CredentialProviders {
+			providers[host] = p.HideSecrets()
+		}
+		c.Registry.CredentialProviders = providers
+	}
+	if c.Registry.WebhookSecret != "" {
+		c.Registry.WebhookSecret = secretReplacement
+	}
+	if c.Release.PullRequest != nil {
+		pr := c.Release.PullRequest.HideSecrets()
+		c.Release.PullRequest = &pr
+	}
+	if c.Notifiers != nil {
+		notifiers := make([]NotifierSpec, len(c.Notifiers))
+		for i, n := range c.Notifiers {
+			notifiers[i] = n.HideSecrets()
+		}
+		c.Notifiers = notifiers
+	}
 	return SafeInstanceConfig(c)
 }
 
@@ -76,6 +436,13 @@ func (a Auth) HidePassword() Auth {
 	return Auth{parts[0] + ":" + secretReplacement}
 }
 
+func (g GitConfig) HideSecrets() GitConfig {
+	if g.Password != "" {
+		g.Password = secretReplacement
+	}
+	return g.HideKey()
+}
+
 func (g GitConfig) HideKey() GitConfig {
 	if g.Key == "" {
 		return g
@@ -102,6 +469,29 @@ func (g GitConfig) HideKey() GitConfig {
 	return g
 }
 
+// HostKey is an SSH host key, and the hosts it's for.
+type HostKey struct {
+	Hosts []string
+	Key   ssh.PublicKey
+}
+
+// HostKeys parses the known hosts.
+func (g GitConfig) HostKeys() ([]HostKey, error) {
+	var keys []HostKey
+	rest := []byte(g.KnownHosts)
+	for {
+		_, hosts, key, _, remaining, err := ssh.ParseKnownHosts(rest)
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, HostKey{Hosts: hosts, Key: key})
+		rest = remaining
+	}
+}
+
 type untypedConfig map[string]interface{}
 
 func (uc untypedConfig) toUnsafeInstanceConfig() (UnsafeInstanceConfig, error) {
@@ -2,6 +2,7 @@ package flux
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -52,3 +53,132 @@ func TestConfig_Patch(t *testing.T) {
 		t.Fatal("auth config not patched")
 	}
 }
+
+func TestReleaseConfig_NeedsApproval(t *testing.T) {
+	services := []ServiceID{"default/helloworld", "prod/frontend"}
+	for _, x := range []struct {
+		config ReleaseConfig
+		needs  bool
+	}{
+		{ReleaseConfig{}, false},
+		{ReleaseConfig{Approvals: 1}, true},
+		{ReleaseConfig{Approvals: 2, ApprovalNamespaces: []string{"prod"}}, true},
+		{ReleaseConfig{Approvals: 2, ApprovalNamespaces: []string{"staging"}}, false},
+		{ReleaseConfig{ApprovalNamespaces: []string{"prod"}}, false},
+	} {
+		if got := x.config.NeedsApproval(services); got != x.needs {
+			t.Errorf("%#v: expected NeedsApproval to be %v, got %v", x.config, x.needs, got)
+		}
+	}
+}
+
+func TestPromotionConfig_Edge(t *testing.T) {
+	conf := PromotionConfig{
+		Name:       "staging",
+		AcceptFrom: []InstanceID{"dev-id"},
+		To: []PromotionEdge{
+			{Instance: "prod-id", Name: "production"},
+			{Instance: "dr-id"},
+		},
+	}
+	for _, x := range []struct {
+		to       string
+		instance InstanceID
+		found    bool
+	}{
+		{"production", "prod-id", true},
+		{"prod-id", "prod-id", true},
+		{"dr-id", "dr-id", true},
+		{"staging", "", false},
+		{"", "", false},
+	} {
+		edge, found := conf.Edge(x.to)
+		if found != x.found || edge.Instance != x.instance {
+			t.Errorf("Edge(%q): expected %q, %v; got %q, %v", x.to, x.instance, x.found, edge.Instance, found)
+		}
+	}
+
+	if !conf.Accepts("dev-id") || conf.Accepts("prod-id") {
+		t.Error("expected promotions to be accepted from dev-id only")
+	}
+}
+
+func TestConfig_HideCredentialProviderSecrets(t *testing.T) {
+	provider := CredentialProviderConfig{
+		Type:            CredentialProviderECR,
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+	}
+	conf := InstanceConfig{
+		Registry: RegistryConfig{
+			CredentialProviders: map[string]CredentialProviderConfig{
+				"*.dkr.ecr.us-east-1.amazonaws.com": provider,
+			},
+		},
+	}
+	hidden := conf.HideSecrets().Registry.CredentialProviders["*.dkr.ecr.us-east-1.amazonaws.com"]
+	if hidden.SecretAccessKey != secretReplacement || hidden.AccessKeyID != provider.AccessKeyID {
+		t.Errorf("expected only the secret access key to be hidden, got %#v", hidden)
+	}
+	if conf.Registry.CredentialProviders["*.dkr.ecr.us-east-1.amazonaws.com"] != provider {
+		t.Errorf("hiding secrets changed the original config")
+	}
+}
+
+func TestConfig_HideGitPassword(t *testing.T) {
+	conf := InstanceConfig{
+		Git: GitConfig{
+			URL:      "https://git.example.com/org/config.git",
+			Username: "flux",
+			Password: "token",
+		},
+	}
+	hidden := conf.HideSecrets().Git
+	if hidden.Password != secretReplacement || hidden.Username != "flux" {
+		t.Errorf("expected only the git password to be hidden, got %#v", hidden)
+	}
+	if conf.Git.Password != "token" {
+		t.Errorf("hiding secrets changed the original config")
+	}
+}
+
+func TestConfig_HidePullRequestToken(t *testing.T) {
+	conf := InstanceConfig{
+		Release: ReleaseConfig{
+			PullRequest: &PullRequestConfig{Token: "token"},
+		},
+	}
+	hidden := conf.HideSecrets().Release.PullRequest
+	if hidden == nil || hidden.Token != secretReplacement {
+		t.Errorf("expected the pull request token to be hidden, got %#v", hidden)
+	}
+	if conf.Release.PullRequest.Token != "token" {
+		t.Errorf("hiding secrets changed the original config")
+	}
+}
+
+func TestGitConfig_HostKeys(t *testing.T) {
+	conf := GitConfig{
+		KnownHosts: `github.com,192.30.253.112 ssh-rsa AAAAB3NzaC1yc2EAAAABIwAAAQEAq2A7hRGmdnm9tUDbO9IDSwBK6TbQa+PXYPCPy6rbTrTtw7PHkccKrpp0yVhp5HdEIcKr6pLlVDBfOLX9QUsyCOV0wzfjIJNlGEYsdlLJizHhbn2mUjvSAHQqZETYP81eFzLQNnPHt4EVVUh7VfDESU84KezmD5QlWpXLmvU31/yMf+Se8xhHTvKSCZIFImWwoG6mbUoWf9nzpIoaSjB+weqqUUmpaaasXVal72J+UX2B+2RPW3RcT0eOzQgqlJL3RKrTJvdsjE3JEAvGq3lGHSZXy28G3skua2SmVi/w4yCE6gbODqnTWlg7+wC604ydGXA8VJiS5ap43JXiUFFAaQ==
+[git.example.com]:2222 ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBEmKSENjQEezOmxkZMy7opKgwFB9nkt5YRrYMjNuG5N87uRgg6CLrbo5wAdT/y6v0mKV0U2w0WZ2YB/++Tpockg=
+`,
+	}
+	keys, err := conf.HostKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected two host keys, got %d", len(keys))
+	}
+	if !reflect.DeepEqual(keys[0].Hosts, []string{"github.com", "192.30.253.112"}) || keys[0].Key.Type() != "ssh-rsa" {
+		t.Errorf("unexpected first host key: %v %s", keys[0].Hosts, keys[0].Key.Type())
+	}
+	if !reflect.DeepEqual(keys[1].Hosts, []string{"[git.example.com]:2222"}) || keys[1].Key.Type() != "ecdsa-sha2-nistp256" {
+		t.Errorf("unexpected second host key: %v %s", keys[1].Hosts, keys[1].Key.Type())
+	}
+
+	conf.KnownHosts = "github.com not-a-key"
+	if _, err := conf.HostKeys(); err == nil {
+		t.Error("expected an error parsing a malformed host key")
+	}
+}
@@ -0,0 +1,191 @@
+// Package cron reads schedules written in the usual five-field cron
+// syntax ("minute hour day-of-month month day-of-week"), and works
+// out when they next fall. Schedules are always in UTC.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How far ahead Next looks before giving up on a schedule that never
+// falls (e.g., the 31st of February).
+const searchYears = 5
+
+type field struct {
+	name     string
+	min, max int
+	names    []string // names for values, from min
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12,
+		names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	// 7 is also Sunday, as in most crons
+	dowField = field{name: "day of week", min: 0, max: 7,
+		names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Schedule is a parsed cron schedule.
+type Schedule struct {
+	spec                          string
+	minute, hour, dom, month, dow uint64
+	// As in other crons, if both the day of the month and the day of
+	// the week are restricted, a day matching either will do.
+	domAny, dowAny bool
+}
+
+// Parse reads a cron schedule, or one of the macros @yearly,
+// @monthly, @weekly, @daily and @hourly.
+func Parse(spec string) (*Schedule, error) {
+	s := &Schedule{spec: spec}
+	expanded := strings.TrimSpace(spec)
+	if macro, ok := macros[strings.ToLower(expanded)]; ok {
+		expanded = macro
+	}
+	fields := strings.Fields(expanded)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron schedule %q should have five fields (minute hour day-of-month month day-of-week), but has %d", spec, len(fields))
+	}
+
+	var err error
+	for _, f := range []struct {
+		field field
+		text  string
+		bits  *uint64
+		any   *bool
+	}{
+		{minuteField, fields[0], &s.minute, nil},
+		{hourField, fields[1], &s.hour, nil},
+		{domField, fields[2], &s.dom, &s.domAny},
+		{monthField, fields[3], &s.month, nil},
+		{dowField, fields[4], &s.dow, &s.dowAny},
+	} {
+		if *f.bits, err = f.field.parse(f.text); err != nil {
+			return nil, fmt.Errorf("cron schedule %q: %s", spec, err)
+		}
+		if f.any != nil {
+			*f.any = f.text == "*" || f.text == "?"
+		}
+	}
+	// Sunday can be 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parse reads a field, which is a comma-separated list of values,
+// ranges, or "*", each of which may have a step (e.g., "*/15").
+func (f field) parse(text string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(text, ",") {
+		rangeText, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangeText = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step %q in %s", part[i+1:], f.name)
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case rangeText == "*" || rangeText == "?":
+			lo, hi = f.min, f.max
+		case strings.Contains(rangeText, "-"):
+			bounds := strings.SplitN(rangeText, "-", 2)
+			var err error
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("range %q in %s goes backwards", rangeText, f.name)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rangeText); err != nil {
+				return 0, err
+			}
+			hi = lo
+			// "5/10" means from 5 onwards, every 10
+			if step > 1 {
+				hi = f.max
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(text string) (int, error) {
+	lower := strings.ToLower(text)
+	for i, name := range f.names {
+		if lower == name {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(text)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s should be from %d to %d, got %q", f.name, f.min, f.max, text)
+	}
+	return v, nil
+}
+
+// Next gives the first time the schedule falls after the time given,
+// or the zero time if it never does.
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(searchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !has(s.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case !has(s.hour, t.Hour()):
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case !has(s.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
@@ -0,0 +1,69 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func mustTime(t *testing.T, s string) time.Time {
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestNext(t *testing.T) {
+	for _, example := range []struct {
+		spec, after, expected string
+	}{
+		{"0 2 * * *", "2017-03-01T01:30:00Z", "2017-03-01T02:00:00Z"},
+		{"0 2 * * *", "2017-03-01T02:00:00Z", "2017-03-02T02:00:00Z"},
+		{"@daily", "2017-12-31T23:59:30Z", "2018-01-01T00:00:00Z"},
+		{"*/15 * * * *", "2017-03-01T10:07:00Z", "2017-03-01T10:15:00Z"},
+		{"30 9-17/4 * * mon-fri", "2017-03-03T18:00:00Z", "2017-03-06T09:30:00Z"},
+		{"0 0 29 2 *", "2017-03-01T00:00:00Z", "2020-02-29T00:00:00Z"},
+		// Either day will do, when both are restricted
+		{"0 0 13 * 5", "2017-03-01T00:00:00Z", "2017-03-03T00:00:00Z"},
+		{"0 0 * * 7", "2017-03-01T00:00:00Z", "2017-03-05T00:00:00Z"},
+		{"0 12 1 jan,jul *", "2017-03-01T00:00:00Z", "2017-07-01T12:00:00Z"},
+		// Never
+		{"0 0 31 2 *", "2017-03-01T00:00:00Z", ""},
+	} {
+		s, err := Parse(example.spec)
+		if err != nil {
+			t.Errorf("%q: %v", example.spec, err)
+			continue
+		}
+		next := s.Next(mustTime(t, example.after))
+		if example.expected == "" {
+			if !next.IsZero() {
+				t.Errorf("%q after %s: expected never, got %s", example.spec, example.after, next)
+			}
+			continue
+		}
+		if expected := mustTime(t, example.expected); !next.Equal(expected) {
+			t.Errorf("%q after %s: expected %s, got %s", example.spec, example.after, expected, next)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * smarch *",
+		"@fortnightly",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected error parsing %q", spec)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS registry_repositories (
+    PRIMARY KEY (instance_id, repository),
+    instance_id  text                      NOT NULL,
+    repository   text                      NOT NULL,
+    scanned_at   timestamp with time zone  NOT NULL,
+    error        text                      NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS registry_images (
+    PRIMARY KEY (instance_id, repository, tag),
+    instance_id  text                      NOT NULL,
+    repository   text                      NOT NULL,
+    tag          text                      NOT NULL,
+    info         jsonb                     NOT NULL,
+    fetched_at   timestamp with time zone  NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS registry_cache (
+    PRIMARY KEY (key),
+    key         text                      NOT NULL,
+    value       bytea                     NOT NULL,
+    expires_at  timestamp with time zone
+);
+
+CREATE INDEX registry_cache_expires_at ON registry_cache (expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE jobs
+  ADD retry        jsonb                     default NULL,
+  ADD attempt      integer,
+  ADD cancelled_at timestamp with time zone;
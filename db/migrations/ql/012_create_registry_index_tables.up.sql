@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS registry_repositories (
+    instance_id  string  NOT NULL,
+    repository   string  NOT NULL,
+    scanned_at   time    NOT NULL,
+    error        string  NOT NULL DEFAULT "",
+);
+
+CREATE TABLE IF NOT EXISTS registry_images (
+    instance_id  string  NOT NULL,
+    repository   string  NOT NULL,
+    tag          string  NOT NULL,
+    info         string  NOT NULL,
+    fetched_at   time    NOT NULL,
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS registry_cache (
+    key         string  NOT NULL,
+    value       blob    NOT NULL,
+    expires_at  time,
+);
+
+CREATE UNIQUE INDEX registry_cache_key ON registry_cache (key);
@@ -0,0 +1,6 @@
+ALTER TABLE jobs
+  ADD retry string;
+ALTER TABLE jobs
+  ADD attempt int;
+ALTER TABLE jobs
+  ADD cancelled_at time;
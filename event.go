@@ -14,6 +14,9 @@ const (
 	EventDeautomate = "deautomate"
 	EventLock       = "lock"
 	EventUnlock     = "unlock"
+	EventRollback   = "rollback"
+	EventSync       = "sync"
+	EventPromote    = "promote"
 
 	LogLevelDebug = "debug"
 	LogLevelInfo  = "info"
@@ -86,10 +89,15 @@ func (e Event) String() string {
 		if len(strServiceIDs) == 0 {
 			strServiceIDs = []string{"no services"}
 		}
+		promoted := ""
+		if from := metadata.Release.Cause.PromotedFrom; from != nil {
+			promoted = fmt.Sprintf(" (promoted from %s)", from)
+		}
 		return fmt.Sprintf(
-			"Released: %s to %s",
+			"Released: %s to %s%s",
 			strings.Join(strImageIDs, ", "),
 			strings.Join(strServiceIDs, ", "),
+			promoted,
 		)
 	case EventAutomate:
 		return fmt.Sprintf("Automated: %s", strings.Join(strServiceIDs, ", "))
@@ -99,6 +107,41 @@ func (e Event) String() string {
 		return fmt.Sprintf("Locked: %s", strings.Join(strServiceIDs, ", "))
 	case EventUnlock:
 		return fmt.Sprintf("Unlocked: %s", strings.Join(strServiceIDs, ", "))
+	case EventRollback:
+		return fmt.Sprintf("Rolled back: %s", strings.Join(strServiceIDs, ", "))
+	case EventSync:
+		metadata := e.Metadata.(SyncEventMetadata)
+		revision := metadata.Revision
+		if len(revision) > 7 {
+			revision = revision[:7]
+		}
+		return fmt.Sprintf(
+			"Synced: %s (%d applied, %d deleted)",
+			revision,
+			len(metadata.Applied),
+			len(metadata.Deleted),
+		)
+	case EventPromote:
+		metadata := e.Metadata.(PromoteEventMetadata)
+		var images []string
+		for _, image := range metadata.Images {
+			images = append(images, image.String())
+		}
+		if len(images) == 0 {
+			images = []string{"no images"}
+		}
+		to := metadata.ToName
+		if to == "" {
+			to = string(metadata.To)
+		}
+		if metadata.Error != "" {
+			return fmt.Sprintf("Promotion to %s failed: %s", to, metadata.Error)
+		}
+		return fmt.Sprintf(
+			"Promoted: %s to %s",
+			strings.Join(images, ", "),
+			to,
+		)
 	default:
 		return "Unknown event"
 	}
@@ -111,3 +154,34 @@ type ReleaseEventMetadata struct {
 	// Message of the error if there was one.
 	Error string `json:"error,omitempty"`
 }
+
+// PromoteEventMetadata is the metadata for when a release is promoted
+// to another instance
+type PromoteEventMetadata struct {
+	// Release is the release (in this instance) that was promoted
+	Release ReleaseID `json:"release"`
+	// To is the instance promoted to, and ToName the name given to it
+	// in the promotion config
+	To     InstanceID `json:"to"`
+	ToName string     `json:"toName,omitempty"`
+	// Images are the images promoted
+	Images []ImageID `json:"images"`
+	// Releases are the releases queued in the instance promoted to,
+	// one for each image
+	Releases []ReleaseID `json:"releases"`
+	// Message of the error if the promotion didn't go ahead
+	Error string `json:"error,omitempty"`
+}
+
+// SyncEventMetadata is the metadata for when the config repo is synced
+// to the platform
+type SyncEventMetadata struct {
+	// Revision is the commit that was synced
+	Revision string `json:"revision"`
+	// Applied and Deleted are the files (relative to the top of the
+	// repo) that were applied or deleted
+	Applied []string `json:"applied,omitempty"`
+	Deleted []string `json:"deleted,omitempty"`
+	// Errors from applying or deleting particular files
+	Errors map[string]string `json:"errors,omitempty"`
+}
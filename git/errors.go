@@ -1,7 +1,7 @@
 package git
 
 import (
-	"errors"
+	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
 )
@@ -19,7 +19,61 @@ described in
 `,
 }}
 
+// ErrPushRejected is returned when pushing fails because the branch
+// has moved on since it was cloned, e.g., because someone else pushed
+// at the same time. Starting again from a fresh clone will usually
+// succeed.
+var ErrPushRejected = &flux.BaseError{
+	Err: errors.New("push rejected because the branch has moved on"),
+	Help: `Someone else pushed to your git repository at the same time
+
+The changes could not be pushed, because the branch had new commits
+on it by the time they were ready. Nothing was changed; it should work
+if you try again.
+`,
+}
+
+// errHostKeyVerification is returned by git operations when ssh
+// refuses the host key; it's explained by HostKeyError.
+var errHostKeyVerification = errors.New("host key verification failed")
+
+// HostKeyError explains that the git host didn't present the host
+// key pinned for it.
+func HostKeyError(url string) error {
+	return flux.UserConfigProblem{&flux.BaseError{
+		Err: errHostKeyVerification,
+		Help: `Host key verification failed for your git repository
+
+The server for your git repository,
+
+    ` + url + `
+
+did not present the SSH host key pinned for it. This may mean someone
+is intercepting the connection; or, it may be that the server's key
+has been changed, or that the repository has moved to another host.
+
+You can see the fingerprint of the pinned key with
+
+    fluxctl get-config --fingerprint=sha256
+
+and check it against that published by your git host. If the key
+has changed legitimately, remove the ` + "`knownHosts`" + ` entry from the git
+section of your config (or replace it with the new key, in
+known_hosts format), and set the config again. A removed key is
+pinned afresh the next time the repository is used.
+
+`,
+	}}
+}
+
 func CloningError(url string, actual error) error {
+	if errors.Cause(actual) == errHostKeyVerification {
+		return HostKeyError(url)
+	}
+	// e.g., from pinning the host key; it's explained already
+	if _, ok := actual.(flux.UserConfigProblem); ok {
+		return actual
+	}
 	return flux.UserConfigProblem{&flux.BaseError{
 		Err: actual,
 		Help: `Problem cloning your git repository
@@ -43,6 +97,9 @@ cross-check with the fingerprint given by
 }
 
 func PushError(url string, actual error) error {
+	if errors.Cause(actual) == errHostKeyVerification {
+		return HostKeyError(url)
+	}
 	return flux.UserConfigProblem{&flux.BaseError{
 		Err: actual,
 		Help: `Problem committing and pushing to git repository.
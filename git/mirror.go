@@ -0,0 +1,209 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Mirrors keeps a bare mirror on disk of each repo it's asked for,
+// and checks out working copies from it. Fetching what's new into the
+// mirror is much quicker than cloning the whole repo afresh each time,
+// for any but the smallest of repos.
+//
+// Each owner (e.g., an instance) gets its own mirror of a repo, even
+// if another owner uses the same one, since access is by the owner's
+// key. Only one process should use a mirror directory at a time.
+type Mirrors struct {
+	dir     string
+	mu      sync.Mutex
+	mirrors map[string]*mirror // by directory
+	checked map[string]*mirror // by working copy
+}
+
+type mirror struct {
+	sync.Mutex // held while fetching, or adding worktrees
+	dir        string
+	inUse      int // protected by Mirrors.mu
+}
+
+// NewMirrors gives mirrors kept in the directory given, creating it if
+// necessary.
+func NewMirrors(dir string) (*Mirrors, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "creating directory for git mirrors")
+	}
+	return &Mirrors{
+		dir:     dir,
+		mirrors: map[string]*mirror{},
+		checked: map[string]*mirror{},
+	}, nil
+}
+
+// Repo gives the repo set up so that Clone and CloneWithHistory check
+// out a working copy from the owner's mirror of it. Call Clean on the
+// repo to remove the working copy, once finished with.
+func (m *Mirrors) Repo(owner string, r Repo) Repo {
+	r.mirrors, r.owner = m, owner
+	return r
+}
+
+// checkout fetches the latest from the repo into the owner's mirror,
+// then adds a working copy of the branch.
+func (m *Mirrors) checkout(owner string, r Repo) (path string, err error) {
+	mir := m.acquire(owner, r.URL)
+	defer func() {
+		if err != nil {
+			m.release(mir)
+		}
+	}()
+
+	mir.Lock()
+	defer mir.Unlock()
+
+	ref, err := m.update(mir, r)
+	if err != nil {
+		return "", err
+	}
+	// Forget any working copies that have been removed
+	if err := execGitCmd(mir.dir, nil, nil, "worktree", "prune"); err != nil {
+		return "", errors.Wrap(err, "git worktree prune")
+	}
+
+	workingDir, err := ioutil.TempDir(os.TempDir(), "flux-gitclone")
+	if err != nil {
+		return "", err
+	}
+	repoPath := filepath.Join(workingDir, "repo")
+	if err := execGitCmd(mir.dir, nil, nil, "worktree", "add", "--detach", repoPath, ref); err != nil {
+		os.RemoveAll(workingDir)
+		return "", errors.Wrap(err, "git worktree add")
+	}
+
+	m.mu.Lock()
+	m.checked[repoPath] = mir
+	m.mu.Unlock()
+	return repoPath, nil
+}
+
+// head fetches the latest from the repo into the owner's mirror, and
+// gives the revision at the head of the branch, without checking out
+// a working copy.
+func (m *Mirrors) head(owner string, r Repo) (string, error) {
+	mir := m.acquire(owner, r.URL)
+	defer m.release(mir)
+
+	mir.Lock()
+	defer mir.Unlock()
+
+	ref, err := m.update(mir, r)
+	if err != nil {
+		return "", err
+	}
+	return revision(mir.dir, ref)
+}
+
+// update fetches the latest from the repo into the mirror, which must
+// be locked, creating the mirror if need be. It gives the ref the
+// branch is fetched to.
+func (m *Mirrors) update(mir *mirror, r Repo) (string, error) {
+	creds, err := r.credentials()
+	if err != nil {
+		return "", err
+	}
+	defer creds.remove()
+
+	if _, err := os.Stat(filepath.Join(mir.dir, "HEAD")); os.IsNotExist(err) {
+		if err := execGitCmd("", nil, nil, "init", "--bare", mir.dir); err != nil {
+			return "", errors.Wrap(err, "git init")
+		}
+		if err := execGitCmd(mir.dir, nil, nil, "remote", "add", "origin", r.URL); err != nil {
+			os.RemoveAll(mir.dir)
+			return "", errors.Wrap(err, "git remote add")
+		}
+	}
+	// The branch is fetched to a remote ref, so that no worktree ever
+	// has it checked out; they're all detached.
+	ref := "refs/remotes/origin/" + r.Branch
+	if err := execGitCmd(mir.dir, creds, nil, "fetch", "origin", "+refs/heads/"+r.Branch+":"+ref); err != nil {
+		return "", errors.Wrap(err, "git fetch")
+	}
+	if err := r.pin(creds); err != nil {
+		return "", err
+	}
+
+	// The modification time of the mirror says when it was last used
+	now := time.Now()
+	os.Chtimes(mir.dir, now, now)
+	return ref, nil
+}
+
+// remove removes a working copy checked out from a mirror.
+func (m *Mirrors) remove(path string) error {
+	m.mu.Lock()
+	mir, ok := m.checked[path]
+	delete(m.checked, path)
+	m.mu.Unlock()
+	err := os.RemoveAll(filepath.Dir(path))
+	if ok {
+		// The worktree is pruned from the mirror next time it's
+		// checked out from.
+		m.release(mir)
+	}
+	return err
+}
+
+func (m *Mirrors) acquire(owner, url string) *mirror {
+	sum := sha256.Sum256([]byte(owner + "\x00" + url))
+	dir := filepath.Join(m.dir, hex.EncodeToString(sum[:]))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mir, ok := m.mirrors[dir]
+	if !ok {
+		mir = &mirror{dir: dir}
+		m.mirrors[dir] = mir
+	}
+	mir.inUse++
+	return mir
+}
+
+func (m *Mirrors) release(mir *mirror) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mir.inUse--
+}
+
+// GC removes the mirrors that haven't been used for the time given
+// (e.g., because the repo is no longer used, or its URL has changed),
+// other than those with working copies still checked out.
+func (m *Mirrors) GC(maxAge time.Duration) error {
+	entries, err := ioutil.ReadDir(m.dir)
+	if err != nil {
+		return errors.Wrap(err, "listing git mirrors")
+	}
+	cutoff := time.Now().Add(-maxAge)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.ModTime().After(cutoff) {
+			continue
+		}
+		dir := filepath.Join(m.dir, entry.Name())
+		if mir, ok := m.mirrors[dir]; ok {
+			if mir.inUse > 0 {
+				continue
+			}
+			delete(m.mirrors, dir)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.Wrapf(err, "removing git mirror %s", entry.Name())
+		}
+	}
+	return nil
+}
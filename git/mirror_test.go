@@ -0,0 +1,144 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMirrorCheckout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-test-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An upstream repo with one commit on master
+	upstream := filepath.Join(dir, "upstream")
+	seed := filepath.Join(dir, "seed")
+	gitIn(t, dir, "init", "-q", "--bare", upstream)
+	gitIn(t, dir, "init", "-q", seed)
+	if err := ioutil.WriteFile(filepath.Join(seed, "a.yaml"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitIn(t, seed, "add", ".")
+	gitIn(t, seed, "commit", "-q", "-m", "first")
+	gitIn(t, seed, "push", "-q", upstream, "HEAD:refs/heads/master")
+
+	mirrors, err := NewMirrors(filepath.Join(dir, "mirrors"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := mirrors.Repo("instance", Repo{URL: upstream, Branch: "master"})
+
+	path, err := repo.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(path, "a.yaml"), []byte("a2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CommitAndPush(path, "second"); err != nil {
+		t.Fatal(err)
+	}
+	pushed, err := HeadRevision(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Clean(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected working copy to be removed, but got %v", err)
+	}
+
+	// Checking out again fetches the commit just pushed
+	path, err = repo.CloneWithHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := HeadRevision(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head != pushed {
+		t.Errorf("expected to check out %s, got %s", pushed, head)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(path, "a.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "a2" {
+		t.Errorf("expected a.yaml to have been updated, got %q", content)
+	}
+
+	// A mirror with a working copy checked out isn't collected ...
+	if err := mirrors.GC(-time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Join(dir, "mirrors")); len(entries) != 1 {
+		t.Errorf("expected mirror in use to be kept, got %d mirrors", len(entries))
+	}
+	// ... but it is once it's no longer used
+	if err := repo.Clean(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := mirrors.GC(-time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Join(dir, "mirrors")); len(entries) != 0 {
+		t.Errorf("expected unused mirror to be removed, got %d mirrors", len(entries))
+	}
+}
+
+func TestBranchHead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-test-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	upstream := filepath.Join(dir, "upstream")
+	seed := filepath.Join(dir, "seed")
+	gitIn(t, dir, "init", "-q", "--bare", upstream)
+	gitIn(t, dir, "init", "-q", seed)
+	commit := func(content string) string {
+		if err := ioutil.WriteFile(filepath.Join(seed, "a.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitIn(t, seed, "add", ".")
+		gitIn(t, seed, "commit", "-q", "-m", content)
+		gitIn(t, seed, "push", "-q", upstream, "HEAD:refs/heads/master")
+		rev, err := HeadRevision(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rev
+	}
+
+	mirrors, err := NewMirrors(filepath.Join(dir, "mirrors"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := Repo{URL: upstream, Branch: "master"}
+	mirrored := mirrors.Repo("instance", plain)
+
+	for _, content := range []string{"a", "a2"} {
+		expected := commit(content)
+		for name, repo := range map[string]Repo{"plain": plain, "mirrored": mirrored} {
+			head, err := repo.BranchHead()
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if head != expected {
+				t.Errorf("%s: expected branch head %s, got %s", name, expected, head)
+			}
+		}
+	}
+
+	if _, err := (Repo{URL: upstream, Branch: "nonesuch"}).BranchHead(); err == nil {
+		t.Error("expected error getting head of branch that doesn't exist")
+	}
+}
@@ -14,23 +14,21 @@ import (
 	"github.com/pkg/errors"
 )
 
-// Do a shallow clone of the repo. We only need the files, and not the
-// history. A shallow clone is marginally quicker, and takes less
-// space, than a full clone.
-func clone(workingDir, keyData, repoURL, repoBranch string) (path string, err error) {
-	keyPath, err := writeKey(keyData)
-	if err != nil {
-		return "", err
-	}
-	defer os.Remove(keyPath)
+// Clone the repo. Usually we only need the files, and not the
+// history, in which case we do a shallow clone; that is marginally
+// quicker, and takes less space, than a full clone.
+func clone(workingDir string, creds *credentials, repoURL, repoBranch string, shallow bool) (path string, err error) {
 	repoPath := filepath.Join(workingDir, "repo")
-	// --single-branch is also useful, but is implied by --depth=1
-	args := []string{"clone", "--depth=1"}
+	// --single-branch is implied by --depth=1
+	args := []string{"clone", "--single-branch"}
+	if shallow {
+		args = append(args, "--depth=1")
+	}
 	if repoBranch != "" {
 		args = append(args, "--branch", repoBranch)
 	}
 	args = append(args, repoURL, repoPath)
-	if err := execGitCmd(workingDir, keyPath, args...); err != nil {
+	if err := execGitCmd(workingDir, creds, nil, args...); err != nil {
 		return "", errors.Wrap(err, "git clone")
 	}
 	return repoPath, nil
@@ -38,7 +36,7 @@ func clone(workingDir, keyData, repoURL, repoBranch string) (path string, err er
 
 func commit(workingDir, commitMessage string) error {
 	if err := execGitCmd(
-		workingDir, "",
+		workingDir, nil, nil,
 		"-c", "user.name=Weave Flux", "-c", "user.email=support@weave.works",
 		"commit",
 		"--no-verify", "-a", "-m", commitMessage,
@@ -48,29 +46,75 @@ func commit(workingDir, commitMessage string) error {
 	return nil
 }
 
-func push(keyData, repoBranch, workingDir string) error {
-	keyPath, err := writeKey(keyData)
-	if err != nil {
-		return err
+func push(creds *credentials, repoBranch, workingDir string) error {
+	// Push HEAD rather than the branch, since a working copy checked
+	// out from a mirror doesn't have the branch checked out.
+	refspec := "HEAD"
+	if repoBranch != "" {
+		refspec = "HEAD:refs/heads/" + repoBranch
 	}
-	defer os.Remove(keyPath)
-	if err := execGitCmd(workingDir, keyPath, "push", "origin", repoBranch); err != nil {
+	if err := execGitCmd(workingDir, creds, nil, "push", "origin", refspec); err != nil {
+		if strings.Contains(err.Error(), rejectedMarker) {
+			return ErrPushRejected
+		}
 		return errors.Wrap(err, fmt.Sprintf("git push origin %s", repoBranch))
 	}
 	return nil
 }
 
-func execGitCmd(dir, keyPath string, args ...string) error {
+// rebase fetches the branch from upstream, and replays the commits
+// made in the working copy on top of it. If that conflicts, the
+// working copy is reset to the upstream branch, so the changes can be
+// made afresh, and ErrRebaseConflict returned.
+func rebase(creds *credentials, repoURL, repoBranch, workingDir string) error {
+	// Fetching from the URL rather than the remote means only
+	// FETCH_HEAD is updated, which belongs to this working copy even
+	// if it was checked out from a mirror.
+	ref := "HEAD"
+	if repoBranch != "" {
+		ref = "refs/heads/" + repoBranch
+	}
+	if err := execGitCmd(workingDir, creds, nil, "fetch", repoURL, ref); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("git fetch %s", ref))
+	}
+	if err := execGitCmd(
+		workingDir, nil, nil,
+		"-c", "user.name=Weave Flux", "-c", "user.email=support@weave.works",
+		"rebase", "FETCH_HEAD",
+	); err != nil {
+		execGitCmd(workingDir, nil, nil, "rebase", "--abort")
+		if err := execGitCmd(workingDir, nil, nil, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return errors.Wrap(err, "git reset")
+		}
+		return ErrRebaseConflict
+	}
+	return nil
+}
+
+// execGitCmd runs git with the arguments given, writing its output to
+// `out` if supplied. The credentials are needed only for commands
+// that talk to the upstream repo.
+func execGitCmd(dir string, creds *credentials, out io.Writer, args ...string) error {
+	if creds != nil && creds.username != "" {
+		// Clear out any other helpers first, so ours is the only one
+		args = append([]string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}, args...)
+	}
 	c := exec.Command("git", args...)
 	if dir != "" {
 		c.Dir = dir
 	}
-	c.Env = env(keyPath)
-	c.Stdout = ioutil.Discard
+	c.Env = env(creds)
+	if out == nil {
+		out = ioutil.Discard
+	}
+	c.Stdout = out
 	errOut := &bytes.Buffer{}
 	c.Stderr = errOut
 	err := c.Run()
 	if err != nil {
+		if strings.Contains(errOut.String(), hostKeyFailedMarker) {
+			return errHostKeyVerification
+		}
 		msg := findFatalMessage(errOut)
 		if msg != "" {
 			err = errors.New(msg)
@@ -79,18 +123,193 @@ func execGitCmd(dir, keyPath string, args ...string) error {
 	return err
 }
 
-func env(keyPath string) []string {
-	base := `GIT_SSH_COMMAND=ssh -o UserKnownHostsFile=/dev/null -o StrictHostKeyChecking=no`
-	if keyPath == "" {
-		return []string{base}
+func env(creds *credentials) []string {
+	// Only the host keys we know about are trusted (with the exception
+	// of when we're trusting the host on first use, below). They're
+	// written unhashed, so they can be compared.
+	knownHosts, strict := "/dev/null", "yes"
+	if creds != nil && creds.knownHostsPath != "" {
+		knownHosts = creds.knownHostsPath
 	}
-	return []string{fmt.Sprintf("%s -i %q", base, keyPath), "GIT_TERMINAL_PROMPT=0"}
+	if creds != nil && creds.trustOnFirstUse {
+		strict = "no"
+	}
+	sshCommand := fmt.Sprintf("ssh -o UserKnownHostsFile=%q -o GlobalKnownHostsFile=/dev/null -o HashKnownHosts=no -o StrictHostKeyChecking=%s", knownHosts, strict)
+	if creds == nil {
+		return []string{"GIT_SSH_COMMAND=" + sshCommand}
+	}
+	if creds.keyPath != "" {
+		sshCommand = fmt.Sprintf("%s -i %q", sshCommand, creds.keyPath)
+	}
+	env := []string{"GIT_SSH_COMMAND=" + sshCommand, "GIT_TERMINAL_PROMPT=0"}
+	if creds.username != "" {
+		env = append(env, "FLUX_GIT_USERNAME="+creds.username, "FLUX_GIT_PASSWORD="+creds.password)
+	}
+	return env
 }
 
+// credentialHelper gives git the username and password for HTTPS
+// from the environment, so they needn't be put in the URL, or in the
+// arguments to git, where they could be seen (e.g., in error
+// messages, or the output of ps).
+const credentialHelper = `!f() { test "$1" = get && echo "username=$FLUX_GIT_USERNAME" && echo "password=$FLUX_GIT_PASSWORD"; }; f`
+
 // check returns true if there are changes locally.
 func check(workingDir, subdir string) bool {
 	// `--quiet` means "exit with 1 if there are changes"
-	return execGitCmd(workingDir, "", "diff", "--quiet", "--", subdir) != nil
+	return execGitCmd(workingDir, nil, nil, "diff", "--quiet", "--", subdir) != nil
+}
+
+func revision(workingDir, ref string) (string, error) {
+	out := &bytes.Buffer{}
+	if err := execGitCmd(workingDir, nil, out, "rev-parse", "--verify", ref+"^{commit}"); err != nil {
+		return "", errors.Wrapf(err, "git rev-parse %s", ref)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// remoteHead gives the revision at the head of the branch in the
+// repo at the URL given, without fetching anything.
+func remoteHead(creds *credentials, repoURL, repoBranch string) (string, error) {
+	ref := "HEAD"
+	if repoBranch != "" {
+		ref = "refs/heads/" + repoBranch
+	}
+	out := &bytes.Buffer{}
+	if err := execGitCmd("", creds, out, "ls-remote", repoURL, ref); err != nil {
+		return "", errors.Wrapf(err, "git ls-remote %s", ref)
+	}
+	fields := strings.Fields(out.String())
+	if len(fields) == 0 {
+		return "", errors.Errorf("no such branch %s", repoBranch)
+	}
+	return fields[0], nil
+}
+
+// changed lists the files under subdir that differ between the
+// revisions given, separating out those that were deleted. If `from`
+// is empty, all the files at `to` are taken to have changed.
+func changedFiles(workingDir, subdir, from, to string) (changed, deleted []string, err error) {
+	if subdir == "" {
+		subdir = "."
+	}
+	out := &bytes.Buffer{}
+	if from == "" {
+		if err := execGitCmd(workingDir, nil, out, "ls-tree", "-r", "--name-only", to, "--", subdir); err != nil {
+			return nil, nil, errors.Wrap(err, "git ls-tree")
+		}
+		return splitList(out.String()), nil, nil
+	}
+	if err := execGitCmd(workingDir, nil, out, "diff", "--name-status", "--no-renames", from, to, "--", subdir); err != nil {
+		return nil, nil, errors.Wrap(err, "git diff")
+	}
+	for _, line := range splitList(out.String()) {
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		if fields[0] == "D" {
+			deleted = append(deleted, fields[1])
+		} else {
+			changed = append(changed, fields[1])
+		}
+	}
+	return changed, deleted, nil
+}
+
+func show(workingDir, rev, file string) ([]byte, error) {
+	out := &bytes.Buffer{}
+	if err := execGitCmd(workingDir, nil, out, "show", rev+":"+file); err != nil {
+		return nil, errors.Wrapf(err, "git show %s:%s", rev, file)
+	}
+	return out.Bytes(), nil
+}
+
+func splitList(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// credentials are what git needs to talk to the upstream repo: a
+// private key, for SSH; or a username and password (or access
+// token), for HTTPS. For SSH, the server's host key must be one of
+// the known hosts, unless we're trusting it on first use.
+type credentials struct {
+	keyPath         string
+	username        string
+	password        string
+	knownHostsPath  string
+	trustOnFirstUse bool
+}
+
+// writeCredentials gets the credentials ready to give to git, writing
+// the private key, if there is one, and the known hosts to files.
+// Call remove once finished with them.
+func writeCredentials(keyData, username, password, knownHosts string, trustOnFirstUse bool) (*credentials, error) {
+	creds := &credentials{
+		username:        username,
+		password:        password,
+		trustOnFirstUse: knownHosts == "" && trustOnFirstUse,
+	}
+	if keyData != "" {
+		keyPath, err := writeKey(keyData)
+		if err != nil {
+			return nil, err
+		}
+		creds.keyPath = keyPath
+	}
+	knownHostsPath, err := writeKnownHosts(knownHosts)
+	if err != nil {
+		creds.remove()
+		return nil, err
+	}
+	creds.knownHostsPath = knownHostsPath
+	return creds, nil
+}
+
+// acceptedHostKey gives the host key that was accepted, if we were
+// trusting the host on first use, and it was reached over SSH.
+func (c *credentials) acceptedHostKey() (string, error) {
+	if !c.trustOnFirstUse {
+		return "", nil
+	}
+	knownHosts, err := ioutil.ReadFile(c.knownHostsPath)
+	if err != nil {
+		return "", errors.Wrap(err, "reading accepted host key")
+	}
+	return string(knownHosts), nil
+}
+
+func (c *credentials) remove() {
+	if c.keyPath != "" {
+		os.Remove(c.keyPath)
+	}
+	if c.knownHostsPath != "" {
+		os.Remove(c.knownHostsPath)
+	}
+}
+
+// writeKnownHosts writes the known hosts to a file for ssh to use;
+// unlike the key, ssh may add to it.
+func writeKnownHosts(knownHosts string) (string, error) {
+	f, err := ioutil.TempFile("", "flux-known-hosts")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(knownHosts)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
 }
 
 func writeKey(keyData string) (string, error) {
@@ -109,12 +328,31 @@ func writeKey(keyData string) (string, error) {
 	return f.Name(), nil
 }
 
+// ssh refuses to connect to a host whose key isn't known (when
+// checking strictly), or doesn't match the one known, with
+//
+//	Host key verification failed.
+const hostKeyFailedMarker = "Host key verification failed"
+
+// git push reports a ref that couldn't be updated because upstream
+// has moved on with a line like
+//
+//	! [rejected]        master -> master (fetch first)
+const rejectedMarker = "! [rejected]"
+
+// findFatalMessage picks out the line explaining why git failed: the
+// fatal error if there is one, otherwise a rejected push.
 func findFatalMessage(output io.Reader) string {
+	var rejected string
 	sc := bufio.NewScanner(output)
 	for sc.Scan() {
-		if strings.HasPrefix(sc.Text(), "fatal:") {
-			return sc.Text()
+		line := sc.Text()
+		if strings.HasPrefix(line, "fatal:") {
+			return line
+		}
+		if rejected == "" && strings.HasPrefix(strings.TrimSpace(line), rejectedMarker) {
+			rejected = strings.TrimSpace(line)
 		}
 	}
-	return ""
+	return rejected
 }
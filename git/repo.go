@@ -4,10 +4,12 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 )
 
 var (
-	ErrNoChanges = errors.New("no changes made in repo")
+	ErrNoChanges      = errors.New("no changes made in repo")
+	ErrRebaseConflict = errors.New("changes conflict with those upstream")
 )
 
 // Repo represents a remote git repo
@@ -20,39 +22,248 @@ type Repo struct {
 	Branch string
 
 	// The private key (e.g., the contents of an id_rsa file) with
-	// permissions to clone and push to the config repo.
+	// permissions to clone and push to the config repo, if it's
+	// reached over SSH.
 	Key string
 
+	// The username and password (or access token) with permissions
+	// to clone and push to the config repo, if it's reached over
+	// HTTPS.
+	Username string
+	Password string
+
 	// The path within the config repo where files are stored.
 	Path string
+
+	// The SSH host keys trusted for the config repo's host, in
+	// known_hosts format. If empty, and PinHostKey is set, whatever
+	// key the host presents is accepted, and given to PinHostKey to
+	// keep; otherwise no key is trusted.
+	KnownHosts string
+	PinHostKey func(knownHosts string) error
+
+	// If set (see Mirrors.Repo), working copies are checked out from
+	// the owner's mirror of the repo, rather than cloned afresh.
+	mirrors *Mirrors
+	owner   string
 }
 
 func (r Repo) Clone() (path string, err error) {
 	if r.URL == "" {
 		return "", NoRepoError
 	}
+	if r.mirrored() {
+		return r.checkout()
+	}
+
+	workingDir, err := ioutil.TempDir(os.TempDir(), "flux-gitclone")
+	if err != nil {
+		return "", err
+	}
+
+	creds, err := r.credentials()
+	if err != nil {
+		return "", err
+	}
+	defer creds.remove()
+
+	repoDir, err := clone(workingDir, creds, r.URL, r.Branch, true)
+	if err != nil {
+		return "", CloningError(r.URL, err)
+	}
+	if err := r.pin(creds); err != nil {
+		os.RemoveAll(workingDir)
+		return "", err
+	}
+	return repoDir, nil
+}
+
+// CloneWithHistory clones the repo including all the commits on the
+// branch, so that revisions can be compared.
+func (r Repo) CloneWithHistory() (path string, err error) {
+	if r.URL == "" {
+		return "", NoRepoError
+	}
+	if r.mirrored() {
+		// Mirrors have all the history anyway
+		return r.checkout()
+	}
 
 	workingDir, err := ioutil.TempDir(os.TempDir(), "flux-gitclone")
 	if err != nil {
 		return "", err
 	}
 
-	repoDir, err := clone(workingDir, r.Key, r.URL, r.Branch)
+	creds, err := r.credentials()
+	if err != nil {
+		return "", err
+	}
+	defer creds.remove()
+
+	repoDir, err := clone(workingDir, creds, r.URL, r.Branch, false)
 	if err != nil {
 		return "", CloningError(r.URL, err)
 	}
+	if err := r.pin(creds); err != nil {
+		os.RemoveAll(workingDir)
+		return "", err
+	}
 	return repoDir, nil
 }
 
+// Clean removes a working copy made by Clone or CloneWithHistory.
+func (r Repo) Clean(path string) error {
+	if r.mirrored() {
+		return r.mirrors.remove(path)
+	}
+	return os.RemoveAll(filepath.Dir(path))
+}
+
+// mirrored says whether working copies come from a mirror. A mirror
+// needs to know which branch to fetch, so without one we clone as
+// usual, and get whatever the default branch is.
+func (r Repo) mirrored() bool {
+	return r.mirrors != nil && r.Branch != ""
+}
+
+func (r Repo) credentials() (*credentials, error) {
+	return writeCredentials(r.Key, r.Username, r.Password, r.KnownHosts, r.PinHostKey != nil)
+}
+
+// pin gives the host key accepted on first use, if there was one, to
+// PinHostKey.
+func (r Repo) pin(creds *credentials) error {
+	knownHosts, err := creds.acceptedHostKey()
+	if err != nil || knownHosts == "" {
+		return err
+	}
+	return r.PinHostKey(knownHosts)
+}
+
+func (r Repo) checkout() (string, error) {
+	path, err := r.mirrors.checkout(r.owner, r)
+	if err != nil {
+		return "", CloningError(r.URL, err)
+	}
+	return path, nil
+}
+
+// BranchHead gives the commit at the head of the branch upstream,
+// without making a working copy; e.g., to find out whether there's
+// anything new before cloning.
+func (r Repo) BranchHead() (string, error) {
+	if r.URL == "" {
+		return "", NoRepoError
+	}
+	if r.mirrored() {
+		rev, err := r.mirrors.head(r.owner, r)
+		if err != nil {
+			return "", CloningError(r.URL, err)
+		}
+		return rev, nil
+	}
+
+	creds, err := r.credentials()
+	if err != nil {
+		return "", err
+	}
+	defer creds.remove()
+
+	rev, err := remoteHead(creds, r.URL, r.Branch)
+	if err != nil {
+		return "", CloningError(r.URL, err)
+	}
+	if err := r.pin(creds); err != nil {
+		return "", err
+	}
+	return rev, nil
+}
+
+// HeadRevision returns the commit at the HEAD of the clone at path.
+func HeadRevision(path string) (string, error) {
+	return revision(path, "HEAD")
+}
+
+// HasRevision says whether the revision given is present in the
+// clone at path; it may not be if, for example, history has been
+// rewritten.
+func HasRevision(path, rev string) bool {
+	_, err := revision(path, rev)
+	return err == nil
+}
+
+// ChangedFiles returns the files under subdir (relative to the top
+// of the repo) that have been changed, and those that have been
+// deleted, between the revisions `from` and `to`. If `from` is
+// empty, all files at revision `to` are returned as changed.
+func ChangedFiles(path, subdir, from, to string) (changed, deleted []string, err error) {
+	return changedFiles(path, subdir, from, to)
+}
+
+// FileAtRevision returns the contents of the file (relative to the top
+// of the repo) as it was at the revision given.
+func FileAtRevision(path, rev, file string) ([]byte, error) {
+	return show(path, rev, file)
+}
+
 func (r Repo) CommitAndPush(path, commitMessage string) error {
+	if err := r.Commit(path, commitMessage); err != nil {
+		return err
+	}
+	return r.Push(path)
+}
+
+// Commit commits the changes made under the config path in the
+// working copy, returning ErrNoChanges if there aren't any.
+func (r Repo) Commit(path, commitMessage string) error {
 	if !check(path, r.Path) {
 		return ErrNoChanges
 	}
-	if err := commit(path, commitMessage); err != nil {
+	return commit(path, commitMessage)
+}
+
+// Push pushes the commits in the working copy to the branch. If the
+// branch has moved on since, it returns ErrPushRejected; see Rebase.
+func (r Repo) Push(path string) error {
+	return r.PushBranch(path, r.Branch)
+}
+
+// PushBranch pushes the commits in the working copy to the branch
+// given, e.g., a new branch from which to open a pull request.
+func (r Repo) PushBranch(path, branch string) error {
+	creds, err := r.credentials()
+	if err != nil {
 		return err
 	}
-	if err := push(r.Key, r.Branch, path); err != nil {
+	defer creds.remove()
+
+	err = push(creds, branch, path)
+	if err != nil && err != ErrPushRejected {
 		return PushError(r.URL, err)
 	}
-	return nil
+	if pinErr := r.pin(creds); pinErr != nil {
+		return pinErr
+	}
+	return err
+}
+
+// Rebase brings the working copy up to date with the branch, with
+// the commits made in it on top, so they can be pushed again. If the
+// commits don't apply cleanly, it returns ErrRebaseConflict, leaving
+// the working copy as the branch is upstream.
+func (r Repo) Rebase(path string) error {
+	creds, err := r.credentials()
+	if err != nil {
+		return err
+	}
+	defer creds.remove()
+
+	err = rebase(creds, r.URL, r.Branch, path)
+	if err != nil && err != ErrRebaseConflict {
+		return PushError(r.URL, err)
+	}
+	if pinErr := r.pin(creds); pinErr != nil {
+		return pinErr
+	}
+	return err
 }
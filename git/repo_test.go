@@ -0,0 +1,368 @@
+package git
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/weaveworks/flux"
+)
+
+func gitIn(t *testing.T, dir string, args ...string) {
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	if out, err := c.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %s\n%s", args, err, out)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-test-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(file, content string) {
+		path := filepath.Join(dir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gitIn(t, dir, "init")
+	write("deploy/a.yaml", "a")
+	write("deploy/b.yaml", "b")
+	write("other/c.yaml", "c")
+	gitIn(t, dir, "add", ".")
+	gitIn(t, dir, "commit", "-m", "first")
+	first, err := HeadRevision(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, deleted, err := ChangedFiles(dir, "deploy", "", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changed, []string{"deploy/a.yaml", "deploy/b.yaml"}) || len(deleted) > 0 {
+		t.Errorf("expected all files in deploy/ to be changed, got %v, %v", changed, deleted)
+	}
+
+	write("deploy/a.yaml", "a2")
+	write("other/c.yaml", "c2")
+	gitIn(t, dir, "rm", "-q", "deploy/b.yaml")
+	gitIn(t, dir, "commit", "-a", "-m", "second")
+	second, err := HeadRevision(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changed, deleted, err = ChangedFiles(dir, "deploy", first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changed, []string{"deploy/a.yaml"}) || !reflect.DeepEqual(deleted, []string{"deploy/b.yaml"}) {
+		t.Errorf("expected a.yaml changed and b.yaml deleted, got %v, %v", changed, deleted)
+	}
+
+	old, err := FileAtRevision(dir, first, "deploy/b.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(old) != "b" {
+		t.Errorf("expected old contents of b.yaml, got %q", old)
+	}
+
+	if !HasRevision(dir, first) || HasRevision(dir, "0000000000000000000000000000000000000000") {
+		t.Error("HasRevision gave the wrong answer")
+	}
+}
+
+func TestRebase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-test-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(dir, file, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	upstream := filepath.Join(dir, "upstream")
+	other := filepath.Join(dir, "other")
+	gitIn(t, dir, "init", "-q", "--bare", upstream)
+	gitIn(t, dir, "init", "-q", other)
+	write(other, "a.yaml", "a")
+	write(other, "b.yaml", "b")
+	gitIn(t, other, "add", ".")
+	gitIn(t, other, "commit", "-q", "-m", "first")
+	gitIn(t, other, "push", "-q", upstream, "HEAD:refs/heads/master")
+
+	repo := Repo{URL: "file://" + upstream, Branch: "master"}
+	path, err := repo.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Clean(path)
+
+	// Someone else pushes a change to another file in the meantime
+	write(path, "a.yaml", "a2")
+	if err := repo.Commit(path, "change a"); err != nil {
+		t.Fatal(err)
+	}
+	write(other, "b.yaml", "b2")
+	gitIn(t, other, "commit", "-q", "-a", "-m", "change b")
+	gitIn(t, other, "push", "-q", upstream, "HEAD:refs/heads/master")
+
+	if err := repo.Push(path); err != ErrPushRejected {
+		t.Fatalf("expected ErrPushRejected, got %v", err)
+	}
+	if err := repo.Rebase(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Push(path); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{"a.yaml": "a2", "b.yaml": "b2"} {
+		content, err := FileAtRevision(path, "HEAD", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("expected %s to be %q after rebasing, got %q", file, expected, content)
+		}
+	}
+
+	// Now someone else changes the same file
+	gitIn(t, other, "pull", "-q", upstream, "master")
+	write(path, "a.yaml", "a3")
+	if err := repo.Commit(path, "change a again"); err != nil {
+		t.Fatal(err)
+	}
+	write(other, "a.yaml", "a4")
+	gitIn(t, other, "commit", "-q", "-a", "-m", "change a too")
+	gitIn(t, other, "push", "-q", upstream, "HEAD:refs/heads/master")
+	upstreamHead, err := HeadRevision(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.Push(path); err != ErrPushRejected {
+		t.Fatalf("expected ErrPushRejected, got %v", err)
+	}
+	if err := repo.Rebase(path); err != ErrRebaseConflict {
+		t.Fatalf("expected ErrRebaseConflict, got %v", err)
+	}
+	head, err := HeadRevision(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head != upstreamHead || check(path, ".") {
+		t.Errorf("expected working copy to be reset to %s after a conflict, got %s", upstreamHead, head)
+	}
+}
+
+func TestCredentialHelper(t *testing.T) {
+	creds, err := writeCredentials("", "flux", "s3cr3t", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer creds.remove()
+
+	// This is how git asks the helper for credentials, when it's
+	// asked for them by the server.
+	c := exec.Command("git", "-c", "credential.helper=", "-c", "credential.helper="+credentialHelper, "credential", "fill")
+	c.Env = env(creds)
+	c.Stdin = strings.NewReader("protocol=https\nhost=git.example.com\n\n")
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git credential fill: %s\n%s", err, out)
+	}
+	for _, line := range []string{"username=flux", "password=s3cr3t"} {
+		if !strings.Contains(string(out), line+"\n") {
+			t.Errorf("expected %q in output, got\n%s", line, out)
+		}
+	}
+}
+
+// serveGitOverSSH runs an SSH server that lets anyone run git
+// commands, using the host key given.
+func serveGitOverSSH(t *testing.T, hostKey crypto.Signer) (addr string, stop func()) {
+	signer, err := ssh.NewSignerFromSigner(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, channels, requests, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(requests)
+				for newChannel := range channels {
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go serveGitCommand(channel, requests)
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String(), func() { listener.Close() }
+}
+
+func serveGitCommand(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	for req := range requests {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil || !strings.HasPrefix(payload.Command, "git-") {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+
+		cmd := exec.Command("sh", "-c", payload.Command)
+		stdin, _ := cmd.StdinPipe()
+		cmd.Stdout, cmd.Stderr = channel, channel.Stderr()
+		go io.Copy(stdin, channel)
+		var status struct{ Status uint32 }
+		if err := cmd.Run(); err != nil {
+			status.Status = 1
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(&status))
+		return
+	}
+}
+
+func TestHostKeyPinning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-test-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	upstream := filepath.Join(dir, "upstream")
+	seed := filepath.Join(dir, "seed")
+	gitIn(t, dir, "init", "-q", "--bare", upstream)
+	gitIn(t, dir, "init", "-q", seed)
+	if err := ioutil.WriteFile(filepath.Join(seed, "a.yaml"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitIn(t, seed, "add", ".")
+	gitIn(t, seed, "commit", "-q", "-m", "first")
+	gitIn(t, seed, "push", "-q", upstream, "HEAD:refs/heads/master")
+
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	clientKey, err := x509.MarshalECPrivateKey(newKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, stop := serveGitOverSSH(t, newKey())
+	defer stop()
+	repo := Repo{
+		URL:    "ssh://git@" + addr + upstream,
+		Branch: "master",
+		Key:    string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: clientKey})),
+	}
+
+	// With no known hosts, and nowhere to pin the host key, nothing
+	// is trusted
+	if _, err := repo.Clone(); !isHostKeyError(err) {
+		t.Fatalf("expected host key error, got %v", err)
+	}
+
+	// The host key is pinned on first use ...
+	var pinned string
+	repo.PinHostKey = func(knownHosts string) error {
+		pinned = knownHosts
+		return nil
+	}
+	path, err := repo.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Clean(path)
+	host, _, _ := net.SplitHostPort(addr)
+	if !strings.Contains(pinned, host) {
+		t.Fatalf("expected host key for %s to be pinned, got %q", addr, pinned)
+	}
+
+	// ... and is then accepted ...
+	repo.KnownHosts = pinned
+	repo.PinHostKey = func(string) error {
+		t.Error("did not expect to pin host key again")
+		return nil
+	}
+	path, err = repo.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.Clean(path)
+
+	// ... whereas a different key is not
+	otherAddr, stopOther := serveGitOverSSH(t, newKey())
+	defer stopOther()
+	repo.URL = "ssh://git@" + otherAddr + upstream
+	_, port, _ := net.SplitHostPort(addr)
+	_, otherPort, _ := net.SplitHostPort(otherAddr)
+	repo.KnownHosts = strings.Replace(pinned, "]:"+port+" ", "]:"+otherPort+" ", 1)
+	if repo.KnownHosts == pinned {
+		t.Fatalf("expected to find port %s in pinned host key %q", port, pinned)
+	}
+	if _, err := repo.Clone(); !isHostKeyError(err) {
+		t.Fatalf("expected host key error, got %v", err)
+	}
+}
+
+func isHostKeyError(err error) bool {
+	problem, ok := err.(flux.UserConfigProblem)
+	return ok && problem.Err == errHostKeyVerification
+}
@@ -64,6 +64,18 @@ func (db *pgDB) scanEvents(query squirrel.Sqlizer) ([]flux.Event, error) {
 					return nil, err
 				}
 				h.Metadata = m
+			case flux.EventSync:
+				var m flux.SyncEventMetadata
+				if err := json.Unmarshal(metadataBytes, &m); err != nil {
+					return nil, err
+				}
+				h.Metadata = m
+			case flux.EventPromote:
+				var m flux.PromoteEventMetadata
+				if err := json.Unmarshal(metadataBytes, &m); err != nil {
+					return nil, err
+				}
+				h.Metadata = m
 			}
 		}
 		events = append(events, h)
@@ -15,6 +15,7 @@ import (
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/api"
 	transport "github.com/weaveworks/flux/http"
+	"github.com/weaveworks/flux/http/websocket"
 	"github.com/weaveworks/flux/jobs"
 )
 
@@ -61,6 +62,9 @@ func (c *client) PostRelease(_ flux.InstanceID, s jobs.ReleaseJobParams) (jobs.J
 	if s.Cause.Message != "" {
 		args = append(args, "message", s.Cause.Message)
 	}
+	if !s.At.IsZero() {
+		args = append(args, "at", s.At.Format(time.RFC3339Nano))
+	}
 
 	var resp transport.PostReleaseResponse
 	err := c.methodWithResp("POST", &resp, "PostRelease", nil, args...)
@@ -73,8 +77,138 @@ func (c *client) GetRelease(_ flux.InstanceID, id jobs.JobID) (jobs.Job, error)
 	return res, err
 }
 
-func (c *client) Automate(_ flux.InstanceID, id flux.ServiceID) error {
-	return c.post("Automate", "service", string(id))
+func (c *client) ApproveRelease(_ flux.InstanceID, id jobs.JobID, approval flux.Approval) (jobs.JobID, error) {
+	args := []string{"id", string(id), "user", approval.User}
+	if approval.Message != "" {
+		args = append(args, "message", approval.Message)
+	}
+	var resp transport.PostReleaseResponse
+	err := c.methodWithResp("POST", &resp, "ApproveRelease", nil, args...)
+	return resp.ReleaseID, err
+}
+
+func (c *client) RejectRelease(_ flux.InstanceID, id jobs.JobID, rejection flux.Approval) error {
+	args := []string{"id", string(id), "user", rejection.User}
+	if rejection.Message != "" {
+		args = append(args, "message", rejection.Message)
+	}
+	return c.post("RejectRelease", args...)
+}
+
+func (c *client) CancelRelease(_ flux.InstanceID, id jobs.JobID) error {
+	return c.post("CancelRelease", "id", string(id))
+}
+
+func (c *client) ListJobs(_ flux.InstanceID, filter jobs.JobFilter) ([]jobs.Job, error) {
+	var params []string
+	for _, p := range []struct{ name, value string }{
+		{"method", filter.Method},
+		{"state", string(filter.State)},
+		{"key", filter.Key},
+	} {
+		if p.value != "" {
+			params = append(params, p.name, p.value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		params = append(params, "since", filter.Since.Format(time.RFC3339Nano))
+	}
+	if !filter.Until.IsZero() {
+		params = append(params, "until", filter.Until.Format(time.RFC3339Nano))
+	}
+	if !filter.ScheduledAfter.IsZero() {
+		params = append(params, "scheduledAfter", filter.ScheduledAfter.Format(time.RFC3339Nano))
+	}
+	if filter.Limit > 0 {
+		params = append(params, "limit", fmt.Sprint(filter.Limit))
+	}
+	if filter.Offset > 0 {
+		params = append(params, "offset", fmt.Sprint(filter.Offset))
+	}
+	var res []jobs.Job
+	err := c.get(&res, "ListJobs", params...)
+	return res, err
+}
+
+func (c *client) FollowJob(_ flux.InstanceID, id jobs.JobID, updates chan<- jobs.Job, stop <-chan struct{}) error {
+	u, err := transport.MakeURL(c.endpoint, c.router, "FollowJob", "id", string(id))
+	if err != nil {
+		return errors.Wrap(err, "constructing URL")
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	ws, err := websocket.Dial(c.client, "fluxctl", c.token, u)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			ws.Close()
+		case <-done:
+		}
+	}()
+
+	dec := json.NewDecoder(ws)
+	var job jobs.Job
+	for {
+		var update transport.JobUpdate
+		if err := dec.Decode(&update); err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			return errors.Wrap(err, "reading job update")
+		}
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.LogFrom > len(job.Log) {
+			return errors.Errorf("job update starts from log line %d, but only %d lines have been seen", update.LogFrom, len(job.Log))
+		}
+		log := append(job.Log[:update.LogFrom:update.LogFrom], update.Job.Log...)
+		job = update.Job
+		job.Log = log
+
+		select {
+		case updates <- job:
+		case <-stop:
+			return nil
+		}
+		if job.Done {
+			return nil
+		}
+	}
+}
+
+func (c *client) Promote(_ flux.InstanceID, from, to string, cause flux.ReleaseCause) ([]jobs.JobID, error) {
+	args := []string{"to", to, "user", cause.User}
+	if from != "" {
+		args = append(args, "from", from)
+	}
+	if cause.Message != "" {
+		args = append(args, "message", cause.Message)
+	}
+	var resp transport.PromoteResponse
+	err := c.methodWithResp("POST", &resp, "Promote", nil, args...)
+	return resp.Releases, err
+}
+
+func (c *client) Automate(_ flux.InstanceID, id flux.ServiceID, filter flux.TagFilter) error {
+	args := []string{"service", string(id)}
+	if filter != flux.TagFilterNone {
+		args = append(args, "tagFilter", string(filter))
+	}
+	return c.post("Automate", args...)
 }
 
 func (c *client) Deautomate(_ flux.InstanceID, id flux.ServiceID) error {
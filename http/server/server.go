@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
@@ -26,6 +27,7 @@ import (
 	"github.com/weaveworks/flux/jobs"
 	"github.com/weaveworks/flux/platform"
 	"github.com/weaveworks/flux/platform/rpc"
+	"github.com/weaveworks/flux/registry"
 )
 
 func NewHandler(s api.FluxService, r *mux.Router, logger log.Logger) http.Handler {
@@ -35,6 +37,12 @@ func NewHandler(s api.FluxService, r *mux.Router, logger log.Logger) http.Handle
 		"ListImages":             handle.ListImages,
 		"PostRelease":            handle.PostRelease,
 		"GetRelease":             handle.GetRelease,
+		"ApproveRelease":         handle.ApproveRelease,
+		"RejectRelease":          handle.RejectRelease,
+		"CancelRelease":          handle.CancelRelease,
+		"ListJobs":               handle.ListJobs,
+		"FollowJob":              handle.FollowJob,
+		"Promote":                handle.Promote,
 		"Automate":               handle.Automate,
 		"Deautomate":             handle.Deautomate,
 		"Lock":                   handle.Lock,
@@ -46,6 +54,7 @@ func NewHandler(s api.FluxService, r *mux.Router, logger log.Logger) http.Handle
 		"PatchConfig":            handle.PatchConfig,
 		"GenerateDeployKeys":     handle.GenerateKeys,
 		"PostIntegrationsGithub": handle.PostIntegrationsGithub,
+		"RegistryWebhook":        handle.RegistryWebhook,
 		"RegisterDaemonV4":       handle.RegisterV4,
 		"RegisterDaemonV5":       handle.RegisterV5,
 		"IsConnected":            handle.IsConnected,
@@ -135,6 +144,14 @@ func (s HTTPService) PostRelease(w http.ResponseWriter, r *http.Request) {
 		excludes = append(excludes, s)
 	}
 
+	var at time.Time
+	if value := r.FormValue("at"); value != "" {
+		if at, err = time.Parse(time.RFC3339Nano, value); err != nil {
+			transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing release time %q", value))
+			return
+		}
+	}
+
 	id, err := s.service.PostRelease(inst, jobs.ReleaseJobParams{
 		ReleaseSpec: flux.ReleaseSpec{
 			ServiceSpecs: serviceSpecs,
@@ -143,17 +160,22 @@ func (s HTTPService) PostRelease(w http.ResponseWriter, r *http.Request) {
 			Excludes:     excludes,
 		},
 		Cause: flux.ReleaseCause{
-			User:    r.FormValue("user"),
+			User:    getUser(r),
 			Message: r.FormValue("message"),
 		},
+		At: at,
 	})
 	if err != nil {
 		errorResponse(w, r, err)
 		return
 	}
 
+	status := "Queued."
+	if at.After(time.Now()) {
+		status = fmt.Sprintf("Scheduled for %s.", at.UTC().Format(time.RFC3339))
+	}
 	jsonResponse(w, r, transport.PostReleaseResponse{
-		Status:    "Queued.",
+		Status:    status,
 		ReleaseID: id,
 	})
 }
@@ -170,6 +192,175 @@ func (s HTTPService) GetRelease(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, r, job)
 }
 
+func (s HTTPService) ApproveRelease(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	id := mux.Vars(r)["id"]
+	approval, err := s.getApproval(r)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	releaseID, err := s.service.ApproveRelease(inst, jobs.JobID(id), approval)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+
+	status := flux.ApprovalPending
+	if releaseID != "" {
+		status = flux.ApprovalApproved
+	}
+	jsonResponse(w, r, transport.PostReleaseResponse{
+		Status:    status,
+		ReleaseID: releaseID,
+	})
+}
+
+func (s HTTPService) RejectRelease(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	id := mux.Vars(r)["id"]
+	rejection, err := s.getApproval(r)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	if err := s.service.RejectRelease(inst, jobs.JobID(id), rejection); err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s HTTPService) CancelRelease(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	id := mux.Vars(r)["id"]
+	if err := s.service.CancelRelease(inst, jobs.JobID(id)); err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s HTTPService) ListJobs(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	filter := jobs.JobFilter{
+		Method: r.FormValue("method"),
+		Key:    r.FormValue("key"),
+	}
+	var err error
+	if state := r.FormValue("state"); state != "" {
+		if filter.State, err = jobs.ParseJobState(state); err != nil {
+			transport.WriteError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	for param, t := range map[string]*time.Time{
+		"since":          &filter.Since,
+		"until":          &filter.Until,
+		"scheduledAfter": &filter.ScheduledAfter,
+	} {
+		if value := r.FormValue(param); value != "" {
+			if *t, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing %s", param))
+				return
+			}
+		}
+	}
+	for param, n := range map[string]*int{
+		"limit":  &filter.Limit,
+		"offset": &filter.Offset,
+	} {
+		if value := r.FormValue(param); value != "" {
+			if _, err = fmt.Sscan(value, n); err != nil {
+				transport.WriteError(w, r, http.StatusBadRequest, errors.Wrapf(err, "parsing %s", param))
+				return
+			}
+		}
+	}
+
+	js, err := s.service.ListJobs(inst, filter)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	if js == nil {
+		js = []jobs.Job{}
+	}
+	jsonResponse(w, r, js)
+}
+
+// FollowJob streams updates to the job over a websocket, as it goes.
+func (s HTTPService) FollowJob(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	id := jobs.JobID(mux.Vars(r)["id"])
+
+	ws, err := websocket.Upgrade(w, r, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, err.Error())
+		return
+	}
+	defer ws.Close()
+
+	// Nothing is expected from the client, but reading is how we
+	// find out it has gone away (and how pongs are seen to).
+	stop := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, ws)
+		close(stop)
+	}()
+
+	updates := make(chan jobs.Job)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.service.FollowJob(inst, id, updates, stop)
+	}()
+
+	enc := json.NewEncoder(ws)
+	var sent int // lines of the log sent so far
+	for {
+		select {
+		case job := <-updates:
+			update := transport.JobUpdate{Job: job, LogFrom: sent}
+			if sent > len(job.Log) {
+				// Not expected, but start afresh if the log is
+				// shorter than last time
+				update.LogFrom = 0
+			}
+			update.Job.Log = job.Log[update.LogFrom:]
+			if err := enc.Encode(update); err != nil {
+				return
+			}
+			sent = len(job.Log)
+		case err := <-errc:
+			if err != nil {
+				_, baseErr := errorCode(err)
+				enc.Encode(transport.JobUpdate{Error: baseErr})
+			}
+			return
+		}
+	}
+}
+
+func (s HTTPService) Promote(w http.ResponseWriter, r *http.Request) {
+	inst := getInstanceID(r)
+	to := mux.Vars(r)["to"]
+	releases, err := s.service.Promote(inst, r.FormValue("from"), to, flux.ReleaseCause{
+		User:    getUser(r),
+		Message: r.FormValue("message"),
+	})
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+
+	jsonResponse(w, r, transport.PromoteResponse{
+		Releases: releases,
+	})
+}
+
 func (s HTTPService) Automate(w http.ResponseWriter, r *http.Request) {
 	inst := getInstanceID(r)
 	service := mux.Vars(r)["service"]
@@ -179,7 +370,13 @@ func (s HTTPService) Automate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = s.service.Automate(inst, id); err != nil {
+	filter, err := flux.ParseTagFilter(r.URL.Query().Get("tagFilter"))
+	if err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, errors.Wrap(err, "parsing tag filter"))
+		return
+	}
+
+	if err = s.service.Automate(inst, id, filter); err != nil {
 		errorResponse(w, r, err)
 		return
 	}
@@ -383,6 +580,31 @@ func (s HTTPService) PostIntegrationsGithub(w http.ResponseWriter, r *http.Reque
 	w.WriteHeader(http.StatusOK)
 }
 
+// RegistryWebhook is called by registries, which don't authenticate
+// as an instance; so the instance is in the URL, along with the
+// secret that shows the webhook was set up by its owner.
+func (s HTTPService) RegistryWebhook(w http.ResponseWriter, r *http.Request) {
+	var (
+		vars   = mux.Vars(r)
+		inst   = flux.InstanceID(vars["instance"])
+		source = vars["source"]
+		secret = vars["secret"]
+	)
+
+	push, err := registry.ParseWebhook(source, r.Body)
+	if err != nil {
+		transport.WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.service.ImagePushed(inst, secret, push); err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 func (s HTTPService) Status(w http.ResponseWriter, r *http.Request) {
 	inst := getInstanceID(r)
 	status, err := s.service.Status(inst)
@@ -499,6 +721,51 @@ func getInstanceID(req *http.Request) flux.InstanceID {
 	return flux.InstanceID(s)
 }
 
+// getUser gives the user making the request. If the request has been
+// authenticated, that's the user it was authenticated as; otherwise,
+// e.g., when running standalone, it's whoever the request says.
+func getUser(req *http.Request) string {
+	if user := req.Header.Get(flux.UserIDHeaderKey); user != "" {
+		return user
+	}
+	return req.FormValue("user")
+}
+
+var ErrApprovalNotAuthenticated = flux.UserConfigProblem{&flux.BaseError{
+	Help: `Releases in this instance must be approved before they are carried
+out, so approvals and rejections are only taken from users the service
+has authenticated. Otherwise anyone could approve a release in
+someone else's name.
+
+Approve or reject the release through the authenticating proxy in
+front of the service, rather than naming yourself with --user.
+`,
+	Err: errors.New("approvals must come from an authenticated user"),
+}}
+
+// getApproval gives the approval (or rejection) of a release made by
+// the request. When the instance requires approvals, they must come
+// from an authenticated user; the user named in the request is only
+// taken at its word when approvals are advisory.
+func (s HTTPService) getApproval(r *http.Request) (flux.Approval, error) {
+	approval := flux.Approval{
+		User:    r.Header.Get(flux.UserIDHeaderKey),
+		Message: r.FormValue("message"),
+	}
+	if approval.User != "" {
+		return approval, nil
+	}
+	config, err := s.service.GetConfig(getInstanceID(r))
+	if err != nil {
+		return flux.Approval{}, errors.Wrap(err, "getting config to check approvals")
+	}
+	if config.Release.Approvals > 0 {
+		return flux.Approval{}, ErrApprovalNotAuthenticated
+	}
+	approval.User = r.FormValue("user")
+	return approval, nil
+}
+
 func jsonResponse(w http.ResponseWriter, r *http.Request, result interface{}) {
 	body, err := json.Marshal(result)
 	if err != nil {
@@ -512,8 +779,13 @@ func jsonResponse(w http.ResponseWriter, r *http.Request, result interface{}) {
 }
 
 func errorResponse(w http.ResponseWriter, r *http.Request, apiError error) {
-	var outErr *flux.BaseError
-	var code int
+	code, outErr := errorCode(apiError)
+	transport.WriteError(w, r, code, outErr)
+}
+
+// errorCode gives the HTTP status code and the error to report, for an
+// error from the service.
+func errorCode(apiError error) (code int, outErr *flux.BaseError) {
 	err := errors.Cause(apiError)
 	switch err := err.(type) {
 	case flux.Missing:
@@ -529,8 +801,7 @@ func errorResponse(w http.ResponseWriter, r *http.Request, apiError error) {
 		code = http.StatusInternalServerError
 		outErr = flux.CoverAllError(apiError)
 	}
-
-	transport.WriteError(w, r, code, outErr)
+	return code, outErr
 }
 
 // codeWriter intercepts the HTTP status code. WriteHeader may not be called in
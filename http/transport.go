@@ -29,6 +29,12 @@ func NewRouter() *mux.Router {
 	r.NewRoute().Name("ListImages").Methods("GET").Path("/v3/images").Queries("service", "{service}")
 	r.NewRoute().Name("PostRelease").Methods("POST").Path("/v4/release").Queries("service", "{service}", "image", "{image}", "kind", "{kind}")
 	r.NewRoute().Name("GetRelease").Methods("GET").Path("/v4/release").Queries("id", "{id}")
+	r.NewRoute().Name("ApproveRelease").Methods("POST").Path("/v6/release/approve").Queries("id", "{id}")
+	r.NewRoute().Name("RejectRelease").Methods("POST").Path("/v6/release/reject").Queries("id", "{id}")
+	r.NewRoute().Name("CancelRelease").Methods("POST").Path("/v6/release/cancel").Queries("id", "{id}")
+	r.NewRoute().Name("ListJobs").Methods("GET").Path("/v6/jobs")
+	r.NewRoute().Name("FollowJob").Methods("GET").Path("/v6/jobs/follow").Queries("id", "{id}")
+	r.NewRoute().Name("Promote").Methods("POST").Path("/v6/promote").Queries("to", "{to}")
 	r.NewRoute().Name("Automate").Methods("POST").Path("/v3/automate").Queries("service", "{service}")
 	r.NewRoute().Name("Deautomate").Methods("POST").Path("/v3/deautomate").Queries("service", "{service}")
 	r.NewRoute().Name("Lock").Methods("POST").Path("/v3/lock").Queries("service", "{service}")
@@ -39,6 +45,7 @@ func NewRouter() *mux.Router {
 	r.NewRoute().Name("SetConfig").Methods("POST").Path("/v4/config")
 	r.NewRoute().Name("PatchConfig").Methods("PATCH").Path("/v4/config")
 	r.NewRoute().Name("GenerateDeployKeys").Methods("POST").Path("/v5/config/deploy-keys")
+	r.NewRoute().Name("RegistryWebhook").Methods("POST").Path("/v6/integrations/registry/{instance}/{source}").Queries("secret", "{secret}")
 	r.NewRoute().Name("PostIntegrationsGithub").Methods("POST").Path("/v5/integrations/github").Queries("owner", "{owner}", "repository", "{repository}")
 	r.NewRoute().Name("RegisterDaemonV4").Methods("GET").Path("/v4/daemon")
 	r.NewRoute().Name("RegisterDaemonV5").Methods("GET").Path("/v5/daemon")
@@ -59,6 +66,20 @@ type PostReleaseResponse struct {
 	ReleaseID jobs.JobID `json:"release_id"`
 }
 
+type PromoteResponse struct {
+	Releases []jobs.JobID `json:"releases"`
+}
+
+// JobUpdate is sent over the websocket to those following a job, each
+// time it changes. To save sending the whole log each time, the job
+// has only the lines from LogFrom onwards. If following the job fails,
+// the last update sent has just the error.
+type JobUpdate struct {
+	Job     jobs.Job        `json:"job"`
+	LogFrom int             `json:"logFrom"`
+	Error   *flux.BaseError `json:"error,omitempty"`
+}
+
 func MakeURL(endpoint string, router *mux.Router, routeName string, urlParams ...string) (*url.URL, error) {
 	if len(urlParams)%2 != 0 {
 		panic("urlParams must be even!")
@@ -18,6 +18,9 @@ type DialErr struct {
 }
 
 func (de DialErr) Error() string {
+	if de.HTTPResponse == nil {
+		return fmt.Sprintf("connecting websocket %s", de.URL)
+	}
 	return fmt.Sprintf("connecting websocket %s (http status code = %v)", de.URL, de.HTTPResponse.StatusCode)
 }
 
@@ -18,13 +18,18 @@ var (
 	ErrInvalidImageID   = errors.New("invalid image ID")
 	ErrBlankImageID     = errors.Wrap(ErrInvalidImageID, "blank image name")
 	ErrMalformedImageID = errors.Wrap(ErrInvalidImageID, `expected image name as either <image>:<tag> or just <image>`)
+	ErrMalformedDigest  = errors.Wrap(ErrInvalidImageID, `expected digest as <algorithm>:<hex>, e.g., sha256:...`)
 )
 
 // ImageID is a fully qualified name that refers to a particular Image.
-// It is in the format: host[:port]/Namespace/Image[:tag]
+// It is in the format: host[:port]/Namespace/Image[:tag][@digest]
 // Here, we refer to the "name" == Namespace/Image
+//
+// The digest, if present, pins the image to a particular manifest;
+// the tag is then just for the benefit of humans (and tag filters).
 type ImageID struct {
 	Host, Namespace, Image, Tag string
+	Digest                      string
 }
 
 func ParseImageID(s string) (ImageID, error) {
@@ -32,12 +37,22 @@ func ParseImageID(s string) (ImageID, error) {
 		return ImageID{}, ErrBlankImageID
 	}
 	var img ImageID
+	if at := strings.Index(s, "@"); at > -1 {
+		img.Digest = s[at+1:]
+		if !isDigest(img.Digest) {
+			return ImageID{}, ErrMalformedDigest
+		}
+		s = s[:at]
+	}
 	parts := strings.Split(s, ":")
 	switch len(parts) {
 	case 0:
 		return ImageID{}, ErrMalformedImageID
 	case 1:
-		img.Tag = "latest"
+		// An image pinned by digest alone has no tag.
+		if img.Digest == "" {
+			img.Tag = "latest"
+		}
 	case 2:
 		img.Tag = parts[1]
 		s = parts[0]
@@ -67,6 +82,21 @@ func ParseImageID(s string) (ImageID, error) {
 	return img, nil
 }
 
+// isDigest says whether the string given looks like a content digest,
+// i.e., <algorithm>:<hex>.
+func isDigest(s string) bool {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return false
+	}
+	for _, c := range parts[1] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
 // Fully qualified name
 func (i ImageID) String() string {
 	if i.Image == "" {
@@ -76,6 +106,9 @@ func (i ImageID) String() string {
 	if i.Tag != "" {
 		ta = fmt.Sprintf(":%s", i.Tag)
 	}
+	if i.Digest != "" {
+		ta += "@" + i.Digest
+	}
 	return fmt.Sprintf("%s%s", i.Repository(), ta)
 }
 
@@ -112,7 +145,36 @@ func (i ImageID) NamespaceImage() string {
 }
 
 func (i ImageID) FullID() string {
-	return fmt.Sprintf("%s/%s/%s:%s", i.Host, i.Namespace, i.Image, i.Tag)
+	id := i.HostNamespaceImage()
+	if i.Tag != "" {
+		id += ":" + i.Tag
+	}
+	if i.Digest != "" {
+		id += "@" + i.Digest
+	}
+	return id
+}
+
+// Pinned says whether the image ID refers to a particular manifest,
+// rather than whatever its tag currently points at.
+func (i ImageID) Pinned() bool {
+	return i.Digest != ""
+}
+
+// WithoutDigest gives the image ID referring to the image by its tag
+// alone.
+func (i ImageID) WithoutDigest() ImageID {
+	i.Digest = ""
+	return i
+}
+
+// Reference gives what to ask a registry for to get the image: its
+// digest if it is pinned, otherwise its tag.
+func (i ImageID) Reference() string {
+	if i.Digest != "" {
+		return i.Digest
+	}
+	return i.Tag
 }
 
 func (i ImageID) Components() (host, repo, tag string) {
@@ -120,10 +182,17 @@ func (i ImageID) Components() (host, repo, tag string) {
 }
 
 // Image can't really be a primitive string only, because we need to also
-// record information about its creation time. (maybe more in the future)
+// record information about its creation time, and whatever else we
+// can find out from the registry.
 type Image struct {
 	ImageID
-	CreatedAt *time.Time `json:",omitempty"`
+	CreatedAt    *time.Time        `json:",omitempty"`
+	Labels       map[string]string `json:",omitempty"`
+	OS           string            `json:",omitempty"`
+	Architecture string            `json:",omitempty"`
+	// For a multi-arch image, the platforms it's available for, as
+	// "os/architecture"
+	Platforms []string `json:",omitempty"`
 }
 
 func ParseImage(s string, createdAt *time.Time) (Image, error) {
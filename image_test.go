@@ -17,6 +17,8 @@ func TestImageID_ParseImageID(t *testing.T) {
 		{"quay.io/library/alpine", "quay.io/library/alpine:latest"},
 		{"quay.io/library/alpine:latest", "quay.io/library/alpine:latest"},
 		{"quay.io/library/alpine:mytag", "quay.io/library/alpine:mytag"},
+		{"alpine:mytag@sha256:abababababababababababababababababababababababababababababababab", "alpine:mytag@sha256:abababababababababababababababababababababababababababababababab"},
+		{"quay.io/library/alpine@sha256:abababababababababababababababababababababababababababababababab", "quay.io/library/alpine@sha256:abababababababababababababababababababababababababababababababab"},
 	} {
 		i, err := ParseImageID(x.test)
 		if err != nil {
@@ -37,6 +39,10 @@ func TestImageID_ParseImageIDErrorCases(t *testing.T) {
 		{"alpine::"},
 		{"alpine:invalid:"},
 		{"/too/many/slashes/"},
+		{"alpine@"},
+		{"alpine:mytag@sha256"},
+		{"alpine:mytag@sha256:NOTHEX"},
+		{"@sha256:abababababababababababababababababababababababababababababababab"},
 	} {
 		_, err := ParseImageID(x.test)
 		if err == nil {
@@ -79,6 +85,8 @@ func TestImageID_Serialization(t *testing.T) {
 	}{
 		{ImageID{Host: dockerHubHost, Namespace: dockerHubLibrary, Image: "alpine", Tag: "a123"}, `"alpine:a123"`},
 		{ImageID{Host: "quay.io", Namespace: "weaveworks", Image: "foobar", Tag: "baz"}, `"quay.io/weaveworks/foobar:baz"`},
+		{ImageID{Host: "quay.io", Namespace: "weaveworks", Image: "foobar", Tag: "baz", Digest: "sha256:abababababababababababababababababababababababababababababababab"}, `"quay.io/weaveworks/foobar:baz@sha256:abababababababababababababababababababababababababababababababab"`},
+		{ImageID{Host: dockerHubHost, Namespace: dockerHubLibrary, Image: "alpine", Digest: "sha256:abababababababababababababababababababababababababababababababab"}, `"alpine@sha256:abababababababababababababababababababababababababababababababab"`},
 	} {
 		serialized, err := json.Marshal(x.test)
 		if err != nil {
@@ -97,3 +105,28 @@ func TestImageID_Serialization(t *testing.T) {
 		}
 	}
 }
+
+func TestImageID_Digest(t *testing.T) {
+	digest := "sha256:abababababababababababababababababababababababababababababababab"
+	pinned, err := ParseImageID("quay.io/weaveworks/foobar:stable@" + digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pinned.Pinned() || pinned.Digest != digest || pinned.Tag != "stable" {
+		t.Fatalf("expected image pinned to %s with tag stable, got %#v", digest, pinned)
+	}
+	if pinned.Reference() != digest {
+		t.Errorf("expected reference %s, got %s", digest, pinned.Reference())
+	}
+	if pinned.FullID() != "quay.io/weaveworks/foobar:stable@"+digest {
+		t.Errorf("unexpected full ID %s", pinned.FullID())
+	}
+
+	unpinned := pinned.WithoutDigest()
+	if unpinned.Pinned() || unpinned.String() != "quay.io/weaveworks/foobar:stable" {
+		t.Errorf("expected unpinned image, got %s", unpinned)
+	}
+	if unpinned.Reference() != "stable" {
+		t.Errorf("expected reference stable, got %s", unpinned.Reference())
+	}
+}
@@ -5,8 +5,9 @@ import (
 )
 
 type ServiceConfig struct {
-	Automated bool `json:"automation"`
-	Locked    bool `json:"locked"`
+	Automated bool           `json:"automation"`
+	Locked    bool           `json:"locked"`
+	TagFilter flux.TagFilter `json:"tagFilter,omitempty"`
 }
 
 func (c ServiceConfig) Policy() flux.Policy {
@@ -22,6 +23,13 @@ func (c ServiceConfig) Policy() flux.Policy {
 type Config struct {
 	Services map[flux.ServiceID]ServiceConfig `json:"services"`
 	Settings flux.UnsafeInstanceConfig        `json:"settings"`
+	// The commit of the config repo last synced to the platform
+	SyncedRevision string `json:"syncedRevision,omitempty"`
+	// How big a share of the job workers the instance gets, relative
+	// to other instances; zero means the default. This is set by
+	// whoever runs the service, rather than through the instance's
+	// settings, so that instances can't give themselves more.
+	JobWeight float64 `json:"jobWeight,omitempty"`
 }
 
 type NamedConfig struct {
@@ -54,19 +54,38 @@ func New(
 type ImageMap map[string][]flux.ImageDescription
 
 // LatestImage returns the latest releasable image for a repository.
-// A releasable image is one that is not tagged "latest". (Assumes the
-// available images are in descending order of latestness.) If no such
-// image exists, returns nil, and the caller can decide whether that's
-// an error or not.
-func (m ImageMap) LatestImage(repo string) *flux.ImageDescription {
+// A releasable image is one that is not tagged "latest", and that
+// passes the tag filter given. (Assumes the available images are in
+// descending order of latestness, unless the filter says otherwise,
+// as a semver filter does.) If no such image exists, returns nil, and
+// the caller can decide whether that's an error or not.
+func (m ImageMap) LatestImage(repo string, filter flux.TagFilter) *flux.ImageDescription {
+	var latest *flux.ImageDescription
+	var latestTag string
 	for _, image := range m[repo] {
 		_, _, tag := image.ID.Components()
-		if strings.EqualFold(tag, "latest") {
+		if strings.EqualFold(tag, "latest") || !filter.Matches(tag) {
 			continue
 		}
-		return &image
+		if latest == nil || filter.Newer(tag, latestTag) {
+			image := image
+			latest, latestTag = &image, tag
+		}
+	}
+	return latest
+}
+
+// ReleaseTarget gives the image to release in place of the current
+// one, given the image to update to. If the current image is pinned
+// by digest (or pin is true, e.g., because a digest was asked for),
+// the target is pinned to the digest of the image to update to, so
+// that re-pushing a tag counts as a new image; otherwise, the target
+// refers to the image by its tag alone.
+func ReleaseTarget(current, latest flux.ImageID, pin bool) flux.ImageID {
+	if current.Pinned() || pin {
+		return latest
 	}
-	return nil
+	return latest.WithoutDigest()
 }
 
 func (h *Instance) ConfigRepo() git.Repo {
@@ -161,32 +180,38 @@ func (h *Instance) ExactImages(images []flux.ImageID) (ImageMap, error) {
 	m := ImageMap{}
 	for _, id := range images {
 		// We must check that the exact images requested actually exist. Otherwise we risk pushing invalid images to git.
-		exist, err := h.imageExists(id)
+		img, exist, err := h.imageExists(id)
 		if err != nil {
 			return m, errors.Wrap(flux.ErrInvalidImageID, err.Error())
 		}
 		if !exist {
 			return m, errors.Wrap(flux.ErrInvalidImageID, fmt.Sprintf("image %q does not exist", id))
 		}
-		m[id.Repository()] = []flux.ImageDescription{flux.ImageDescription{ID: id}}
+		// If asked for a tag, note the digest it points at, so the
+		// release can pin it if needed.
+		if id.Digest == "" {
+			id.Digest = img.Digest
+		}
+		m[id.Repository()] = []flux.ImageDescription{flux.ImageDescription{ID: id, CreatedAt: img.CreatedAt}}
 	}
 	return m, nil
 }
 
-// Checks whether the given image exists in the repository.
-// Return true if exist, false otherwise
-func (h *Instance) imageExists(imageID flux.ImageID) (bool, error) {
+// Checks whether the given image exists in the repository, by its
+// digest if it has one, otherwise by its tag.
+// Return the image and true if exist, false otherwise
+func (h *Instance) imageExists(imageID flux.ImageID) (flux.Image, bool, error) {
 	// Use this method to parse the image, because it is safe. I.e. it will error and inform the user if it is malformed.
 	img, err := flux.ParseImage(imageID.String(), nil)
 	if err != nil {
-		return false, err
+		return flux.Image{}, false, err
 	}
 	// Get a specific image.
-	_, err = h.Registry.GetImage(registry.RepositoryFromImage(img), img.Tag)
+	found, err := h.Registry.GetImage(registry.RepositoryFromImage(img), img.Reference())
 	if err != nil {
-		return false, nil
+		return flux.Image{}, false, nil
 	}
-	return true, nil
+	return found, true, nil
 }
 
 func (h *Instance) PlatformApply(defs []platform.ServiceDefinition) (err error) {
@@ -200,6 +225,17 @@ func (h *Instance) PlatformApply(defs []platform.ServiceDefinition) (err error)
 	return h.Platform.Apply(defs)
 }
 
+func (h *Instance) PlatformSync(def platform.SyncDef) (err error) {
+	defer func(begin time.Time) {
+		releaseHelperDuration.With(
+			fluxmetrics.LabelMethod, "PlatformSync",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return h.Platform.Sync(def)
+}
+
 func (h *Instance) Ping() error {
 	return h.Platform.Ping()
 }
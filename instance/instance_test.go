@@ -9,8 +9,10 @@ import (
 var (
 	exampleImage   = "index.docker.io/owner/repo:tag"
 	parsedImage, _ = flux.ParseImage(exampleImage, nil)
+	pinnedImage, _ = flux.ParseImage("owner/pinned:stable@sha256:cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd", nil)
 	testRegistry   = registry.NewMockRegistry([]flux.Image{
 		parsedImage,
+		pinnedImage,
 	}, nil)
 )
 
@@ -24,11 +26,14 @@ func TestInstance_ImageExists(t *testing.T) {
 	testImageExists(t, i, "owner/repo:tag", true)
 	testImageExists(t, i, "repo:tag", false) // False because the namespaces is owner, not library
 	testImageExists(t, i, "owner:tag", false)
+	testImageExists(t, i, "owner/pinned:stable", true)
+	testImageExists(t, i, "owner/pinned@sha256:cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd", true)
+	testImageExists(t, i, "owner/pinned:stable@sha256:efefefefefefefefefefefefefefefefefefefefefefefefefefefefefefefef", false)
 }
 
 func testImageExists(t *testing.T, i Instance, image string, expected bool) {
 	id, _ := flux.ParseImageID(image)
-	b, err := i.imageExists(id)
+	_, b, err := i.imageExists(id)
 	if err != nil {
 		t.Fatalf("%v: error when requesting image %q", err.Error(), image)
 	}
@@ -42,8 +47,94 @@ func TestInstance_ErrWhenBlank(t *testing.T) {
 		Registry: testRegistry,
 	}
 	id, _ := flux.ParseImageID("")
-	_, err := i.imageExists(id)
+	_, _, err := i.imageExists(id)
 	if err == nil {
 		t.Fatal("Was expecting error")
 	}
 }
+
+func TestImageMap_LatestImage(t *testing.T) {
+	var images []flux.ImageDescription
+	for _, tag := range []string{"latest", "debug-abc123", "2.0.0-rc1", "1.4.10", "1.5.0", "1.4.2"} {
+		id, _ := flux.ParseImageID("owner/repo:" + tag)
+		images = append(images, flux.ImageDescription{ID: id})
+	}
+	m := ImageMap{"owner/repo": images}
+
+	for _, x := range []struct {
+		filter   flux.TagFilter
+		expected string
+	}{
+		{flux.TagFilterNone, "debug-abc123"},
+		{"semver:~1.4", "1.4.10"},
+		{"semver:^1.4", "1.5.0"},
+		{"glob:1.4.*", "1.4.10"},
+		{"regexp:^2", "2.0.0-rc1"},
+		{"semver:~3", ""},
+	} {
+		latest := m.LatestImage("owner/repo", x.filter)
+		switch {
+		case latest == nil && x.expected != "":
+			t.Errorf("filter %q: expected %q, got nothing", x.filter, x.expected)
+		case latest != nil && latest.ID.Tag != x.expected:
+			t.Errorf("filter %q: expected %q, got %q", x.filter, x.expected, latest.ID.Tag)
+		}
+	}
+}
+
+func TestReleaseTarget(t *testing.T) {
+	parse := func(s string) flux.ImageID {
+		id, err := flux.ParseImageID(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	latest := parse("owner/repo:stable@sha256:efefefefefefefefefefefefefefefefefefefefefefefefefefefefefefefef")
+	for _, x := range []struct {
+		current  string
+		pin      bool
+		expected string
+	}{
+		{"owner/repo:stable", false, "owner/repo:stable"},
+		{"owner/repo:stable", true, "owner/repo:stable@sha256:efefefefefefefefefefefefefefefefefefefefefefefefefefefefefefefef"},
+		{"owner/repo:stable@sha256:cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd", false, "owner/repo:stable@sha256:efefefefefefefefefefefefefefefefefefefefefefefefefefefefefefefef"},
+		{"owner/repo@sha256:cdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcdcd", false, "owner/repo:stable@sha256:efefefefefefefefefefefefefefefefefefefefefefefefefefefefefefefef"},
+	} {
+		if target := ReleaseTarget(parse(x.current), latest, x.pin); target.String() != x.expected {
+			t.Errorf("current %s, pin %v: expected %s, got %s", x.current, x.pin, x.expected, target)
+		}
+	}
+}
+
+func TestPinHostKey(t *testing.T) {
+	const (
+		url        = "git@github.com:org/config"
+		knownHosts = "github.com ssh-rsa AAAA\n"
+	)
+	config := MakeConfig()
+	config.Settings.Git.URL = url
+
+	pinned, err := pinHostKey(url, knownHosts)(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned.Settings.Git.KnownHosts != knownHosts {
+		t.Errorf("expected host key to be pinned, got %q", pinned.Settings.Git.KnownHosts)
+	}
+	if _, err := pinHostKey(url, knownHosts)(pinned); err != nil {
+		t.Errorf("expected pinning the same host key again to succeed, got %v", err)
+	}
+	if _, err := pinHostKey(url, "github.com ssh-rsa BBBB\n")(pinned); err == nil {
+		t.Error("expected pinning a different host key to fail")
+	}
+
+	// If the repo has changed since, nothing is pinned
+	unpinned, err := pinHostKey("git@example.com:org/config", knownHosts)(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unpinned.Settings.Git.KnownHosts != "" {
+		t.Errorf("expected no host key to be pinned for another repo, got %q", unpinned.Settings.Git.KnownHosts)
+	}
+}
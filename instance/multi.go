@@ -18,8 +18,20 @@ type MultitenantInstancer struct {
 	Connecter           platform.Connecter
 	Logger              log.Logger
 	History             history.DB
-	MemcacheClient      registry.MemcacheClient
+	RegistryCache       registry.CacheBackend // may be nil, if registry caching is off
 	RegistryCacheExpiry time.Duration
+	// Limits on requests to each registry host, shared by all
+	// instances; may be nil
+	RegistryLimits *registry.RateLimits
+	// The index of images kept by scanning registries, and how long
+	// since a repository was scanned we'll still use it; may be nil,
+	// in which case images are always fetched from the registries
+	Index       registry.Index
+	IndexMaxAge time.Duration
+	// Where to keep mirrors of the instances' config repos, to check
+	// them out from; may be nil, in which case they're cloned afresh
+	// each time
+	GitMirrors *git.Mirrors
 }
 
 func (m *MultitenantInstancer) Get(instanceID flux.InstanceID) (*Instance, error) {
@@ -44,12 +56,21 @@ func (m *MultitenantInstancer) Get(instanceID flux.InstanceID) (*Instance, error
 	}
 	registryLogger := log.NewContext(instanceLogger).With("component", "registry")
 	reg := registry.NewRegistry(
-		registry.NewRemoteClientFactory(creds, registryLogger, m.MemcacheClient, m.RegistryCacheExpiry),
+		registry.NewRemoteClientFactory(creds, registryLogger, m.RegistryCache, m.RegistryCacheExpiry, m.RegistryLimits),
 		registryLogger,
 	)
 	reg = registry.NewInstrumentedRegistry(reg)
+	if m.Index != nil {
+		reg = registry.NewIndexedRegistry(instanceID, m.Index, m.IndexMaxAge, reg)
+	}
 
 	repo := gitRepoFromSettings(c.Settings)
+	repo.PinHostKey = func(knownHosts string) error {
+		return m.DB.UpdateConfig(instanceID, pinHostKey(repo.URL, knownHosts))
+	}
+	if m.GitMirrors != nil {
+		repo = m.GitMirrors.Repo(string(instanceID), repo)
+	}
 
 	// Events for this instance
 	eventRW := EventReadWriter{instanceID, m.History}
@@ -74,9 +95,32 @@ func gitRepoFromSettings(settings flux.UnsafeInstanceConfig) git.Repo {
 		branch = "master"
 	}
 	return git.Repo{
-		URL:    settings.Git.URL,
-		Branch: branch,
-		Key:    settings.Git.Key,
-		Path:   settings.Git.Path,
+		URL:        settings.Git.URL,
+		Branch:     branch,
+		Key:        settings.Git.Key,
+		Username:   settings.Git.Username,
+		Password:   settings.Git.Password,
+		Path:       settings.Git.Path,
+		KnownHosts: settings.Git.KnownHosts,
+	}
+}
+
+// pinHostKey keeps the host key accepted the first time the repo was
+// used, so that only it is accepted from then on. If another key has
+// been pinned in the meantime (e.g., by another job using the repo at
+// the same time), the keys must agree.
+func pinHostKey(url, knownHosts string) UpdateFunc {
+	return func(config Config) (Config, error) {
+		gitConfig := &config.Settings.Git
+		if gitConfig.URL != url {
+			// The repo has been changed since; its key will be
+			// pinned the next time it's used
+			return config, nil
+		}
+		if gitConfig.KnownHosts != "" && gitConfig.KnownHosts != knownHosts {
+			return config, git.HostKeyError(url)
+		}
+		gitConfig.KnownHosts = knownHosts
+		return config, nil
 	}
 }
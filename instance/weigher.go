@@ -0,0 +1,52 @@
+package instance
+
+import (
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// JobWeigher weighs instances by their config, for sharing out jobs
+// between them. Since weights seldom change, and are wanted whenever
+// a job is taken from the queue, they are remembered for a while.
+type JobWeigher struct {
+	db     DB
+	expiry time.Duration
+
+	mu      sync.Mutex
+	weights map[flux.InstanceID]weight
+}
+
+type weight struct {
+	value     float64
+	fetchedAt time.Time
+}
+
+func NewJobWeigher(db DB, expiry time.Duration) *JobWeigher {
+	return &JobWeigher{
+		db:      db,
+		expiry:  expiry,
+		weights: map[flux.InstanceID]weight{},
+	}
+}
+
+// Weight gives the instance's job weight, or zero if it hasn't been
+// given one.
+func (w *JobWeigher) Weight(inst flux.InstanceID) (float64, error) {
+	w.mu.Lock()
+	cached, ok := w.weights[inst]
+	w.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < w.expiry {
+		return cached.value, nil
+	}
+
+	config, err := w.db.GetConfig(inst)
+	if err != nil {
+		return 0, err
+	}
+	w.mu.Lock()
+	w.weights[inst] = weight{value: config.JobWeight, fetchedAt: time.Now()}
+	w.mu.Unlock()
+	return config.JobWeight, nil
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/weaveworks/flux/http/httperror"
 	"golang.org/x/oauth2"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 var (
@@ -21,6 +23,13 @@ var (
 	}
 )
 
+// The states a pull request can be in, as far as flux is concerned.
+const (
+	PullRequestOpen   = "open"
+	PullRequestMerged = "merged"
+	PullRequestClosed = "closed"
+)
+
 type github struct {
 	client *gh.Client
 }
@@ -69,6 +78,98 @@ func (g *github) InsertDeployKey(ownerName string, repoName string, deployKey st
 	return nil
 }
 
+// CreatePullRequest opens a pull request to merge the branch head
+// into the branch base, and gives its number and the URL of its page.
+func (g *github) CreatePullRequest(ownerName, repoName, head, base, title, body string) (int, string, error) {
+	pr, resp, err := g.client.PullRequests.Create(ownerName, repoName, &gh.NewPullRequest{
+		Title: &title,
+		Head:  &head,
+		Base:  &base,
+		Body:  &body,
+	})
+	if err != nil {
+		return 0, "", parseError(resp, err)
+	}
+	var htmlURL string
+	if pr.HTMLURL != nil {
+		htmlURL = *pr.HTMLURL
+	}
+	return *pr.Number, htmlURL, nil
+}
+
+// PullRequestState says whether the pull request given is still open,
+// or has been merged or closed.
+func (g *github) PullRequestState(ownerName, repoName string, number int) (string, error) {
+	pr, resp, err := g.client.PullRequests.Get(ownerName, repoName, number)
+	if err != nil {
+		return "", parseError(resp, err)
+	}
+	switch {
+	case pr.Merged != nil && *pr.Merged:
+		return PullRequestMerged, nil
+	case pr.State != nil && *pr.State == "closed":
+		return PullRequestClosed, nil
+	}
+	return PullRequestOpen, nil
+}
+
+// ClosePullRequest closes the pull request given without merging it.
+func (g *github) ClosePullRequest(ownerName, repoName string, number int) error {
+	state := "closed"
+	_, resp, err := g.client.PullRequests.Edit(ownerName, repoName, number, &gh.PullRequest{
+		State: &state,
+	})
+	if err != nil {
+		return parseError(resp, err)
+	}
+	return nil
+}
+
+// DeleteBranch deletes the branch given. It's not an error if the
+// branch has already gone, e.g., because GitHub was set to delete it
+// when its pull request was merged.
+func (g *github) DeleteBranch(ownerName, repoName, branch string) error {
+	resp, err := g.client.Git.DeleteRef(ownerName, repoName, "heads/"+branch)
+	if err != nil {
+		// GitHub says a ref that doesn't exist is unprocessable
+		if resp != nil && resp.StatusCode == http.StatusUnprocessableEntity {
+			return nil
+		}
+		return parseError(resp, err)
+	}
+	return nil
+}
+
+// IsTransient says whether an error from calling GitHub may go away
+// by itself, because GitHub couldn't be reached or had trouble of its
+// own; as opposed to, e.g., the token being refused, which won't get
+// better until someone fixes it.
+func IsTransient(err error) bool {
+	apiErr, ok := err.(*httperror.APIError)
+	if !ok {
+		// We didn't get a response (see parseError)
+		return true
+	}
+	return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// RepoFromURL gives the owner and name of the GitHub repo with the git
+// URL given, e.g., "git@github.com:weaveworks/flux-example" or
+// "https://github.com/weaveworks/flux-example.git".
+func RepoFromURL(gitURL string) (ownerName string, repoName string, err error) {
+	var path string
+	if strings.HasPrefix(gitURL, "git@github.com:") {
+		path = strings.TrimPrefix(gitURL, "git@github.com:")
+	} else if u, err := url.Parse(gitURL); err == nil && u.Host == "github.com" {
+		path = strings.TrimPrefix(u.Path, "/")
+	}
+	parts := strings.Split(strings.TrimSuffix(path, ".git"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%q is not the URL of a GitHub repo", gitURL)
+	}
+	return parts[0], parts[1], nil
+}
+
 func populateError(err httperror.APIError, resp *gh.Response) *httperror.APIError {
 	err.StatusCode = resp.StatusCode
 	err.Status = resp.Status
@@ -76,6 +177,11 @@ func populateError(err httperror.APIError, resp *gh.Response) *httperror.APIErro
 }
 
 func parseError(resp *gh.Response, err error) error {
+	if resp == nil {
+		// We didn't get as far as a response, e.g., because GitHub
+		// couldn't be reached
+		return err
+	}
 	switch resp.StatusCode {
 	case http.StatusUnauthorized:
 		return populateError(errUnauthorized, resp)
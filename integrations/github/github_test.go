@@ -1,8 +1,10 @@
 package github
 
 import (
+	"encoding/json"
 	"fmt"
 	gh "github.com/google/go-github/github"
+	"github.com/weaveworks/flux/http/httperror"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -113,3 +115,160 @@ func testMethod(t *testing.T, r *http.Request, want string) {
 		t.Errorf("Request method: %v, want %v", got, want)
 	}
 }
+
+func TestCreatePullRequest(t *testing.T) {
+	setup()
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/pulls", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		var pr gh.NewPullRequest
+		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+			t.Fatal(err)
+		}
+		if *pr.Head != "flux-release" || *pr.Base != "master" || *pr.Body != "body" {
+			t.Errorf("unexpected pull request %+v", pr)
+		}
+		fmt.Fprint(w, `{"number":7,"html_url":"https://github.com/o/r/pull/7"}`)
+	})
+
+	g := github{
+		client: client,
+	}
+
+	number, url, err := g.CreatePullRequest("o", "r", "flux-release", "master", "title", "body")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != 7 || url != "https://github.com/o/r/pull/7" {
+		t.Errorf("expected pull request 7, got %d at %s", number, url)
+	}
+}
+
+func TestPullRequestState(t *testing.T) {
+	setup()
+	defer teardown()
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number":1,"state":"open","merged":false}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number":2,"state":"closed","merged":true}`)
+	})
+	mux.HandleFunc("/repos/o/r/pulls/3", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"number":3,"state":"closed","merged":false}`)
+	})
+
+	g := github{
+		client: client,
+	}
+
+	for number, expected := range map[int]string{
+		1: PullRequestOpen,
+		2: PullRequestMerged,
+		3: PullRequestClosed,
+	} {
+		state, err := g.PullRequestState("o", "r", number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state != expected {
+			t.Errorf("pull request %d: expected %s, got %s", number, expected, state)
+		}
+	}
+}
+
+func TestClosePullRequest(t *testing.T) {
+	setup()
+	defer teardown()
+	var closed bool
+	mux.HandleFunc("/repos/o/r/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "PATCH")
+		var pr gh.PullRequest
+		if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+			t.Fatal(err)
+		}
+		closed = pr.State != nil && *pr.State == "closed"
+		fmt.Fprint(w, `{"number":1,"state":"closed"}`)
+	})
+
+	g := github{
+		client: client,
+	}
+
+	if err := g.ClosePullRequest("o", "r", 1); err != nil {
+		t.Fatal(err)
+	}
+	if !closed {
+		t.Error("expected pull request to be closed")
+	}
+}
+
+func TestDeleteBranch(t *testing.T) {
+	setup()
+	defer teardown()
+	var deleted bool
+	mux.HandleFunc("/repos/o/r/git/refs/heads/flux-release", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "DELETE")
+		deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/repos/o/r/git/refs/heads/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"message":"Reference does not exist"}`)
+	})
+
+	g := github{
+		client: client,
+	}
+
+	if err := g.DeleteBranch("o", "r", "flux-release"); err != nil {
+		t.Fatal(err)
+	}
+	if !deleted {
+		t.Error("expected branch to be deleted")
+	}
+	if err := g.DeleteBranch("o", "r", "gone"); err != nil {
+		t.Errorf("expected no error for a branch that's already gone, got %v", err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for err, expected := range map[error]bool{
+		fmt.Errorf("dial tcp: connection refused"):                      true,
+		&httperror.APIError{StatusCode: http.StatusBadGateway}:          true,
+		&httperror.APIError{StatusCode: http.StatusTooManyRequests}:     true,
+		&httperror.APIError{StatusCode: http.StatusUnauthorized}:        false,
+		&httperror.APIError{StatusCode: http.StatusNotFound}:            false,
+		&httperror.APIError{StatusCode: http.StatusUnprocessableEntity}: false,
+	} {
+		if IsTransient(err) != expected {
+			t.Errorf("%v: expected transient to be %v", err, expected)
+		}
+	}
+}
+
+func TestRepoFromURL(t *testing.T) {
+	for _, gitURL := range []string{
+		"git@github.com:o/r",
+		"git@github.com:o/r.git",
+		"https://github.com/o/r.git",
+		"ssh://git@github.com/o/r",
+	} {
+		owner, repo, err := RepoFromURL(gitURL)
+		if err != nil {
+			t.Errorf("%s: %s", gitURL, err)
+			continue
+		}
+		if owner != "o" || repo != "r" {
+			t.Errorf("%s: expected o/r, got %s/%s", gitURL, owner, repo)
+		}
+	}
+	for _, gitURL := range []string{
+		"git@gitlab.com:o/r",
+		"https://github.com/o",
+		"/tmp/config.git",
+	} {
+		if _, _, err := RepoFromURL(gitURL); err == nil {
+			t.Errorf("%s: expected an error", gitURL)
+		}
+	}
+}
@@ -17,9 +17,10 @@ const StatusQueued = "Queued."
 
 // DatabaseStore is a job store backed by a sql.DB.
 type DatabaseStore struct {
-	conn   dbProxy
-	oldest time.Duration
-	now    func(dbProxy) (time.Time, error)
+	conn    dbProxy
+	oldest  time.Duration
+	now     func(dbProxy) (time.Time, error)
+	weigher Weigher
 }
 
 type dbProxy interface {
@@ -44,13 +45,41 @@ func NewDatabaseStore(driver, datasource string, oldest time.Duration) (*Databas
 	return s, s.sanityCheck()
 }
 
+// WeighInstances sets how NextJob weighs instances against each
+// other, when sharing out jobs.
+func (s *DatabaseStore) WeighInstances(w Weigher) {
+	s.weigher = w
+}
+
+// The columns scanned by scanJob, in order
+const jobColumns = `instance_id, id, queue, method, params, scheduled_at, priority, key, submitted_at, claimed_at, heartbeat_at, finished_at, result, log, status, done, success, error, retry, attempt, cancelled_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 func (s *DatabaseStore) GetJob(inst flux.InstanceID, id JobID) (Job, error) {
+	job, err := s.scanJob(s.conn.QueryRow(`
+		SELECT `+jobColumns+`
+		  FROM jobs
+		 WHERE id = $1
+		   AND instance_id = $2
+	`, string(id), string(inst)))
+	if err == sql.ErrNoRows {
+		return Job{}, ErrNoSuchJob
+	}
+	return job, err
+}
+
+func (s *DatabaseStore) scanJob(row rowScanner) (Job, error) {
 	var (
 		job Job
 		err error
 
 		// these all need special treatment, either because they can
 		// be null, or because they need decoding
+		instanceID  string
+		jobID       string
 		paramsBytes []byte
 		claimedAt   nullTime
 		heartbeatAt nullTime
@@ -60,33 +89,40 @@ func (s *DatabaseStore) GetJob(inst flux.InstanceID, id JobID) (Job, error) {
 		done        sql.NullBool
 		success     sql.NullBool
 		errorBytes  []byte
+		retryBytes  []byte
+		attempt     sql.NullInt64
+		cancelledAt nullTime
 	)
 
-	if err = s.conn.QueryRow(`
-		SELECT queue, method, params, scheduled_at, priority, key, submitted_at, claimed_at, heartbeat_at, finished_at, result, log, status, done, success, error
-		  FROM jobs
-		 WHERE id = $1
-		   AND instance_id = $2
-	`, string(id), string(inst)).Scan(
-		&job.Queue, &job.Method, &paramsBytes, &job.ScheduledAt, &job.Priority, &job.Key, &job.Submitted,
+	if err = row.Scan(
+		&instanceID, &jobID, &job.Queue, &job.Method, &paramsBytes, &job.ScheduledAt, &job.Priority, &job.Key, &job.Submitted,
 		&claimedAt, &heartbeatAt, &finishedAt, &resultBytes, &logBytes, &job.Status, &done, &success, &errorBytes,
+		&retryBytes, &attempt, &cancelledAt,
 	); err == sql.ErrNoRows {
-		return Job{}, ErrNoSuchJob
+		return Job{}, err
 	} else if err != nil {
 		return Job{}, errors.Wrap(err, "error getting job")
 	}
 
+	job.Instance = flux.InstanceID(instanceID)
+	job.ID = JobID(jobID)
 	job.Claimed = claimedAt.Time
 	job.Heartbeat = heartbeatAt.Time
 	job.Finished = finishedAt.Time
 	job.Done = done.Bool
 	job.Success = success.Bool
+	job.Attempt = int(attempt.Int64)
+	job.Cancelled = cancelledAt.Valid
 
 	if job.Params, err = s.scanParams(job.Method, paramsBytes); err != nil {
 		return Job{}, errors.Wrap(err, "unmarshaling params")
 	}
 
-	if job.Result, err = s.scanResult(job.Method, resultBytes); err != nil {
+	if job.Retry, err = s.scanRetry(retryBytes); err != nil {
+		return Job{}, errors.Wrap(err, "unmarshaling retry policy")
+	}
+
+	if job.Result, err = s.scanResult(job.Method, resultBytes); err != nil && err != ErrNoResultExpected {
 		return Job{}, errors.Wrap(err, "unmarshaling result")
 	}
 
@@ -103,6 +139,141 @@ func (s *DatabaseStore) GetJob(inst flux.InstanceID, id JobID) (Job, error) {
 	return job, nil
 }
 
+// ListJobs gives the instance's jobs matching the filter, most
+// recently submitted first. Queued jobs have their position in the
+// queue filled in.
+func (s *DatabaseStore) ListJobs(inst flux.InstanceID, filter JobFilter) ([]Job, error) {
+	var (
+		where = []string{"instance_id = $1"}
+		args  = []interface{}{string(inst)}
+	)
+	arg := func(cond string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.Method != "" {
+		arg("method = $%d", filter.Method)
+	}
+	if filter.Key != "" {
+		arg("key = $%d", filter.Key)
+	}
+	if !filter.Since.IsZero() {
+		arg("submitted_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		arg("submitted_at < $%d", filter.Until)
+	}
+	if !filter.ScheduledAfter.IsZero() {
+		arg("scheduled_at > $%d", filter.ScheduledAfter)
+	}
+	switch filter.State {
+	case "":
+	case JobQueued:
+		where = append(where, "claimed_at IS NULL", "finished_at IS NULL")
+	case JobRunning:
+		where = append(where, "claimed_at IS NOT NULL", "finished_at IS NULL")
+	case JobSucceeded:
+		where = append(where, "finished_at IS NOT NULL")
+		arg("success = $%d", true)
+		arg("(approval IS NULL OR approval = $%d)", flux.ApprovalApproved)
+	case JobPendingApproval:
+		where = append(where, "finished_at IS NOT NULL")
+		arg("approval = $%d", flux.ApprovalPending)
+	case JobRejected:
+		where = append(where, "finished_at IS NOT NULL")
+		arg("approval = $%d", flux.ApprovalRejected)
+	case JobFailed:
+		where = append(where, "finished_at IS NOT NULL")
+		arg("success = $%d", false)
+	default:
+		return nil, fmt.Errorf("unknown job state %q", filter.State)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	offset := filter.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	var result []Job
+	err := s.Transaction(func(s *DatabaseStore) error {
+		rows, err := s.conn.Query(fmt.Sprintf(`
+			SELECT `+jobColumns+`
+			  FROM jobs
+			 WHERE %s
+			 ORDER BY submitted_at DESC
+			 LIMIT %d OFFSET %d`,
+			strings.Join(where, " AND "), limit, offset), args...)
+		if err != nil {
+			return errors.Wrap(err, "listing jobs")
+		}
+		defer rows.Close()
+		for rows.Next() {
+			job, err := s.scanJob(rows)
+			if err != nil {
+				return err
+			}
+			result = append(result, job)
+		}
+		if err = rows.Err(); err != nil {
+			return errors.Wrap(err, "listing jobs")
+		}
+		return s.fillQueuePositions(inst, result)
+	})
+	return result, err
+}
+
+// fillQueuePositions works out where each queued job is in its
+// queue, going by the order in which NextJob takes jobs. Since an
+// instance only runs one job from a queue at a time, only its own
+// jobs count.
+func (s *DatabaseStore) fillQueuePositions(inst flux.InstanceID, jobs []Job) error {
+	queued := map[JobID]*Job{}
+	for i := range jobs {
+		if jobs[i].State() == JobQueued {
+			queued[jobs[i].ID] = &jobs[i]
+		}
+	}
+	if len(queued) == 0 {
+		return nil
+	}
+
+	rows, err := s.conn.Query(`
+		SELECT id, queue, priority, scheduled_at, submitted_at
+		  FROM jobs
+		 WHERE instance_id = $1
+		   AND claimed_at IS NULL
+		   AND finished_at IS NULL
+		 ORDER BY (-1 * priority), scheduled_at, submitted_at`,
+		string(inst))
+	if err != nil {
+		return errors.Wrap(err, "finding queue positions")
+	}
+	defer rows.Close()
+	positions := map[string]int{}
+	for rows.Next() {
+		var (
+			id, queue                string
+			priority                 int
+			scheduledAt, submittedAt time.Time
+		)
+		if err := rows.Scan(&id, &queue, &priority, &scheduledAt, &submittedAt); err != nil {
+			return errors.Wrap(err, "finding queue positions")
+		}
+		positions[queue]++
+		if job, ok := queued[JobID(id)]; ok {
+			job.QueuePosition = positions[queue]
+		}
+	}
+	return rows.Err()
+}
+
 // PutJobIgnoringDuplicates schedules a job to run. Key field and any
 // duplicates are ignored.
 func (s *DatabaseStore) PutJobIgnoringDuplicates(inst flux.InstanceID, job Job) (JobID, error) {
@@ -125,6 +296,17 @@ func (s *DatabaseStore) PutJobIgnoringDuplicates(inst flux.InstanceID, job Job)
 	if err != nil {
 		return JobID(""), errors.Wrap(err, "marshaling log")
 	}
+	if job.Retry == nil {
+		job.Retry = RetryPolicyFor(job.Method)
+	}
+	var retry interface{}
+	if job.Retry != nil {
+		retryBytes, err := json.Marshal(job.Retry)
+		if err != nil {
+			return JobID(""), errors.Wrap(err, "marshaling retry policy")
+		}
+		retry = string(retryBytes)
+	}
 
 	err = s.Transaction(func(s *DatabaseStore) error {
 		now, err := s.now(s.conn)
@@ -135,8 +317,8 @@ func (s *DatabaseStore) PutJobIgnoringDuplicates(inst flux.InstanceID, job Job)
 			job.ScheduledAt = now
 		}
 		_, err = s.conn.Exec(`
-			INSERT INTO jobs (instance_id, id, queue, method, params, scheduled_at, priority, key, submitted_at, log, status)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			INSERT INTO jobs (instance_id, id, queue, method, params, scheduled_at, priority, key, submitted_at, log, status, retry, attempt, approval)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
 			string(inst),
 			string(jobID),
 			job.Queue,
@@ -148,6 +330,9 @@ func (s *DatabaseStore) PutJobIgnoringDuplicates(inst flux.InstanceID, job Job)
 			now,
 			string(logBytes),
 			status,
+			retry,
+			0,
+			approvalColumn(job),
 		)
 		return err
 	})
@@ -188,130 +373,50 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 	if len(queues) == 0 {
 		queues = []string{DefaultQueue}
 	}
+	// Weights are looked up before starting the transaction, since
+	// they may come from another connection to the same database.
+	weights, err := s.waitingWeights(queues)
+	if err != nil {
+		return Job{}, err
+	}
 	var job Job
-	err := s.Transaction(func(s *DatabaseStore) error {
+	err = s.Transaction(func(s *DatabaseStore) error {
 		now, err := s.now(s.conn)
 		if err != nil {
 			return errors.Wrap(err, "getting current time")
 		}
-		var (
-			instanceID  string
-			jobID       string
-			queue       string
-			method      string
-			paramsBytes []byte
-			scheduledAt time.Time
-			priority    int
-			key         string
-			submittedAt time.Time
-			claimedAt   nullTime
-			heartbeatAt nullTime
-			finishedAt  nullTime
-			logStr      string
-			status      string
-			done        sql.NullBool
-			success     sql.NullBool
-		)
-		query, args, err := sqlx.In(`
-			SELECT instance_id, id, queue, method, params,
-						 scheduled_at, priority, key, submitted_at,
-						 claimed_at, heartbeat_at, finished_at, log, status,
-						 done, success
-			FROM jobs
-
-			-- Scope it to our selected queues
-			WHERE queue IN (?)
-
-			-- Only unclaimed/unfinished jobs are available
-			AND claimed_at IS NULL
-			AND finished_at IS NULL
-
-			-- Don't make jobs available until after they are scheduled
-			AND scheduled_at <= ?
-
-			-- Only one job at a time per instance * queue
-			AND instance_id NOT IN (
-				SELECT instance_id
-				FROM jobs
-				WHERE queue IN (?)
-				AND claimed_at IS NOT NULL
-				AND finished_at IS NULL
-				GROUP BY instance_id
-			)
-
-			-- subtraction is to work around for ql, not being able to sort
-			-- multiple columns in different ways.
-			ORDER BY (-1 * priority), scheduled_at, submitted_at
-			LIMIT 1`,
-			queues,
-			now,
-			queues,
-		)
+		candidates, err := s.nextCandidates(queues, now)
 		if err != nil {
-			return errors.Wrap(err, "dequeueing next job")
+			return err
 		}
-		query = sqlx.Rebind(sqlx.DOLLAR, query)
-		if err := s.conn.QueryRow(query, args...).Scan(
-			&instanceID,
-			&jobID,
-			&queue,
-			&method,
-			&paramsBytes,
-			&scheduledAt,
-			&priority,
-			&key,
-			&submittedAt,
-			&claimedAt,
-			&heartbeatAt,
-			&finishedAt,
-			&logStr,
-			&status,
-			&done,
-			&success,
-		); err == sql.ErrNoRows {
+		if len(candidates) == 0 {
 			return ErrNoJobAvailable
-		} else if err != nil {
-			return errors.Wrap(err, "dequeueing next job")
 		}
-
-		params, err := s.scanParams(method, paramsBytes)
+		claimed, err := s.recentlyClaimed(queues, now.Add(-FairnessWindow))
 		if err != nil {
-			return errors.Wrap(err, "unmarshaling params")
+			return err
 		}
+		id := pickFairly(candidates, claimed, weights)
 
+		job, err = s.scanJob(s.conn.QueryRow(`
+			SELECT `+jobColumns+`
+			  FROM jobs
+			 WHERE id = $1
+		`, string(id)))
+		if err != nil {
+			return errors.Wrap(err, "dequeueing next job")
+		}
 		// NB because we're getting a fresh job, we don't expect any
 		// result to be present.
-
-		var log []string
-		if err := json.NewDecoder(strings.NewReader(logStr)).Decode(&log); err != nil {
-			return errors.Wrap(err, "unmarshaling log")
-		}
-
-		job = Job{
-			Instance:    flux.InstanceID(instanceID),
-			ID:          JobID(jobID),
-			Queue:       queue,
-			Method:      method,
-			Params:      params,
-			ScheduledAt: scheduledAt,
-			Priority:    priority,
-			Key:         key,
-			Submitted:   submittedAt,
-			Claimed:     claimedAt.Time,
-			Heartbeat:   heartbeatAt.Time,
-			Finished:    finishedAt.Time,
-			Log:         log,
-			Status:      status,
-			Done:        done.Bool,
-			Success:     success.Bool,
-		}
+		job.Claimed = now
+		job.Attempt++
 
 		if res, err := s.conn.Exec(`
 			UPDATE jobs
-				 SET claimed_at = $1
-			 WHERE id = $2
-				 AND instance_id = $3
-		`, now, jobID, instanceID); err != nil {
+				 SET claimed_at = $1, attempt = $2
+			 WHERE id = $3
+				 AND instance_id = $4
+		`, now, job.Attempt, string(job.ID), string(job.Instance)); err != nil {
 			return errors.Wrap(err, "marking job as claimed")
 		} else if n, err := res.RowsAffected(); err != nil {
 			return errors.Wrap(err, "after update, checking affected rows")
@@ -323,6 +428,187 @@ func (s *DatabaseStore) NextJob(queues []string) (Job, error) {
 	return job, err
 }
 
+// A candidate is the job each instance would run next.
+type candidate struct {
+	instance flux.InstanceID
+	id       JobID
+	priority int
+}
+
+// nextCandidates finds, for each instance with a job ready to run,
+// the job it would run next. Only jobs with the highest priority
+// waiting are candidates, so that fairness between instances never
+// puts a background job ahead of an interactive one. The candidates
+// are in the order they'd be taken if fairness didn't come into it.
+func (s *DatabaseStore) nextCandidates(queues []string, now time.Time) ([]candidate, error) {
+	query, args, err := sqlx.In(`
+		SELECT instance_id, id, priority, scheduled_at, submitted_at
+		FROM jobs
+
+		-- Scope it to our selected queues
+		WHERE queue IN (?)
+
+		-- Only unclaimed/unfinished jobs are available
+		AND claimed_at IS NULL
+		AND finished_at IS NULL
+
+		-- Don't make jobs available until after they are scheduled
+		AND scheduled_at <= ?
+
+		-- Only one job at a time per instance * queue
+		AND instance_id NOT IN (
+			SELECT instance_id
+			FROM jobs
+			WHERE queue IN (?)
+			AND claimed_at IS NOT NULL
+			AND finished_at IS NULL
+			GROUP BY instance_id
+		)
+
+		-- subtraction is to work around for ql, not being able to sort
+		-- multiple columns in different ways.
+		ORDER BY (-1 * priority), scheduled_at, submitted_at`,
+		queues,
+		now,
+		queues,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding next jobs")
+	}
+	rows, err := s.conn.Query(sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding next jobs")
+	}
+	defer rows.Close()
+
+	var (
+		candidates []candidate
+		seen       = map[flux.InstanceID]bool{}
+	)
+	for rows.Next() {
+		var (
+			c                        candidate
+			instanceID, jobID        string
+			scheduledAt, submittedAt time.Time
+		)
+		if err := rows.Scan(&instanceID, &jobID, &c.priority, &scheduledAt, &submittedAt); err != nil {
+			return nil, errors.Wrap(err, "finding next jobs")
+		}
+		if len(candidates) > 0 && c.priority < candidates[0].priority {
+			break
+		}
+		c.instance, c.id = flux.InstanceID(instanceID), JobID(jobID)
+		if !seen[c.instance] {
+			seen[c.instance] = true
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, errors.Wrap(rows.Err(), "finding next jobs")
+}
+
+// recentlyClaimed counts the jobs each instance has had claimed from
+// the queues since the time given. They're counted here rather than
+// with GROUP BY, since ql gets the counts wrong.
+func (s *DatabaseStore) recentlyClaimed(queues []string, since time.Time) (map[flux.InstanceID]int, error) {
+	query, args, err := sqlx.In(`
+		SELECT instance_id
+		FROM jobs
+		WHERE queue IN (?)
+		AND claimed_at >= ?`,
+		queues,
+		since,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "counting recently claimed jobs")
+	}
+	rows, err := s.conn.Query(sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "counting recently claimed jobs")
+	}
+	defer rows.Close()
+	claimed := map[flux.InstanceID]int{}
+	for rows.Next() {
+		var instanceID string
+		if err := rows.Scan(&instanceID); err != nil {
+			return nil, errors.Wrap(err, "counting recently claimed jobs")
+		}
+		claimed[flux.InstanceID(instanceID)]++
+	}
+	return claimed, errors.Wrap(rows.Err(), "counting recently claimed jobs")
+}
+
+// waitingWeights looks up the weight of each instance with jobs
+// waiting in the queues. Without a Weigher, it gives nil, and every
+// instance is weighed the same.
+func (s *DatabaseStore) waitingWeights(queues []string) (map[flux.InstanceID]float64, error) {
+	if s.weigher == nil {
+		return nil, nil
+	}
+	query, args, err := sqlx.In(`
+		SELECT DISTINCT instance_id
+		FROM jobs
+		WHERE queue IN (?)
+		AND claimed_at IS NULL
+		AND finished_at IS NULL`,
+		queues,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding waiting instances")
+	}
+	rows, err := s.conn.Query(sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding waiting instances")
+	}
+	defer rows.Close()
+	var instances []flux.InstanceID
+	for rows.Next() {
+		var instanceID string
+		if err := rows.Scan(&instanceID); err != nil {
+			return nil, errors.Wrap(err, "finding waiting instances")
+		}
+		instances = append(instances, flux.InstanceID(instanceID))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "finding waiting instances")
+	}
+	rows.Close()
+
+	weights := map[flux.InstanceID]float64{}
+	for _, inst := range instances {
+		// An instance we can't weigh still gets its jobs run, as
+		// though it had the default weight.
+		if w, err := s.weigher.Weight(inst); err == nil && w > 0 {
+			weights[inst] = w
+		}
+	}
+	return weights, nil
+}
+
+// pickFairly chooses which of the candidates to run next. Each
+// instance's share is the number of jobs it has had claimed recently,
+// divided by its weight; the candidate of the instance that would
+// have the smallest share after this job wins, and ties go to the job
+// that has waited longest. So an instance with lots of jobs queued
+// can't keep other instances waiting, and an instance with twice the
+// weight gets about twice as many jobs run when both are busy.
+func pickFairly(candidates []candidate, claimed map[flux.InstanceID]int, weights map[flux.InstanceID]float64) JobID {
+	var (
+		best      JobID
+		bestShare float64
+	)
+	for _, c := range candidates {
+		weight, ok := weights[c.instance]
+		if !ok {
+			weight = DefaultWeight
+		}
+		share := float64(claimed[c.instance]+1) / weight
+		if best == "" || share < bestShare {
+			best, bestShare = c.id, share
+		}
+	}
+	return best
+}
+
 func (s *DatabaseStore) scanParams(method string, params []byte) (interface{}, error) {
 	switch method {
 	case ReleaseJob:
@@ -339,11 +625,41 @@ func (s *DatabaseStore) scanParams(method string, params []byte) (interface{}, e
 		}
 		err := json.Unmarshal(params, &p)
 		return p, err
+	case SyncJob:
+		var p SyncJobParams
+		if params == nil {
+			return p, nil
+		}
+		err := json.Unmarshal(params, &p)
+		return p, err
+	case PromoteJob:
+		var p PromoteJobParams
+		if params == nil {
+			return p, nil
+		}
+		err := json.Unmarshal(params, &p)
+		return p, err
+	case RegistryScanJob:
+		var p RegistryScanJobParams
+		if params == nil {
+			return p, nil
+		}
+		err := json.Unmarshal(params, &p)
+		return p, err
 	default:
 		return nil, ErrUnknownJobMethod
 	}
 }
 
+func (s *DatabaseStore) scanRetry(retry []byte) (*RetryPolicy, error) {
+	if retry == nil {
+		return nil, nil
+	}
+	var p *RetryPolicy
+	err := json.Unmarshal(retry, &p)
+	return p, err
+}
+
 func (s *DatabaseStore) scanResult(method string, result []byte) (interface{}, error) {
 	switch method {
 	case ReleaseJob:
@@ -353,7 +669,7 @@ func (s *DatabaseStore) scanResult(method string, result []byte) (interface{}, e
 		}
 		err := json.Unmarshal(result, &r)
 		return r, err
-	case AutomatedInstanceJob:
+	case AutomatedInstanceJob, SyncJob, PromoteJob, RegistryScanJob:
 		// A result is not expected for these jobs
 		return nil, ErrNoResultExpected
 	default:
@@ -361,7 +677,23 @@ func (s *DatabaseStore) scanResult(method string, result []byte) (interface{}, e
 	}
 }
 
+// approvalColumn gives the value kept in the approval column, so
+// that releases held for approval can be told apart in queries.
+func approvalColumn(job Job) interface{} {
+	if state := job.approvalState(); state != "" {
+		return state
+	}
+	return nil
+}
+
 func (s *DatabaseStore) UpdateJob(job Job) error {
+	return s.updateJob(job, nil)
+}
+
+// updateJob records the job's progress. If `paramsWas` is given, the
+// job is only updated if its params are still as given, otherwise
+// it returns ErrJobChanged.
+func (s *DatabaseStore) updateJob(job Job, paramsWas *sql.NullString) error {
 	paramsBytes, err := json.Marshal(job.Params)
 	if err != nil {
 		return errors.Wrap(err, "marshaling params")
@@ -379,18 +711,32 @@ func (s *DatabaseStore) UpdateJob(job Job) error {
 		return errors.Wrap(err, "marshaling error")
 	}
 
-	return s.Transaction(func(s *DatabaseStore) error {
-		if res, err := s.conn.Exec(`
+	query := `
 			UPDATE jobs
-				 SET params = $1, result = $2, log = $3, status = $4, error = $5
-			 WHERE id = $6
-				 AND instance_id = $7
-		`, string(paramsBytes), string(resultBytes), string(logBytes), job.Status, string(errBytes), string(job.ID), string(job.Instance)); err != nil {
+				 SET params = $1, result = $2, log = $3, status = $4, error = $5, approval = $6
+			 WHERE id = $7
+				 AND instance_id = $8`
+	args := []interface{}{string(paramsBytes), string(resultBytes), string(logBytes), job.Status, string(errBytes), approvalColumn(job), string(job.ID), string(job.Instance)}
+	var notFound error = ErrNoSuchJob
+	if paramsWas != nil {
+		if paramsWas.Valid {
+			query += `
+				 AND params = $9`
+			args = append(args, paramsWas.String)
+		} else {
+			query += `
+				 AND params IS NULL`
+		}
+		notFound = ErrJobChanged
+	}
+
+	return s.Transaction(func(s *DatabaseStore) error {
+		if res, err := s.conn.Exec(query, args...); err != nil {
 			return errors.Wrap(err, "updating job in database")
 		} else if n, err := res.RowsAffected(); err != nil {
 			return errors.Wrap(err, "after update, checking affected rows")
 		} else if n == 0 {
-			return ErrNoSuchJob
+			return notFound
 		} else if n > 1 {
 			return errors.Errorf("updating job affected %d rows; wanted 1", n)
 		}
@@ -417,8 +763,133 @@ func (s *DatabaseStore) UpdateJob(job Job) error {
 	})
 }
 
-func (s *DatabaseStore) Heartbeat(id JobID) error {
+// ChangeJob fetches the job, lets `change` alter it, and records the
+// altered job, all in one transaction. The job is only updated if its
+// params are as they were when fetched, so that if someone else
+// changed the job in between (e.g., approving a release at the same
+// time), one change doesn't overwrite the other.
+func (s *DatabaseStore) ChangeJob(inst flux.InstanceID, id JobID, change func(*Job, JobReadPusher) error) error {
 	return s.Transaction(func(s *DatabaseStore) error {
+		var paramsWas sql.NullString
+		if err := s.conn.QueryRow(`
+			SELECT params FROM jobs WHERE id = $1 AND instance_id = $2
+		`, string(id), string(inst)).Scan(&paramsWas); err == sql.ErrNoRows {
+			return ErrNoSuchJob
+		} else if err != nil {
+			return errors.Wrap(err, "fetching job params")
+		}
+		job, err := s.GetJob(inst, id)
+		if err != nil {
+			return err
+		}
+		// These aren't filled in when fetching a job, but are needed
+		// to update it
+		job.Instance, job.ID = inst, id
+		if err := change(&job, s); err != nil {
+			return err
+		}
+		return s.updateJob(job, &paramsWas)
+	})
+}
+
+// RetryJob records the job's progress, as UpdateJob does, and makes
+// it available to be claimed again once the delay given has passed,
+// with the attempts counted so far as given in the job. If the job
+// was cancelled in the meantime, it's finished instead.
+func (s *DatabaseStore) RetryJob(job Job, after time.Duration) error {
+	return s.Transaction(func(s *DatabaseStore) error {
+		var cancelledAt nullTime
+		if err := s.conn.QueryRow(`
+			SELECT cancelled_at FROM jobs WHERE id = $1 AND instance_id = $2
+		`, string(job.ID), string(job.Instance)).Scan(&cancelledAt); err == sql.ErrNoRows {
+			return ErrNoSuchJob
+		} else if err != nil {
+			return errors.Wrap(err, "checking whether job is cancelled")
+		}
+		if cancelledAt.Valid {
+			job.Status = "Cancelled."
+			job.Log = append(job.Log, job.Status)
+			job.Error = ErrJobCancelled
+			job.Done = true
+			job.Success = false
+			return s.UpdateJob(job)
+		}
+
+		if err := s.UpdateJob(job); err != nil {
+			return err
+		}
+		now, err := s.now(s.conn)
+		if err != nil {
+			return errors.Wrap(err, "getting current time")
+		}
+		if _, err := s.conn.Exec(`
+			UPDATE jobs
+				 SET claimed_at = NULL, heartbeat_at = NULL, scheduled_at = $1, attempt = $2
+			 WHERE id = $3
+				 AND instance_id = $4
+		`, now.Add(after), job.Attempt, string(job.ID), string(job.Instance)); err != nil {
+			return errors.Wrap(err, "rescheduling job in database")
+		}
+		return nil
+	})
+}
+
+// CancelJob marks the job as cancelled. If it hasn't been claimed
+// (including if it's waiting to be retried), it's finished there and
+// then; otherwise, the worker running it finds out the next time it
+// heartbeats the job.
+func (s *DatabaseStore) CancelJob(inst flux.InstanceID, id JobID) error {
+	return s.Transaction(func(s *DatabaseStore) error {
+		job, err := s.GetJob(inst, id)
+		if err != nil {
+			return err
+		}
+		if job.Done {
+			return ErrJobFinished
+		}
+		now, err := s.now(s.conn)
+		if err != nil {
+			return errors.Wrap(err, "getting current time")
+		}
+		if !job.Claimed.IsZero() {
+			if _, err := s.conn.Exec(`
+				UPDATE jobs
+					 SET cancelled_at = $1
+				 WHERE id = $2
+					 AND instance_id = $3
+			`, now, string(id), string(inst)); err != nil {
+				return errors.Wrap(err, "marking job cancelled in database")
+			}
+			return nil
+		}
+
+		job.Instance, job.ID = inst, id
+		job.Status = "Cancelled."
+		job.Log = append(job.Log, job.Status)
+		job.Error = ErrJobCancelled
+		job.Done = true
+		job.Success = false
+		if err := s.UpdateJob(job); err != nil {
+			return err
+		}
+		if _, err := s.conn.Exec(`
+			UPDATE jobs
+				 SET cancelled_at = $1
+			 WHERE id = $2
+				 AND instance_id = $3
+		`, now, string(id), string(inst)); err != nil {
+			return errors.Wrap(err, "marking job cancelled in database")
+		}
+		return nil
+	})
+}
+
+// Heartbeat records that the job is still being worked on, and
+// returns ErrJobCancelled if someone has asked for it to be
+// cancelled.
+func (s *DatabaseStore) Heartbeat(id JobID) error {
+	var cancelledAt nullTime
+	err := s.Transaction(func(s *DatabaseStore) error {
 		now, err := s.now(s.conn)
 		if err != nil {
 			return errors.Wrap(err, "getting current time")
@@ -436,8 +907,18 @@ func (s *DatabaseStore) Heartbeat(id JobID) error {
 		} else if n > 1 {
 			return errors.Errorf("heartbeating job affected %d rows; wanted 1", n)
 		}
+
+		if err := s.conn.QueryRow(`
+			SELECT cancelled_at FROM jobs WHERE id = $1
+		`, string(id)).Scan(&cancelledAt); err != nil {
+			return errors.Wrap(err, "checking whether job is cancelled")
+		}
 		return nil
 	})
+	if err == nil && cancelledAt.Valid {
+		return ErrJobCancelled
+	}
+	return err
 }
 
 func (s *DatabaseStore) GC() error {
@@ -449,9 +930,12 @@ func (s *DatabaseStore) GC() error {
 			return errors.Wrap(err, "getting current time")
 		}
 
+		// Jobs scheduled for later are kept until then, even if
+		// finished (i.e., cancelled), so a cancelled occurrence of a
+		// recurring release isn't put back.
 		if _, err := s.conn.Exec(`
 			DELETE FROM jobs
-						WHERE (finished_at IS NOT NULL AND submitted_at < $1)
+						WHERE (finished_at IS NOT NULL AND submitted_at < $1 AND scheduled_at < $1)
 						   OR (claimed_at IS NOT NULL
 							 AND claimed_at < $1
 							 AND (heartbeat_at IS NULL OR heartbeat_at < $1))
@@ -481,9 +965,10 @@ func (s *DatabaseStore) Transaction(f func(*DatabaseStore) error) error {
 		return err
 	}
 	err = f(&DatabaseStore{
-		conn:   tx,
-		oldest: s.oldest,
-		now:    s.now,
+		conn:    tx,
+		oldest:  s.oldest,
+		now:     s.now,
+		weigher: s.weigher,
 	})
 	if err != nil {
 		// Rollback error is ignored as we already have an error in progress
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"reflect"
 	"testing"
 	"time"
 
@@ -433,6 +434,84 @@ func TestDatabaseStoreFairScheduling(t *testing.T) {
 	}
 }
 
+// weights is a Weigher with fixed weights
+type weights map[flux.InstanceID]float64
+
+func (w weights) Weight(inst flux.InstanceID) (float64, error) {
+	return w[inst], nil
+}
+
+func TestDatabaseStoreWeightedFairScheduling(t *testing.T) {
+	noisy := flux.InstanceID("noisy")
+	quiet := flux.InstanceID("quiet")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	// takeAndFinish takes the next job, checks whose it is, and
+	// finishes it so the instance can run another.
+	takeAndFinish := func(expected flux.InstanceID) {
+		job, err := db.NextJob(nil)
+		bailIfErr(t, err)
+		if job.Instance != expected {
+			t.Fatalf("expected a job for %s, got one for %s", expected, job.Instance)
+		}
+		job.Done = true
+		job.Success = true
+		bailIfErr(t, db.UpdateJob(job))
+	}
+
+	// The noisy instance queues lots of jobs, then the quiet instance
+	// queues a few
+	for i := 0; i < 4; i++ {
+		_, err := db.PutJob(noisy, Job{Method: ReleaseJob, Params: ReleaseJobParams{}, Priority: PriorityBackground})
+		bailIfErr(t, err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err := db.PutJob(quiet, Job{Method: ReleaseJob, Params: ReleaseJobParams{}, Priority: PriorityBackground})
+		bailIfErr(t, err)
+	}
+
+	// The oldest job goes first, but then it's the quiet instance's
+	// turn, even though the noisy instance's jobs have waited longer;
+	// and so on, taking turns, until the quiet instance runs out
+	for _, expected := range []flux.InstanceID{noisy, quiet, noisy, quiet, noisy, noisy} {
+		takeAndFinish(expected)
+	}
+
+	// Move on, so the jobs run so far don't count
+	db.now = func(_ dbProxy) (time.Time, error) {
+		return time.Now().Add(FairnessWindow + time.Minute), nil
+	}
+
+	// With twice the weight, the noisy instance gets two turns to the
+	// quiet instance's one
+	db.WeighInstances(weights{noisy: 2})
+	for i := 0; i < 2; i++ {
+		_, err := db.PutJob(quiet, Job{Method: ReleaseJob, Params: ReleaseJobParams{}, Priority: PriorityBackground})
+		bailIfErr(t, err)
+	}
+	for i := 0; i < 4; i++ {
+		_, err := db.PutJob(noisy, Job{Method: ReleaseJob, Params: ReleaseJobParams{}, Priority: PriorityBackground})
+		bailIfErr(t, err)
+	}
+	for _, expected := range []flux.InstanceID{noisy, quiet, noisy, noisy, quiet, noisy} {
+		takeAndFinish(expected)
+	}
+
+	// Fairness doesn't trump priority
+	_, err := db.PutJob(noisy, Job{Method: ReleaseJob, Params: ReleaseJobParams{}, Priority: PriorityBackground})
+	bailIfErr(t, err)
+	_, err = db.PutJob(noisy, Job{Method: ReleaseJob, Params: ReleaseJobParams{}, Priority: PriorityInteractive})
+	bailIfErr(t, err)
+	_, err = db.PutJob(quiet, Job{Method: ReleaseJob, Params: ReleaseJobParams{}, Priority: PriorityBackground})
+	bailIfErr(t, err)
+	job, err := db.NextJob(nil)
+	bailIfErr(t, err)
+	if job.Instance != noisy || job.Priority != PriorityInteractive {
+		t.Errorf("expected the interactive job to go first, got %#v", job)
+	}
+}
+
 func TestDatabaseStoreExpiresNeverHeartbeatedJobs(t *testing.T) {
 	instance := flux.InstanceID("instance")
 	db := Setup(t)
@@ -513,3 +592,305 @@ func TestDatabaseStoreExpiresHeartbeatedButCrashedJobs(t *testing.T) {
 		t.Errorf("expected ErrNoSuchJob, got %q", err)
 	}
 }
+
+func TestDatabaseStoreCancelJob(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	// A job that hasn't been claimed is finished straight away
+	queuedID, err := db.PutJob(instance, Job{
+		Method: ReleaseJob,
+		Params: ReleaseJobParams{},
+	})
+	bailIfErr(t, err)
+	bailIfErr(t, db.CancelJob(instance, queuedID))
+	queued, err := db.GetJob(instance, queuedID)
+	bailIfErr(t, err)
+	if !queued.Done || queued.Success || !queued.Cancelled {
+		t.Errorf("expected job to be done, unsuccessful and cancelled, got %+v", queued)
+	}
+	if queued.Error == nil || queued.Error.Err.Error() != ErrJobCancelled.Err.Error() {
+		t.Errorf("expected cancelled error, got %v", queued.Error)
+	}
+	if _, err = db.NextJob(nil); err != ErrNoJobAvailable {
+		t.Errorf("expected cancelled job not to be available, got %v", err)
+	}
+	if err = db.CancelJob(instance, queuedID); err != ErrJobFinished {
+		t.Errorf("expected ErrJobFinished cancelling a finished job, got %v", err)
+	}
+
+	// A running job finds out when it heartbeats
+	runningID, err := db.PutJob(instance, Job{
+		Method: ReleaseJob,
+		Params: ReleaseJobParams{},
+	})
+	bailIfErr(t, err)
+	_, err = db.NextJob(nil)
+	bailIfErr(t, err)
+	bailIfErr(t, db.Heartbeat(runningID))
+	bailIfErr(t, db.CancelJob(instance, runningID))
+	running, err := db.GetJob(instance, runningID)
+	bailIfErr(t, err)
+	if running.Done || !running.Cancelled {
+		t.Errorf("expected running job to be marked cancelled, but not done, got %+v", running)
+	}
+	if err = db.Heartbeat(runningID); err != ErrJobCancelled {
+		t.Errorf("expected ErrJobCancelled from heartbeat, got %v", err)
+	}
+}
+
+func TestDatabaseStoreChangeJob(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	id, err := db.PutJob(instance, Job{
+		Method: ReleaseJob,
+		Params: ReleaseJobParams{},
+	})
+	bailIfErr(t, err)
+
+	// Changes, and any jobs put along with them, are recorded
+	var putID JobID
+	bailIfErr(t, db.ChangeJob(instance, id, func(job *Job, store JobReadPusher) error {
+		params := job.Params.(ReleaseJobParams)
+		params.Cause.Message = "changed"
+		job.Params = params
+		job.Status = "Changed."
+		var err error
+		putID, err = store.PutJob(instance, Job{Method: ReleaseJob, Params: ReleaseJobParams{}})
+		return err
+	}))
+	job, err := db.GetJob(instance, id)
+	bailIfErr(t, err)
+	if job.Params.(ReleaseJobParams).Cause.Message != "changed" || job.Status != "Changed." {
+		t.Errorf("expected change to be recorded, got %+v", job)
+	}
+	if _, err = db.GetJob(instance, putID); err != nil {
+		t.Errorf("expected job put with the change to exist, got %v", err)
+	}
+
+	// If someone else changes the job in the meantime, the change
+	// fails (and its transaction is rolled back; but tests run in a
+	// transaction of their own, so we can't see that here)
+	err = db.ChangeJob(instance, id, func(job *Job, store JobReadPusher) error {
+		other := *job
+		other.Params = ReleaseJobParams{Cause: flux.ReleaseCause{Message: "someone else"}}
+		if err := store.(*DatabaseStore).UpdateJob(other); err != nil {
+			return err
+		}
+		job.Status = "Changed again."
+		return nil
+	})
+	if err != ErrJobChanged {
+		t.Errorf("expected ErrJobChanged, got %v", err)
+	}
+	job, err = db.GetJob(instance, id)
+	bailIfErr(t, err)
+	if job.Status == "Changed again." {
+		t.Error("expected change made concurrently not to be overwritten")
+	}
+
+	if err = db.ChangeJob(instance, JobID("nonesuch"), func(*Job, JobReadPusher) error { return nil }); err != ErrNoSuchJob {
+		t.Errorf("expected ErrNoSuchJob changing a job that doesn't exist, got %v", err)
+	}
+}
+
+func TestDatabaseStoreRetryJob(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	now := time.Now()
+	db.now = func(_ dbProxy) (time.Time, error) {
+		return now, nil
+	}
+
+	jobID, err := db.PutJob(instance, Job{
+		Method: ReleaseJob,
+		Params: ReleaseJobParams{},
+	})
+	bailIfErr(t, err)
+
+	job, err := db.NextJob(nil)
+	bailIfErr(t, err)
+	if job.Attempt != 1 {
+		t.Errorf("expected first attempt, got %d", job.Attempt)
+	}
+	if expected := RetryPolicyFor(ReleaseJob); job.Retry == nil || *job.Retry != *expected {
+		t.Errorf("expected default retry policy %+v, got %+v", expected, job.Retry)
+	}
+
+	job.Status = "Failed: try again"
+	bailIfErr(t, db.RetryJob(job, time.Minute))
+	if _, err = db.NextJob(nil); err != ErrNoJobAvailable {
+		t.Errorf("expected job not to be available until it's due, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	job, err = db.NextJob(nil)
+	bailIfErr(t, err)
+	if job.ID != jobID || job.Attempt != 2 {
+		t.Errorf("expected second attempt at job %s, got attempt %d at %s", jobID, job.Attempt, job.ID)
+	}
+
+	got, err := db.GetJob(instance, jobID)
+	bailIfErr(t, err)
+	if got.Done || got.Attempt != 2 || got.Status != "Failed: try again" {
+		t.Errorf("expected unfinished job on its second attempt, got %+v", got)
+	}
+
+	// A job put back to wait doesn't use up the attempt
+	job.Attempt--
+	job.Status = "Waiting"
+	bailIfErr(t, db.RetryJob(job, time.Minute))
+	now = now.Add(2 * time.Minute)
+	job, err = db.NextJob(nil)
+	bailIfErr(t, err)
+	if job.ID != jobID || job.Attempt != 2 {
+		t.Errorf("expected second attempt at job %s again after waiting, got attempt %d at %s", jobID, job.Attempt, job.ID)
+	}
+}
+
+func TestDatabaseStoreListJobs(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	now := time.Now()
+	db.now = func(_ dbProxy) (time.Time, error) {
+		return now, nil
+	}
+	put := func(job Job) JobID {
+		id, err := db.PutJob(instance, job)
+		bailIfErr(t, err)
+		now = now.Add(time.Second)
+		return id
+	}
+
+	running := put(Job{Method: ReleaseJob, Params: ReleaseJobParams{}})
+	_, err := db.NextJob(nil)
+	bailIfErr(t, err)
+	low := put(Job{Method: ReleaseJob, Params: ReleaseJobParams{}, Priority: PriorityBackground})
+	high := put(Job{Method: ReleaseJob, Params: ReleaseJobParams{}, Priority: PriorityInteractive})
+	sync := put(Job{Method: SyncJob, Params: SyncJobParams{InstanceID: instance}, Key: "sync"})
+	_, err = db.PutJob(flux.InstanceID("other"), Job{Method: ReleaseJob, Params: ReleaseJobParams{}})
+	bailIfErr(t, err)
+
+	ids := func(js []Job) []JobID {
+		var ids []JobID
+		for _, j := range js {
+			ids = append(ids, j.ID)
+		}
+		return ids
+	}
+
+	for _, example := range []struct {
+		name     string
+		filter   JobFilter
+		expected []JobID
+	}{
+		{"all, most recent first", JobFilter{}, []JobID{sync, high, low, running}},
+		{"by method", JobFilter{Method: SyncJob}, []JobID{sync}},
+		{"by key", JobFilter{Key: "sync"}, []JobID{sync}},
+		{"queued", JobFilter{State: JobQueued}, []JobID{sync, high, low}},
+		{"running", JobFilter{State: JobRunning}, []JobID{running}},
+		{"paged", JobFilter{Limit: 2, Offset: 1}, []JobID{high, low}},
+	} {
+		js, err := db.ListJobs(instance, example.filter)
+		bailIfErr(t, err)
+		if got := ids(js); !reflect.DeepEqual(example.expected, got) {
+			t.Errorf("%s: expected %v, got %v", example.name, example.expected, got)
+		}
+	}
+
+	// The queued releases are positioned in the order they'll be run
+	js, err := db.ListJobs(instance, JobFilter{Method: ReleaseJob, State: JobQueued})
+	bailIfErr(t, err)
+	positions := map[JobID]int{}
+	for _, j := range js {
+		positions[j.ID] = j.QueuePosition
+	}
+	if expected := map[JobID]int{high: 1, low: 2}; !reflect.DeepEqual(expected, positions) {
+		t.Errorf("expected queue positions %v, got %v", expected, positions)
+	}
+
+	// Releases scheduled for later can be picked out
+	later := put(Job{Method: ReleaseJob, Params: ReleaseJobParams{}, ScheduledAt: now.Add(time.Hour)})
+	js, err = db.ListJobs(instance, JobFilter{ScheduledAfter: now})
+	bailIfErr(t, err)
+	if expected, got := []JobID{later}, ids(js); !reflect.DeepEqual(expected, got) {
+		t.Errorf("scheduled later: expected %v, got %v", expected, got)
+	}
+}
+
+func TestDatabaseStoreListJobsByApproval(t *testing.T) {
+	instance := flux.InstanceID("instance")
+	db := Setup(t)
+	defer Cleanup(t, db)
+
+	now := time.Now()
+	db.now = func(_ dbProxy) (time.Time, error) {
+		return now, nil
+	}
+	// Run each release to completion, with the params it ends up with
+	finish := func(params ReleaseJobParams) JobID {
+		id, err := db.PutJob(instance, Job{Method: ReleaseJob, Params: ReleaseJobParams{}})
+		bailIfErr(t, err)
+		now = now.Add(time.Second)
+		job, err := db.NextJob(nil)
+		bailIfErr(t, err)
+		job.Params = params
+		job.Done, job.Success = true, true
+		bailIfErr(t, db.UpdateJob(job))
+		return id
+	}
+
+	succeeded := finish(ReleaseJobParams{})
+	pending := finish(ReleaseJobParams{Approval: &flux.ReleaseApproval{Required: 1}})
+	approved := finish(ReleaseJobParams{Approval: &flux.ReleaseApproval{
+		Required:  1,
+		Approvals: []flux.Approval{{User: "alice"}},
+	}})
+	rejected := finish(ReleaseJobParams{Approval: &flux.ReleaseApproval{
+		Required:  1,
+		Rejection: &flux.Approval{User: "bob"},
+	}})
+
+	for _, example := range []struct {
+		state    JobState
+		expected []JobID
+	}{
+		{JobSucceeded, []JobID{approved, succeeded}},
+		{JobPendingApproval, []JobID{pending}},
+		{JobRejected, []JobID{rejected}},
+		{JobFailed, nil},
+	} {
+		js, err := db.ListJobs(instance, JobFilter{State: example.state})
+		bailIfErr(t, err)
+		var got []JobID
+		for _, j := range js {
+			if j.State() != example.state {
+				t.Errorf("%s: listed job %s is %s", example.state, j.ID, j.State())
+			}
+			got = append(got, j.ID)
+		}
+		if !reflect.DeepEqual(example.expected, got) {
+			t.Errorf("%s: expected %v, got %v", example.state, example.expected, got)
+		}
+	}
+
+	// An approval given later moves the release along
+	bailIfErr(t, db.ChangeJob(instance, pending, func(job *Job, _ JobReadPusher) error {
+		params := job.Params.(ReleaseJobParams)
+		params.Approval.Approvals = []flux.Approval{{User: "alice"}}
+		job.Params = params
+		return nil
+	}))
+	js, err := db.ListJobs(instance, JobFilter{State: JobPendingApproval})
+	bailIfErr(t, err)
+	if len(js) != 0 {
+		t.Errorf("expected no releases pending approval once approved, got %d", len(js))
+	}
+}
@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// Hub passes on updates to jobs, as they are made, to anyone
+// following them. It only knows about the updates made in this
+// process; those following a job should also look at the job store
+// now and then, to see updates made elsewhere.
+type Hub struct {
+	mu        sync.Mutex
+	followers map[JobID]map[chan Job]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		followers: map[JobID]map[chan Job]struct{}{},
+	}
+}
+
+// Subscribe gives a channel on which updates to the job given will
+// be sent, and a func to call when no longer interested. Followers
+// that fall behind get only the latest update, which, since each is
+// the whole job, is all they need.
+func (h *Hub) Subscribe(id JobID) (<-chan Job, func()) {
+	ch := make(chan Job, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.followers[id] == nil {
+		h.followers[id] = map[chan Job]struct{}{}
+	}
+	h.followers[id][ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.followers[id], ch)
+		if len(h.followers[id]) == 0 {
+			delete(h.followers, id)
+		}
+	}
+}
+
+// Publish sends the job to everyone following it. It never blocks.
+func (h *Hub) Publish(job Job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.followers[job.ID] {
+		// Make room for the latest update, if the follower hasn't
+		// taken the last one yet
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- job
+	}
+}
+
+type publishingJobStore struct {
+	JobStore
+	hub *Hub
+}
+
+// PublishingJobStore gives a job store that publishes each update to
+// a job on the hub, once it's been stored.
+func PublishingJobStore(js JobStore, hub *Hub) JobStore {
+	return &publishingJobStore{
+		JobStore: js,
+		hub:      hub,
+	}
+}
+
+func (p *publishingJobStore) UpdateJob(j Job) error {
+	if err := p.JobStore.UpdateJob(j); err != nil {
+		return err
+	}
+	p.hub.Publish(j)
+	return nil
+}
+
+func (p *publishingJobStore) ChangeJob(inst flux.InstanceID, id JobID, change func(*Job, JobReadPusher) error) error {
+	var changed Job
+	if err := p.JobStore.ChangeJob(inst, id, func(j *Job, store JobReadPusher) error {
+		if err := change(j, store); err != nil {
+			return err
+		}
+		changed = *j
+		return nil
+	}); err != nil {
+		return err
+	}
+	p.hub.Publish(changed)
+	return nil
+}
+
+func (p *publishingJobStore) RetryJob(j Job, after time.Duration) error {
+	if err := p.JobStore.RetryJob(j, after); err != nil {
+		return err
+	}
+	p.hub.Publish(j)
+	return nil
+}
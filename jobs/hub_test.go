@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"testing"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	updates, unsubscribe := hub.Subscribe("job")
+	others, unsubscribeOthers := hub.Subscribe("other")
+	defer unsubscribeOthers()
+
+	// A follower who falls behind gets just the latest update
+	hub.Publish(Job{ID: "job", Status: "first"})
+	hub.Publish(Job{ID: "job", Status: "second"})
+	select {
+	case job := <-updates:
+		if job.Status != "second" {
+			t.Errorf("expected the latest update, got %q", job.Status)
+		}
+	default:
+		t.Fatal("expected an update")
+	}
+	select {
+	case job := <-updates:
+		t.Errorf("expected no more updates, got %q", job.Status)
+	case job := <-others:
+		t.Errorf("expected no updates for another job, got %q", job.Status)
+	default:
+	}
+
+	unsubscribe()
+	hub.Publish(Job{ID: "job", Status: "third"})
+	select {
+	case job := <-updates:
+		t.Errorf("expected no updates after unsubscribing, got %q", job.Status)
+	default:
+	}
+}
@@ -3,6 +3,7 @@ package jobs
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/weaveworks/flux"
@@ -19,6 +20,18 @@ const (
 	// AutomatedInstanceJob is the method for a check automated instance job
 	AutomatedInstanceJob = "automated_instance"
 
+	// SyncJob is the method for a job syncing the config repo to the
+	// platform
+	SyncJob = "sync"
+
+	// PromoteJob is the method for a job promoting a release to
+	// another instance
+	PromoteJob = "promote"
+
+	// RegistryScanJob is the method for a job scanning the registries
+	// for the images an instance uses
+	RegistryScanJob = "registry_scan"
+
 	// PriorityBackground is priority for background jobs
 	PriorityBackground = 100
 
@@ -36,6 +49,32 @@ release ID.`,
 		Err: errors.New("no such release job found"),
 	}}
 
+	// This is a user-facing error
+	ErrJobFinished = flux.UserConfigProblem{&flux.BaseError{
+		Help: `The release you asked to cancel has already finished.
+
+You can see how it finished with
+
+    fluxctl check-release --release-id=<id>
+`,
+		Err: errors.New("job has already finished"),
+	}}
+
+	// ErrJobCancelled is given by the job store, when heartbeating a
+	// job that someone has asked to be cancelled, and recorded as
+	// the error of a job that was cancelled.
+	ErrJobCancelled = &flux.BaseError{
+		Help: `The release was cancelled before it finished.
+
+Any changes it made before then have not been undone.
+`,
+		Err: errors.New("job cancelled"),
+	}
+
+	// ErrJobChanged is given by ChangeJob, when someone else changed
+	// the job while it was being changed.
+	ErrJobChanged = errors.New("job was changed concurrently")
+
 	ErrNoJobAvailable   = errors.New("no job available")
 	ErrUnknownJobMethod = errors.New("unknown job method")
 	ErrJobAlreadyQueued = errors.New("job is already queued")
@@ -45,6 +84,12 @@ release ID.`,
 type JobStore interface {
 	JobReadPusher
 	JobWritePopper
+	// ChangeJob fetches the job and lets `change` alter it, and put
+	// any jobs that go with the change using the store it's given;
+	// then records the altered job. It's all or nothing, and if the
+	// job's params were changed by someone else in the meantime, it
+	// fails with ErrJobChanged, so one change can't undo another.
+	ChangeJob(inst flux.InstanceID, id JobID, change func(*Job, JobReadPusher) error) error
 	GC() error
 }
 
@@ -52,6 +97,13 @@ type JobReadPusher interface {
 	GetJob(flux.InstanceID, JobID) (Job, error)
 	PutJob(flux.InstanceID, Job) (JobID, error)
 	PutJobIgnoringDuplicates(flux.InstanceID, Job) (JobID, error)
+	// ListJobs gives the instance's jobs matching the filter, most
+	// recently submitted first.
+	ListJobs(flux.InstanceID, JobFilter) ([]Job, error)
+	// CancelJob stops a job from going any further. A job that
+	// hasn't been claimed yet is finished straight away; one that's
+	// running is told of the cancellation when next heartbeated.
+	CancelJob(flux.InstanceID, JobID) error
 }
 
 type JobWritePopper interface {
@@ -61,13 +113,35 @@ type JobWritePopper interface {
 
 type JobUpdater interface {
 	UpdateJob(Job) error
+	// Heartbeat records that the job is still being worked on. It
+	// returns ErrJobCancelled if the job has been cancelled.
 	Heartbeat(JobID) error
+	// RetryJob puts a job that failed (or is waiting; see WaitError)
+	// back in its queue, to be tried again after the delay given.
+	RetryJob(job Job, after time.Duration) error
 }
 
 type JobPopper interface {
+	// NextJob claims the next job to run from the queues. Jobs are
+	// shared out between instances fairly, by their weight.
 	NextJob(queues []string) (Job, error)
 }
 
+// Weigher says how big a share of the workers each instance should
+// get, relative to the others.
+type Weigher interface {
+	Weight(flux.InstanceID) (float64, error)
+}
+
+const (
+	// DefaultWeight is the weight of an instance that hasn't been
+	// given one, or can't be weighed.
+	DefaultWeight = 1.0
+	// FairnessWindow is how far back we look at the jobs each
+	// instance has had run, to work out whose turn it is.
+	FairnessWindow = 10 * time.Minute
+)
+
 type JobID string
 
 func NewJobID() JobID {
@@ -90,6 +164,10 @@ type Job struct {
 	// job with the same key doesn't exist.
 	Key string `json:"key,omitempty"`
 
+	// How to retry the job if it fails; if not given when the job
+	// is put, the default policy for the method is used.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
 	// To be used by the worker
 	Submitted time.Time       `json:"submitted"`
 	Claimed   time.Time       `json:"claimed,omitempty"`
@@ -101,6 +179,90 @@ type Job struct {
 	Done      bool            `json:"done"`
 	Success   bool            `json:"success"` // only makes sense after done is true
 	Error     *flux.BaseError `json:"error,omitempty"`
+	Attempt   int             `json:"attempt,omitempty"`   // counting from one, once claimed
+	Cancelled bool            `json:"cancelled,omitempty"` // someone has asked for it to be cancelled
+
+	// Filled in when listing jobs: for a queued job, how many jobs
+	// in its queue for the same instance will be run before it,
+	// plus one.
+	QueuePosition int `json:"queuePosition,omitempty"`
+}
+
+// JobState is where a job is in its life.
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	// A release that has been planned, but is held until it's
+	// approved, or was rejected instead
+	JobPendingApproval JobState = "pending-approval"
+	JobRejected        JobState = "rejected"
+)
+
+// State says where the job is in its life.
+func (j Job) State() JobState {
+	switch {
+	case j.Done && j.Success:
+		switch j.approvalState() {
+		case flux.ApprovalPending:
+			return JobPendingApproval
+		case flux.ApprovalRejected:
+			return JobRejected
+		}
+		return JobSucceeded
+	case j.Done:
+		return JobFailed
+	case !j.Claimed.IsZero():
+		return JobRunning
+	default:
+		return JobQueued
+	}
+}
+
+// ParseJobState checks the state given is one of those known.
+func ParseJobState(s string) (JobState, error) {
+	switch state := JobState(s); state {
+	case JobQueued, JobRunning, JobSucceeded, JobFailed, JobPendingApproval, JobRejected:
+		return state, nil
+	}
+	return "", fmt.Errorf("unknown job state %q; expected one of %s, %s, %s, %s, %s, %s", s, JobQueued, JobRunning, JobSucceeded, JobFailed, JobPendingApproval, JobRejected)
+}
+
+// approvalState gives the state of the approval a release asked for,
+// or the empty string if the job is not a release that asked for
+// approval.
+func (j Job) approvalState() string {
+	params, ok := j.Params.(ReleaseJobParams)
+	if !ok || params.Approval == nil {
+		return ""
+	}
+	return params.Approval.State()
+}
+
+// DefaultListLimit is the number of jobs listed when no limit is
+// given; MaxListLimit is the most that will be listed at once.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// JobFilter says which jobs to list. Fields left empty match any job.
+type JobFilter struct {
+	Method string
+	State  JobState
+	Key    string
+	// Jobs submitted at or after Since, and before Until
+	Since time.Time
+	Until time.Time
+	// Jobs scheduled to run after this time, e.g., to list the
+	// releases waiting for their time to come
+	ScheduledAfter time.Time
+	// For paging through the jobs
+	Limit  int
+	Offset int
 }
 
 func (j *Job) UnmarshalJSON(data []byte) error {
@@ -139,6 +301,29 @@ func (j *Job) UnmarshalJSON(data []byte) error {
 type ReleaseJobParams struct {
 	flux.ReleaseSpec
 	Cause flux.ReleaseCause
+	// For a release that needs approval before it's carried out,
+	// the approvals (or rejection) so far.
+	Approval *flux.ReleaseApproval `json:",omitempty"`
+	// For a release carrying out one that was approved, the ID of
+	// the release approved and the result planned, so we can check
+	// it still holds.
+	Approved     JobID              `json:",omitempty"`
+	ApprovedPlan flux.ReleaseResult `json:",omitempty"`
+	// For a release made by pull request, the pull request it's
+	// waiting on.
+	PullRequest *flux.ReleasePullRequest `json:",omitempty"`
+	// When to carry out the release; the zero time means straight
+	// away.
+	At time.Time
+	// For a release carried out regularly, the name of the schedule
+	// (in the instance's release config) it's from.
+	Schedule string `json:",omitempty"`
+}
+
+// PendingApproval says whether this is a release waiting to be
+// approved.
+func (params ReleaseJobParams) PendingApproval() bool {
+	return params.Approval != nil && params.Approval.State() == flux.ApprovalPending
 }
 
 func (params ReleaseJobParams) Spec() flux.ReleaseSpec {
@@ -148,4 +333,40 @@ func (params ReleaseJobParams) Spec() flux.ReleaseSpec {
 // AutomatedInstanceJobParams are the params for an automated_instance job
 type AutomatedInstanceJobParams struct {
 	InstanceID flux.InstanceID
+	// If set, only consider the services using images from this
+	// repository, e.g., because we've been told of a push to it.
+	Repository string `json:",omitempty"`
+}
+
+// SyncJobParams are the params for a sync job
+type SyncJobParams struct {
+	InstanceID flux.InstanceID
+}
+
+// RegistryScanJobParams are the params for a registry_scan job
+type RegistryScanJobParams struct {
+	InstanceID flux.InstanceID
+	// If set, scan only this repository, straight away, e.g.,
+	// because we've been told of a push to it; and fetch the tags
+	// given again, since they may have moved.
+	Repository string   `json:",omitempty"`
+	Tags       []string `json:",omitempty"`
+	// Whether to check automated services once the repository has
+	// been scanned.
+	Automate bool `json:",omitempty"`
+}
+
+// PromoteJobParams are the params for a promote job
+type PromoteJobParams struct {
+	InstanceID flux.InstanceID
+	// The promotion edge to follow, by the name or ID of the instance
+	// promoted to.
+	To string
+	// The release being promoted, when it finished, and the images
+	// and services it updated.
+	Release    flux.ReleaseID
+	ReleasedAt time.Time
+	Images     []flux.ImageID
+	Services   []flux.ServiceID
+	Cause      flux.ReleaseCause
 }
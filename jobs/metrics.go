@@ -30,6 +30,13 @@ var (
 		Help:      "Job duration in seconds.",
 		Buckets:   stdprometheus.DefBuckets,
 	}, []string{fluxmetrics.LabelMethod, fluxmetrics.LabelSuccess})
+	queueWait = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Namespace: "flux",
+		Subsystem: "jobs",
+		Name:      "queue_wait_seconds",
+		Help:      "Time from when a job could have run, to when it was taken from the queue.",
+		Buckets:   stdprometheus.ExponentialBuckets(0.5, 2, 14),
+	}, []string{fluxmetrics.LabelInstanceID, fluxmetrics.LabelMethod})
 )
 
 func InstrumentedJobStore(js JobStore) JobStore {
@@ -68,6 +75,16 @@ func (i *instrumentedJobStore) PutJobIgnoringDuplicates(inst flux.InstanceID, j
 	return i.js.PutJobIgnoringDuplicates(inst, j)
 }
 
+func (i *instrumentedJobStore) ListJobs(inst flux.InstanceID, filter JobFilter) (js []Job, err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "ListJobs",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.js.ListJobs(inst, filter)
+}
+
 func (i *instrumentedJobStore) UpdateJob(j Job) (err error) {
 	defer func(begin time.Time) {
 		requestDuration.With(
@@ -95,7 +112,14 @@ func (i *instrumentedJobStore) NextJob(queues []string) (j Job, err error) {
 			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
 		).Observe(time.Since(begin).Seconds())
 	}(time.Now())
-	return i.js.NextJob(queues)
+	j, err = i.js.NextJob(queues)
+	if err == nil {
+		queueWait.With(
+			fluxmetrics.LabelInstanceID, string(j.Instance),
+			fluxmetrics.LabelMethod, j.Method,
+		).Observe(j.Claimed.Sub(j.ScheduledAt).Seconds())
+	}
+	return j, err
 }
 
 func (i *instrumentedJobStore) GC() (err error) {
@@ -107,3 +131,33 @@ func (i *instrumentedJobStore) GC() (err error) {
 	}(time.Now())
 	return i.js.GC()
 }
+
+func (i *instrumentedJobStore) RetryJob(j Job, after time.Duration) (err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "RetryJob",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.js.RetryJob(j, after)
+}
+
+func (i *instrumentedJobStore) ChangeJob(inst flux.InstanceID, jobID JobID, change func(*Job, JobReadPusher) error) (err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "ChangeJob",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.js.ChangeJob(inst, jobID, change)
+}
+
+func (i *instrumentedJobStore) CancelJob(inst flux.InstanceID, jobID JobID) (err error) {
+	defer func(begin time.Time) {
+		requestDuration.With(
+			fluxmetrics.LabelMethod, "CancelJob",
+			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
+		).Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return i.js.CancelJob(inst, jobID)
+}
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy says how many times to try a job, and how long to wait
+// between attempts. The wait doubles after each attempt, starting at
+// InitialBackoff, up to MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts    int           `json:"maxAttempts"`
+	InitialBackoff time.Duration `json:"initialBackoff"`
+	MaxBackoff     time.Duration `json:"maxBackoff"`
+}
+
+// DefaultRetryPolicies gives the policy used for jobs of each method,
+// when none is given with the job. Methods not here are tried once.
+var DefaultRetryPolicies = map[string]RetryPolicy{
+	ReleaseJob: {
+		MaxAttempts:    3,
+		InitialBackoff: 15 * time.Second,
+		MaxBackoff:     2 * time.Minute,
+	},
+}
+
+// RetryPolicyFor gives the default retry policy for the method, or
+// nil if jobs with that method shouldn't be retried.
+func RetryPolicyFor(method string) *RetryPolicy {
+	if p, ok := DefaultRetryPolicies[method]; ok {
+		return &p
+	}
+	return nil
+}
+
+// CanRetry says whether there are attempts left after the one given
+// (counting from one).
+func (p *RetryPolicy) CanRetry(attempt int) bool {
+	return p != nil && attempt < p.MaxAttempts
+}
+
+// Backoff gives how long to wait after the attempt given (counting
+// from one) before trying again.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || backoff < p.MaxBackoff); i++ {
+		backoff *= 2
+	}
+	if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	return backoff
+}
+
+// RetryableHandler is a Handler that knows which of its errors are
+// worth trying the job again for. Errors from handlers that don't
+// implement it are retried if they are temporary.
+type RetryableHandler interface {
+	Handler
+	Retryable(*Job, error) bool
+}
+
+// IsTemporary says whether an error, or the error it wraps, says of
+// itself that it is temporary (as e.g., net.Error does).
+func IsTemporary(err error) bool {
+	temp, ok := errors.Cause(err).(interface {
+		Temporary() bool
+	})
+	return ok && temp.Temporary()
+}
+
+// WaitError is given by a handler when a job can't go any further
+// until something outside flux happens, e.g., a pull request being
+// merged. The job is put back in its queue to be handled again after
+// the delay given, with the reason as its status; waiting doesn't use
+// up any of the job's attempts.
+type WaitError struct {
+	Reason string
+	After  time.Duration
+}
+
+func (e *WaitError) Error() string {
+	return e.Reason
+}
+
+func retryable(h Handler, job *Job, err error) bool {
+	if r, ok := h.(RetryableHandler); ok {
+		return r.Retryable(job, err)
+	}
+	return IsTemporary(err)
+}
@@ -0,0 +1,50 @@
+package jobs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     time.Minute,
+	}
+	for attempt, expected := range map[int]time.Duration{
+		1: 10 * time.Second,
+		2: 20 * time.Second,
+		3: 40 * time.Second,
+		4: time.Minute,
+		5: time.Minute,
+	} {
+		if got := p.Backoff(attempt); got != expected {
+			t.Errorf("attempt %d: expected backoff %s, got %s", attempt, expected, got)
+		}
+	}
+
+	if !p.CanRetry(4) || p.CanRetry(5) {
+		t.Error("expected to be able to retry after attempt 4 of 5, and not after attempt 5")
+	}
+	var none *RetryPolicy
+	if none.CanRetry(1) {
+		t.Error("expected no retries without a policy")
+	}
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "temporary" }
+func (temporaryError) Temporary() bool { return true }
+
+func TestIsTemporary(t *testing.T) {
+	if !IsTemporary(pkgerrors.Wrap(temporaryError{}, "doing something")) {
+		t.Error("expected wrapped temporary error to be temporary")
+	}
+	if IsTemporary(errors.New("permanent")) {
+		t.Error("expected plain error not to be temporary")
+	}
+}
@@ -1,6 +1,7 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -19,8 +20,12 @@ var (
 	ErrNoHandlerForJob = fmt.Errorf("no handler for job type")
 )
 
+// Handler carries out jobs of a particular method. The context is
+// cancelled if someone cancels the job while it's being handled;
+// handlers should check it before doing anything that can't be
+// undone, and give up with the context's error if it's done.
 type Handler interface {
-	Handle(*Job, JobUpdater) ([]Job, error)
+	Handle(context.Context, *Job, JobUpdater) ([]Job, error)
 }
 
 // Worker grabs jobs from the job store and executes them.
@@ -78,28 +83,67 @@ func (w *Worker) Work() {
 		logger := log.NewContext(w.logger).With("job", job.ID)
 		logger.Log("method", job.Method)
 
-		cancel, done := make(chan struct{}), make(chan struct{})
-		go heartbeat(job.ID, w.jobs, time.Second, cancel, done, logger)
+		ctx, cancelJob := context.WithCancel(context.Background())
+		stop, done := make(chan struct{}), make(chan struct{})
+		go heartbeat(job.ID, w.jobs, time.Second, cancelJob, stop, done, logger)
 
 		job.Status = "Executing..."
+		if job.Attempt > 1 {
+			job.Status = fmt.Sprintf("Executing (attempt %d of %d)...", job.Attempt, job.Retry.MaxAttempts)
+		}
 		if err := w.jobs.UpdateJob(job); err != nil {
 			logger.Log("err", errors.Wrap(err, "updating job"))
 		}
 
 		begin := time.Now().UTC()
 		var followUps []Job
-		if handler, ok := w.handlers[job.Method]; !ok {
+		handler, ok := w.handlers[job.Method]
+		if !ok {
 			err = ErrNoHandlerForJob
 		} else {
-			followUps, err = handler.Handle(&job, w.jobs)
+			followUps, err = handler.Handle(ctx, &job, w.jobs)
 		}
 		jobDuration.With(
 			fluxmetrics.LabelMethod, job.Method,
 			fluxmetrics.LabelSuccess, fmt.Sprint(err == nil),
 		).Observe(time.Since(begin).Seconds())
 		logger.Log("took", time.Since(begin))
+
+		close(stop)
+		<-done
+		cancelled := ctx.Err() != nil
+		cancelJob()
+
+		if wait, waiting := errors.Cause(err).(*WaitError); waiting && !cancelled {
+			logger.Log("wait", wait.After, "reason", wait.Reason)
+			job.Attempt--
+			job.Status = wait.Reason
+			if err := w.jobs.RetryJob(job, wait.After); err != nil {
+				logger.Log("err", errors.Wrap(err, "putting waiting job back"))
+			}
+			continue
+		}
+
+		if err != nil && !cancelled && ok && job.Retry.CanRetry(job.Attempt) && retryable(handler, &job, err) {
+			backoff := job.Retry.Backoff(job.Attempt)
+			status := fmt.Sprintf("Failed: %s; trying again in %s (attempt %d of %d).", err, backoff, job.Attempt, job.Retry.MaxAttempts)
+			logger.Log("retry", backoff, "err", err)
+			job.Status = status
+			job.Log = append(job.Log, status)
+			if err := w.jobs.RetryJob(job, backoff); err != nil {
+				logger.Log("err", errors.Wrap(err, "retrying job"))
+			}
+			continue
+		}
+
 		job.Done = true
-		if err != nil {
+		switch {
+		case err != nil && cancelled:
+			job.Success = false
+			job.Status = "Cancelled."
+			job.Log = append(job.Log, job.Status)
+			job.Error = ErrJobCancelled
+		case err != nil:
 			job.Success = false
 			status := fmt.Sprintf("Failed: %s", err)
 			job.Status = status
@@ -113,9 +157,13 @@ func (w *Worker) Work() {
 			} else {
 				job.Error = flux.CoverAllError(err)
 			}
-		} else {
+		default:
 			job.Success = true
-			job.Status = "Complete."
+			// A release held for approval hasn't completed; the
+			// handler's last status says what it's waiting for.
+			if job.State() == JobSucceeded {
+				job.Status = "Complete."
+			}
 		}
 		if err := w.jobs.UpdateJob(job); err != nil {
 			logger.Log("err", errors.Wrap(err, "updating job"))
@@ -127,9 +175,6 @@ func (w *Worker) Work() {
 				logger.Log("err", errors.Wrap(err, "putting follow-up job"))
 			}
 		}
-
-		close(cancel)
-		<-done
 	}
 }
 
@@ -144,17 +189,28 @@ func (w *Worker) Stop(timeout time.Duration) error {
 	}
 }
 
-func heartbeat(id JobID, h heartbeater, d time.Duration, cancel <-chan struct{}, done chan<- struct{}, logger log.Logger) {
+// heartbeat keeps the job marked as being worked on, until stopped,
+// calling cancel if the job store says the job has been cancelled.
+func heartbeat(id JobID, h heartbeater, d time.Duration, cancel context.CancelFunc, stop <-chan struct{}, done chan<- struct{}, logger log.Logger) {
 	t := time.NewTicker(d)
 	defer t.Stop()
 	defer close(done)
+	cancelled := false
 	for {
 		select {
 		case <-t.C:
-			if err := h.Heartbeat(id); err != nil {
+			switch err := h.Heartbeat(id); err {
+			case nil:
+			case ErrJobCancelled:
+				if !cancelled {
+					logger.Log("heartbeat", "cancelled")
+					cancel()
+					cancelled = true
+				}
+			default:
 				logger.Log("heartbeat", err)
 			}
-		case <-cancel:
+		case <-stop:
 			return
 		}
 	}
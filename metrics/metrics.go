@@ -9,6 +9,9 @@ const (
 	LabelMethod  = "method"
 	LabelSuccess = "success"
 
+	// Not "instance", which Prometheus uses for the scrape target
+	LabelInstanceID = "instance_id"
+
 	// Labels for release metrics
 	LabelAction      = "action"
 	LabelReleaseType = "release_type"
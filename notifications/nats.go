@@ -0,0 +1,38 @@
+package notifications
+
+import (
+	"encoding/json"
+
+	"github.com/nats-io/nats"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+const defaultNATSSubject = "flux.notifications"
+
+// natsNotifier publishes the message, as JSON, to a NATS subject.
+type natsNotifier struct {
+	spec flux.NotifierSpec
+}
+
+func (n *natsNotifier) Notify(msg Message) error {
+	subject := n.spec.Subject
+	if subject == "" {
+		subject = defaultNATSSubject
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "encoding NATS message")
+	}
+
+	conn, err := nats.Connect(n.spec.URL, nats.Timeout(httpClient.Timeout))
+	if err != nil {
+		return errors.Wrapf(err, "connecting to NATS at %s", n.spec.URL)
+	}
+	defer conn.Close()
+	if err := conn.Publish(subject, body); err != nil {
+		return errors.Wrapf(err, "publishing to %s", subject)
+	}
+	return errors.Wrap(conn.Flush(), "flushing NATS connection")
+}
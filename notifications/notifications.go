@@ -1,21 +1,145 @@
 package notifications
 
 import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
 	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/instance"
 )
 
+const (
+	defaultEventTemplate = `{{.String}}`
+)
+
+// Message is what's given to a notifier: the text to announce, as
+// well as the release or event it's about, for notifiers that send
+// structured data.
+type Message struct {
+	Type    string        `json:"type"`
+	Text    string        `json:"text"`
+	Release *flux.Release `json:"release,omitempty"`
+	Event   *flux.Event   `json:"event,omitempty"`
+}
+
+// Notifier is something that can announce a message somewhere.
+type Notifier interface {
+	Notify(Message) error
+}
+
+// NewNotifier constructs a notifier from an entry in the instance's
+// list of notifiers.
+func NewNotifier(spec flux.NotifierSpec) (Notifier, error) {
+	switch spec.Type {
+	case flux.NotifierWebhook:
+		return &webhookNotifier{spec}, nil
+	case flux.NotifierTeams:
+		return &teamsNotifier{spec}, nil
+	case flux.NotifierSMTP:
+		return &smtpNotifier{spec}, nil
+	case flux.NotifierNATS:
+		return &natsNotifier{spec}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q", spec.Type)
+}
+
 // Release performs post-release notifications for an instance
 func Release(cfg instance.Config, r flux.Release, releaseError error) error {
 	if r.Spec.Kind != flux.ReleaseKindExecute {
 		return nil
 	}
 
-	// TODO: Use a config settings format which allows multiple notifiers to be
-	// configured.
-	var err error
+	var errs []string
 	if cfg.Settings.Slack.HookURL != "" {
-		err = slackNotifyRelease(cfg.Settings.Slack, r, releaseError)
+		if err := slackNotifyRelease(cfg.Settings.Slack, r, releaseError); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	for _, spec := range cfg.Settings.Notifiers {
+		if !spec.Wants(flux.EventRelease) {
+			continue
+		}
+		if err := notifyRelease(spec, r, releaseError); err != nil {
+			errs = append(errs, errors.Wrapf(err, "%s notifier", spec.Type).Error())
+		}
+	}
+	return combine(errs)
+}
+
+// Event announces an event (other than a release, which is announced
+// by Release) to those notifiers that want events of its type.
+func Event(cfg instance.Config, e flux.Event) error {
+	var errs []string
+	for _, spec := range cfg.Settings.Notifiers {
+		if e.Type == flux.EventRelease || !spec.Wants(e.Type) {
+			continue
+		}
+		if err := notifyEvent(spec, e); err != nil {
+			errs = append(errs, errors.Wrapf(err, "%s notifier", spec.Type).Error())
+		}
+	}
+	return combine(errs)
+}
+
+func notifyRelease(spec flux.NotifierSpec, r flux.Release, releaseError error) error {
+	notifier, err := NewNotifier(spec)
+	if err != nil {
+		return err
+	}
+
+	template := defaultReleaseTemplate
+	if spec.ReleaseTemplate != "" {
+		template = spec.ReleaseTemplate
+	}
+	errorMessage := ""
+	if releaseError != nil {
+		errorMessage = releaseError.Error()
+	}
+	text, err := instantiateTemplate("release", template, struct {
+		flux.Release
+		Error string
+	}{
+		Release: r,
+		Error:   errorMessage,
+	})
+	if err != nil {
+		return err
+	}
+
+	return notifier.Notify(Message{
+		Type:    flux.EventRelease,
+		Text:    text,
+		Release: &r,
+	})
+}
+
+func notifyEvent(spec flux.NotifierSpec, e flux.Event) error {
+	notifier, err := NewNotifier(spec)
+	if err != nil {
+		return err
+	}
+
+	template := defaultEventTemplate
+	if spec.EventTemplate != "" {
+		template = spec.EventTemplate
+	}
+	text, err := instantiateTemplate("event", template, e)
+	if err != nil {
+		return err
+	}
+
+	return notifier.Notify(Message{
+		Type:  e.Type,
+		Text:  text,
+		Event: &e,
+	})
+}
+
+func combine(errs []string) error {
+	if len(errs) == 0 {
+		return nil
 	}
-	return err
+	return errors.New(strings.Join(errs, "; "))
 }
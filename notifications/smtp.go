@@ -0,0 +1,62 @@
+package notifications
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// smtpNotifier sends the message as a plain text email.
+type smtpNotifier struct {
+	spec flux.NotifierSpec
+}
+
+// So we can test without a mail server
+var sendMail = smtp.SendMail
+
+func (n *smtpNotifier) Notify(msg Message) error {
+	if len(n.spec.To) == 0 {
+		return errors.New("no recipients given for email")
+	}
+	var auth smtp.Auth
+	if n.spec.Username != "" {
+		host, _, err := net.SplitHostPort(n.spec.URL)
+		if err != nil {
+			return errors.Wrapf(err, "parsing SMTP server address %q", n.spec.URL)
+		}
+		auth = smtp.PlainAuth("", n.spec.Username, n.spec.Password, host)
+	}
+	if err := sendMail(n.spec.URL, auth, n.spec.From, n.spec.To, n.email(msg, time.Now())); err != nil {
+		return errors.Wrap(err, "sending email")
+	}
+	return nil
+}
+
+func (n *smtpNotifier) email(msg Message, now time.Time) []byte {
+	subject := n.spec.Subject
+	if subject == "" {
+		subject = "Flux " + msg.Type
+	}
+	buf := &bytes.Buffer{}
+	for _, header := range [][2]string{
+		{"From", n.spec.From},
+		{"To", strings.Join(n.spec.To, ", ")},
+		{"Subject", subject},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", `text/plain; charset="utf-8"`},
+	} {
+		fmt.Fprintf(buf, "%s: %s\r\n", header[0], header[1])
+	}
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.Replace(msg.Text, "\n", "\r\n", -1))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
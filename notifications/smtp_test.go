@@ -0,0 +1,46 @@
+package notifications
+
+import (
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestSMTPNotifier(t *testing.T) {
+	var gotAddr, gotFrom string
+	var gotTo []string
+	var gotMsg []byte
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotFrom, gotTo, gotMsg = addr, from, to, msg
+		return nil
+	}
+	defer func() { sendMail = smtp.SendMail }()
+
+	if err := notifyEvent(flux.NotifierSpec{
+		Type: flux.NotifierSMTP,
+		URL:  "mail.example.com:25",
+		From: "flux@example.com",
+		To:   []string{"ops@example.com", "dev@example.com"},
+	}, flux.Event{
+		Type:       flux.EventAutomate,
+		ServiceIDs: []flux.ServiceID{"default/helloworld"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if gotAddr != "mail.example.com:25" || gotFrom != "flux@example.com" || len(gotTo) != 2 {
+		t.Errorf("Unexpected envelope: %q, %q, %q", gotAddr, gotFrom, gotTo)
+	}
+	msg := string(gotMsg)
+	for _, expected := range []string{
+		"To: ops@example.com, dev@example.com\r\n",
+		"Subject: Flux automate\r\n",
+		"\r\n\r\nAutomated: default/helloworld\r\n",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("Expected email to contain %q, got:\n%s", expected, msg)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// teamsNotifier posts to a Microsoft Teams incoming webhook, which
+// expects a "MessageCard".
+type teamsNotifier struct {
+	spec flux.NotifierSpec
+}
+
+func (n *teamsNotifier) Notify(msg Message) error {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(map[string]string{
+		"@type":    "MessageCard",
+		"@context": "http://schema.org/extensions",
+		"summary":  "Flux " + msg.Type,
+		"text":     msg.Text,
+	}); err != nil {
+		return errors.Wrap(err, "encoding Teams POST request")
+	}
+
+	req, err := http.NewRequest("POST", n.spec.URL, buf)
+	if err != nil {
+		return errors.Wrap(err, "constructing Teams HTTP request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return post(req, "Teams")
+}
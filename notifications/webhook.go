@@ -0,0 +1,64 @@
+package notifications
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+const signatureHeader = "X-Flux-Signature"
+
+// webhookNotifier POSTs the message as JSON. If there's a secret, the
+// payload is signed with it, so the receiver can check it came from
+// us; the signature is given as `sha256=<hex HMAC of the body>`.
+type webhookNotifier struct {
+	spec flux.NotifierSpec
+}
+
+func (n *webhookNotifier) Notify(msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "encoding webhook payload")
+	}
+	req, err := http.NewRequest("POST", n.spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "constructing webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.spec.Secret != "" {
+		req.Header.Set(signatureHeader, sign(n.spec.Secret, body))
+	}
+	return post(req, "webhook")
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post does the request and checks for an unsuccessful response,
+// including the start of the body in the error if there is one.
+func post(req *http.Request, to string) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "executing HTTP POST to %s", to)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		return fmt.Errorf("%s from %s (%s)", resp.Status, to, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var gotSignature string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(signatureHeader)
+		gotBody, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	if err := notifyRelease(flux.NotifierSpec{
+		Type:   flux.NotifierWebhook,
+		URL:    server.URL,
+		Secret: "s3cr3t",
+	}, exampleRelease(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	if gotBody == nil {
+		t.Fatal("Expected a request to the webhook to have been made")
+	}
+
+	if expected := sign("s3cr3t", gotBody); gotSignature != expected {
+		t.Errorf("Expected signature %q, got %q", expected, gotSignature)
+	}
+	var msg struct {
+		Type    string
+		Text    string
+		Release json.RawMessage
+	}
+	if err := json.Unmarshal(gotBody, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != flux.EventRelease || len(msg.Release) == 0 {
+		t.Errorf("Expected a release message, got %#v", msg)
+	}
+	if expected := "Release (test-user) all latest to default/helloworld. done"; msg.Text != expected {
+		t.Errorf("Expected text %q, got %q", expected, msg.Text)
+	}
+}
+
+func TestEvent_Filter(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&msg)
+		got = append(got, msg.Text)
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	cfg := instance.Config{
+		Settings: flux.UnsafeInstanceConfig{
+			Notifiers: []flux.NotifierSpec{
+				{Type: flux.NotifierWebhook, URL: server.URL, Events: []string{flux.EventLock}},
+				{Type: flux.NotifierWebhook, URL: server.URL, Events: []string{flux.EventLock}, EventTemplate: "{{.Type}} {{join .ServiceIDStrings \",\"}}"},
+				{Type: flux.NotifierWebhook, URL: server.URL}, // releases only
+			},
+		},
+	}
+	for _, e := range []flux.Event{
+		{Type: flux.EventLock, ServiceIDs: []flux.ServiceID{"default/helloworld"}},
+		{Type: flux.EventAutomate, ServiceIDs: []flux.ServiceID{"default/helloworld"}},
+	} {
+		if err := Event(cfg, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) != 2 || got[0] != "Locked: default/helloworld" || got[1] != "lock default/helloworld" {
+		t.Errorf("Expected just the lock event to be announced, twice, got %q", got)
+	}
+}
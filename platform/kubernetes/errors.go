@@ -34,9 +34,9 @@ This may be because those resources do not use images, or because it
 is a new kind of resource in Kubernetes, and Flux does not support it
 yet.
 
-If you can use a Deployment instead, Flux can work with
-those. Otherwise, you may have to update the resource manually (e.g.,
-using kubectl).
+If you can use a Deployment, DaemonSet, StatefulSet or CronJob
+instead, Flux can work with those. Otherwise, you may have to update
+the resource manually (e.g., using kubectl).
 `,
 		},
 	}
@@ -3,66 +3,265 @@ package kubernetes
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
 	"github.com/weaveworks/flux"
 )
 
+// ServiceFiles records where a service is defined: the file with the
+// Service resource, and the files with the pod controllers the
+// service selects. These may be the same file.
+type ServiceFiles struct {
+	Service     string
+	Controllers []string
+	// The pod controllers themselves, since a file may define others
+	// that the service doesn't select
+	PodControllers []PodController
+}
+
+// PodController picks out a pod controller: the file it's defined in,
+// and its kind and name, to find it among whatever else is in the
+// file.
+type PodController struct {
+	Path, Kind, Name string
+}
+
+// FileError is a problem with one of the files looked at. These are
+// not fatal, since a repo may well contain files that aren't resource
+// definitions, or that we can't parse; but they're worth reporting.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err)
+}
+
 // FindDefinedServices finds all the services defined under the
 // directory given, and returns a map of service IDs (from its
-// specified namespace and name) to the paths of resource definition
-// files.
+// specified namespace and name) to the paths of the files defining
+// the pod controllers for the service. Services without a pod
+// controller are not included; and files that can't be parsed are
+// skipped. Use `ParseServices` to get all the details.
 func FindDefinedServices(path string) (map[flux.ServiceID][]string, error) {
-	bin, err := findBinary("kubeservice")
+	services, _, err := ParseServices(path)
 	if err != nil {
 		return nil, err
 	}
+	res := map[flux.ServiceID][]string{}
+	for id, files := range services {
+		if len(files.Controllers) > 0 {
+			res[id] = files.Controllers
+		}
+	}
+	return res, nil
+}
 
-	var files []string
-	filepath.Walk(path, func(target string, info os.FileInfo, err error) error {
+// ParseServices walks the directory given, decoding each YAML or JSON
+// file (which may contain several documents, or `List` resources),
+// and matches the Services found against the pod controllers in the
+// same namespace, using their selectors. It returns where each
+// service is defined, and the problems found with individual files.
+func ParseServices(path string) (map[flux.ServiceID]ServiceFiles, []FileError, error) {
+	var (
+		services    []resource
+		controllers []resource
+		warnings    []FileError
+	)
+	err := filepath.Walk(path, func(target string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
 			return nil
 		}
-		if ext := filepath.Ext(target); ext == ".yaml" || ext == ".yml" {
-			files = append(files, target)
+		switch strings.ToLower(filepath.Ext(target)) {
+		case ".yaml", ".yml", ".json":
+			break
+		default:
+			return nil
+		}
+
+		def, err := ioutil.ReadFile(target)
+		if err != nil {
+			return errors.Wrapf(err, "reading %s", target)
+		}
+		resources, err := parseResources(target, def)
+		if err != nil {
+			warnings = append(warnings, FileError{Path: target, Err: err})
+			return nil
+		}
+		for _, r := range resources {
+			switch {
+			case r.kind == "Service":
+				services = append(services, r)
+			case r.labels != nil:
+				controllers = append(controllers, r)
+			}
 		}
 		return nil
 	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-	services := map[flux.ServiceID][]string{}
-	for _, file := range files {
-		var stdout, stderr bytes.Buffer
-		cmd := exec.Command(bin, "./"+filepath.Base(file)) // due to bug (?) in kubeservice
-		cmd.Dir = filepath.Dir(file)
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
-		if err := cmd.Run(); err != nil {
+	defined := map[flux.ServiceID]ServiceFiles{}
+	for _, s := range services {
+		id := flux.MakeServiceID(s.namespace, s.name)
+		if existing, ok := defined[id]; ok {
+			warnings = append(warnings, FileError{
+				Path: s.path,
+				Err:  fmt.Errorf("service %s is also defined in %s", id, existing.Service),
+			})
 			continue
 		}
-		for _, out := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
-			if out != "" {
-				id := flux.ServiceID(out)
-				services[id] = append(services[id], file)
+		files := ServiceFiles{Service: s.path}
+		if len(s.selector) > 0 {
+			seen := map[string]bool{}
+			for _, c := range controllers {
+				if c.namespace != s.namespace || !matchLabels(s.selector, c.labels) {
+					continue
+				}
+				files.PodControllers = append(files.PodControllers, PodController{
+					Path: c.path,
+					Kind: c.kind,
+					Name: c.name,
+				})
+				if !seen[c.path] {
+					seen[c.path] = true
+					files.Controllers = append(files.Controllers, c.path)
+				}
 			}
+			sort.Strings(files.Controllers)
 		}
+		defined[id] = files
 	}
-	return services, nil
+	return defined, warnings, nil
 }
 
-func findBinary(name string) (string, error) {
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", err
+// The bits of a resource we need to match services with pod
+// controllers.
+type resource struct {
+	path            string
+	kind            string
+	namespace, name string
+	// For a Service
+	selector map[string]string
+	// For a pod controller, the labels given to its pods
+	labels map[string]string
+}
+
+// Where to find the pod template in each kind of resource that
+// controls pods. This includes ReplicationControllers, which we can
+// find (and report on) though not update.
+func controllerTemplatePath(kind string) ([]string, bool) {
+	if kind == "ReplicationController" {
+		return []string{"spec", "template"}, true
+	}
+	path, ok := podTemplatePaths[kind]
+	return path, ok
+}
+
+func parseResources(path string, def []byte) ([]resource, error) {
+	var res []resource
+	decoder := yaml.NewDecoder(bytes.NewReader(def))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		found, err := resourcesIn(path, doc.Content[0])
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, found...)
+	}
+}
+
+func resourcesIn(path string, node *yaml.Node) ([]resource, error) {
+	kind := scalarAt(node, "kind")
+	switch {
+	case kind == "":
+		// Not a resource; perhaps some other kind of file
+		return nil, nil
+	case kind == "List" || strings.HasSuffix(kind, "List"):
+		var res []resource
+		if items := nodeAt(node, "items"); items != nil && items.Kind == yaml.SequenceNode {
+			for _, item := range items.Content {
+				found, err := resourcesIn(path, item)
+				if err != nil {
+					return nil, err
+				}
+				res = append(res, found...)
+			}
+		}
+		return res, nil
+	}
+
+	r := resource{
+		path:      path,
+		kind:      kind,
+		namespace: scalarAt(node, "metadata", "namespace"),
+		name:      scalarAt(node, "metadata", "name"),
 	}
-	localBin := filepath.Join(cwd, name)
-	if _, err := os.Stat(localBin); err == nil {
-		return localBin, nil
+	if r.namespace == "" {
+		r.namespace = "default"
 	}
-	if pathBin, err := exec.LookPath(name); err == nil {
-		return pathBin, nil
+	if kind == "Service" {
+		if r.name == "" {
+			return nil, fmt.Errorf("service without a name (line %d)", node.Line)
+		}
+		if err := decodeLabels(nodeAt(node, "spec", "selector"), &r.selector); err != nil {
+			return nil, errors.Wrapf(err, "decoding selector of service %s", r.name)
+		}
+		return []resource{r}, nil
+	}
+	if templatePath, ok := controllerTemplatePath(kind); ok {
+		labelsPath := append(append([]string{}, templatePath...), "metadata", "labels")
+		if err := decodeLabels(nodeAt(node, labelsPath...), &r.labels); err != nil {
+			return nil, errors.Wrapf(err, "decoding pod labels of %s %s", kind, r.name)
+		}
+		if r.labels == nil {
+			r.labels = map[string]string{}
+		}
+		return []resource{r}, nil
+	}
+	return nil, nil
+}
+
+func decodeLabels(node *yaml.Node, labels *map[string]string) error {
+	if node == nil {
+		return nil
+	}
+	return node.Decode(labels)
+}
+
+// matchLabels says whether all the pairs in the selector are present
+// in the labels.
+func matchLabels(selector, labels map[string]string) bool {
+	for k, v := range selector {
+		if l, ok := labels[k]; !ok || l != v {
+			return false
+		}
 	}
-	return "", fmt.Errorf("%s not found", name)
+	return true
 }
@@ -1,9 +1,13 @@
 package kubernetes
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/weaveworks/flux"
 	"github.com/weaveworks/flux/platform/kubernetes/testdata"
 )
 
@@ -24,3 +28,126 @@ func TestDefinedServices(t *testing.T) {
 		t.Errorf("Got unexpected result: %#v", services)
 	}
 }
+
+var parseFiles = map[string]string{
+	// A service and its deployment in one file
+	"frontend.yaml": `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: frontend
+  namespace: web
+spec:
+  selector:
+    name: frontend
+---
+apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: frontend
+  namespace: web
+spec:
+  template:
+    metadata:
+      labels:
+        name: frontend
+        tier: web
+    spec:
+      containers:
+      - name: frontend
+        image: quay.io/weaveworks/frontend:v1
+`,
+	// A service with its statefulset in another directory, as JSON
+	"db/db-svc.json": `{
+  "apiVersion": "v1",
+  "kind": "Service",
+  "metadata": {"name": "db"},
+  "spec": {"selector": {"app": "db"}}
+}`,
+	"controllers/db-sts.yaml": `apiVersion: apps/v1beta1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  template:
+    metadata:
+      labels: {app: db}
+    spec:
+      containers:
+      - name: db
+        image: postgres:9.6
+`,
+	// A list, with a service that selects nothing in the repo
+	"list.yaml": `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: external
+  spec:
+    selector:
+      app: elsewhere
+- apiVersion: extensions/v1beta1
+  kind: DaemonSet
+  metadata:
+    name: agent
+    namespace: web
+  spec:
+    template:
+      metadata:
+        labels:
+          app: elsewhere
+`,
+	// Not parseable, and not a resource
+	"broken.yaml": "kind: Service\nmetadata: [\n",
+	"values.yml":  "replicas: 3\n",
+	"README.md":   "# Not a manifest\n",
+}
+
+func TestParseServices(t *testing.T) {
+	dir, cleanup := testdata.TempDir(t)
+	defer cleanup()
+
+	for name, content := range parseFiles {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	services, warnings, err := ParseServices(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[flux.ServiceID]ServiceFiles{
+		"web/frontend": {
+			Service:     filepath.Join(dir, "frontend.yaml"),
+			Controllers: []string{filepath.Join(dir, "frontend.yaml")},
+			PodControllers: []PodController{
+				{Path: filepath.Join(dir, "frontend.yaml"), Kind: "Deployment", Name: "frontend"},
+			},
+		},
+		"default/db": {
+			Service:     filepath.Join(dir, "db/db-svc.json"),
+			Controllers: []string{filepath.Join(dir, "controllers/db-sts.yaml")},
+			PodControllers: []PodController{
+				{Path: filepath.Join(dir, "controllers/db-sts.yaml"), Kind: "StatefulSet", Name: "db"},
+			},
+		},
+		"default/external": {
+			Service: filepath.Join(dir, "list.yaml"),
+		},
+	}
+	if !reflect.DeepEqual(expected, services) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, services)
+	}
+
+	if len(warnings) != 1 || warnings[0].Path != filepath.Join(dir, "broken.yaml") {
+		t.Errorf("expected a warning about broken.yaml, got %#v", warnings)
+	}
+}
@@ -6,6 +6,7 @@ package kubernetes
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 
 	k8syaml "github.com/ghodss/yaml"
@@ -86,12 +87,13 @@ type Applier interface {
 // Cluster is a handle to a Kubernetes API server.
 // (Typically, this code is deployed into the same cluster.)
 type Cluster struct {
-	config  *rest.Config
-	client  extendedClient
-	applier Applier
-	actionc chan func()
-	version string // string response for the version command.
-	logger  log.Logger
+	config    *rest.Config
+	client    extendedClient
+	workloads *workloadClient
+	applier   Applier
+	actionc   chan func()
+	version   string // string response for the version command.
+	logger    log.Logger
 }
 
 // NewCluster returns a usable cluster. Host should be of the form
@@ -101,14 +103,19 @@ func NewCluster(config *rest.Config, applier Applier, version string, logger log
 	if err != nil {
 		return nil, err
 	}
+	workloads, err := newWorkloadClient(config)
+	if err != nil {
+		return nil, err
+	}
 
 	c := &Cluster{
-		config:  config,
-		client:  extendedClient{client.Discovery(), client.Core(), client.Extensions()},
-		applier: applier,
-		actionc: make(chan func()),
-		version: version,
-		logger:  logger,
+		config:    config,
+		client:    extendedClient{client.Discovery(), client.Core(), client.Extensions()},
+		workloads: workloads,
+		applier:   applier,
+		actionc:   make(chan func()),
+		version:   version,
+		logger:    logger,
 	}
 	go c.loop()
 	return c, nil
@@ -248,10 +255,53 @@ func (c *Cluster) podControllersInNamespace(namespace string) (res []podControll
 		}
 	}
 
+	daemonsets, err := c.workloads.list(daemonSetKind, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "collecting daemonsets")
+	}
+	for _, item := range daemonsets {
+		var ds daemonSet
+		if err := json.Unmarshal(item, &ds); err != nil {
+			return nil, errors.Wrap(err, "decoding daemonset")
+		}
+		if !isAddon(&ds) {
+			res = append(res, podController{DaemonSet: &ds})
+		}
+	}
+
+	statefulsets, err := c.workloads.list(statefulSetKind, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "collecting statefulsets")
+	}
+	for _, item := range statefulsets {
+		var ss statefulSet
+		if err := json.Unmarshal(item, &ss); err != nil {
+			return nil, errors.Wrap(err, "decoding statefulset")
+		}
+		if !isAddon(&ss) {
+			res = append(res, podController{StatefulSet: &ss})
+		}
+	}
+
+	cronjobs, err := c.workloads.list(cronJobKind, namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "collecting cronjobs")
+	}
+	for _, item := range cronjobs {
+		var cj cronJob
+		if err := json.Unmarshal(item, &cj); err != nil {
+			return nil, errors.Wrap(err, "decoding cronjob")
+		}
+		if !isAddon(&cj) {
+			res = append(res, podController{CronJob: &cj})
+		}
+	}
+
 	return res, nil
 }
 
-// Find the pod controller (deployment or replication controller) that matches the service
+// Find the pod controller (deployment, replication controller,
+// daemonset, statefulset or cronjob) that matches the service
 func matchController(service *v1.Service, controllers []podController) (podController, error) {
 	selector := service.Spec.Selector
 	if len(selector) == 0 {
@@ -274,31 +324,46 @@ func matchController(service *v1.Service, controllers []podController) (podContr
 	}
 }
 
-// Either a replication controller, a deployment, or neither (both nils).
+// One of the kinds of resource that controls pods, or none (all
+// nils).
 type podController struct {
 	ReplicationController *v1.ReplicationController
 	Deployment            *apiext.Deployment
+	DaemonSet             *daemonSet
+	StatefulSet           *statefulSet
+	CronJob               *cronJob
 }
 
-func (p podController) templateContainers() (res []platform.Container) {
-	var apiContainers []v1.Container
-	if p.Deployment != nil {
-		apiContainers = p.Deployment.Spec.Template.Spec.Containers
-	} else if p.ReplicationController != nil {
-		apiContainers = p.ReplicationController.Spec.Template.Spec.Containers
+func (p podController) podTemplate() *v1.PodTemplateSpec {
+	switch {
+	case p.Deployment != nil:
+		return &p.Deployment.Spec.Template
+	case p.ReplicationController != nil:
+		return p.ReplicationController.Spec.Template
+	case p.DaemonSet != nil:
+		return &p.DaemonSet.Spec.Template
+	case p.StatefulSet != nil:
+		return &p.StatefulSet.Spec.Template
+	case p.CronJob != nil:
+		return &p.CronJob.Spec.JobTemplate.Spec.Template
 	}
+	return nil
+}
 
-	for _, c := range apiContainers {
+func (p podController) templateContainers() (res []platform.Container) {
+	template := p.podTemplate()
+	if template == nil {
+		return nil
+	}
+	for _, c := range template.Spec.Containers {
 		res = append(res, platform.Container{Name: c.Name, Image: c.Image})
 	}
 	return res
 }
 
 func (p podController) templateLabels() map[string]string {
-	if p.Deployment != nil {
-		return p.Deployment.Spec.Template.Labels
-	} else if p.ReplicationController != nil {
-		return p.ReplicationController.Spec.Template.Labels
+	if template := p.podTemplate(); template != nil {
+		return template.Labels
 	}
 	return nil
 }
@@ -317,7 +382,7 @@ func (p podController) matchedBy(selector map[string]string) bool {
 }
 
 // Determine a status for the service by looking at the rollout status
-// for the deployment or replication controller.
+// for the pod controller.
 func (p podController) status() string {
 	switch {
 	case p.Deployment != nil:
@@ -325,10 +390,20 @@ func (p podController) status() string {
 		if status.ObservedGeneration >= meta.Generation {
 			// the definition has been updated; now let's see about the replicas
 			updated, wanted := status.UpdatedReplicas, *p.Deployment.Spec.Replicas
-			if updated == wanted {
-				return StatusReady
+			if updated < wanted {
+				return fmt.Sprintf("%d out of %d updated", updated, wanted)
+			}
+			// All the pods have been updated; but they may not
+			// have come up (e.g., if they are crash-looping), and
+			// the old pods may not all have gone yet.
+			available := status.AvailableReplicas
+			if available < wanted {
+				return fmt.Sprintf("%d out of %d available", available, wanted)
+			}
+			if status.Replicas > wanted {
+				return fmt.Sprintf("%d old replicas terminating", status.Replicas-wanted)
 			}
-			return fmt.Sprintf("%d out of %d updated", updated, wanted)
+			return StatusReady
 		}
 		return StatusUpdating
 	case p.ReplicationController != nil:
@@ -345,6 +420,12 @@ func (p podController) status() string {
 			return fmt.Sprintf("%d out of %d ready", ready, total)
 		}
 		return StatusUpdating
+	case p.DaemonSet != nil:
+		return p.DaemonSet.status()
+	case p.StatefulSet != nil:
+		return p.StatefulSet.status()
+	case p.CronJob != nil:
+		return p.CronJob.status()
 	}
 	return StatusUnknown
 }
@@ -380,6 +461,7 @@ func (c *Cluster) Sync(spec platform.SyncDef) error {
 		}
 		if len(errs) > 0 {
 			errc <- errs
+			return
 		}
 		errc <- nil
 	}
@@ -462,6 +544,35 @@ func (c *Cluster) Export() ([]byte, error) {
 			}
 		}
 
+		for _, kind := range []workloadKind{daemonSetKind, statefulSetKind, cronJobKind} {
+			items, err := c.workloads.list(kind, ns.Name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "getting %s", kind.Resource)
+			}
+			for _, item := range items {
+				var object struct {
+					v1.ObjectMeta `json:"metadata"`
+				}
+				if err := json.Unmarshal(item, &object); err != nil {
+					return nil, errors.Wrapf(err, "decoding %s", kind.Resource)
+				}
+				if isAddon(&object) {
+					continue
+				}
+				// Keep the whole of the definition, including any
+				// fields we don't know about
+				var definition map[string]interface{}
+				if err := json.Unmarshal(item, &definition); err != nil {
+					return nil, errors.Wrapf(err, "decoding %s", kind.Resource)
+				}
+				delete(definition, "apiVersion")
+				delete(definition, "kind")
+				if err := appendYAML(&config, kind.APIVersion, kind.Kind, definition); err != nil {
+					return nil, errors.Wrapf(err, "marshalling %s to YAML", kind.Kind)
+				}
+			}
+		}
+
 		services, err := c.client.Services(ns.Name).List(api.ListOptions{})
 		if err != nil {
 			return nil, errors.Wrap(err, "getting services")
@@ -5,170 +5,345 @@ import (
 	"fmt"
 	"io"
 	"regexp"
+	"sort"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 
 	"github.com/weaveworks/flux"
 )
 
-// UpdatePodController takes the body of a ReplicationController or Deployment
-// resource definition (specified in YAML) and the name of the new image that
-// should be put in the definition (in the format "repo.org/group/name:tag"). It
-// returns a new resource definition body where all references to the old image
-// have been replaced with the new one.
-//
-// This function has many additional requirements that are likely in flux. Read
-// the source to learn about them.
-func UpdatePodController(def []byte, newImageID flux.ImageID, trace io.Writer) ([]byte, error) {
-	// Sanity check
-	obj, err := definitionObj(def)
-	if err != nil {
-		return nil, err
-	}
-	switch obj.Kind {
-	case "ReplicationController":
-		return nil, ErrReplicationControllersDeprecated
-	case "Deployment":
-		break
-	default:
-		return nil, UpdateNotSupportedError(obj.Kind)
+// ManifestChange is a single edit made to a manifest file.
+type ManifestChange struct {
+	// The kind and name of the resource changed
+	Kind string
+	Name string
+	// The path to the value changed, e.g.,
+	// `spec.template.spec.containers[0].image`
+	Path string
+	// The line the value is on, counting from 1
+	Line     int
+	Old, New string
+}
+
+func (c ManifestChange) String() string {
+	return fmt.Sprintf("%s %s %s (line %d): %s -> %s", c.Kind, c.Name, c.Path, c.Line, c.Old, c.New)
+}
+
+// ManifestDiff is the list of edits made to a manifest file.
+type ManifestDiff []ManifestChange
+
+func (d ManifestDiff) String() string {
+	var changes []string
+	for _, c := range d {
+		changes = append(changes, c.String())
 	}
+	return strings.Join(changes, "; ")
+}
 
-	var buf bytes.Buffer
-	err = tryUpdate(string(def), newImageID, trace, &buf)
-	return buf.Bytes(), err
+// Where to find the pod template in each kind of resource we can
+// update.
+var podTemplatePaths = map[string][]string{
+	"Deployment":  {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
 }
 
-// Attempt to update an RC or Deployment config. This makes several assumptions
-// that are justified only with the phrase "because that's how we do it",
-// including:
-//
-//  * the file is a replication controller or deployment
-//  * the update is from one tag of an image to another tag of the
-//    same image; e.g., "weaveworks/helloworld:a00001" to
-//    "weaveworks/helloworld:a00002"
-//  * the container spec to update is the (first) one that uses the
-//    same image name (e.g., weaveworks/helloworld)
-//  * the name of the controller is updated to reflect the new tag
-//  * there's a label which must be updated in both the pod spec and the selector
-//  * the file uses canonical YAML syntax, that is, one line per item
-//  * ... other assumptions as encoded in the regular expressions used
-//
-// Here's an example of the assumed structure:
+// UpdatePodController takes a file of resource definitions (in YAML,
+// possibly with several documents), the kind and name of the pod
+// controller to update, and the new image that should be used (in the
+// format "repo.org/group/name:tag"). It returns the file with every
+// container (and init container) of that controller using the same
+// image repository changed to use the new image, along with a record
+// of what was changed. Anything else in the file is left alone, even
+// if it uses the same image.
 //
-// ```
-// apiVersion: v1
-// kind: ReplicationController # not presently checked
-// metadata:                         # )
-//   ...                             # ) any number of equally-indented lines
-//   name: helloworld-master-a000001 # ) can precede the name
-// spec:
-//   replicas: 2
-//   selector:                 # )
-//     name: helloworld        # ) this use of labels is assumed
-//     version: master-a000001 # )
-//   template:
-//     metadata:
-//       labels:                   # )
-//         name: helloworld        # ) this structure is assumed, as for the selector
-//         version: master-a000001 # )
-//     spec:
-//       containers:
-//       # extra container specs are allowed here ...
-//       - name: helloworld                                    # )
-//         image: quay.io/weaveworks/helloworld:master-a000001 # ) these must be together
-//         args:
-//         - -msg=Ahoy
-//         ports:
-//         - containerPort: 80
-// ```
-func tryUpdate(def string, newImage flux.ImageID, trace io.Writer, out io.Writer) error {
-	nameRE := multilineRE(
-		`metadata:\s*`,
-		`(?:  .*\n)*  name:\s*"?([\w-]+)"?\s*`,
-	)
-	matches := nameRE.FindStringSubmatch(def)
-	if matches == nil || len(matches) < 2 {
-		return fmt.Errorf("Could not find resource name")
+// The file is parsed to find the values to change, but those values
+// are changed in place, so everything else, including comments and
+// formatting, is left as it was. In keeping with how we have tended
+// to name things, if the name of the resource ends with the old tag,
+// it's changed to end with the new tag; and so is any `version` label
+// in the pod template or selector.
+func UpdatePodController(def []byte, kind, name string, newImageID flux.ImageID) ([]byte, ManifestDiff, error) {
+	docs, err := parseDocuments(def)
+	if err != nil {
+		return nil, nil, err
 	}
-	oldDefName := matches[1]
-	fmt.Fprintf(trace, "Found resource name %q in fragment:\n\n%s\n\n", oldDefName, matches[0])
 
-	imageRE := multilineRE(
-		`      containers:.*`,
-		`(?:      .*\n)*(?:  ){3,4}- name:\s*"?([\w-]+)"?(?:\s.*)?`,
-		`(?:  ){4,5}image:\s*"?(`+newImage.Repository()+`(:[\w][\w.-]{0,127})?)"?(\s.*)?`,
+	var (
+		edits      []edit
+		diff       ManifestDiff
+		matched    bool
+		found      bool
+		repository = newImageID.Repository()
 	)
-	// tag part of regexp from
-	// https://github.com/docker/distribution/blob/master/reference/regexp.go#L36
+	for _, doc := range docs {
+		if scalarAt(doc, "kind") != kind || scalarAt(doc, "metadata", "name") != name {
+			continue
+		}
+		matched = true
+		if kind == "ReplicationController" {
+			return nil, nil, ErrReplicationControllersDeprecated
+		}
+		templatePath, ok := podTemplatePaths[kind]
+		if !ok {
+			return nil, nil, UpdateNotSupportedError(kind)
+		}
+
+		u := docUpdater{
+			kind: kind,
+			name: name,
+		}
+		template := nodeAt(doc, templatePath...)
+		podSpecPath := append(append([]string{}, templatePath...), "spec")
+		for _, field := range []string{"initContainers", "containers"} {
+			containers := nodeAt(doc, append(podSpecPath, field)...)
+			if containers == nil || containers.Kind != yaml.SequenceNode {
+				continue
+			}
+			for i, container := range containers.Content {
+				image := valueNode(container, "image")
+				if image == nil || image.Kind != yaml.ScalarNode {
+					continue
+				}
+				oldImageID, err := flux.ParseImageID(image.Value)
+				if err != nil || oldImageID.Repository() != repository {
+					continue
+				}
+				found = true
+				if oldImageID == newImageID {
+					continue
+				}
+				path := fmt.Sprintf("%s.%s[%d].image", strings.Join(podSpecPath, "."), field, i)
+				u.change(path, image, newImageID.String(), false)
 
-	matches = imageRE.FindStringSubmatch(def)
-	if matches == nil || len(matches) < 3 {
-		return fmt.Errorf("Could not find image name: %s", newImage.Repository())
+				// Only a change of tag means a change of name; an image
+				// pinned by digest alone has no tag to go by.
+				_, _, oldTag := oldImageID.Components()
+				_, _, newTag := newImageID.Components()
+				if oldTag != "" && newTag != "" && oldTag != newTag {
+					u.retag(doc, template, templatePath, oldTag, newTag)
+				}
+			}
+		}
+		edits = append(edits, u.edits...)
+		diff = append(diff, u.diff...)
 	}
-	containerName := matches[1]
-	oldImage, err := flux.ParseImageID(matches[2])
+
+	if !matched {
+		return nil, nil, fmt.Errorf("Could not find %s %s", kind, name)
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("Could not find image name: %s", repository)
+	}
+	out, err := applyEdits(def, edits)
 	if err != nil {
-		return err
-	}
-	fmt.Fprintf(trace, "Found container %q using image %v in fragment:\n\n%s\n\n", containerName, oldImage, matches[0])
-
-	if oldImage.Repository() != newImage.Repository() {
-		return fmt.Errorf(`expected existing image name and new image name to match, but %q != %q`, oldImage.Repository(), newImage.Repository())
-	}
-
-	// Now to replace bits. Specifically,
-	// * the name, with a re-tagged name
-	// * the image for the container
-	// * the version label (in two places)
-	//
-	// Some values (most likely the version) will be interpreted as a
-	// number if unquoted; while, on the other hand, it is apparently
-	// not OK to quote things that don't look like numbers. So: we
-	// extract values *without* quotes, and add them if necessary.
-
-	newDefName := oldDefName
-	_, _, oldImageTag := oldImage.Components()
-	_, _, newImageTag := newImage.Components()
-	if strings.HasSuffix(oldDefName, oldImageTag) {
-		newDefName = oldDefName[:len(oldDefName)-len(oldImageTag)] + newImageTag
-	}
-
-	newDefName = maybeQuote(newDefName)
-	newTag := maybeQuote(newImageTag)
-
-	fmt.Fprintln(trace, "")
-	fmt.Fprintln(trace, "Replacing ...")
-	fmt.Fprintf(trace, "Resource name: %s -> %s\n", oldDefName, newDefName)
-	fmt.Fprintf(trace, "Version in templates (and selector if present): %s -> %s\n", oldImageTag, newTag)
-	fmt.Fprintf(trace, "Image in templates: %s -> %s\n", oldImage, newImage)
-	fmt.Fprintln(trace, "")
-
-	// The name we want is that under `metadata:`, which will be indented once
-	replaceRCNameRE := regexp.MustCompile(`(?m:^(  name:\s*) (?:"?[\w-]+"?)(\s.*)$)`)
-	withNewDefName := replaceRCNameRE.ReplaceAllString(def, fmt.Sprintf(`$1 %s$2`, newDefName))
-
-	// Replacing labels: these are in two places, the container template and the selector
-	replaceLabelsRE := multilineRE(
-		`((?:  selector|      labels):.*)`,
-		`((?:  ){2,4}name:.*)`,
-		`((?:  ){2,4}version:\s*) (?:"?[-\w]+"?)(\s.*)`,
-	)
-	replaceLabels := fmt.Sprintf("$1\n$2\n$3 %s$4", newTag)
-	withNewLabels := replaceLabelsRE.ReplaceAllString(withNewDefName, replaceLabels)
+		return nil, nil, err
+	}
+	return out, diff, nil
+}
 
-	replaceImageRE := multilineRE(
-		`((?:  ){3,4}- name:\s*`+containerName+`)`,
-		`((?:  ){4,5}image:\s*) .*`,
-	)
-	replaceImage := fmt.Sprintf("$1\n$2 %s$3", newImage.String())
-	withNewImage := replaceImageRE.ReplaceAllString(withNewLabels, replaceImage)
+// docUpdater accumulates the edits to make to one document.
+type docUpdater struct {
+	kind, name string
+	edits      []edit
+	diff       ManifestDiff
+	retagged   bool
+}
 
-	fmt.Fprint(out, withNewImage)
+func (u *docUpdater) change(path string, node *yaml.Node, value string, quoteNumbers bool) {
+	if node.Value == value {
+		return
+	}
+	u.edits = append(u.edits, edit{node: node, value: value, quoteNumbers: quoteNumbers})
+	u.diff = append(u.diff, ManifestChange{
+		Kind: u.kind,
+		Name: u.name,
+		Path: path,
+		Line: node.Line,
+		Old:  node.Value,
+		New:  value,
+	})
+}
+
+// retag changes the resource name and version labels that carry the
+// tag of the image, the first time an image in the document is
+// changed.
+func (u *docUpdater) retag(doc, template *yaml.Node, templatePath []string, oldTag, newTag string) {
+	if u.retagged {
+		return
+	}
+	u.retagged = true
+
+	if name := nodeAt(doc, "metadata", "name"); name != nil && name.Kind == yaml.ScalarNode && strings.HasSuffix(name.Value, oldTag) {
+		u.change("metadata.name", name, name.Value[:len(name.Value)-len(oldTag)]+newTag, true)
+	}
+	for _, labels := range []struct {
+		path string
+		node *yaml.Node
+	}{
+		{"spec.selector", nodeAt(doc, "spec", "selector")},
+		{"spec.selector.matchLabels", nodeAt(doc, "spec", "selector", "matchLabels")},
+		{strings.Join(templatePath, ".") + ".metadata.labels", nodeAt(template, "metadata", "labels")},
+	} {
+		if version := valueNode(labels.node, "version"); version != nil && version.Kind == yaml.ScalarNode {
+			u.change(labels.path+".version", version, newTag, true)
+		}
+	}
+}
+
+// ---
+
+func parseDocuments(def []byte) ([]*yaml.Node, error) {
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(def))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing YAML")
+		}
+		if len(doc.Content) > 0 {
+			docs = append(docs, doc.Content[0])
+		}
+	}
+}
+
+// valueNode gives the value for a key in a mapping node, or nil if
+// it's not a mapping or the key is not present.
+func valueNode(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
 	return nil
 }
 
-func multilineRE(lines ...string) *regexp.Regexp {
-	return regexp.MustCompile(`(?m:^` + strings.Join(lines, "\n") + `$)`)
+func nodeAt(node *yaml.Node, path ...string) *yaml.Node {
+	for _, key := range path {
+		node = valueNode(node, key)
+	}
+	return node
+}
+
+func scalarAt(node *yaml.Node, path ...string) string {
+	if node = nodeAt(node, path...); node != nil && node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+	return ""
+}
+
+// An edit replaces the scalar node given with a new value, in the
+// original text.
+type edit struct {
+	node  *yaml.Node
+	value string
+	// Whether to quote the value if (and only if) it would otherwise
+	// be read as a number, rather than keeping the original quoting
+	quoteNumbers bool
+}
+
+// A replacement puts text in place of def[start:end].
+type replacement struct {
+	start, end int
+	text       string
+}
+
+type byStart []replacement
+
+func (r byStart) Len() int           { return len(r) }
+func (r byStart) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byStart) Less(i, j int) bool { return r[i].start < r[j].start }
+
+func applyEdits(def []byte, edits []edit) ([]byte, error) {
+	// Where each line starts
+	lines := []int{0}
+	for i, b := range def {
+		if b == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+
+	var replacements []replacement
+	for _, e := range edits {
+		if e.node.Line < 1 || e.node.Line > len(lines) {
+			return nil, fmt.Errorf("value %q is at line %d, outside the file", e.node.Value, e.node.Line)
+		}
+		start := lines[e.node.Line-1]
+		for col := 1; col < e.node.Column && start < len(def); col++ {
+			_, size := utf8.DecodeRune(def[start:])
+			start += size
+		}
+		end, err := scalarEnd(def, start, e.node)
+		if err != nil {
+			return nil, err
+		}
+		text := e.value
+		switch {
+		case e.quoteNumbers:
+			text = maybeQuote(text)
+		case e.node.Style == yaml.DoubleQuotedStyle:
+			text = `"` + text + `"`
+		case e.node.Style == yaml.SingleQuotedStyle:
+			text = `'` + text + `'`
+		}
+		replacements = append(replacements, replacement{start, end, text})
+	}
+
+	// Splice the replacements in, from the end backwards so the
+	// offsets stay correct
+	sort.Sort(byStart(replacements))
+	out := append([]byte{}, def...)
+	for i := len(replacements) - 1; i >= 0; i-- {
+		r := replacements[i]
+		out = append(out[:r.start], append([]byte(r.text), out[r.end:]...)...)
+	}
+	return out, nil
+}
+
+// scalarEnd finds where the scalar starting at start ends, so long as
+// it's written on a single line.
+func scalarEnd(def []byte, start int, node *yaml.Node) (int, error) {
+	rest := def[start:]
+	if i := bytes.IndexByte(rest, '\n'); i > -1 {
+		rest = rest[:i]
+	}
+	switch node.Style {
+	case yaml.DoubleQuotedStyle:
+		for i := 1; i < len(rest); i++ {
+			switch rest[i] {
+			case '\\':
+				i++
+			case '"':
+				return start + i + 1, nil
+			}
+		}
+	case yaml.SingleQuotedStyle:
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\'' {
+				if i+1 < len(rest) && rest[i+1] == '\'' {
+					i++
+					continue
+				}
+				return start + i + 1, nil
+			}
+		}
+	case 0, yaml.TaggedStyle:
+		if bytes.HasPrefix(rest, []byte(node.Value)) {
+			return start + len(node.Value), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot update value %q at line %d, as it is not written on a single line", node.Value, node.Line)
 }
 
 var looksLikeNumber *regexp.Regexp = regexp.MustCompile("^(" + strings.Join([]string{
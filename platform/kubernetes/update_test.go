@@ -1,42 +1,93 @@
 package kubernetes
 
 import (
-	"bytes"
-	"fmt"
-	"os"
 	"testing"
 
 	"github.com/weaveworks/flux"
 )
 
-func testUpdate(t *testing.T, name, caseIn, updatedImage, caseOut string) {
+func testUpdate(t *testing.T, name, caseIn, kind, resource, updatedImage, caseOut string) ManifestDiff {
 	id, err := flux.ParseImageID(updatedImage)
 	if err != nil {
 		t.Fatal(err)
 	}
-	var trace, out bytes.Buffer
-	if err := tryUpdate(caseIn, id, &trace, &out); err != nil {
-		fmt.Fprintln(os.Stderr, "Failed:", name)
-		fmt.Fprintf(os.Stderr, "--- TRACE ---\n"+trace.String()+"\n---\n")
-		t.Fatal(err)
+	out, diff, err := UpdatePodController([]byte(caseIn), kind, resource, id)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
 	}
-	if string(out.Bytes()) != caseOut {
-		fmt.Fprintln(os.Stderr, "Failed:", name)
-		fmt.Fprintf(os.Stderr, "--- TRACE ---\n"+trace.String()+"\n---\n")
-		t.Fatalf("Did not get expected result:\n\n%s\n\nInstead got:\n\n%s", caseOut, string(out.Bytes()))
+	if string(out) != caseOut {
+		t.Fatalf("%s: did not get expected result:\n\n%s\n\nInstead got:\n\n%s\n\nChanges: %s", name, caseOut, string(out), diff)
 	}
+	return diff
 }
 
 func TestUpdates(t *testing.T) {
 	for _, c := range [][]string{
-		{"common case", case1, case1image, case1out},
-		{"new version like number", case2, case2image, case2out},
-		{"old version like number", case2out, case2reverseImage, case2},
-		{"name label out of order", case3, case3image, case3out},
-		{"version (tag) with dots", case4, case4image, case4out},
-		{"minimal dockerhub image name", case5, case5image, case5out},
+		{"common case", case1, "Deployment", "pr-assigner", case1image, case1out},
+		{"new version like number", case2, "Deployment", "fluxy", case2image, case2out},
+		{"old version like number", case2out, "Deployment", "fluxy", case2reverseImage, case2},
+		{"name label out of order", case3, "Deployment", "grafana", case3image, case3out},
+		{"version (tag) with dots", case4, "Deployment", "front-end", case4image, case4out},
+		{"minimal dockerhub image name", case5, "Deployment", "nginx", case5image, case5out},
+		{"four-space indents", case6, "Deployment", "helloworld", case6image, case6out},
+		{"flow style and quoted image", case7, "Deployment", "helloworld", case7image, case7out},
+		{"multiple documents, init containers and repeated image", case8, "DaemonSet", "helloworld", case8image, case8out},
+		{"stateful set, with cron job using the same image", case9, "StatefulSet", "db", case9image, case9out},
+		{"cron job, with stateful set using the same image", case9, "CronJob", "db-backup", case9image, case9cronOut},
+		{"tag re-pushed, pinned by digest", case10, "Deployment", "fluxy-stable", case10image, case10out},
+		{"tag to digest alone", case10, "Deployment", "fluxy-stable", case11image, case11out},
 	} {
-		testUpdate(t, c[0], c[1], c[2], c[3])
+		testUpdate(t, c[0], c[1], c[2], c[3], c[4], c[5])
+	}
+}
+
+func TestUpdateDiff(t *testing.T) {
+	diff := testUpdate(t, "new version like number", case2, "Deployment", "fluxy", case2image, case2out)
+	expected := ManifestDiff{
+		{Kind: "Deployment", Name: "fluxy", Path: "spec.template.spec.containers[0].image", Line: 20, Old: "weaveworks/fluxy:master-a000001", New: "weaveworks/fluxy:1234567"},
+		{Kind: "Deployment", Name: "fluxy", Path: "spec.template.metadata.labels.version", Line: 12, Old: "master-a000001", New: "1234567"},
+	}
+	if len(diff) != len(expected) {
+		t.Fatalf("expected changes %s, got %s", expected, diff)
+	}
+	for i := range expected {
+		if diff[i] != expected[i] {
+			t.Errorf("expected change %s, got %s", expected[i], diff[i])
+		}
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	id, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000002")
+	for name, c := range map[string][]string{
+		"image not used":   {case1, "Deployment", "pr-assigner"},
+		"no such resource": {case1, "Deployment", "helloworld"},
+		"unsupported kind": {`apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+`, "Service", "helloworld"},
+		"replication controller": {`apiVersion: v1
+kind: ReplicationController
+metadata:
+  name: helloworld
+`, "ReplicationController", "helloworld"},
+		"multi-line image": {`apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: helloworld
+spec:
+  template:
+    spec:
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:
+          master-a000001
+`, "Deployment", "helloworld"},
+	} {
+		if _, _, err := UpdatePodController([]byte(c[0]), c[1], c[2], id); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
 	}
 }
 
@@ -368,3 +419,283 @@ spec:
         ports:
         - containerPort: 80
 `
+
+const case6 = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+    name: helloworld
+spec:
+    template:
+        metadata:
+            labels:
+                name: helloworld
+        spec:
+            containers:
+                -   name: helloworld
+                    # The one to update
+                    image: quay.io/weaveworks/helloworld:master-a000001
+                    args:
+                        -   -msg=Ahoy
+`
+
+const case6image = "quay.io/weaveworks/helloworld:master-a000002"
+
+const case6out = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+    name: helloworld
+spec:
+    template:
+        metadata:
+            labels:
+                name: helloworld
+        spec:
+            containers:
+                -   name: helloworld
+                    # The one to update
+                    image: quay.io/weaveworks/helloworld:master-a000002
+                    args:
+                        -   -msg=Ahoy
+`
+
+const case7 = `apiVersion: apps/v1beta1
+kind: Deployment
+metadata: {name: helloworld, labels: {name: helloworld}}
+spec:
+  template:
+    metadata: {labels: {name: helloworld, version: "1.0"}}
+    spec:
+      containers: [{name: helloworld, image: "quay.io/weaveworks/helloworld:1.0", args: [-msg=Ahoy]}, {name: sidecar, image: 'weaveworks/sidecar:master-a000001'}]
+`
+
+const case7image = "quay.io/weaveworks/helloworld:1.1"
+
+const case7out = `apiVersion: apps/v1beta1
+kind: Deployment
+metadata: {name: helloworld, labels: {name: helloworld}}
+spec:
+  template:
+    metadata: {labels: {name: helloworld, version: "1.1"}}
+    spec:
+      containers: [{name: helloworld, image: "quay.io/weaveworks/helloworld:1.1", args: [-msg=Ahoy]}, {name: sidecar, image: 'weaveworks/sidecar:master-a000001'}]
+`
+
+const case8 = `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: helloworld
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: quay.io/weaveworks/helloworld:master-a000001 # same image, different command
+        args: [migrate]
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000001
+      - name: helloworld-admin
+        image: quay.io/weaveworks/helloworld:master-a000001
+        args: [admin]
+`
+
+const case8image = "quay.io/weaveworks/helloworld:master-a000002"
+
+const case8out = `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: helloworld
+spec:
+  ports:
+  - port: 80
+---
+apiVersion: extensions/v1beta1
+kind: DaemonSet
+metadata:
+  name: helloworld
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: quay.io/weaveworks/helloworld:master-a000002 # same image, different command
+        args: [migrate]
+      containers:
+      - name: helloworld
+        image: quay.io/weaveworks/helloworld:master-a000002
+      - name: helloworld-admin
+        image: quay.io/weaveworks/helloworld:master-a000002
+        args: [admin]
+`
+
+const case9 = `apiVersion: apps/v1beta1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  serviceName: db
+  selector:
+    matchLabels:
+      name: db
+      version: "9.6"
+  template:
+    metadata:
+      labels:
+        name: db
+        version: "9.6"
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:9.6
+---
+apiVersion: batch/v2alpha1
+kind: CronJob
+metadata:
+  name: db-backup
+spec:
+  schedule: "0 3 * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: postgres:9.6 # uses pg_dump
+          restartPolicy: OnFailure
+`
+
+const case9image = "postgres:10"
+
+const case9out = `apiVersion: apps/v1beta1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  serviceName: db
+  selector:
+    matchLabels:
+      name: db
+      version: "10"
+  template:
+    metadata:
+      labels:
+        name: db
+        version: "10"
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:10
+---
+apiVersion: batch/v2alpha1
+kind: CronJob
+metadata:
+  name: db-backup
+spec:
+  schedule: "0 3 * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: postgres:9.6 # uses pg_dump
+          restartPolicy: OnFailure
+`
+
+const case9cronOut = `apiVersion: apps/v1beta1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  serviceName: db
+  selector:
+    matchLabels:
+      name: db
+      version: "9.6"
+  template:
+    metadata:
+      labels:
+        name: db
+        version: "9.6"
+    spec:
+      containers:
+      - name: postgres
+        image: postgres:9.6
+---
+apiVersion: batch/v2alpha1
+kind: CronJob
+metadata:
+  name: db-backup
+spec:
+  schedule: "0 3 * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: postgres:10 # uses pg_dump
+          restartPolicy: OnFailure
+`
+
+const case10 = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: fluxy-stable
+spec:
+  template:
+    metadata:
+      labels:
+        name: fluxy
+        version: stable
+    spec:
+      containers:
+      - name: fluxy
+        image: weaveworks/fluxy:stable@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa
+`
+
+const case10image = "weaveworks/fluxy:stable@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+
+const case10out = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: fluxy-stable
+spec:
+  template:
+    metadata:
+      labels:
+        name: fluxy
+        version: stable
+    spec:
+      containers:
+      - name: fluxy
+        image: weaveworks/fluxy:stable@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb
+`
+
+const case11image = "weaveworks/fluxy@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+
+const case11out = `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: fluxy-stable
+spec:
+  template:
+    metadata:
+      labels:
+        name: fluxy
+        version: stable
+    spec:
+      containers:
+      - name: fluxy
+        image: weaveworks/fluxy@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb
+`
@@ -0,0 +1,196 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	v1 "k8s.io/client-go/1.5/pkg/api/v1"
+	rest "k8s.io/client-go/1.5/rest"
+)
+
+// The client library we use predates StatefulSets and CronJobs (and
+// several fields of DaemonSet status that tell us how a rollout is
+// going), so we fetch those workloads from the API directly and
+// decode just the parts we need.
+
+// A kind of workload we fetch without a typed client.
+type workloadKind struct {
+	Kind       string
+	APIVersion string // e.g., "apps/v1beta1"
+	Resource   string // as used in the API path, e.g., "statefulsets"
+}
+
+var (
+	daemonSetKind   = workloadKind{"DaemonSet", "extensions/v1beta1", "daemonsets"}
+	statefulSetKind = workloadKind{"StatefulSet", "apps/v1beta1", "statefulsets"}
+	cronJobKind     = workloadKind{"CronJob", "batch/v2alpha1", "cronjobs"}
+)
+
+type daemonSet struct {
+	v1.ObjectMeta `json:"metadata"`
+	Spec          struct {
+		Template v1.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+	Status struct {
+		ObservedGeneration     *int64 `json:"observedGeneration"`
+		DesiredNumberScheduled int32  `json:"desiredNumberScheduled"`
+		NumberMisscheduled     int32  `json:"numberMisscheduled"`
+		NumberReady            *int32 `json:"numberReady"`
+		UpdatedNumberScheduled *int32 `json:"updatedNumberScheduled"`
+	} `json:"status"`
+}
+
+type statefulSet struct {
+	v1.ObjectMeta `json:"metadata"`
+	Spec          struct {
+		Replicas *int32             `json:"replicas"`
+		Template v1.PodTemplateSpec `json:"template"`
+	} `json:"spec"`
+	Status struct {
+		ObservedGeneration *int64 `json:"observedGeneration"`
+		Replicas           int32  `json:"replicas"`
+		ReadyReplicas      *int32 `json:"readyReplicas"`
+		UpdatedReplicas    *int32 `json:"updatedReplicas"`
+	} `json:"status"`
+}
+
+type cronJob struct {
+	v1.ObjectMeta `json:"metadata"`
+	Spec          struct {
+		JobTemplate struct {
+			Spec struct {
+				Template v1.PodTemplateSpec `json:"template"`
+			} `json:"spec"`
+		} `json:"jobTemplate"`
+	} `json:"spec"`
+}
+
+// workloadClient fetches lists of resources from the API server,
+// using the same configuration as the typed clients.
+type workloadClient struct {
+	client *http.Client
+	server *url.URL
+}
+
+func newWorkloadClient(config *rest.Config) (*workloadClient, error) {
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating transport for API server")
+	}
+	host := config.Host
+	if host == "" {
+		host = "localhost"
+	}
+	if !strings.Contains(host, "://") {
+		scheme := "http://"
+		if config.TLSClientConfig.CAFile != "" || len(config.TLSClientConfig.CAData) > 0 ||
+			config.TLSClientConfig.CertFile != "" || len(config.TLSClientConfig.CertData) > 0 ||
+			config.Insecure {
+			scheme = "https://"
+		}
+		host = scheme + host
+	}
+	server, err := url.Parse(host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing API server address %q", config.Host)
+	}
+	return &workloadClient{
+		client: &http.Client{Transport: transport},
+		server: server,
+	}, nil
+}
+
+// list returns the resources of the kind given in a namespace, as
+// raw JSON. If the API server doesn't serve that kind (e.g., because
+// it's an older version, or the API group is not enabled), there are
+// no resources of that kind and no error.
+func (w *workloadClient) list(kind workloadKind, namespace string) ([]json.RawMessage, error) {
+	u := *w.server
+	u.Path = path.Join(u.Path, "apis", kind.APIVersion, "namespaces", namespace, kind.Resource)
+	response, err := w.client.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "listing %s", kind.Resource)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		break
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		body, _ := ioutil.ReadAll(response.Body)
+		return nil, fmt.Errorf("listing %s: %s: %s", kind.Resource, response.Status, strings.TrimSpace(string(body)))
+	}
+
+	var list struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&list); err != nil {
+		return nil, errors.Wrapf(err, "decoding list of %s", kind.Resource)
+	}
+	return list.Items, nil
+}
+
+// --- rollout status for each kind
+
+func (d *daemonSet) status() string {
+	status := d.Status
+	if status.ObservedGeneration != nil && *status.ObservedGeneration < d.Generation {
+		return StatusUpdating
+	}
+	wanted := status.DesiredNumberScheduled
+	// Older API servers don't report these, in which case the best
+	// we can do is say whether the pods are scheduled on the right
+	// nodes.
+	if status.UpdatedNumberScheduled != nil && *status.UpdatedNumberScheduled < wanted {
+		return fmt.Sprintf("%d out of %d updated", *status.UpdatedNumberScheduled, wanted)
+	}
+	if status.NumberReady != nil && *status.NumberReady < wanted {
+		return fmt.Sprintf("%d out of %d ready", *status.NumberReady, wanted)
+	}
+	if status.NumberMisscheduled > 0 {
+		return fmt.Sprintf("%d misscheduled", status.NumberMisscheduled)
+	}
+	return StatusReady
+}
+
+func (s *statefulSet) status() string {
+	status := s.Status
+	if status.ObservedGeneration == nil || *status.ObservedGeneration < s.Generation {
+		return StatusUpdating
+	}
+	wanted := int32(1)
+	if s.Spec.Replicas != nil {
+		wanted = *s.Spec.Replicas
+	}
+	// Pods are created (and updated) one at a time, in order, so
+	// there may be fewer than wanted for a while.
+	if status.Replicas < wanted {
+		return fmt.Sprintf("%d out of %d created", status.Replicas, wanted)
+	}
+	if status.UpdatedReplicas != nil && *status.UpdatedReplicas < wanted {
+		return fmt.Sprintf("%d out of %d updated", *status.UpdatedReplicas, wanted)
+	}
+	if status.ReadyReplicas != nil && *status.ReadyReplicas < wanted {
+		return fmt.Sprintf("%d out of %d ready", *status.ReadyReplicas, wanted)
+	}
+	if status.Replicas > wanted {
+		return fmt.Sprintf("%d old replicas terminating", status.Replicas-wanted)
+	}
+	return StatusReady
+}
+
+// A CronJob doesn't roll out as such; each run creates a job with
+// the current template. So once its spec has been applied, it's as
+// ready as it will be, whether or not it's suspended or has jobs
+// running.
+func (c *cronJob) status() string {
+	return StatusReady
+}
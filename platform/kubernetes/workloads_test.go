@@ -0,0 +1,118 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rest "k8s.io/client-go/1.5/rest"
+)
+
+func TestWorkloadsList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apis/apps/v1beta1/namespaces/default/statefulsets":
+			w.Write([]byte(`{"kind": "StatefulSetList", "items": [{"metadata": {"name": "db", "namespace": "default"}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newWorkloadClient(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := client.list(statefulSetKind, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected one statefulset, got %d", len(items))
+	}
+	var ss statefulSet
+	if err := json.Unmarshal(items[0], &ss); err != nil {
+		t.Fatal(err)
+	}
+	if ss.Name != "db" {
+		t.Errorf("expected statefulset named %q, got %q", "db", ss.Name)
+	}
+
+	// Not served by this API server, so there are none
+	items, err = client.list(cronJobKind, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("expected no cronjobs, got %d", len(items))
+	}
+}
+
+func TestWorkloadStatus(t *testing.T) {
+	for _, x := range []struct {
+		def    string
+		into   interface{ status() string }
+		status string
+	}{
+		// DaemonSets
+		{`{"metadata": {"generation": 2}, "status": {"observedGeneration": 1}}`,
+			&daemonSet{}, StatusUpdating},
+		{`{"metadata": {"generation": 2}, "status": {"observedGeneration": 2, "desiredNumberScheduled": 3, "updatedNumberScheduled": 1, "numberReady": 3}}`,
+			&daemonSet{}, "1 out of 3 updated"},
+		{`{"metadata": {"generation": 2}, "status": {"observedGeneration": 2, "desiredNumberScheduled": 3, "updatedNumberScheduled": 3, "numberReady": 2}}`,
+			&daemonSet{}, "2 out of 3 ready"},
+		{`{"metadata": {"generation": 1}, "status": {"desiredNumberScheduled": 3, "numberMisscheduled": 1}}`,
+			&daemonSet{}, "1 misscheduled"},
+		{`{"metadata": {"generation": 1}, "status": {"desiredNumberScheduled": 3}}`,
+			&daemonSet{}, StatusReady},
+		// StatefulSets
+		{`{"metadata": {"generation": 2}, "spec": {"replicas": 3}, "status": {"observedGeneration": 1, "replicas": 3}}`,
+			&statefulSet{}, StatusUpdating},
+		{`{"metadata": {"generation": 1}, "spec": {"replicas": 3}, "status": {"observedGeneration": 1, "replicas": 1}}`,
+			&statefulSet{}, "1 out of 3 created"},
+		{`{"metadata": {"generation": 1}, "spec": {"replicas": 3}, "status": {"observedGeneration": 1, "replicas": 3, "readyReplicas": 2}}`,
+			&statefulSet{}, "2 out of 3 ready"},
+		{`{"metadata": {"generation": 1}, "status": {"observedGeneration": 1, "replicas": 1}}`,
+			&statefulSet{}, StatusReady},
+		// CronJobs are ready once applied, whatever they're doing
+		{`{"spec": {"suspend": true}}`,
+			&cronJob{}, StatusReady},
+		{`{"status": {"active": [{"name": "job-1"}, {"name": "job-2"}]}}`,
+			&cronJob{}, StatusReady},
+		{`{"status": {}}`,
+			&cronJob{}, StatusReady},
+	} {
+		if err := json.Unmarshal([]byte(x.def), x.into); err != nil {
+			t.Fatal(err)
+		}
+		if got := x.into.status(); got != x.status {
+			t.Errorf("%T %s: expected status %q, got %q", x.into, x.def, x.status, got)
+		}
+	}
+}
+
+func TestPodControllerTemplates(t *testing.T) {
+	var cj cronJob
+	if err := json.Unmarshal([]byte(`{
+  "metadata": {"name": "backup"},
+  "spec": {"jobTemplate": {"spec": {"template": {
+    "metadata": {"labels": {"name": "backup"}},
+    "spec": {"containers": [{"name": "backup", "image": "quay.io/weaveworks/backup:v1"}]}
+  }}}}
+}`), &cj); err != nil {
+		t.Fatal(err)
+	}
+	pc := podController{CronJob: &cj}
+	if status := pc.status(); status != StatusReady {
+		t.Errorf("expected cronjob to be ready once applied, got %q", status)
+	}
+	if !pc.matchedBy(map[string]string{"name": "backup"}) {
+		t.Errorf("expected cronjob to be matched by its pod template labels")
+	}
+	containers := pc.templateContainers()
+	if len(containers) != 1 || containers[0].Image != "quay.io/weaveworks/backup:v1" {
+		t.Errorf("unexpected containers %#v", containers)
+	}
+}
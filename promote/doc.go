@@ -0,0 +1,8 @@
+// Package promote carries releases from one instance to another,
+// e.g., from staging to production. An instance's config lists the
+// instances its releases are promoted to; after each successful
+// release, a promote job is queued for each of those (waiting for the
+// soak time, if one is given), which queues releases of the same
+// images in the instance promoted to. Promotions are only made to
+// instances that accept them from the instance promoting.
+package promote
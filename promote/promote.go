@@ -0,0 +1,367 @@
+package promote
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+var ErrNoPromotionEdge = flux.UserConfigProblem{&flux.BaseError{
+	Help: `There is no promotion to the instance given.
+
+Promotions are declared in the "promotion" section of the config of
+the instance promoted from, by listing the instances to promote to
+under "to". Each is given by its instance ID, and can be referred to
+by that or by the name given to it.
+`,
+	Err: errors.New("no promotion to that instance"),
+}}
+
+var ErrPromotionNotAccepted = flux.UserConfigProblem{&flux.BaseError{
+	Help: `The instance promoted to does not accept promotions from this one.
+
+As a safeguard, an instance must list the IDs of the instances it
+accepts promotions from, under "acceptFrom" in the "promotion" section
+of its config.
+`,
+	Err: errors.New("promotion not accepted"),
+}}
+
+var ErrNotSoaked = flux.UserConfigProblem{&flux.BaseError{
+	Help: `The release has not been in place for long enough to promote it.
+
+The promotion has a soak time, given as "soakTime" in the promotion
+config; releases are promoted only once they have been in place for
+that long. Try again later.
+`,
+	Err: errors.New("release has not soaked for long enough"),
+}}
+
+var ErrNotReady = flux.UserConfigProblem{&flux.BaseError{
+	Help: `Not all the released services are ready.
+
+The promotion requires that the services updated by the release are
+ready in the instance promoted from ("requireReady" in the promotion
+config). Check on the services with
+
+    fluxctl list-services
+
+and try again once they are ready.
+`,
+	Err: errors.New("released services are not ready"),
+}}
+
+var ErrNothingToPromote = flux.Missing{&flux.BaseError{
+	Help: `There is no release to promote.
+
+Only a successful release can be promoted, and none was found in the
+history of the instance promoted from.
+`,
+	Err: errors.New("no successful release found"),
+}}
+
+// How many events to look through at a time, when looking for the
+// release to promote.
+const historyPageSize = 100
+
+// Promoter handles promote jobs, and promotes releases on demand.
+type Promoter struct {
+	cfg Config
+}
+
+// New creates a new promoter.
+func New(cfg Config) (*Promoter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Promoter{
+		cfg: cfg,
+	}, nil
+}
+
+// Params gives the parameters for promoting the release given,
+// following the promotion edge to the instance named. Only the
+// services the release succeeded in updating are promoted.
+func Params(inst flux.InstanceID, to string, release flux.Release, cause flux.ReleaseCause) jobs.PromoteJobParams {
+	params := jobs.PromoteJobParams{
+		InstanceID: inst,
+		To:         to,
+		Release:    release.ID,
+		ReleasedAt: release.EndedAt,
+		Cause:      cause,
+	}
+	images := map[string]flux.ImageID{}
+	for id, result := range release.Result {
+		if result.Status != flux.ReleaseStatusSuccess {
+			continue
+		}
+		params.Services = append(params.Services, id)
+		for _, update := range result.PerContainer {
+			images[update.Target.String()] = update.Target
+		}
+	}
+	sort.Sort(serviceIDs(params.Services))
+	var names []string
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params.Images = append(params.Images, images[name])
+	}
+	return params
+}
+
+// LatestRelease finds the most recent successful release in the
+// history given, so it can be promoted on demand.
+func LatestRelease(events history.EventReader) (flux.Release, error) {
+	before := time.Now().UTC()
+	for {
+		page, err := events.AllEvents(before, historyPageSize)
+		if err != nil {
+			return flux.Release{}, errors.Wrap(err, "fetching history")
+		}
+		for _, event := range page {
+			if event.Type != flux.EventRelease {
+				continue
+			}
+			metadata, ok := event.Metadata.(flux.ReleaseEventMetadata)
+			if !ok {
+				continue
+			}
+			release := metadata.Release
+			if release.Status == flux.ReleaseStatusSuccess && release.Spec.Kind == flux.ReleaseKindExecute {
+				return release, nil
+			}
+		}
+		if len(page) < historyPageSize {
+			return flux.Release{}, ErrNothingToPromote
+		}
+		before = page[len(page)-1].StartedAt
+	}
+}
+
+// Jobs gives the promote jobs to follow a successful release in the
+// instance given: one for each promotion edge that isn't manual,
+// scheduled for when the release has soaked. Edges with a soak time
+// that can't be parsed are left out, and reported in the error
+// returned alongside the jobs for the rest.
+func Jobs(inst flux.InstanceID, conf flux.PromotionConfig, release flux.Release) ([]jobs.Job, error) {
+	var (
+		promotions []jobs.Job
+		bad        []string
+	)
+	for _, edge := range conf.To {
+		if edge.Manual {
+			continue
+		}
+		soak, err := edge.Soak()
+		if err != nil {
+			bad = append(bad, fmt.Sprintf("parsing soak time for promotion to %s: %s", edge.Instance, err))
+			continue
+		}
+		cause := flux.ReleaseCause{
+			User:    flux.UserPromoted,
+			Message: release.Cause.Message,
+		}
+		promotions = append(promotions, jobs.Job{
+			Queue:       jobs.PromoteJob,
+			Method:      jobs.PromoteJob,
+			Priority:    jobs.PriorityBackground,
+			ScheduledAt: release.EndedAt.Add(soak),
+			Key: strings.Join([]string{
+				jobs.PromoteJob,
+				string(inst),
+				string(release.ID),
+				string(edge.Instance),
+			}, "|"),
+			Params: Params(inst, string(edge.Instance), release, cause),
+		})
+	}
+	if len(bad) > 0 {
+		return promotions, errors.New(strings.Join(bad, "; "))
+	}
+	return promotions, nil
+}
+
+func (p *Promoter) Handle(_ context.Context, job *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
+	switch job.Method {
+	case jobs.PromoteJob:
+		logStatus := func(format string, args ...interface{}) {
+			status := fmt.Sprintf(format, args...)
+			job.Status = status
+			job.Log = append(job.Log, status)
+			updater.UpdateJob(*job)
+		}
+		params := job.Params.(jobs.PromoteJobParams)
+		_, err := p.Promote(params, job.Priority, logStatus)
+		if err != nil {
+			p.logFailure(params, err)
+		}
+		return nil, err
+	default:
+		return nil, jobs.ErrUnknownJobMethod
+	}
+}
+
+// Promote checks that the promotion described can go ahead, queues a
+// release of each image in the instance promoted to, and records the
+// promotion in the history of the instance promoted from. It returns
+// the IDs of the releases queued.
+func (p *Promoter) Promote(params jobs.PromoteJobParams, priority int, logStatus func(string, ...interface{})) ([]jobs.JobID, error) {
+	inst, err := p.cfg.Instancer.Get(params.InstanceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance")
+	}
+	conf, err := inst.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+	edge, ok := conf.Settings.Promotion.Edge(params.To)
+	if !ok {
+		return nil, errors.Wrapf(ErrNoPromotionEdge, "promoting to %s", params.To)
+	}
+	target, err := p.cfg.InstanceDB.GetConfig(edge.Instance)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting config of instance promoted to")
+	}
+	if !target.Settings.Promotion.Accepts(params.InstanceID) {
+		return nil, errors.Wrapf(ErrPromotionNotAccepted, "promoting to %s", edge.Instance)
+	}
+
+	soak, err := edge.Soak()
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing soak time")
+	}
+	if soaked := time.Since(params.ReleasedAt); soaked < soak {
+		return nil, errors.Wrapf(ErrNotSoaked, "release %s has been in place for %s of %s", params.Release, soaked, soak)
+	}
+
+	if len(params.Images) == 0 {
+		logStatus("Release %s updated no images; nothing to promote.", params.Release)
+		return nil, nil
+	}
+
+	if edge.RequireReady && len(params.Services) > 0 {
+		logStatus("Checking released services are ready.")
+		services, err := inst.GetServices(params.Services)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting released services")
+		}
+		var notReady []string
+		for _, service := range services {
+			if service.Status != kubernetes.StatusReady {
+				notReady = append(notReady, string(service.ID))
+			}
+		}
+		if len(notReady) > 0 {
+			return nil, errors.Wrapf(ErrNotReady, "services %s", strings.Join(notReady, ", "))
+		}
+	}
+
+	from := &flux.PromotionLink{
+		Instance: params.InstanceID,
+		Name:     conf.Settings.Promotion.Name,
+		Release:  params.Release,
+	}
+	toName := edge.Name
+	if toName == "" {
+		toName = string(edge.Instance)
+	}
+	message := fmt.Sprintf("promoted from %s", from)
+	if params.Cause.Message != "" {
+		message = params.Cause.Message + "; " + message
+	}
+
+	var ids []jobs.JobID
+	var releases []flux.ReleaseID
+	for _, image := range params.Images {
+		id, err := p.cfg.Jobs.PutJob(edge.Instance, jobs.Job{
+			Queue:    jobs.ReleaseJob,
+			Method:   jobs.ReleaseJob,
+			Priority: priority,
+			Params: jobs.ReleaseJobParams{
+				ReleaseSpec: flux.ReleaseSpec{
+					ServiceSpecs: []flux.ServiceSpec{flux.ServiceSpecAll},
+					ImageSpec:    flux.ImageSpecFromID(image),
+					Kind:         flux.ReleaseKindExecute,
+				},
+				Cause: flux.ReleaseCause{
+					User:         params.Cause.User,
+					Message:      message,
+					PromotedFrom: from,
+				},
+			},
+		})
+		if err != nil {
+			return ids, errors.Wrapf(err, "queueing release of %s to %s", image, toName)
+		}
+		logStatus("Queued release %s of %s in %s.", id, image, toName)
+		ids = append(ids, id)
+		releases = append(releases, flux.ReleaseID(id))
+	}
+
+	now := time.Now().UTC()
+	err = inst.LogEvent(flux.Event{
+		ServiceIDs: params.Services,
+		Type:       flux.EventPromote,
+		StartedAt:  now,
+		EndedAt:    now,
+		LogLevel:   flux.LogLevelInfo,
+		Metadata: flux.PromoteEventMetadata{
+			Release:  params.Release,
+			To:       edge.Instance,
+			ToName:   edge.Name,
+			Images:   params.Images,
+			Releases: releases,
+		},
+	})
+	if err != nil {
+		log.NewContext(p.cfg.Logger).With("instanceID", params.InstanceID).Log("err", errors.Wrap(err, "logging promotion event"))
+	}
+	return ids, nil
+}
+
+// logFailure records a promotion that didn't go ahead in the history
+// of the instance promoting, since otherwise it would go unnoticed.
+func (p *Promoter) logFailure(params jobs.PromoteJobParams, promoteErr error) {
+	logger := log.NewContext(p.cfg.Logger).With("instanceID", params.InstanceID)
+	inst, err := p.cfg.Instancer.Get(params.InstanceID)
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "getting instance"))
+		return
+	}
+	now := time.Now().UTC()
+	err = inst.LogEvent(flux.Event{
+		ServiceIDs: params.Services,
+		Type:       flux.EventPromote,
+		StartedAt:  now,
+		EndedAt:    now,
+		LogLevel:   flux.LogLevelError,
+		Metadata: flux.PromoteEventMetadata{
+			Release: params.Release,
+			To:      flux.InstanceID(params.To),
+			Images:  params.Images,
+			Error:   promoteErr.Error(),
+		},
+	})
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "logging promotion event"))
+	}
+}
+
+type serviceIDs []flux.ServiceID
+
+func (s serviceIDs) Len() int           { return len(s) }
+func (s serviceIDs) Less(i, j int) bool { return s[i] < s[j] }
+func (s serviceIDs) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,122 @@
+package promote
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/jobs"
+)
+
+func mustParseImageID(t *testing.T, s string) flux.ImageID {
+	id, err := flux.ParseImageID(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestParams(t *testing.T) {
+	frontend := mustParseImageID(t, "quay.io/weaveworks/frontend:v2")
+	sidecar := mustParseImageID(t, "quay.io/weaveworks/sidecar:v5")
+	release := flux.Release{
+		ID:      "release-1",
+		EndedAt: time.Now().UTC(),
+		Result: flux.ReleaseResult{
+			"web/frontend": {
+				Status: flux.ReleaseStatusSuccess,
+				PerContainer: []flux.ContainerUpdate{
+					{Container: "frontend", Target: frontend},
+					{Container: "sidecar", Target: sidecar},
+				},
+			},
+			"web/admin": {
+				Status: flux.ReleaseStatusSuccess,
+				PerContainer: []flux.ContainerUpdate{
+					{Container: "sidecar", Target: sidecar},
+				},
+			},
+			"web/broken": {
+				Status: flux.ReleaseStatusFailed,
+				PerContainer: []flux.ContainerUpdate{
+					{Container: "broken", Target: mustParseImageID(t, "quay.io/weaveworks/broken:v1")},
+				},
+			},
+			"web/other": {
+				Status: flux.ReleaseStatusIgnored,
+			},
+		},
+	}
+
+	params := Params("staging-id", "production", release, flux.ReleaseCause{User: "alice"})
+	expected := jobs.PromoteJobParams{
+		InstanceID: "staging-id",
+		To:         "production",
+		Release:    "release-1",
+		ReleasedAt: release.EndedAt,
+		Images:     []flux.ImageID{frontend, sidecar},
+		Services:   []flux.ServiceID{"web/admin", "web/frontend"},
+		Cause:      flux.ReleaseCause{User: "alice"},
+	}
+	if !reflect.DeepEqual(expected, params) {
+		t.Errorf("expected:\n%#v\ngot:\n%#v", expected, params)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	release := flux.Release{
+		ID:      "release-1",
+		EndedAt: time.Now().UTC(),
+		Cause:   flux.ReleaseCause{User: "alice", Message: "fix the thing"},
+	}
+	conf := flux.PromotionConfig{
+		To: []flux.PromotionEdge{
+			{Instance: "prod-id", Name: "production", SoakTime: "1h"},
+			{Instance: "dr-id", Manual: true},
+			{Instance: "qa-id"},
+		},
+	}
+
+	promotions, err := Jobs("staging-id", conf, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promotions) != 2 {
+		t.Fatalf("expected two promotions (the manual one is left out), got %d", len(promotions))
+	}
+	for i, x := range []struct {
+		to          string
+		scheduledAt time.Time
+	}{
+		{"prod-id", release.EndedAt.Add(time.Hour)},
+		{"qa-id", release.EndedAt},
+	} {
+		job := promotions[i]
+		if job.Method != jobs.PromoteJob {
+			t.Errorf("%d: expected a promote job, got %q", i, job.Method)
+		}
+		if !job.ScheduledAt.Equal(x.scheduledAt) {
+			t.Errorf("%d: expected job to be scheduled at %s, got %s", i, x.scheduledAt, job.ScheduledAt)
+		}
+		params := job.Params.(jobs.PromoteJobParams)
+		if params.To != x.to {
+			t.Errorf("%d: expected promotion to %s, got %s", i, x.to, params.To)
+		}
+		// Automatic promotions are not attributed to the user making
+		// the release, so they still need approval where required
+		if params.Cause.User != flux.UserPromoted {
+			t.Errorf("%d: expected promotion to be by %s, got %s", i, flux.UserPromoted, params.Cause.User)
+		}
+	}
+
+	// A bad soak time leaves out that promotion, but not the others
+	conf.To[0].SoakTime = "a while"
+	promotions, err = Jobs("staging-id", conf, release)
+	if err == nil {
+		t.Error("expected error from bad soak time")
+	}
+	if len(promotions) != 1 || promotions[0].Params.(jobs.PromoteJobParams).To != "qa-id" {
+		t.Errorf("expected only the promotion to qa-id, got %+v", promotions)
+	}
+}
@@ -2,95 +2,269 @@ package registry
 
 import (
 	"encoding/json"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/bradfitz/gomemcache/memcache"
-	"github.com/docker/distribution/manifest/schema1"
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 )
 
+// The versions of the cached formats, used in cache keys.
+const (
+	manifestCacheVersion = "registrymanifestv3"
+	tagsCacheVersion     = "registrytagsv1"
+)
+
+const (
+	// How long to remember that a tag doesn't exist; not long, since
+	// it's probably about to be pushed.
+	missingManifestExpiry = 5 * time.Minute
+	// How long a listing of tags is used before asking the registry
+	// whether it's changed.
+	tagsFreshFor = time.Minute
+)
+
+// A Cache is made for each request to a registry (see
+// remoteClientFactory), so what's only looked up once per request,
+// like the generation of a repository's entries, is kept in it.
 type Cache struct {
-	next   dockerRegistryInterface
-	creds  Credentials
-	expiry time.Duration
-	Client MemcacheClient
-	logger log.Logger
+	next    dockerRegistryInterface
+	creds   Credentials
+	expiry  time.Duration
+	Backend CacheBackend
+	logger  log.Logger
+
+	mu          sync.Mutex
+	generations map[string]string
+}
+
+// What's kept for a manifest: either the image info, or a note that
+// the registry doesn't have it.
+type cachedManifest struct {
+	Info    ImageInfo `json:"info"`
+	Missing bool      `json:"missing,omitempty"`
+}
+
+// What's kept for a listing of tags, along with what we need to ask
+// the registry if it's changed.
+type cachedTags struct {
+	Tags      []string  `json:"tags"`
+	ETag      string    `json:"etag,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
 }
 
 type CachedDockerRegistry func(dockerRegistryInterface) dockerRegistryInterface
 
-func NewCache(creds Credentials, cache MemcacheClient, expiry time.Duration, logger log.Logger) CachedDockerRegistry {
+func NewCache(creds Credentials, backend CacheBackend, expiry time.Duration, logger log.Logger) CachedDockerRegistry {
 	return func(next dockerRegistryInterface) dockerRegistryInterface {
 		return &Cache{
-			next:   next,
-			creds:  creds,
-			expiry: expiry,
-			Client: cache,
-			logger: logger,
+			next:    next,
+			creds:   creds,
+			expiry:  expiry,
+			Backend: backend,
+			logger:  logger,
+
+			generations: map[string]string{},
 		}
 	}
 }
 
-func (c *Cache) Manifest(repository, reference string) ([]schema1.History, error) {
+func (c *Cache) Manifest(repository, reference string) (ImageInfo, error) {
 	// Don't cache latest. There are probably some other frequently changing tags
 	// we shouldn't cache here as well.
 	if reference == "latest" {
 		return c.next.Manifest(repository, reference)
 	}
-	repo, err := ParseRepository(repository)
+	key, err := c.key(manifestCacheVersion, repository, reference)
 	if err != nil {
-		return []schema1.History{}, err
+		return ImageInfo{}, err
 	}
-	creds := c.creds.credsFor(repo.Host())
 
 	// Try the cache
-	key := strings.Join([]string{
-		"registryhistoryv1", // Just to version in case we need to change format later.
+	var cached cachedManifest
+	if c.get(key, &cached) {
+		if cached.Missing {
+			return ImageInfo{}, NotFoundError{
+				URL:    repository + "/manifests/" + reference,
+				Status: "404 Not Found (cached)",
+			}
+		}
+		return cached.Info, nil
+	}
+
+	// fall back to the backend
+	return c.fetchManifest(key, repository, reference)
+}
+
+// FreshManifest asks the registry for the manifest, whatever is
+// cached, and caches what it gets. It's for when what a tag points at
+// must be up to date; e.g., when releasing an image by its tag.
+func (c *Cache) FreshManifest(repository, reference string) (ImageInfo, error) {
+	if reference == "latest" {
+		return c.next.Manifest(repository, reference)
+	}
+	key, err := c.key(manifestCacheVersion, repository, reference)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	return c.fetchManifest(key, repository, reference)
+}
+
+// fetchManifest gets the manifest from the registry, and caches it,
+// or that it's missing, under the key given.
+func (c *Cache) fetchManifest(key, repository, reference string) (ImageInfo, error) {
+	info, err := c.next.Manifest(repository, reference)
+	switch {
+	case err == nil:
+		c.set(key, cachedManifest{Info: info}, c.expiry)
+	case IsNotFound(err):
+		expiry := missingManifestExpiry
+		if c.expiry < expiry {
+			expiry = c.expiry
+		}
+		c.set(key, cachedManifest{Missing: true}, expiry)
+	}
+	return info, err
+}
+
+// Tags lists the tags in a repository. A listing is used for a short
+// while, and after that, if the registry supports it, we ask whether
+// it's changed rather than fetching it all again.
+func (c *Cache) Tags(repository string) ([]string, error) {
+	key, err := c.key(tagsCacheVersion, repository, "")
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var cached cachedTags
+	found := c.get(key, &cached)
+	if found && now.Sub(cached.CheckedAt) < tagsFreshFor {
+		return cached.Tags, nil
+	}
+
+	fresh := cachedTags{CheckedAt: now}
+	if lister, ok := c.next.(conditionalTagLister); ok {
+		var etag string
+		if found {
+			etag = cached.ETag
+		}
+		tags, newETag, changed, err := lister.TagsIfChanged(repository, etag)
+		if err != nil {
+			return nil, err
+		}
+		fresh.ETag = newETag
+		if changed {
+			fresh.Tags = tags
+		} else {
+			fresh.Tags = cached.Tags
+		}
+	} else {
+		if fresh.Tags, err = c.next.Tags(repository); err != nil {
+			return nil, err
+		}
+	}
+	c.set(key, fresh, c.expiry)
+	return fresh.Tags, nil
+}
+
+// key gives the cache key for something from the registry.
+func (c *Cache) key(version, repository, reference string) (string, error) {
+	repo, err := ParseRepository(repository)
+	if err != nil {
+		return "", err
+	}
+	creds, err := c.creds.credsFor(repo.Host())
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{
+		// The version of the format. Entries in older formats are
+		// simply left to expire.
+		version,
 		// Just the username here means we won't invalidate the cache when user
 		// changes password, but that should be rare. And, it also means we're not
-		// putting user passwords in plaintext into memcache.
+		// putting user passwords in plaintext into the cache.
 		creds.username,
 		repository,
 		reference,
-	}, "|")
-	cacheItem, err := c.Client.Get(key)
-	if err == nil {
-		// Return the cache item
-		var history []schema1.History
-		if err := json.Unmarshal(cacheItem.Value, &history); err == nil {
-			return history, nil
-		} else {
-			c.logger.Log("err", err.Error)
+		c.generation(repository),
+	}, "|"), nil
+}
+
+// get looks for the key in the cache, and decodes what's there into
+// value. It says whether it found something usable; errors are
+// logged, and count as not finding anything.
+func (c *Cache) get(key string, value interface{}) bool {
+	bytes, err := c.Backend.Get(key)
+	if err != nil {
+		if err != ErrCacheMiss {
+			c.logger.Log("err", errors.Wrap(err, "fetching from registry cache"))
 		}
-	} else if err != memcache.ErrCacheMiss {
-		c.logger.Log("err", errors.Wrap(err, "Fetching tag from memcache"))
+		return false
+	}
+	if err := json.Unmarshal(bytes, value); err != nil {
+		c.logger.Log("err", errors.Wrap(err, "decoding from registry cache"))
+		return false
 	}
+	return true
+}
 
-	// fall back to the backend
-	history, err := c.next.Manifest(repository, reference)
-	if err == nil {
-		// Store positive responses in the cache
-		val, err := json.Marshal(history)
-		if err != nil {
-			c.logger.Log("err", errors.Wrap(err, "serializing tag to store in memcache"))
-			return history, nil
-		}
-		if err := c.Client.Set(&memcache.Item{
-			Key:        key,
-			Value:      val,
-			Expiration: int32(c.expiry.Seconds()),
-		}); err != nil {
-			c.logger.Log("err", errors.Wrap(err, "storing tag in memcache"))
-			return history, nil
+// set stores the value in the cache. Failing to do so isn't fatal,
+// so errors are just logged.
+func (c *Cache) set(key string, value interface{}, expiry time.Duration) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		c.logger.Log("err", errors.Wrap(err, "serializing to store in registry cache"))
+		return
+	}
+	if err := c.Backend.Set(key, bytes, expiry); err != nil {
+		c.logger.Log("err", errors.Wrap(err, "storing in registry cache"))
+	}
+}
+
+// generation gives the current generation of the cache entries for a
+// repository. Entries are keyed by generation, so that we can
+// invalidate them all at once by starting a new generation. It's
+// looked up the first time it's needed, and the same generation used
+// for the rest of the request.
+func (c *Cache) generation(repository string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen, ok := c.generations[repository]; ok {
+		return gen
+	}
+	value, err := c.Backend.Get(generationKey(repository))
+	switch {
+	case err == ErrCacheMiss:
+		// Either there's never been a generation, or it's been
+		// evicted; in the latter case, entries from before it was
+		// last changed may still be around, so start afresh.
+		value = newGeneration()
+		if err := c.Backend.Set(generationKey(repository), value, 0); err != nil {
+			c.logger.Log("err", errors.Wrap(err, "storing repository generation in registry cache"))
 		}
+	case err != nil:
+		// Don't remember this; it may work next time
+		c.logger.Log("err", errors.Wrap(err, "fetching repository generation from registry cache"))
+		return ""
 	}
+	c.generations[repository] = string(value)
+	return string(value)
+}
 
-	return history, err
+func newGeneration() []byte {
+	return []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
 }
 
-// Pass through. Not caching tags.
-func (c *Cache) Tags(repository string) ([]string, error) {
-	return c.next.Tags(repository)
+func generationKey(repository string) string {
+	return strings.Join([]string{"registrygenerationv1", repository}, "|")
+}
+
+// InvalidateRepository makes any cached metadata for the images in a
+// repository stale, for all credentials; e.g., because we've been
+// told that an image has been pushed to it.
+func InvalidateRepository(backend CacheBackend, repository Repository) error {
+	return backend.Set(generationKey(repository.NamespaceImage()), newGeneration(), 0)
 }
@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/jonboulle/clockwork"
+)
+
+// ErrCacheMiss is returned by a CacheBackend that has nothing for the
+// key asked for.
+var ErrCacheMiss = errors.New("cache miss")
+
+// CacheBackend is somewhere to keep cached registry responses.
+type CacheBackend interface {
+	// Get gives the value stored for the key, or ErrCacheMiss if
+	// there's none, or it has expired.
+	Get(key string) ([]byte, error)
+	// Set stores the value for the key, for the time given; zero
+	// means for as long as the backend will keep it.
+	Set(key string, value []byte, expiry time.Duration) error
+}
+
+// ---
+
+type memcacheBackend struct {
+	client MemcacheClient
+}
+
+// NewMemcacheBackend gives a CacheBackend that uses memcached, so the
+// cache can be shared between replicas of the service.
+func NewMemcacheBackend(client MemcacheClient) CacheBackend {
+	return &memcacheBackend{client}
+}
+
+func (m *memcacheBackend) Get(key string) ([]byte, error) {
+	item, err := m.client.Get(key)
+	if err == memcache.ErrCacheMiss {
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+func (m *memcacheBackend) Set(key string, value []byte, expiry time.Duration) error {
+	return m.client.Set(&memcache.Item{
+		Key:        key,
+		Value:      value,
+		Expiration: int32(expiry.Seconds()),
+	})
+}
+
+// ---
+
+type lruBackend struct {
+	size  int
+	clock clockwork.Clock
+
+	mu      sync.Mutex
+	entries *list.List // most recently used at the front
+	byKey   map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time // zero for never
+}
+
+// NewLRUBackend gives a CacheBackend kept in memory, holding up to
+// size entries; when it's full, the entry least recently used is
+// dropped.
+func NewLRUBackend(size int) CacheBackend {
+	return newLRUBackend(size, clockwork.NewRealClock())
+}
+
+func newLRUBackend(size int, clock clockwork.Clock) *lruBackend {
+	if size < 1 {
+		size = 1
+	}
+	return &lruBackend{
+		size:    size,
+		clock:   clock,
+		entries: list.New(),
+		byKey:   map[string]*list.Element{},
+	}
+}
+
+func (l *lruBackend) Get(key string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.byKey[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && !l.clock.Now().Before(entry.expires) {
+		l.entries.Remove(elem)
+		delete(l.byKey, key)
+		return nil, ErrCacheMiss
+	}
+	l.entries.MoveToFront(elem)
+	return entry.value, nil
+}
+
+func (l *lruBackend) Set(key string, value []byte, expiry time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var expires time.Time
+	if expiry > 0 {
+		expires = l.clock.Now().Add(expiry)
+	}
+	if elem, ok := l.byKey[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.value, entry.expires = value, expires
+		l.entries.MoveToFront(elem)
+		return nil
+	}
+	l.byKey[key] = l.entries.PushFront(&lruEntry{
+		key:     key,
+		value:   value,
+		expires: expires,
+	})
+	for l.entries.Len() > l.size {
+		oldest := l.entries.Back()
+		l.entries.Remove(oldest)
+		delete(l.byKey, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package registry
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jonboulle/clockwork"
+)
+
+func TestLRUBackend(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	lru := newLRUBackend(2, clock)
+
+	if _, err := lru.Get("a"); err != ErrCacheMiss {
+		t.Fatalf("expected cache miss, got %v", err)
+	}
+	lru.Set("a", []byte("A"), 0)
+	lru.Set("b", []byte("B"), 0)
+	// Using "a" makes "b" the least recently used
+	if value, err := lru.Get("a"); err != nil || string(value) != "A" {
+		t.Fatalf("expected A, got %q, %v", value, err)
+	}
+	lru.Set("c", []byte("C"), 0)
+	if _, err := lru.Get("b"); err != ErrCacheMiss {
+		t.Errorf("expected b to have been dropped, got %v", err)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, err := lru.Get(key); err != nil {
+			t.Errorf("expected %s to be kept, got %v", key, err)
+		}
+	}
+
+	lru.Set("a", []byte("A"), time.Minute)
+	clock.Advance(time.Minute)
+	if _, err := lru.Get("a"); err != ErrCacheMiss {
+		t.Errorf("expected a to have expired, got %v", err)
+	}
+}
+
+func TestCache_MissingManifest(t *testing.T) {
+	calls := 0
+	next := NewMockDockerClient(func(repo, ref string) (ImageInfo, error) {
+		calls++
+		return ImageInfo{}, NotFoundError{URL: repo + "/" + ref, Status: "404 Not Found"}
+	}, nil)
+	c := NewCache(NoCredentials(), NewLRUBackend(10), 20*time.Minute, log.NewNopLogger())(next)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Manifest("weaveworks/foorepo", "notyet"); !IsNotFound(err) {
+			t.Fatalf("expected not found error, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the missing tag to be remembered, but the backend was called %d times", calls)
+	}
+
+	// Other errors aren't remembered
+	next = NewMockDockerClient(func(repo, ref string) (ImageInfo, error) {
+		calls++
+		return ImageInfo{}, errors.New("unauthorized")
+	}, nil)
+	c = NewCache(NoCredentials(), NewLRUBackend(10), 20*time.Minute, log.NewNopLogger())(next)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Manifest("weaveworks/foorepo", "tag"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	if calls != 3 {
+		t.Errorf("expected errors not to be cached, but the backend was called %d times", calls-1)
+	}
+}
+
+func TestCache_InvalidateRepositoryLRU(t *testing.T) {
+	calls := 0
+	next := NewMockDockerClient(func(repo, ref string) (ImageInfo, error) {
+		calls++
+		return ImageInfo{Digest: "sha256:1234"}, nil
+	}, nil)
+	backend := NewLRUBackend(10)
+	c := NewCache(NoCredentials(), backend, 20*time.Minute, log.NewNopLogger())(next)
+
+	c.Manifest("weaveworks/foorepo", "tag1")
+	c.Manifest("weaveworks/foorepo", "tag1")
+	if calls != 1 {
+		t.Fatalf("expected one call to the backend, got %d", calls)
+	}
+	repo, err := ParseRepository("weaveworks/foorepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InvalidateRepository(backend, repo); err != nil {
+		t.Fatal(err)
+	}
+	// The next request sees the new generation
+	c = NewCache(NoCredentials(), backend, 20*time.Minute, log.NewNopLogger())(next)
+	c.Manifest("weaveworks/foorepo", "tag1")
+	if calls != 2 {
+		t.Errorf("expected to go back to the backend after invalidating, got %d calls", calls)
+	}
+}
+
+// countingBackend counts the lookups of each key.
+type countingBackend struct {
+	CacheBackend
+	gets map[string]int
+}
+
+func (b *countingBackend) Get(key string) ([]byte, error) {
+	b.gets[key]++
+	return b.CacheBackend.Get(key)
+}
+
+func TestCache_GenerationOncePerRequest(t *testing.T) {
+	next := NewMockDockerClient(func(repo, ref string) (ImageInfo, error) {
+		return ImageInfo{Digest: "sha256:1234"}, nil
+	}, nil)
+	backend := &countingBackend{NewLRUBackend(10), map[string]int{}}
+	c := NewCache(NoCredentials(), backend, 20*time.Minute, log.NewNopLogger())(next)
+
+	for _, tag := range []string{"tag1", "tag2", "tag1"} {
+		if _, err := c.Manifest("weaveworks/foorepo", tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := backend.gets[generationKey("weaveworks/foorepo")]; n != 1 {
+		t.Errorf("expected the generation to be looked up once, got %d lookups", n)
+	}
+}
+
+func TestCache_NewGenerationOnMiss(t *testing.T) {
+	next := NewMockDockerClient(func(repo, ref string) (ImageInfo, error) {
+		return ImageInfo{Digest: "sha256:fresh"}, nil
+	}, nil)
+	backend := NewLRUBackend(10)
+	// An entry left over from before the generation was evicted
+	c := NewCache(NoCredentials(), backend, 20*time.Minute, log.NewNopLogger())(next).(*Cache)
+	c.generations["weaveworks/foorepo"] = ""
+	c.set("registrymanifestv3||weaveworks/foorepo|tag1|", cachedManifest{Info: ImageInfo{Digest: "sha256:stale"}}, time.Hour)
+
+	c = NewCache(NoCredentials(), backend, 20*time.Minute, log.NewNopLogger())(next).(*Cache)
+	if info, err := c.Manifest("weaveworks/foorepo", "tag1"); err != nil || info.Digest != "sha256:fresh" {
+		t.Errorf("expected entry from before the generation was lost not to be used, got %v, %v", info, err)
+	}
+	gen, err := backend.Get(generationKey("weaveworks/foorepo"))
+	if err != nil || string(gen) == "" {
+		t.Fatalf("expected a new generation to be stored, got %q, %v", gen, err)
+	}
+	c = NewCache(NoCredentials(), backend, 20*time.Minute, log.NewNopLogger())(next).(*Cache)
+	if c.generation("weaveworks/foorepo") != string(gen) {
+		t.Errorf("expected the stored generation to be used by later requests")
+	}
+}
+
+func TestCache_FreshManifest(t *testing.T) {
+	digest := "sha256:1234"
+	calls := 0
+	next := NewMockDockerClient(func(repo, ref string) (ImageInfo, error) {
+		calls++
+		return ImageInfo{Digest: digest}, nil
+	}, nil)
+	c := NewCache(NoCredentials(), NewLRUBackend(10), 20*time.Minute, log.NewNopLogger())(next).(*Cache)
+
+	c.Manifest("weaveworks/foorepo", "tag1")
+	// The tag is pushed again
+	digest = "sha256:5678"
+	if info, _ := c.Manifest("weaveworks/foorepo", "tag1"); info.Digest != "sha256:1234" || calls != 1 {
+		t.Fatalf("expected cached manifest, got %v after %d calls", info, calls)
+	}
+	if info, err := c.FreshManifest("weaveworks/foorepo", "tag1"); err != nil || info.Digest != digest {
+		t.Errorf("expected fresh manifest, got %v, %v", info, err)
+	}
+	// and what was fetched is cached
+	if info, _ := c.Manifest("weaveworks/foorepo", "tag1"); info.Digest != digest || calls != 2 {
+		t.Errorf("expected fresh manifest to be cached, got %v after %d calls", info, calls)
+	}
+}
+
+func TestCache_TagsRevalidated(t *testing.T) {
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v2/weaveworks/test/tags/list" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/weaveworks/test/tags/list?last=b&n=2>; rel="next"`)
+			w.Write([]byte(`{"name": "weaveworks/test", "tags": ["a", "b"]}`))
+			return
+		}
+		w.Write([]byte(`{"name": "weaveworks/test", "tags": ["c"]}`))
+	}))
+	defer server.Close()
+
+	next := &etagClient{manifestFetcher{
+		client:  http.DefaultClient,
+		baseURL: server.URL,
+	}}
+	backend := newLRUBackend(10, clockwork.NewRealClock())
+	c := NewCache(NoCredentials(), backend, 20*time.Minute, log.NewNopLogger())(next)
+
+	expected := []string{"a", "b", "c"}
+	tags, err := c.Tags("weaveworks/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, tags) {
+		t.Fatalf("expected %v, got %v", expected, tags)
+	}
+	if requests != 2 {
+		t.Errorf("expected two requests for two pages, got %d", requests)
+	}
+
+	// Fresh, so it's not checked
+	if _, err = c.Tags("weaveworks/test"); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("expected no more requests, got %d", requests)
+	}
+
+	// Make it stale, and it's revalidated with one request
+	key, _ := c.(*Cache).key(tagsCacheVersion, "weaveworks/test", "")
+	stale := []byte(`{"tags": ["a", "b", "c"], "etag": "\"v1\"", "checkedAt": "2017-01-01T00:00:00Z"}`)
+	backend.Set(key, stale, 0)
+	tags, err = c.Tags("weaveworks/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, tags) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+	if requests != 3 || notModified != 1 {
+		t.Errorf("expected one more, conditional request; got %d requests, %d not modified", requests, notModified)
+	}
+}
+
+// etagClient lists tags using the registry API, as the real client
+// does.
+type etagClient struct {
+	fetcher manifestFetcher
+}
+
+func (c *etagClient) Manifest(repository, reference string) (ImageInfo, error) {
+	return ImageInfo{}, errors.New("not expected")
+}
+
+func (c *etagClient) Tags(repository string) ([]string, error) {
+	tags, _, _, err := c.TagsIfChanged(repository, "")
+	return tags, err
+}
+
+func (c *etagClient) TagsIfChanged(repository, etag string) ([]string, string, bool, error) {
+	f := c.fetcher
+	f.repository = repository
+	return f.tags(etag)
+}
@@ -6,12 +6,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
-	"github.com/docker/distribution/manifest/schema1"
 	"github.com/go-kit/kit/log"
 )
 
@@ -44,15 +44,19 @@ func TestCache(t *testing.T) {
 
 	manifestCalled := 0
 
-	manifestFunc := func(repo, ref string) ([]schema1.History, error) {
+	expected := ImageInfo{
+		Digest: "sha256:1234",
+		Labels: map[string]string{"test": "json"},
+	}
+	manifestFunc := func(repo, ref string) (ImageInfo, error) {
 		manifestCalled++
-		return []schema1.History{{`{"test":"json"}`}}, nil
+		return expected, nil
 	}
 
 	mock := NewMockDockerClient(manifestFunc, nil)
 	c := NewCache(
 		NoCredentials(),
-		mc,
+		NewMemcacheBackend(mc),
 		20*time.Minute,
 		log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout)),
 	)(mock)
@@ -62,12 +66,8 @@ func TestCache(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if len(response) != 1 {
-		t.Fatalf("Expected 1 history item, got %v", response)
-	}
-	expected := schema1.History{`{"test":"json"}`}
-	if response[0] != expected {
-		t.Fatalf("Expected  history item: %v, got %v", expected, response[0])
+	if !reflect.DeepEqual(expected, response) {
+		t.Fatalf("Expected image info: %v, got %v", expected, response)
 	}
 	if manifestCalled != 1 {
 		t.Errorf("Expected 1 call to the backend, got %d", manifestCalled)
@@ -75,10 +75,11 @@ func TestCache(t *testing.T) {
 
 	// It should cache on the way through
 	_, err = mc.Get(strings.Join([]string{
-		"registryhistoryv1",
+		"registrymanifestv3",
 		"", // no username
 		"weaveworks/foorepo",
 		"tag1",
+		"", // no generation yet
 	}, "|"))
 	if err != nil {
 		// Will catch ErrCacheMiss
@@ -96,13 +97,13 @@ func TestCache(t *testing.T) {
 	}
 
 	// It should pass through errors from the backend
-	manifestFunc = func(repo, ref string) ([]schema1.History, error) {
-		return nil, fmt.Errorf("test error")
+	manifestFunc = func(repo, ref string) (ImageInfo, error) {
+		return ImageInfo{}, fmt.Errorf("test error")
 	}
 	mock = NewMockDockerClient(manifestFunc, nil)
 	c = NewCache(
 		NoCredentials(),
-		mc,
+		NewMemcacheBackend(mc),
 		20*time.Minute,
 		log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout)),
 	)(mock)
@@ -111,3 +112,45 @@ func TestCache(t *testing.T) {
 		t.Fatalf("Expected test error, but got %v", err)
 	}
 }
+
+func TestCache_InvalidateRepository(t *testing.T) {
+	mc := Setup(t)
+	defer Cleanup(t)
+
+	manifestCalled := 0
+	mock := NewMockDockerClient(func(repo, ref string) (ImageInfo, error) {
+		manifestCalled++
+		return ImageInfo{Digest: "sha256:1234"}, nil
+	}, nil)
+	c := NewCache(
+		NoCredentials(),
+		NewMemcacheBackend(mc),
+		20*time.Minute,
+		log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout)),
+	)(mock)
+
+	if _, err := c.Manifest("weaveworks/foorepo", "tag1"); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := ParseRepository("weaveworks/foorepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InvalidateRepository(NewMemcacheBackend(mc), repo); err != nil {
+		t.Fatal(err)
+	}
+
+	// It should go back to the backend, for the next request
+	c = NewCache(
+		NoCredentials(),
+		NewMemcacheBackend(mc),
+		20*time.Minute,
+		log.NewLogfmtLogger(log.NewSyncWriter(os.Stdout)),
+	)(mock)
+	if _, err := c.Manifest("weaveworks/foorepo", "tag1"); err != nil {
+		t.Fatal(err)
+	}
+	if manifestCalled != 2 {
+		t.Errorf("Expected 2 calls to the backend, got %d", manifestCalled)
+	}
+}
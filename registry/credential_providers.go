@@ -0,0 +1,589 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+
+	"github.com/weaveworks/flux"
+)
+
+// Token is a username and password for a registry, that may stop
+// working at some point.
+type Token struct {
+	Username, Password string
+	// When the token expires; zero if it's not known to.
+	Expiry time.Time
+}
+
+// CredentialProvider gets credentials for a registry host, usually by
+// trading some longer-lived credentials for a token.
+type CredentialProvider interface {
+	Credentials(host string) (Token, error)
+}
+
+const (
+	// How long we give providers to come up with a token
+	providerTimeout = 30 * time.Second
+	// Tokens are fetched again this long before they expire (or at
+	// half their lifetime, if that's sooner), so they don't run out
+	// mid-request.
+	tokenRefreshBefore = 10 * time.Minute
+	// How long to use a token that doesn't say when it expires
+	tokenDefaultLifetime = 15 * time.Minute
+	// How often to look for expired tokens to drop from the cache
+	tokenSweepInterval = time.Minute
+)
+
+// NewCredentialProvider makes the provider described by the config.
+// It checks the config is complete, but doesn't try to get a token.
+func NewCredentialProvider(conf flux.CredentialProviderConfig) (CredentialProvider, error) {
+	client := &http.Client{Timeout: providerTimeout}
+	switch conf.Type {
+	case flux.CredentialProviderECR:
+		if conf.AccessKeyID == "" || conf.SecretAccessKey == "" {
+			return nil, errors.New("ECR credential provider needs accessKeyID and secretAccessKey")
+		}
+		return &ecrProvider{conf: conf, client: client, now: time.Now}, nil
+	case flux.CredentialProviderGCR:
+		var key gcrServiceAccountKey
+		if err := json.Unmarshal([]byte(conf.ServiceAccountKey), &key); err != nil {
+			return nil, errors.Wrap(err, "GCR credential provider needs serviceAccountKey, as JSON")
+		}
+		if key.ClientEmail == "" || key.PrivateKey == "" {
+			return nil, errors.New("GCR service account key has no client_email or private_key")
+		}
+		tokenURL := key.TokenURI
+		if conf.Endpoint != "" {
+			tokenURL = conf.Endpoint
+		}
+		if tokenURL == "" {
+			tokenURL = gcrDefaultTokenURL
+		}
+		return &gcrProvider{
+			config: &jwt.Config{
+				Email:        key.ClientEmail,
+				PrivateKey:   []byte(key.PrivateKey),
+				PrivateKeyID: key.PrivateKeyID,
+				Scopes:       []string{gcrScope},
+				TokenURL:     tokenURL,
+			},
+			client: client,
+		}, nil
+	case flux.CredentialProviderACR:
+		if conf.TenantID == "" || conf.ClientID == "" || conf.ClientSecret == "" {
+			return nil, errors.New("ACR credential provider needs tenantID, clientID and clientSecret")
+		}
+		loginURL := conf.Endpoint
+		if loginURL == "" {
+			loginURL = acrDefaultLoginURL
+		}
+		return &acrProvider{conf: conf, loginURL: loginURL, registryScheme: "https", client: client}, nil
+	case flux.CredentialProviderHelper:
+		if !helperName.MatchString(conf.Helper) {
+			return nil, fmt.Errorf("credential helper %q is not a valid name (letters, digits, '-' and '_' only)", conf.Helper)
+		}
+		if !helperAllowed(conf.Helper) {
+			return nil, fmt.Errorf("credential helper %q is not one of those this service allows", conf.Helper)
+		}
+		return &helperProvider{command: "docker-credential-" + conf.Helper}, nil
+	}
+	return nil, fmt.Errorf("unknown credential provider type %q; expected one of ecr, gcr, acr or helper", conf.Type)
+}
+
+// ---
+
+// tokenCache keeps tokens until they are due to be refreshed. It's
+// shared by all the credentials made from instance configs, since
+// those are made afresh for each request. Tokens are dropped once
+// they have expired, so those for configs no longer in use don't
+// pile up.
+type tokenCache struct {
+	clock     clockwork.Clock
+	mu        sync.Mutex
+	tokens    map[string]*cachedToken
+	lastSwept time.Time
+}
+
+type cachedToken struct {
+	sync.Mutex
+	token     Token
+	valid     bool
+	refreshAt time.Time
+	// When the entry can be dropped. Unlike the rest, this is
+	// guarded by the cache's lock, since that's what sweeps it.
+	evictAt time.Time
+}
+
+var sharedTokens = newTokenCache(clockwork.NewRealClock())
+
+func newTokenCache(clock clockwork.Clock) *tokenCache {
+	return &tokenCache{
+		clock:  clock,
+		tokens: map[string]*cachedToken{},
+	}
+}
+
+// cached wraps the provider made from the config given so its tokens
+// are kept in the cache. Tokens are kept by config (and host), so
+// changing the config means getting a new token.
+func (c *tokenCache) cached(conf flux.CredentialProviderConfig, provider CredentialProvider) CredentialProvider {
+	confBytes, _ := json.Marshal(conf)
+	return &cachingProvider{
+		key:      fmt.Sprintf("%x", sha256.Sum256(confBytes)),
+		provider: provider,
+		cache:    c,
+	}
+}
+
+func (c *tokenCache) entry(key string) *cachedToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	if now.Sub(c.lastSwept) >= tokenSweepInterval {
+		for k, e := range c.tokens {
+			if now.After(e.evictAt) {
+				delete(c.tokens, k)
+			}
+		}
+		c.lastSwept = now
+	}
+	entry, ok := c.tokens[key]
+	if !ok {
+		// If no token is got for it, it goes in the next sweep
+		// after this
+		entry = &cachedToken{evictAt: now.Add(tokenDefaultLifetime)}
+		c.tokens[key] = entry
+	}
+	return entry
+}
+
+// keepUntil says when an entry can be dropped: once its token has
+// expired, or, for a token with no expiry, once it would have been
+// fetched again.
+func (c *tokenCache) keepUntil(entry *cachedToken, t time.Time) {
+	c.mu.Lock()
+	entry.evictAt = t
+	c.mu.Unlock()
+}
+
+type cachingProvider struct {
+	key      string
+	provider CredentialProvider
+	cache    *tokenCache
+}
+
+func (p *cachingProvider) Credentials(host string) (Token, error) {
+	entry := p.cache.entry(p.key + "|" + host)
+	// Holding the lock while fetching means concurrent requests
+	// for the same registry wait for the one token.
+	entry.Lock()
+	defer entry.Unlock()
+
+	now := p.cache.clock.Now()
+	if entry.valid && now.Before(entry.refreshAt) {
+		return entry.token, nil
+	}
+	token, err := p.provider.Credentials(host)
+	if err != nil {
+		// Make do with the token we have, if it's still good.
+		if entry.valid && (entry.token.Expiry.IsZero() || now.Before(entry.token.Expiry)) {
+			return entry.token, nil
+		}
+		return Token{}, err
+	}
+
+	refreshAt := now.Add(tokenDefaultLifetime)
+	if !token.Expiry.IsZero() {
+		margin := tokenRefreshBefore
+		if half := token.Expiry.Sub(now) / 2; half < margin {
+			margin = half
+		}
+		refreshAt = token.Expiry.Add(-margin)
+	}
+	entry.token, entry.valid, entry.refreshAt = token, true, refreshAt
+	if token.Expiry.IsZero() {
+		p.cache.keepUntil(entry, refreshAt)
+	} else {
+		p.cache.keepUntil(entry, token.Expiry)
+	}
+	return token, nil
+}
+
+// --- ECR
+
+// ECR registries are named <account>.dkr.ecr.<region>.amazonaws.com
+var ecrHost = regexp.MustCompile(`^(\d+)\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+// ecrProvider gets a token by calling GetAuthorizationToken in the
+// ECR API, signing the request itself rather than pulling in the
+// whole AWS SDK.
+type ecrProvider struct {
+	conf   flux.CredentialProviderConfig
+	client *http.Client
+	now    func() time.Time
+}
+
+func (p *ecrProvider) Credentials(host string) (Token, error) {
+	var account, region, domain string
+	if m := ecrHost.FindStringSubmatch(host); m != nil {
+		account, region, domain = m[1], m[2], "amazonaws.com"+m[3]
+	}
+	if p.conf.Region != "" {
+		region = p.conf.Region
+	}
+	if region == "" {
+		return Token{}, fmt.Errorf("%s is not an ECR registry host, and no region is given", host)
+	}
+	if domain == "" {
+		domain = "amazonaws.com"
+	}
+	endpoint := p.conf.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://api.ecr.%s.%s/", region, domain)
+	}
+
+	var request struct {
+		RegistryIDs []string `json:"registryIds,omitempty"`
+	}
+	if account != "" {
+		request.RegistryIDs = []string{account}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return Token{}, err
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	signV4(req, body, p.conf.AccessKeyID, p.conf.SecretAccessKey, region, "ecr", p.now())
+
+	var response struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+	if err := doJSON(p.client, req, &response); err != nil {
+		return Token{}, errors.Wrap(err, "getting ECR authorization token")
+	}
+	if len(response.AuthorizationData) == 0 {
+		return Token{}, errors.New("no ECR authorization token returned")
+	}
+	data := response.AuthorizationData[0]
+	token, err := basicAuthToken(data.AuthorizationToken)
+	if err != nil {
+		return Token{}, errors.Wrap(err, "decoding ECR authorization token")
+	}
+	if data.ExpiresAt > 0 {
+		token.Expiry = time.Unix(int64(data.ExpiresAt), 0)
+	}
+	return token, nil
+}
+
+// signV4 signs a request to an AWS API, as described in
+// http://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func signV4(req *http.Request, body []byte, accessKeyID, secretAccessKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	// The host is sent from req.Host rather than the headers, but
+	// must be signed all the same.
+	headers := map[string]string{"host": req.Host}
+	names := []string{"host"}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		names = append(names, lower)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// --- GCR
+
+const (
+	gcrDefaultTokenURL = "https://accounts.google.com/o/oauth2/token"
+	gcrScope           = "https://www.googleapis.com/auth/devstorage.read_only"
+	// The username GCR expects along with an OAuth2 access token
+	gcrUsername = "oauth2accesstoken"
+)
+
+// The bits of a service account key we need.
+type gcrServiceAccountKey struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// gcrProvider gets an OAuth2 access token for a service account, by
+// presenting a JWT signed with the service account key.
+type gcrProvider struct {
+	config *jwt.Config
+	client *http.Client
+}
+
+func (p *gcrProvider) Credentials(host string) (Token, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, p.client)
+	token, err := p.config.TokenSource(ctx).Token()
+	if err != nil {
+		return Token{}, errors.Wrap(err, "getting GCR access token")
+	}
+	return Token{
+		Username: gcrUsername,
+		Password: token.AccessToken,
+		Expiry:   token.Expiry,
+	}, nil
+}
+
+// --- ACR
+
+const (
+	acrDefaultLoginURL = "https://login.microsoftonline.com"
+	acrResource        = "https://management.azure.com/"
+	// The username ACR expects along with a refresh token
+	acrUsername = "00000000-0000-0000-0000-000000000000"
+	// ACR refresh tokens are good for three hours; if we can't tell
+	// from the token itself, assume less than that.
+	acrDefaultLifetime = time.Hour
+)
+
+// acrProvider gets an Azure AD token for a service principal, and
+// exchanges it with the registry for a refresh token, which can be
+// used as a password.
+type acrProvider struct {
+	conf           flux.CredentialProviderConfig
+	loginURL       string
+	registryScheme string
+	client         *http.Client
+}
+
+func (p *acrProvider) Credentials(host string) (Token, error) {
+	var aad struct {
+		AccessToken string `json:"access_token"`
+	}
+	err := postForm(p.client, strings.TrimSuffix(p.loginURL, "/")+"/"+(&url.URL{Path: p.conf.TenantID}).String()+"/oauth2/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.conf.ClientID},
+		"client_secret": {p.conf.ClientSecret},
+		"resource":      {acrResource},
+	}, &aad)
+	if err != nil {
+		return Token{}, errors.Wrap(err, "getting Azure AD token")
+	}
+
+	var exchange struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err = postForm(p.client, p.registryScheme+"://"+host+"/oauth2/exchange", url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {host},
+		"tenant":       {p.conf.TenantID},
+		"access_token": {aad.AccessToken},
+	}, &exchange)
+	if err != nil {
+		return Token{}, errors.Wrap(err, "exchanging Azure AD token for ACR refresh token")
+	}
+	if exchange.RefreshToken == "" {
+		return Token{}, errors.New("no ACR refresh token returned")
+	}
+	expiry, ok := jwtExpiry(exchange.RefreshToken)
+	if !ok {
+		expiry = time.Now().Add(acrDefaultLifetime)
+	}
+	return Token{
+		Username: acrUsername,
+		Password: exchange.RefreshToken,
+		Expiry:   expiry,
+	}, nil
+}
+
+// jwtExpiry reads the expiry claim of a JWT, without checking it.
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
+
+// --- docker credential helpers
+
+var helperName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Helpers run on the host running Flux, so it's up to whoever runs
+// it, rather than the instance config, which helpers can be used.
+var allowedHelpers = struct {
+	sync.RWMutex
+	names map[string]bool
+}{names: map[string]bool{}}
+
+// AllowCredentialHelpers says which docker credential helpers
+// instance configs may use, by name (e.g., "ecr-login" for
+// docker-credential-ecr-login). Only those given here can be used;
+// by default, none.
+func AllowCredentialHelpers(names []string) {
+	allowed := map[string]bool{}
+	for _, name := range names {
+		allowed[name] = true
+	}
+	allowedHelpers.Lock()
+	allowedHelpers.names = allowed
+	allowedHelpers.Unlock()
+}
+
+func helperAllowed(name string) bool {
+	allowedHelpers.RLock()
+	defer allowedHelpers.RUnlock()
+	return allowedHelpers.names[name]
+}
+
+// helperProvider runs a docker credential helper, as described in
+// https://github.com/docker/docker-credential-helpers, to get
+// credentials. Helpers don't say when credentials expire, so they're
+// used for a fixed time.
+type helperProvider struct {
+	command string
+}
+
+func (p *helperProvider) Credentials(host string) (Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), providerTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.command, "get")
+	cmd.Stdin = strings.NewReader(host)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers report errors like "credentials not found" on stdout
+		message := strings.TrimSpace(stderr.String() + string(out))
+		return Token{}, errors.Wrapf(err, "running %s: %s", p.command, message)
+	}
+	var result struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return Token{}, errors.Wrapf(err, "decoding output of %s", p.command)
+	}
+	return Token{
+		Username: result.Username,
+		Password: result.Secret,
+	}, nil
+}
+
+// ---
+
+// basicAuthToken decodes base64 "username:password".
+func basicAuthToken(encoded string) (Token, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return Token{}, err
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return Token{}, errors.New("expected username:password")
+	}
+	return Token{Username: parts[0], Password: parts[1]}, nil
+}
+
+func postForm(client *http.Client, endpoint string, form url.Values, result interface{}) error {
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doJSON(client, req, result)
+}
+
+func doJSON(client *http.Client, req *http.Request, result interface{}) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL, res.Status, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, result)
+}
@@ -0,0 +1,393 @@
+package registry
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/weaveworks/flux"
+)
+
+type countingProvider struct {
+	calls int
+	token Token
+	err   error
+}
+
+func (p *countingProvider) Credentials(host string) (Token, error) {
+	p.calls++
+	return p.token, p.err
+}
+
+func TestTokenCache_RefreshesBeforeExpiry(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	provider := &countingProvider{
+		token: Token{Username: "user", Password: "token1", Expiry: clock.Now().Add(time.Hour)},
+	}
+	cached := newTokenCache(clock).cached(flux.CredentialProviderConfig{Type: "test"}, provider)
+
+	for i := 0; i < 3; i++ {
+		if token, err := cached.Credentials("registry.example.com"); err != nil || token.Password != "token1" {
+			t.Fatalf("expected token1, got %v, %v", token, err)
+		}
+	}
+	if provider.calls != 1 {
+		t.Fatalf("expected one call to the provider, got %d", provider.calls)
+	}
+
+	// Other hosts get their own token
+	cached.Credentials("other.example.com")
+	if provider.calls != 2 {
+		t.Fatalf("expected a call to the provider for another host, got %d calls", provider.calls)
+	}
+
+	// Within the refresh margin, a new token is fetched
+	clock.Advance(time.Hour - tokenRefreshBefore + time.Second)
+	provider.token = Token{Username: "user", Password: "token2", Expiry: clock.Now().Add(time.Hour)}
+	if token, _ := cached.Credentials("registry.example.com"); token.Password != "token2" {
+		t.Fatalf("expected refreshed token, got %v", token)
+	}
+
+	// If refreshing fails, the old token is used until it expires
+	clock.Advance(time.Hour - tokenRefreshBefore + time.Second)
+	provider.err = errors.New("provider down")
+	if token, err := cached.Credentials("registry.example.com"); err != nil || token.Password != "token2" {
+		t.Fatalf("expected old token while it's still good, got %v, %v", token, err)
+	}
+	clock.Advance(tokenRefreshBefore)
+	if _, err := cached.Credentials("registry.example.com"); err == nil {
+		t.Fatalf("expected error once token has expired")
+	}
+}
+
+func TestTokenCache_ShortLivedAndUnexpiring(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	short := &countingProvider{
+		token: Token{Password: "short", Expiry: clock.Now().Add(4 * time.Minute)},
+	}
+	forever := &countingProvider{
+		token: Token{Password: "forever"},
+	}
+	cache := newTokenCache(clock)
+	cachedShort := cache.cached(flux.CredentialProviderConfig{Type: "short"}, short)
+	cachedForever := cache.cached(flux.CredentialProviderConfig{Type: "forever"}, forever)
+	cachedShort.Credentials("host")
+	cachedForever.Credentials("host")
+
+	// Tokens with less life than the refresh margin are refreshed
+	// at half-life.
+	clock.Advance(time.Minute)
+	cachedShort.Credentials("host")
+	clock.Advance(time.Minute + time.Second)
+	cachedShort.Credentials("host")
+	if short.calls != 2 {
+		t.Errorf("expected short-lived token to be refreshed at half-life, got %d calls", short.calls)
+	}
+
+	clock.Advance(tokenDefaultLifetime - 3*time.Minute)
+	cachedForever.Credentials("host")
+	if forever.calls != 1 {
+		t.Errorf("expected token with no expiry to be kept for %s, got %d calls", tokenDefaultLifetime, forever.calls)
+	}
+	clock.Advance(time.Minute)
+	cachedForever.Credentials("host")
+	if forever.calls != 2 {
+		t.Errorf("expected token with no expiry to be refreshed after %s, got %d calls", tokenDefaultLifetime, forever.calls)
+	}
+}
+
+func TestTokenCache_EvictsExpired(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	cache := newTokenCache(clock)
+	provider := &countingProvider{
+		token: Token{Password: "token", Expiry: clock.Now().Add(time.Hour)},
+	}
+	cache.cached(flux.CredentialProviderConfig{Type: "old"}, provider).Credentials("host")
+	failing := &countingProvider{err: errors.New("provider down")}
+	cache.cached(flux.CredentialProviderConfig{Type: "failing"}, failing).Credentials("host")
+	if len(cache.tokens) != 2 {
+		t.Fatalf("expected two entries, got %d", len(cache.tokens))
+	}
+
+	// An entry that never got a token goes once it's been there for
+	// a while; one with a token stays until the token expires.
+	clock.Advance(tokenDefaultLifetime + time.Second)
+	provider.token.Expiry = clock.Now().Add(time.Hour)
+	current := cache.cached(flux.CredentialProviderConfig{Type: "current"}, provider)
+	current.Credentials("host")
+	if len(cache.tokens) != 2 {
+		t.Errorf("expected the entry with no token to be dropped, got %d entries", len(cache.tokens))
+	}
+	clock.Advance(time.Hour)
+	current.Credentials("host")
+	if len(cache.tokens) != 1 {
+		t.Errorf("expected the expired token to be dropped, got %d entries", len(cache.tokens))
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// The "get-vanilla" case from the AWS signature v4 test suite
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	now, _ := time.Parse("20060102T150405Z", "20150830T123600Z")
+	signV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", now)
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+func TestECRProvider(t *testing.T) {
+	expiresAt := time.Now().Add(12 * time.Hour).Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target := r.Header.Get("X-Amz-Target"); target != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" {
+			t.Errorf("unexpected target %q", target)
+		}
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(auth, "/eu-west-1/ecr/aws4_request") {
+			t.Errorf("unexpected authorization %q", auth)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != `{"registryIds":["123456789012"]}` {
+			t.Errorf("unexpected request body %s", body)
+		}
+		fmt.Fprintf(w, `{"authorizationData": [{"authorizationToken": %q, "expiresAt": %d, "proxyEndpoint": "https://123456789012.dkr.ecr.eu-west-1.amazonaws.com"}]}`,
+			base64.StdEncoding.EncodeToString([]byte("AWS:ecrpassword")), expiresAt.Unix())
+	}))
+	defer server.Close()
+
+	provider, err := NewCredentialProvider(flux.CredentialProviderConfig{
+		Type:            flux.CredentialProviderECR,
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		Endpoint:        server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := provider.Credentials("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Username != "AWS" || token.Password != "ecrpassword" || !token.Expiry.Equal(expiresAt) {
+		t.Errorf("unexpected token %#v", token)
+	}
+
+	if _, err := provider.Credentials("registry.example.com"); err == nil {
+		t.Errorf("expected error for a host that isn't ECR, with no region given")
+	}
+}
+
+func TestGCRProvider(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if grant := r.Form.Get("grant_type"); grant != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("unexpected grant type %q", grant)
+		}
+		if r.Form.Get("assertion") == "" {
+			t.Errorf("expected a signed JWT assertion")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "gcrtoken", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	key, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "flux@example.iam.gserviceaccount.com",
+		"private_key":  string(keyPEM),
+		"token_uri":    server.URL,
+	})
+	provider, err := NewCredentialProvider(flux.CredentialProviderConfig{
+		Type:              flux.CredentialProviderGCR,
+		ServiceAccountKey: string(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := provider.Credentials("gcr.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Username != gcrUsername || token.Password != "gcrtoken" || token.Expiry.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("unexpected token %#v", token)
+	}
+}
+
+func TestACRProvider(t *testing.T) {
+	expiry := time.Now().Add(3 * time.Hour).Truncate(time.Second)
+	claims, _ := json.Marshal(map[string]int64{"exp": expiry.Unix()})
+	refreshToken := "header." + base64.RawURLEncoding.EncodeToString(claims) + ".signature"
+
+	var registryHost string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/mytenant/oauth2/token":
+			if r.Form.Get("client_id") != "myclient" || r.Form.Get("client_secret") != "mysecret" {
+				t.Errorf("unexpected client credentials %v", r.Form)
+			}
+			fmt.Fprint(w, `{"access_token": "aadtoken"}`)
+		case "/oauth2/exchange":
+			if r.Form.Get("access_token") != "aadtoken" || r.Form.Get("service") != registryHost {
+				t.Errorf("unexpected exchange %v", r.Form)
+			}
+			fmt.Fprintf(w, `{"refresh_token": %q}`, refreshToken)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	registryHost = u.Host
+
+	provider, err := NewCredentialProvider(flux.CredentialProviderConfig{
+		Type:         flux.CredentialProviderACR,
+		TenantID:     "mytenant",
+		ClientID:     "myclient",
+		ClientSecret: "mysecret",
+		Endpoint:     server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.(*acrProvider).registryScheme = "http"
+	token, err := provider.Credentials(registryHost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Username != acrUsername || token.Password != refreshToken || !token.Expiry.Equal(expiry) {
+		t.Errorf("unexpected token %#v", token)
+	}
+}
+
+func TestHelperProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flux-credential-helper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := `#!/bin/sh
+read host
+if [ "$1" = get ] && [ "$host" = registry.example.com ]; then
+  echo '{"ServerURL": "registry.example.com", "Username": "helperuser", "Secret": "helpersecret"}'
+else
+  echo "credentials not found in native keychain"
+  exit 1
+fi
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	conf := flux.CredentialProviderConfig{
+		Type:   flux.CredentialProviderHelper,
+		Helper: "fake",
+	}
+	// Helpers can only be used once they're allowed
+	if _, err := NewCredentialProvider(conf); err == nil {
+		t.Fatal("expected error for helper that isn't allowed")
+	}
+	AllowCredentialHelpers([]string{"fake"})
+	defer AllowCredentialHelpers(nil)
+
+	provider, err := NewCredentialProvider(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := provider.Credentials("registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Username != "helperuser" || token.Password != "helpersecret" {
+		t.Errorf("unexpected token %#v", token)
+	}
+	if _, err = provider.Credentials("other.example.com"); err == nil || !strings.Contains(err.Error(), "credentials not found") {
+		t.Errorf("expected error from helper, got %v", err)
+	}
+}
+
+func TestNewCredentialProvider_Invalid(t *testing.T) {
+	for _, conf := range []flux.CredentialProviderConfig{
+		{Type: "unknown"},
+		{Type: flux.CredentialProviderECR, AccessKeyID: "AKIDEXAMPLE"},
+		{Type: flux.CredentialProviderGCR, ServiceAccountKey: "not JSON"},
+		{Type: flux.CredentialProviderGCR, ServiceAccountKey: "{}"},
+		{Type: flux.CredentialProviderACR, TenantID: "mytenant"},
+		{Type: flux.CredentialProviderHelper, Helper: "../../bin/sh"},
+		{Type: flux.CredentialProviderHelper, Helper: "notallowed"},
+	} {
+		if _, err := NewCredentialProvider(conf); err == nil {
+			t.Errorf("expected error for %#v", conf)
+		}
+	}
+}
+
+func TestCredentialsFromConfig_Providers(t *testing.T) {
+	AllowCredentialHelpers([]string{"ecr-login"})
+	defer AllowCredentialHelpers(nil)
+	clock := clockwork.NewFakeClock()
+	conf := flux.UnsafeInstanceConfig{
+		Registry: flux.RegistryConfig{
+			Auths: map[string]flux.Auth{
+				"123456789012.dkr.ecr.eu-west-1.amazonaws.com": {
+					Auth: base64.StdEncoding.EncodeToString([]byte("static:password")),
+				},
+			},
+			CredentialProviders: map[string]flux.CredentialProviderConfig{
+				"*.dkr.ecr.eu-west-1.amazonaws.com": {
+					Type:   flux.CredentialProviderHelper,
+					Helper: "ecr-login",
+				},
+			},
+		},
+	}
+	creds, err := credentialsFromConfig(conf, newTokenCache(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &countingProvider{token: Token{Username: "AWS", Password: "token"}}
+	creds.providers["*.dkr.ecr.eu-west-1.amazonaws.com"] = provider
+
+	// Static credentials win
+	if c, err := creds.credsFor("123456789012.dkr.ecr.eu-west-1.amazonaws.com"); err != nil || c.username != "static" {
+		t.Errorf("expected static credentials, got %v, %v", c, err)
+	}
+	if c, err := creds.credsFor("210987654321.dkr.ecr.eu-west-1.amazonaws.com"); err != nil || c.username != "AWS" || c.password != "token" {
+		t.Errorf("expected credentials from provider, got %v, %v", c, err)
+	}
+	if c, err := creds.credsFor("quay.io"); err != nil || c.username != "" {
+		t.Errorf("expected no credentials, got %v, %v", c, err)
+	}
+	if len(creds.Hosts()) != 2 {
+		t.Errorf("expected hosts from both auths and providers, got %v", creds.Hosts())
+	}
+
+	conf.Registry.CredentialProviders["["] = flux.CredentialProviderConfig{Type: flux.CredentialProviderHelper, Helper: "ecr-login"}
+	if _, err := credentialsFromConfig(conf, newTokenCache(clock)); err == nil {
+		t.Errorf("expected error for bad host pattern")
+	}
+}
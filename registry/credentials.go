@@ -3,7 +3,9 @@ package registry
 import (
 	"encoding/base64"
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/weaveworks/flux"
+	"path"
 	"strings"
 )
 
@@ -14,7 +16,16 @@ func NoCredentials() Credentials {
 	}
 }
 
+// CredentialsFromConfig gives the credentials for the registries in
+// the config: those given outright, and those to be got from a
+// credential provider. Tokens from providers are shared between all
+// the credentials made here, so they are only fetched again when
+// they are about to expire.
 func CredentialsFromConfig(config flux.UnsafeInstanceConfig) (Credentials, error) {
+	return credentialsFromConfig(config, sharedTokens)
+}
+
+func credentialsFromConfig(config flux.UnsafeInstanceConfig, tokens *tokenCache) (Credentials, error) {
 	m := map[string]creds{}
 	for host, entry := range config.Registry.Auths {
 		decodedAuth, err := base64.StdEncoding.DecodeString(entry.Auth)
@@ -31,18 +42,61 @@ func CredentialsFromConfig(config flux.UnsafeInstanceConfig) (Credentials, error
 			password: authParts[1],
 		}
 	}
-	return Credentials{m: m}, nil
+	providers := map[string]CredentialProvider{}
+	for host, conf := range config.Registry.CredentialProviders {
+		if _, err := path.Match(host, ""); err != nil {
+			return Credentials{}, errors.Wrapf(err, "credential provider host %q", host)
+		}
+		provider, err := NewCredentialProvider(conf)
+		if err != nil {
+			return Credentials{}, errors.Wrapf(err, "credential provider for %s", host)
+		}
+		providers[host] = tokens.cached(conf, provider)
+	}
+	return Credentials{m: m, providers: providers}, nil
 }
 
-// For yields an authenticator for a specific host.
-func (cs Credentials) credsFor(host string) creds {
+// For yields an authenticator for a specific host. Credentials given
+// outright take precedence over those from a provider.
+func (cs Credentials) credsFor(host string) (creds, error) {
 	if cred, found := cs.m[host]; found {
-		return cred
+		return cred, nil
 	}
 	if cred, found := cs.m[fmt.Sprintf("https://%s/v1/", host)]; found {
-		return cred
+		return cred, nil
+	}
+	if provider, found := cs.providerFor(host); found {
+		token, err := provider.Credentials(host)
+		if err != nil {
+			return creds{}, errors.Wrapf(err, "getting credentials for %s", host)
+		}
+		return creds{
+			username: token.Username,
+			password: token.Password,
+		}, nil
+	}
+	return creds{}, nil
+}
+
+// providerFor finds the provider for a host, preferring one given
+// for exactly that host to one given by a pattern.
+func (cs Credentials) providerFor(host string) (CredentialProvider, bool) {
+	if provider, found := cs.providers[host]; found {
+		return provider, true
 	}
-	return creds{}
+	var (
+		match    string
+		provider CredentialProvider
+	)
+	for pattern, p := range cs.providers {
+		// Patterns are checked when the credentials are made. Go
+		// through them all, and pick the first in order, so that
+		// the result doesn't depend on map iteration.
+		if ok, _ := path.Match(pattern, host); ok && (provider == nil || pattern < match) {
+			match, provider = pattern, p
+		}
+	}
+	return provider, provider != nil
 }
 
 // Hosts returns all of the hosts available in these credentials.
@@ -51,5 +105,8 @@ func (cs Credentials) Hosts() []string {
 	for host := range cs.m {
 		hosts = append(hosts, host)
 	}
+	for host := range cs.providers {
+		hosts = append(hosts, host)
+	}
 	return hosts
 }
@@ -0,0 +1,171 @@
+package registry
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+// Index keeps what is known about the images in the repositories
+// each instance uses, so it doesn't have to be fetched from the
+// registries every time it's wanted. It's kept up to date by scanning
+// the registries in the background.
+type Index interface {
+	// Repositories lists the repositories indexed for the instance.
+	Repositories(inst flux.InstanceID) ([]string, error)
+	// GetRepository gives what's indexed for the repository. If it
+	// has never been scanned, the result has a zero ScannedAt.
+	GetRepository(inst flux.InstanceID, repository string) (IndexedRepository, error)
+	// PutRepository replaces what's indexed for the repository.
+	PutRepository(inst flux.InstanceID, repo IndexedRepository) error
+	// DeleteRepository forgets the repository.
+	DeleteRepository(inst flux.InstanceID, repository string) error
+}
+
+// IndexedRepository is the result of scanning a repository.
+type IndexedRepository struct {
+	// The repository, as given by `Repository.String()`
+	Repository string
+	// When the repository was last scanned, and the error from that
+	// scan if it failed.
+	ScannedAt time.Time
+	Error     string
+	Images    []IndexedImage
+}
+
+// IndexedImage is what we know about the image with a tag, and when
+// we found it out.
+type IndexedImage struct {
+	Tag       string
+	Info      ImageInfo
+	FetchedAt time.Time
+}
+
+// Fresh says whether the repository was successfully scanned in the
+// last maxAge.
+func (r IndexedRepository) Fresh(now time.Time, maxAge time.Duration) bool {
+	return !r.ScannedAt.IsZero() && r.Error == "" && now.Sub(r.ScannedAt) <= maxAge
+}
+
+// ToImages gives the images indexed, most recently created first,
+// as they would be got from the registry.
+func (r IndexedRepository) ToImages(repository Repository) []flux.Image {
+	images := make([]flux.Image, len(r.Images))
+	for i, indexed := range r.Images {
+		images[i] = withInfo(repository.ToImage(indexed.Tag), indexed.Info)
+	}
+	sort.Sort(byCreatedDesc(images))
+	return images
+}
+
+// IndexImage gives the entry for an image fetched from a registry.
+func IndexImage(img flux.Image, fetchedAt time.Time) IndexedImage {
+	return IndexedImage{
+		Tag:       img.Tag,
+		Info:      infoOf(img),
+		FetchedAt: fetchedAt,
+	}
+}
+
+// ---
+
+type indexedRegistry struct {
+	inst   flux.InstanceID
+	index  Index
+	maxAge time.Duration
+	next   Registry
+}
+
+// NewIndexedRegistry gives a Registry that serves repositories from
+// the index, if they have been scanned in the last maxAge, and
+// otherwise from the registry given.
+func NewIndexedRegistry(inst flux.InstanceID, index Index, maxAge time.Duration, next Registry) Registry {
+	return &indexedRegistry{
+		inst:   inst,
+		index:  index,
+		maxAge: maxAge,
+		next:   next,
+	}
+}
+
+func (r *indexedRegistry) GetRepository(repository Repository) ([]flux.Image, error) {
+	// If the index can't be read, we can still go to the registry;
+	// it's just slower.
+	indexed, err := r.index.GetRepository(r.inst, repository.String())
+	if err == nil && indexed.Fresh(time.Now(), r.maxAge) {
+		return indexed.ToImages(repository), nil
+	}
+	return r.next.GetRepository(repository)
+}
+
+// Single images are wanted when releasing, when it's important to
+// know what the tag points at right now, so these go to the registry.
+
+func (r *indexedRegistry) GetImage(repository Repository, tag string) (flux.Image, error) {
+	return r.next.GetImage(repository, tag)
+}
+
+func (r *indexedRegistry) GetTags(repository Repository) ([]string, error) {
+	return r.next.GetTags(repository)
+}
+
+func (r *indexedRegistry) GetImages(repository Repository, tags []string) ([]flux.Image, error) {
+	return r.next.GetImages(repository, tags)
+}
+
+// ---
+
+type memIndex struct {
+	mu    sync.Mutex
+	repos map[flux.InstanceID]map[string]IndexedRepository
+}
+
+// NewMemIndex gives an Index kept in memory, for when there's no
+// database to hand.
+func NewMemIndex() Index {
+	return &memIndex{
+		repos: map[flux.InstanceID]map[string]IndexedRepository{},
+	}
+}
+
+func (m *memIndex) Repositories(inst flux.InstanceID) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.repos[inst] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *memIndex) GetRepository(inst flux.InstanceID, repository string) (IndexedRepository, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	repo, ok := m.repos[inst][repository]
+	if !ok {
+		return IndexedRepository{Repository: repository}, nil
+	}
+	repo.Images = append([]IndexedImage(nil), repo.Images...)
+	return repo, nil
+}
+
+func (m *memIndex) PutRepository(inst flux.InstanceID, repo IndexedRepository) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.repos[inst] == nil {
+		m.repos[inst] = map[string]IndexedRepository{}
+	}
+	repo.Images = append([]IndexedImage(nil), repo.Images...)
+	m.repos[inst][repo.Repository] = repo
+	return nil
+}
+
+func (m *memIndex) DeleteRepository(inst flux.InstanceID, repository string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.repos[inst], repository)
+	return nil
+}
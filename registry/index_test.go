@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+)
+
+func TestIndexedRegistry(t *testing.T) {
+	inst := flux.InstanceID("instance")
+	repo, err := ParseRepository("quay.io/weaveworks/helloworld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	older, newer := time.Now().Add(-time.Hour).UTC(), time.Now().UTC()
+	index := NewMemIndex()
+	live := NewMockRegistry(nil, errors.New("went to the registry"))
+	reg := NewIndexedRegistry(inst, index, time.Minute, live)
+
+	// Not scanned yet
+	if _, err := reg.GetRepository(repo); err == nil {
+		t.Fatal("expected to go to the registry for a repository not indexed")
+	}
+
+	index.PutRepository(inst, IndexedRepository{
+		Repository: repo.String(),
+		ScannedAt:  time.Now(),
+		Images: []IndexedImage{
+			{Tag: "older", Info: ImageInfo{Digest: "sha256:1", CreatedAt: older}},
+			{Tag: "newer", Info: ImageInfo{Digest: "sha256:2", CreatedAt: newer}},
+		},
+	})
+	images, err := reg.GetRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("expected two images, got %#v", images)
+	}
+	if images[0].Tag != "newer" || images[0].Digest != "sha256:2" || !images[0].CreatedAt.Equal(newer) {
+		t.Errorf("expected newest image first, got %#v", images[0])
+	}
+	if images[1].ImageID.String() != "quay.io/weaveworks/helloworld:older@sha256:1" {
+		t.Errorf("unexpected image ID %s", images[1].ImageID)
+	}
+
+	// Scanned, but failed, or too long ago
+	for _, indexed := range []IndexedRepository{
+		{Repository: repo.String(), ScannedAt: time.Now(), Error: "unauthorized"},
+		{Repository: repo.String(), ScannedAt: time.Now().Add(-time.Hour)},
+	} {
+		index.PutRepository(inst, indexed)
+		if _, err := reg.GetRepository(repo); err == nil {
+			t.Errorf("expected to go to the registry for %#v", indexed)
+		}
+	}
+}
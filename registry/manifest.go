@@ -0,0 +1,329 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The kinds of manifest we know how to read. Registries may serve an
+// image in any of these, depending on how it was pushed and what we
+// say we accept.
+const (
+	MediaTypeManifestV1       = "application/vnd.docker.distribution.manifest.v1+json"
+	MediaTypeSignedManifestV1 = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+	MediaTypeManifestV2       = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeManifestList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest      = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex         = "application/vnd.oci.image.index.v1+json"
+)
+
+// In order of preference; we'd rather have anything than schema1.
+var acceptManifests = []string{
+	MediaTypeOCIIndex,
+	MediaTypeManifestList,
+	MediaTypeOCIManifest,
+	MediaTypeManifestV2,
+	MediaTypeSignedManifestV1,
+	MediaTypeManifestV1,
+}
+
+// For multi-arch images, the platform whose image we describe.
+const (
+	defaultOS   = "linux"
+	defaultArch = "amd64"
+)
+
+// Manifests and config blobs are small; anything much bigger than
+// this is not what we're looking for.
+const maxManifestSize = 4 * 1024 * 1024
+
+// ImageInfo is what we can find out about an image from its manifest
+// and config, whatever format they come in.
+type ImageInfo struct {
+	// The digest of the manifest; for a multi-arch image, this is the
+	// digest of the index (or list), since that's what the tag
+	// refers to.
+	Digest       string            `json:"digest,omitempty"`
+	CreatedAt    time.Time         `json:"createdAt,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	OS           string            `json:"os,omitempty"`
+	Architecture string            `json:"architecture,omitempty"`
+	// For a multi-arch image, the platforms it's available for, as
+	// "os/architecture" (with "/variant" if there is one). The other
+	// fields describe the image for the default platform, or the
+	// first listed if that isn't available.
+	Platforms []string `json:"platforms,omitempty"`
+}
+
+// The bits of an image config we want. Schema1 manifests carry the
+// same fields, JSON-encoded in the `v1Compatibility` of each entry in
+// the history.
+type imageConfig struct {
+	Created      time.Time `json:"created"`
+	OS           string    `json:"os"`
+	Architecture string    `json:"architecture"`
+	Config       struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+type schema1Manifest struct {
+	History []struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	} `json:"history"`
+}
+
+type schema2Manifest struct {
+	Config struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"config"`
+}
+
+type manifestIndex struct {
+	Manifests []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+		Platform  struct {
+			Architecture string `json:"architecture"`
+			OS           string `json:"os"`
+			Variant      string `json:"variant,omitempty"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// manifestFetcher gets manifests and blobs for a repository, using
+// the registry API directly, since the client library only knows
+// about schema1 manifests.
+type manifestFetcher struct {
+	client     *http.Client
+	baseURL    string
+	repository string
+}
+
+// imageInfo fetches the manifest for the reference (a tag or digest)
+// given, following an index to the image for the default platform,
+// and the config blob where there is one.
+func (f manifestFetcher) imageInfo(reference string) (ImageInfo, error) {
+	var info ImageInfo
+	mediaType, digest, body, err := f.manifest(reference)
+	if err != nil {
+		return info, err
+	}
+	info.Digest = digest
+
+	if mediaType == MediaTypeManifestList || mediaType == MediaTypeOCIIndex {
+		var index manifestIndex
+		if err = json.Unmarshal(body, &index); err != nil {
+			return info, errors.Wrap(err, "decoding manifest index")
+		}
+		if len(index.Manifests) == 0 {
+			return info, errors.New("manifest index lists no images")
+		}
+		chosen := -1
+		for i, m := range index.Manifests {
+			platform := m.Platform.OS + "/" + m.Platform.Architecture
+			if m.Platform.Variant != "" {
+				platform += "/" + m.Platform.Variant
+			}
+			info.Platforms = append(info.Platforms, platform)
+			if chosen < 0 && m.Platform.OS == defaultOS && m.Platform.Architecture == defaultArch {
+				chosen = i
+			}
+		}
+		if chosen < 0 {
+			chosen = 0
+		}
+		mediaType, _, body, err = f.manifest(index.Manifests[chosen].Digest)
+		if err != nil {
+			return info, errors.Wrapf(err, "fetching manifest for %s", info.Platforms[chosen])
+		}
+	}
+
+	var config imageConfig
+	switch mediaType {
+	case MediaTypeManifestV2, MediaTypeOCIManifest:
+		var manifest schema2Manifest
+		if err = json.Unmarshal(body, &manifest); err != nil {
+			return info, errors.Wrap(err, "decoding manifest")
+		}
+		if manifest.Config.Digest == "" {
+			return info, errors.New("manifest has no config")
+		}
+		blob, err := f.get("/blobs/"+manifest.Config.Digest, nil)
+		if err != nil {
+			return info, errors.Wrap(err, "fetching image config")
+		}
+		defer blob.Body.Close()
+		configBytes, err := readLimited(blob.Body)
+		if err != nil {
+			return info, errors.Wrap(err, "reading image config")
+		}
+		if err = json.Unmarshal(configBytes, &config); err != nil {
+			return info, errors.Wrap(err, "decoding image config")
+		}
+	case MediaTypeManifestV1, MediaTypeSignedManifestV1:
+		// The history appears most-recent (i.e., topmost layer)
+		// first, so we just decode the first entry.
+		var manifest schema1Manifest
+		if err = json.Unmarshal(body, &manifest); err != nil {
+			return info, errors.Wrap(err, "decoding manifest")
+		}
+		if len(manifest.History) > 0 {
+			// Older images may have junk in here; it's no reason
+			// not to report the image.
+			json.Unmarshal([]byte(manifest.History[0].V1Compatibility), &config)
+		}
+	default:
+		return info, fmt.Errorf("unknown manifest type %q", mediaType)
+	}
+
+	info.CreatedAt = config.Created
+	info.OS = config.OS
+	info.Architecture = config.Architecture
+	info.Labels = config.Config.Labels
+	return info, nil
+}
+
+// manifest fetches a manifest, and returns its media type, digest
+// and content.
+func (f manifestFetcher) manifest(reference string) (mediaType, digest string, body []byte, err error) {
+	res, err := f.get("/manifests/"+reference, acceptManifests)
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer res.Body.Close()
+	if body, err = readLimited(res.Body); err != nil {
+		return "", "", nil, errors.Wrap(err, "reading manifest")
+	}
+
+	mediaType = manifestMediaType(res.Header.Get("Content-Type"), body)
+	digest = res.Header.Get("Docker-Content-Digest")
+	if digest == "" && strings.HasPrefix(reference, "sha256:") {
+		digest = reference
+	}
+	if digest == "" && mediaType != MediaTypeSignedManifestV1 {
+		// The digest of a signed manifest is of its content without
+		// the signatures, so we can only work it out for the others.
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+	return mediaType, digest, body, nil
+}
+
+// manifestMediaType works out what kind of manifest we've been given.
+// Registries don't always set the content type, or set it to
+// something generic, so failing that we look at the manifest itself.
+func manifestMediaType(contentType string, body []byte) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		for _, known := range acceptManifests {
+			if mediaType == known {
+				return mediaType
+			}
+		}
+	}
+	var versioned struct {
+		SchemaVersion int    `json:"schemaVersion"`
+		MediaType     string `json:"mediaType"`
+		Manifests     []json.RawMessage
+	}
+	if err := json.Unmarshal(body, &versioned); err != nil {
+		return contentType
+	}
+	switch {
+	case versioned.MediaType != "":
+		return versioned.MediaType
+	case versioned.SchemaVersion == 1:
+		return MediaTypeManifestV1
+	case versioned.Manifests != nil:
+		return MediaTypeOCIIndex
+	case versioned.SchemaVersion == 2:
+		return MediaTypeOCIManifest
+	}
+	return contentType
+}
+
+func (f manifestFetcher) get(path string, accept []string) (*http.Response, error) {
+	url := strings.TrimSuffix(f.baseURL, "/") + "/v2/" + f.repository + path
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, mediaType := range accept {
+		req.Header.Add("Accept", mediaType)
+	}
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		if res.StatusCode == http.StatusNotFound {
+			return nil, NotFoundError{URL: url, Status: res.Status}
+		}
+		return nil, StatusError{URL: url, StatusCode: res.StatusCode, Status: res.Status}
+	}
+	return res, nil
+}
+
+// NotFoundError is returned when the registry says it doesn't have
+// the manifest (or blob) asked for.
+type NotFoundError struct {
+	URL    string
+	Status string
+}
+
+func (err NotFoundError) Error() string {
+	return fmt.Sprintf("fetching %s: %s", err.URL, err.Status)
+}
+
+// IsNotFound says whether the error is, or was caused by, the
+// registry not having something.
+func IsNotFound(err error) bool {
+	_, ok := errors.Cause(err).(NotFoundError)
+	return ok
+}
+
+// StatusError is returned when the registry responds with an error
+// status other than 404.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (err StatusError) Error() string {
+	return fmt.Sprintf("fetching %s: %s", err.URL, err.Status)
+}
+
+// Temporary says whether the error is on the registry's side (a 5xx
+// status), so might not happen if tried again.
+func (err StatusError) Temporary() bool {
+	return err.StatusCode >= 500
+}
+
+// IsServerError says whether the error is, or was caused by, the
+// registry responding with a 5xx status.
+func IsServerError(err error) bool {
+	statusErr, ok := errors.Cause(err).(StatusError)
+	return ok && statusErr.Temporary()
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	body, err := ioutil.ReadAll(io.LimitReader(r, maxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxManifestSize {
+		return nil, errors.New("too large")
+	}
+	return body, nil
+}
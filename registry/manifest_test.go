@@ -0,0 +1,192 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	testConfig = `{
+  "architecture": "arm64",
+  "os": "linux",
+  "created": "2017-05-03T11:30:20.409925312Z",
+  "config": {"Labels": {"org.label-schema.vcs-ref": "abc123"}}
+}`
+	testManifestV2 = `{
+  "schemaVersion": 2,
+  "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+  "config": {
+    "mediaType": "application/vnd.docker.container.image.v1+json",
+    "digest": "sha256:config"
+  },
+  "layers": []
+}`
+	testOCIManifest = `{
+  "schemaVersion": 2,
+  "config": {
+    "mediaType": "application/vnd.oci.image.config.v1+json",
+    "digest": "sha256:config"
+  },
+  "layers": []
+}`
+	testIndex = `{
+  "schemaVersion": 2,
+  "manifests": [
+    {"digest": "sha256:windows", "platform": {"os": "windows", "architecture": "amd64"}},
+    {"digest": "sha256:arm", "platform": {"os": "linux", "architecture": "arm", "variant": "v7"}},
+    {"digest": "sha256:amd64", "platform": {"os": "linux", "architecture": "amd64"}}
+  ]
+}`
+	testManifestV1 = `{
+  "schemaVersion": 1,
+  "history": [
+    {"v1Compatibility": "{\"created\":\"2017-01-13T16:22:58.009923189Z\",\"os\":\"linux\",\"architecture\":\"amd64\"}"},
+    {"v1Compatibility": "{\"created\":\"2016-01-13T16:22:58.009923189Z\"}"}
+  ]
+}`
+)
+
+type testDocument struct {
+	contentType string
+	body        string
+}
+
+// A registry serving the manifests and blobs given, for the
+// repository "weaveworks/test".
+func testRegistry(t *testing.T, manifests, blobs map[string]testDocument) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		docs, prefix := manifests, "/v2/weaveworks/test/manifests/"
+		if len(r.URL.Path) > len(prefix) && r.URL.Path[:len(prefix)] == prefix {
+			if len(r.Header["Accept"]) == 0 {
+				t.Errorf("expected Accept headers when fetching manifest")
+			}
+		} else {
+			docs, prefix = blobs, "/v2/weaveworks/test/blobs/"
+		}
+		if len(r.URL.Path) <= len(prefix) || r.URL.Path[:len(prefix)] != prefix {
+			http.NotFound(w, r)
+			return
+		}
+		doc, ok := docs[r.URL.Path[len(prefix):]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if doc.contentType != "" {
+			w.Header().Set("Content-Type", doc.contentType)
+		}
+		w.Write([]byte(doc.body))
+	}))
+}
+
+func mustParseTime(t *testing.T, s string) time.Time {
+	created, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func TestImageInfo(t *testing.T) {
+	config := map[string]testDocument{
+		"sha256:config": {"application/octet-stream", testConfig},
+	}
+	configInfo := ImageInfo{
+		CreatedAt:    mustParseTime(t, "2017-05-03T11:30:20.409925312Z"),
+		Labels:       map[string]string{"org.label-schema.vcs-ref": "abc123"},
+		OS:           "linux",
+		Architecture: "arm64",
+	}
+	digestOf := func(body string) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(body)))
+	}
+
+	for name, x := range map[string]struct {
+		manifests map[string]testDocument
+		expected  func(ImageInfo) ImageInfo
+	}{
+		"schema2": {
+			manifests: map[string]testDocument{
+				"tag": {MediaTypeManifestV2, testManifestV2},
+			},
+			expected: func(info ImageInfo) ImageInfo {
+				info.Digest = digestOf(testManifestV2)
+				return info
+			},
+		},
+		"OCI manifest, without a content type": {
+			manifests: map[string]testDocument{
+				"tag": {"", testOCIManifest},
+			},
+			expected: func(info ImageInfo) ImageInfo {
+				info.Digest = digestOf(testOCIManifest)
+				return info
+			},
+		},
+		"OCI index": {
+			manifests: map[string]testDocument{
+				"tag":            {MediaTypeOCIIndex + "; charset=utf-8", testIndex},
+				"sha256:amd64":   {MediaTypeOCIManifest, testOCIManifest},
+				"sha256:arm":     {MediaTypeOCIManifest, `{"config": {}}`},
+				"sha256:windows": {MediaTypeOCIManifest, `{"config": {}}`},
+			},
+			expected: func(info ImageInfo) ImageInfo {
+				info.Digest = digestOf(testIndex)
+				info.Platforms = []string{"windows/amd64", "linux/arm/v7", "linux/amd64"}
+				return info
+			},
+		},
+		"schema1": {
+			manifests: map[string]testDocument{
+				"tag": {"application/json", testManifestV1},
+			},
+			expected: func(ImageInfo) ImageInfo {
+				return ImageInfo{
+					Digest:       digestOf(testManifestV1),
+					CreatedAt:    mustParseTime(t, "2017-01-13T16:22:58.009923189Z"),
+					OS:           "linux",
+					Architecture: "amd64",
+				}
+			},
+		},
+	} {
+		server := testRegistry(t, x.manifests, config)
+		info, err := manifestFetcher{
+			client:     http.DefaultClient,
+			baseURL:    server.URL,
+			repository: "weaveworks/test",
+		}.imageInfo("tag")
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if expected := x.expected(configInfo); !reflect.DeepEqual(expected, info) {
+			t.Errorf("%s: expected\n%#v\ngot\n%#v", name, expected, info)
+		}
+	}
+}
+
+func TestImageInfo_Errors(t *testing.T) {
+	server := testRegistry(t, map[string]testDocument{
+		"noconfig": {MediaTypeManifestV2, testManifestV2},
+		"unknown":  {"text/plain", "hello"},
+	}, nil)
+	defer server.Close()
+
+	fetcher := manifestFetcher{
+		client:     http.DefaultClient,
+		baseURL:    server.URL,
+		repository: "weaveworks/test",
+	}
+	for _, tag := range []string{"missing", "noconfig", "unknown"} {
+		if _, err := fetcher.imageInfo(tag); err == nil {
+			t.Errorf("expected error for %s", tag)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package registry
 
 import (
-	"github.com/docker/distribution/manifest/schema1"
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
@@ -37,22 +36,26 @@ func (r *mockRemote) Manifest(repository Repository, tag string) (flux.Image, er
 	return r.img, r.err
 }
 
+func (r *mockRemote) FreshManifest(repository Repository, tag string) (flux.Image, error) {
+	return r.Manifest(repository, tag)
+}
+
 func (r *mockRemote) Cancel() {
 }
 
 type mockDockerClient struct {
-	manifest func(repository, reference string) ([]schema1.History, error)
+	manifest func(repository, reference string) (ImageInfo, error)
 	tags     func(repository string) ([]string, error)
 }
 
-func NewMockDockerClient(manifest func(repository, reference string) ([]schema1.History, error), tags func(repository string) ([]string, error)) dockerRegistryInterface {
+func NewMockDockerClient(manifest func(repository, reference string) (ImageInfo, error), tags func(repository string) ([]string, error)) dockerRegistryInterface {
 	return &mockDockerClient{
 		manifest: manifest,
 		tags:     tags,
 	}
 }
 
-func (m *mockDockerClient) Manifest(repository, reference string) ([]schema1.History, error) {
+func (m *mockDockerClient) Manifest(repository, reference string) (ImageInfo, error) {
 	return m.manifest(repository, reference)
 }
 
@@ -99,13 +102,37 @@ func (m *mockRegistry) GetRepository(repository Repository) ([]flux.Image, error
 	return imgs, m.err
 }
 
-func (m *mockRegistry) GetImage(repository Repository, tag string) (flux.Image, error) {
-	if len(m.imgs) > 0 {
-		for _, i := range m.imgs {
-			if i.String() == repository.ToImage(tag).String() {
-				return i, nil
-			}
+func (m *mockRegistry) GetImage(repository Repository, reference string) (flux.Image, error) {
+	want := repository.ToImage(reference)
+	for _, i := range m.imgs {
+		if i.Repository() != want.Repository() {
+			continue
+		}
+		if (want.Digest != "" && i.Digest == want.Digest) || (want.Digest == "" && i.Tag == want.Tag) {
+			return i, nil
 		}
 	}
 	return flux.Image{}, errors.New("not found")
 }
+
+func (m *mockRegistry) GetTags(repository Repository) ([]string, error) {
+	var tags []string
+	for _, i := range m.imgs {
+		if i.ImageID.NamespaceImage() == repository.NamespaceImage() && i.Tag != "" {
+			tags = append(tags, i.Tag)
+		}
+	}
+	return tags, m.err
+}
+
+func (m *mockRegistry) GetImages(repository Repository, tags []string) ([]flux.Image, error) {
+	var imgs []flux.Image
+	for _, tag := range tags {
+		img, err := m.GetImage(repository, tag)
+		if err != nil {
+			return imgs, err
+		}
+		imgs = append(imgs, img)
+	}
+	return imgs, m.err
+}
@@ -39,6 +39,24 @@ func (m *instrumentedRegistry) GetImage(repository Repository, tag string) (res
 	return
 }
 
+func (m *instrumentedRegistry) GetTags(repository Repository) (res []string, err error) {
+	start := time.Now()
+	res, err = m.next.GetTags(repository)
+	fetchDuration.With(
+		fluxmetrics.LabelSuccess, strconv.FormatBool(err == nil),
+	).Observe(time.Since(start).Seconds())
+	return
+}
+
+func (m *instrumentedRegistry) GetImages(repository Repository, tags []string) (res []flux.Image, err error) {
+	start := time.Now()
+	res, err = m.next.GetImages(repository, tags)
+	fetchDuration.With(
+		fluxmetrics.LabelSuccess, strconv.FormatBool(err == nil),
+	).Observe(time.Since(start).Seconds())
+	return
+}
+
 type InstrumentedRemote Remote
 
 type instrumentedRemote struct {
@@ -61,6 +79,16 @@ func (m *instrumentedRemote) Manifest(repository Repository, tag string) (res fl
 	return
 }
 
+func (m *instrumentedRemote) FreshManifest(repository Repository, tag string) (res flux.Image, err error) {
+	start := time.Now()
+	res, err = m.next.FreshManifest(repository, tag)
+	requestDuration.With(
+		LabelRequestKind, RequestKindMetadata,
+		fluxmetrics.LabelSuccess, strconv.FormatBool(err == nil),
+	).Observe(time.Since(start).Seconds())
+	return
+}
+
 func (m *instrumentedRemote) Tags(repository Repository) (res []string, err error) {
 	start := time.Now()
 	res, err = m.next.Tags(repository)
@@ -14,6 +14,7 @@ import (
 type wwwAuthenticateFixer struct {
 	transport   http.RoundTripper
 	tokenHeader string
+	tokenHost   string
 }
 
 func (t *wwwAuthenticateFixer) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -45,18 +46,21 @@ func replaceUnquoted(h string) string {
 // If we've got a token from a previous roundtrip, try using it
 // again. BEWARE: this means this transport should only be used when
 // asking (repeatedly) about a single repository, otherwise we may
-// leak authorisation.
+// leak authorisation. The token is only given to the host it was
+// first used with, since blobs are often served by redirecting to
+// storage elsewhere, which won't want it.
 func (t *wwwAuthenticateFixer) maybeAddToken(req *http.Request) {
 	authHeaders := req.Header[http.CanonicalHeaderKey("Authorization")]
 	for _, h := range authHeaders {
 		if strings.EqualFold(h[:7], "bearer ") {
 			if t.tokenHeader == "" {
 				t.tokenHeader = h
+				t.tokenHost = req.URL.Host
 			}
 			return
 		}
 	}
-	if t.tokenHeader != "" {
+	if t.tokenHeader != "" && req.URL.Host == t.tokenHost {
 		req.Header.Set("Authorization", t.tokenHeader)
 	}
 }
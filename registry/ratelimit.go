@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// RateLimits limits the rate of requests made to each registry host.
+// The limits apply across everything using the same RateLimits --
+// in the service, that's all instances -- so that between us we don't
+// get throttled (or banned) by a registry.
+type RateLimits struct {
+	rps   float64
+	burst int
+	clock clockwork.Clock
+
+	mu    sync.Mutex
+	hosts map[string]*tokenBucket
+}
+
+// NewRateLimits makes a RateLimits allowing, for each host, an average
+// of rps requests a second, and up to burst at once. A rate of zero or
+// less means there's no limit.
+func NewRateLimits(rps float64, burst int) *RateLimits {
+	return newRateLimits(rps, burst, clockwork.NewRealClock())
+}
+
+func newRateLimits(rps float64, burst int, clock clockwork.Clock) *RateLimits {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimits{
+		rps:   rps,
+		burst: burst,
+		clock: clock,
+		hosts: map[string]*tokenBucket{},
+	}
+}
+
+// Wait blocks until a request can be made to the host, or the context
+// is done.
+func (l *RateLimits) Wait(ctx context.Context, host string) error {
+	if l == nil || l.rps <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	bucket, ok := l.hosts[host]
+	if !ok {
+		bucket = &tokenBucket{
+			tokens: float64(l.burst),
+			last:   l.clock.Now(),
+		}
+		l.hosts[host] = bucket
+	}
+	wait := bucket.reserve(l.clock.Now(), l.rps, float64(l.burst))
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	select {
+	case <-l.clock.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RoundTripper wraps a http.RoundTripper so that requests made with
+// it, which are all assumed to be for the host given, wait their turn.
+func (l *RateLimits) RoundTripper(next http.RoundTripper, host string) http.RoundTripper {
+	return roundtripperFunc(func(r *http.Request) (*http.Response, error) {
+		if err := l.Wait(r.Context(), host); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(r)
+	})
+}
+
+// tokenBucket is filled at a steady rate, up to a maximum; each
+// request takes a token. Tokens are taken even if there aren't any
+// left, so that requests go in the order they arrived, and each waits
+// for the bucket to fill up to its token.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) reserve(now time.Time, rate, max float64) time.Duration {
+	b.tokens += now.Sub(b.last).Seconds() * rate
+	if b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
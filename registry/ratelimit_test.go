@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+func TestRateLimits_Burst(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	limits := newRateLimits(1, 2, clock)
+
+	// The first two go straight through
+	for i := 0; i < 2; i++ {
+		if err := limits.Wait(context.Background(), "quay.io"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// .. as does one to another host
+	if err := limits.Wait(context.Background(), "index.docker.io"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- limits.Wait(context.Background(), "quay.io")
+	}()
+	clock.BlockUntil(1)
+	select {
+	case <-done:
+		t.Fatal("expected third request to wait")
+	default:
+	}
+	clock.Advance(time.Second)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected third request to go through after a second")
+	}
+}
+
+func TestRateLimits_Cancel(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	limits := newRateLimits(1, 1, clock)
+	if err := limits.Wait(context.Background(), "quay.io"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limits.Wait(ctx, "quay.io"); err != context.Canceled {
+		t.Errorf("expected cancelled wait, got %v", err)
+	}
+}
+
+func TestRateLimits_NoLimit(t *testing.T) {
+	var limits *RateLimits
+	if err := limits.Wait(context.Background(), "quay.io"); err != nil {
+		t.Fatal(err)
+	}
+	limits = NewRateLimits(0, 0)
+	for i := 0; i < 100; i++ {
+		if err := limits.Wait(context.Background(), "quay.io"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
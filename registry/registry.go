@@ -18,7 +18,16 @@ const (
 // The Registry interface is a domain specific API to access container registries.
 type Registry interface {
 	GetRepository(repository Repository) ([]flux.Image, error)
+	// GetImage fetches a single image. It's used to check an image
+	// exists, and find what its tag points at, before releasing it,
+	// so it always asks the registry rather than using the cache.
 	GetImage(repository Repository, tag string) (flux.Image, error)
+	// GetTags lists the tags in the repository.
+	GetTags(repository Repository) ([]string, error)
+	// GetImages fetches the images for the tags given. If any can't
+	// be fetched, it returns those that could be along with the
+	// first error.
+	GetImages(repository Repository, tags []string) ([]flux.Image, error)
 }
 
 type registry struct {
@@ -59,6 +68,30 @@ func (reg *registry) GetRepository(img Repository) (_ []flux.Image, err error) {
 	// `library/nats`. We need that to fetch the tags etc. However, we
 	// want the results to use the *actual* name of the images to be
 	// as supplied, e.g., `nats`.
+	images, err := reg.tagsToRepository(rem, img, tags)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byCreatedDesc(images))
+	return images, nil
+}
+
+// GetTags lists the tags in the repository.
+func (reg *registry) GetTags(img Repository) (_ []string, err error) {
+	rem, err := reg.newRemote(img)
+	if err != nil {
+		return
+	}
+	defer rem.Cancel()
+	return rem.Tags(img)
+}
+
+// GetImages fetches the images with the tags given.
+func (reg *registry) GetImages(img Repository, tags []string) (_ []flux.Image, err error) {
+	rem, err := reg.newRemote(img)
+	if err != nil {
+		return
+	}
 	return reg.tagsToRepository(rem, img, tags)
 }
 
@@ -68,7 +101,7 @@ func (reg *registry) GetImage(img Repository, tag string) (_ flux.Image, err err
 	if err != nil {
 		return
 	}
-	return rem.Manifest(img, tag)
+	return rem.FreshManifest(img, tag)
 }
 
 func (reg *registry) newRemote(img Repository) (rem Remote, err error) {
@@ -108,17 +141,21 @@ func (reg *registry) tagsToRepository(remote Remote, repository Repository, tags
 	}
 	close(toFetch)
 
-	images := make([]flux.Image, cap(fetched))
+	// Wait for all of them, so that we can give back what we did
+	// manage to fetch, along with the first error.
+	var firstErr error
+	images := make([]flux.Image, 0, cap(fetched))
 	for i := 0; i < cap(fetched); i++ {
 		res := <-fetched
 		if res.err != nil {
-			return nil, res.err
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
 		}
-		images[i] = res.image
+		images = append(images, res.image)
 	}
-
-	sort.Sort(byCreatedDesc(images))
-	return images, nil
+	return images, firstErr
 }
 
 // -----
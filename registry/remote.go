@@ -2,18 +2,18 @@ package registry
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"time"
-
-	"github.com/docker/distribution/manifest/schema1"
 
 	"github.com/weaveworks/flux"
 )
 
 type Remote interface {
 	Tags(repository Repository) ([]string, error)
-	Manifest(repository Repository, tag string) (flux.Image, error)
+	// Manifest gets the image with the reference (tag or digest)
+	// given.
+	Manifest(repository Repository, reference string) (flux.Image, error)
+	// FreshManifest is like Manifest, but doesn't use anything
+	// cached, so that what a tag points at is up to date.
+	FreshManifest(repository Repository, reference string) (flux.Image, error)
 	Cancel()
 }
 
@@ -33,34 +33,60 @@ func (rc *remote) Tags(repository Repository) (_ []string, err error) {
 	return rc.client.Tags(repository.NamespaceImage())
 }
 
-func (rc *remote) Manifest(repository Repository, tag string) (img flux.Image, err error) {
-	img, err = flux.ParseImage(fmt.Sprintf("%s:%s", repository.String(), tag), nil)
+func (rc *remote) Manifest(repository Repository, reference string) (img flux.Image, err error) {
+	img = repository.ToImage(reference)
+	info, err := rc.client.Manifest(repository.NamespaceImage(), reference)
 	if err != nil {
 		return
 	}
-	history, err := rc.client.Manifest(repository.NamespaceImage(), tag)
+	return withInfo(img, info), nil
+}
+
+func (rc *remote) FreshManifest(repository Repository, reference string) (img flux.Image, err error) {
+	client, ok := rc.client.(freshManifester)
+	if !ok {
+		return rc.Manifest(repository, reference)
+	}
+	img = repository.ToImage(reference)
+	info, err := client.FreshManifest(repository.NamespaceImage(), reference)
 	if err != nil {
 		return
 	}
+	return withInfo(img, info), nil
+}
 
-	// the manifest includes some v1-backwards-compatibility data,
-	// oddly called "History", which are layer metadata as JSON
-	// strings; these appear most-recent (i.e., topmost layer) first,
-	// so happily we can just decode the first entry to get a created
-	// time.
-	type v1image struct {
-		Created time.Time `json:"created"`
+// withInfo fills in the image with what we found out from its
+// manifest.
+func withInfo(img flux.Image, info ImageInfo) flux.Image {
+	if !info.CreatedAt.IsZero() {
+		createdAt := info.CreatedAt
+		img.CreatedAt = &createdAt
 	}
-	var topmost v1image
-	if len(history) > 0 {
-		if err = json.Unmarshal([]byte(history[0].V1Compatibility), &topmost); err == nil {
-			if !topmost.Created.IsZero() {
-				img.CreatedAt = &topmost.Created
-			}
-		}
+	// Record what the tag points at now, so we can tell if it's
+	// moved.
+	if img.Digest == "" {
+		img.Digest = info.Digest
 	}
+	img.Labels = info.Labels
+	img.OS = info.OS
+	img.Architecture = info.Architecture
+	img.Platforms = info.Platforms
+	return img
+}
 
-	return
+// infoOf is the inverse of withInfo.
+func infoOf(img flux.Image) ImageInfo {
+	info := ImageInfo{
+		Digest:       img.Digest,
+		Labels:       img.Labels,
+		OS:           img.OS,
+		Architecture: img.Architecture,
+		Platforms:    img.Platforms,
+	}
+	if img.CreatedAt != nil {
+		info.CreatedAt = *img.CreatedAt
+	}
+	return info
 }
 
 func (rc *remote) Cancel() {
@@ -70,5 +96,10 @@ func (rc *remote) Cancel() {
 // We need this because they didn't wrap it in an interface.
 type dockerRegistryInterface interface {
 	Tags(repository string) ([]string, error)
-	Manifest(repository, reference string) ([]schema1.History, error)
+	Manifest(repository, reference string) (ImageInfo, error)
+}
+
+// A client that can skip its cache, like Cache.
+type freshManifester interface {
+	FreshManifest(repository, reference string) (ImageInfo, error)
 }
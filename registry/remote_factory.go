@@ -20,27 +20,33 @@ type creds struct {
 
 // Credentials to a (Docker) registry.
 type Credentials struct {
-	m map[string]creds
+	m         map[string]creds
+	providers map[string]CredentialProvider
 }
 
 type RemoteClientFactory interface {
 	CreateFor(host string) (Remote, error)
 }
 
-func NewRemoteClientFactory(c Credentials, l log.Logger, mc MemcacheClient, ce time.Duration) RemoteClientFactory {
+// NewRemoteClientFactory creates a factory for remote clients. If
+// rate limits are given (they may be nil), requests made by the
+// clients wait their turn for the host.
+func NewRemoteClientFactory(c Credentials, l log.Logger, cache CacheBackend, ce time.Duration, limits *RateLimits) RemoteClientFactory {
 	return &remoteClientFactory{
-		creds:          c,
-		Logger:         l,
-		MemcacheClient: mc,
-		CacheExpiry:    ce,
+		creds:       c,
+		Logger:      l,
+		Cache:       cache,
+		CacheExpiry: ce,
+		Limits:      limits,
 	}
 }
 
 type remoteClientFactory struct {
-	creds          Credentials
-	Logger         log.Logger
-	MemcacheClient MemcacheClient
-	CacheExpiry    time.Duration
+	creds       Credentials
+	Logger      log.Logger
+	Cache       CacheBackend
+	CacheExpiry time.Duration
+	Limits      *RateLimits
 }
 
 func (f *remoteClientFactory) CreateFor(host string) (_ Remote, err error) {
@@ -62,7 +68,10 @@ func (f *remoteClientFactory) newRegistryClient(host string) (client dockerRegis
 	if err != nil {
 		return
 	}
-	auth := f.creds.credsFor(host)
+	auth, err := f.creds.credsFor(host)
+	if err != nil {
+		return
+	}
 
 	// A context we'll use to cancel requests on error
 	ctx, cancel := context.WithCancel(context.Background())
@@ -71,6 +80,10 @@ func (f *remoteClientFactory) newRegistryClient(host string) (client dockerRegis
 
 	// Use the wrapper to fix headers for quay.io, and remember bearer tokens
 	var transport http.RoundTripper = &wwwAuthenticateFixer{transport: http.DefaultTransport}
+	// Wait our turn for the host, including when retrying
+	if f.Limits != nil {
+		transport = f.Limits.RoundTripper(transport, host)
+	}
 	// Now the auth-handling wrappers that come with the library
 	transport = dockerregistry.WrapTransport(transport, httphost, auth.username, auth.password)
 	// Add the backoff mechanism so we don't DOS registries
@@ -89,8 +102,8 @@ func (f *remoteClientFactory) newRegistryClient(host string) (client dockerRegis
 			Logf: dockerregistry.Quiet,
 		},
 	}
-	if f.MemcacheClient != nil {
-		client = NewCache(f.creds, f.MemcacheClient, f.CacheExpiry, f.Logger)(client)
+	if f.Cache != nil {
+		client = NewCache(f.creds, f.Cache, f.CacheExpiry, f.Logger)(client)
 	} else {
 		f.Logger.Log("registry_cache", "disabled")
 	}
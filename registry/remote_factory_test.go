@@ -15,7 +15,7 @@ import (
 // It will fail if there is not internet connection
 func TestRemoteFactory_CreateForDockerHub(t *testing.T) {
 	// No credentials required for public Image
-	fact := NewRemoteClientFactory(Credentials{}, log.NewNopLogger(), nil, time.Second)
+	fact := NewRemoteClientFactory(Credentials{}, log.NewNopLogger(), nil, time.Second, nil)
 	img, err := flux.ParseImage("alpine:latest", nil)
 	testRepository = RepositoryFromImage(img)
 	if err != nil {
@@ -36,7 +36,7 @@ func TestRemoteFactory_CreateForDockerHub(t *testing.T) {
 }
 
 func TestRemoteFactory_InvalidHost(t *testing.T) {
-	fact := NewRemoteClientFactory(Credentials{}, log.NewNopLogger(), nil, time.Second)
+	fact := NewRemoteClientFactory(Credentials{}, log.NewNopLogger(), nil, time.Second, nil)
 	img, err := flux.ParseImage("invalid.host/library/alpine:latest", nil)
 	if err != nil {
 		t.Fatal(err)
@@ -69,7 +69,10 @@ func TestRemoteFactory_CredentialsFromConfig(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	c := creds.credsFor(host)
+	c, err := creds.credsFor(host)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if user != c.username {
 		t.Fatalf("Expected %q, got %q.", user, c.username)
 	}
@@ -116,7 +119,10 @@ func TestRemoteFactory_CredentialsFromConfigHTTPSHosts(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	c := creds.credsFor(host)
+	c, err := creds.credsFor(host)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if user != c.username {
 		t.Fatalf("Expected %q, got %q.", user, c.username)
 	}
@@ -4,7 +4,6 @@ import (
 	"testing"
 	"time"
 
-	"github.com/docker/distribution/manifest/schema1"
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
@@ -17,22 +16,21 @@ const constTime = "2017-01-13T16:22:58.009923189Z"
 var (
 	img, _         = flux.ParseImage(testImageStr, nil)
 	testRepository = RepositoryFromImage(img)
+	created, _     = time.Parse(time.RFC3339Nano, constTime)
 
-	man = schema1.SignedManifest{
-		Manifest: schema1.Manifest{
-			History: []schema1.History{
-				{
-					V1Compatibility: `{"created":"` + constTime + `"}`,
-				},
-			},
-		},
+	info = ImageInfo{
+		Digest:       "sha256:9d2d1a9c9b4e1b5e8f0f1e4c3e2b4f4d6c2b1a0e9f8e7d6c5b4a392817161514",
+		CreatedAt:    created,
+		Labels:       map[string]string{"maintainer": "weaveworks"},
+		OS:           "linux",
+		Architecture: "amd64",
 	}
 )
 
 // Need to create a dummy manifest here
 func TestRemoteClient_ParseManifest(t *testing.T) {
-	manifestFunc := func(repo, ref string) ([]schema1.History, error) {
-		return man.Manifest.History, nil
+	manifestFunc := func(repo, ref string) (ImageInfo, error) {
+		return info, nil
 	}
 	c := remote{
 		client: NewMockDockerClient(manifestFunc, nil),
@@ -42,12 +40,39 @@ func TestRemoteClient_ParseManifest(t *testing.T) {
 	if err != nil {
 		t.Fatal(err.Error())
 	}
-	if string(desc.FullID()) != testImageStr {
-		t.Fatalf("Expecting %q but got %q", testImageStr, string(desc.FullID()))
+	if expected := testImageStr + "@" + info.Digest; string(desc.FullID()) != expected {
+		t.Fatalf("Expecting %q but got %q", expected, string(desc.FullID()))
 	}
 	if desc.CreatedAt.Format(time.RFC3339Nano) != constTime {
 		t.Fatalf("Expecting %q but got %q", constTime, desc.CreatedAt.Format(time.RFC3339Nano))
 	}
+	if desc.Digest != info.Digest {
+		t.Fatalf("Expecting %q but got %q", info.Digest, desc.Digest)
+	}
+	if desc.Labels["maintainer"] != "weaveworks" || desc.OS != "linux" || desc.Architecture != "amd64" {
+		t.Fatalf("Expecting labels, OS and architecture from the image info, but got %#v", desc)
+	}
+}
+
+func TestRemoteClient_ManifestByDigest(t *testing.T) {
+	var fetched string
+	manifestFunc := func(repo, ref string) (ImageInfo, error) {
+		fetched = ref
+		return info, nil
+	}
+	c := remote{
+		client: NewMockDockerClient(manifestFunc, nil),
+	}
+	desc, err := c.Manifest(testRepository, info.Digest)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if fetched != info.Digest {
+		t.Fatalf("Expecting manifest to be fetched by digest, but got %q", fetched)
+	}
+	if expected := "index.docker.io/test/Image@" + info.Digest; desc.FullID() != expected {
+		t.Fatalf("Expecting %q but got %q", expected, desc.FullID())
+	}
 }
 
 // Just a simple pass through.
@@ -80,8 +105,8 @@ func TestRemoteClient_IsCancelCalled(t *testing.T) {
 }
 
 func TestRemoteClient_RemoteErrors(t *testing.T) {
-	manifestFunc := func(repo, ref string) ([]schema1.History, error) {
-		return man.Manifest.History, errors.New("dummy")
+	manifestFunc := func(repo, ref string) (ImageInfo, error) {
+		return info, errors.New("dummy")
 	}
 	tagsFunc := func(repository string) ([]string, error) {
 		return []string{
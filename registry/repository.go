@@ -1,6 +1,8 @@
 package registry
 
 import (
+	"strings"
+
 	"github.com/weaveworks/flux"
 )
 
@@ -36,8 +38,15 @@ func (r Repository) String() string {
 	return r.img.HostNamespaceImage()
 }
 
-func (r Repository) ToImage(tag string) flux.Image {
+// ToImage gives the image in this repository with the reference
+// given, which is either a tag or (since tags can't contain colons) a
+// digest.
+func (r Repository) ToImage(reference string) flux.Image {
 	newImage := r.img
-	newImage.Tag = tag
+	if strings.Contains(reference, ":") {
+		newImage.Tag, newImage.Digest = "", reference
+	} else {
+		newImage.Tag, newImage.Digest = reference, ""
+	}
 	return newImage
 }
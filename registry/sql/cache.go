@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux/registry"
+)
+
+// Expired entries are cleared out every so often when storing
+// something, rather than on every write.
+const purgeEvery = 100
+
+// Cache is a registry.CacheBackend kept in a SQL database, so it
+// survives restarts.
+type Cache struct {
+	conn *sql.DB
+	sets uint64
+}
+
+func NewCache(driver, datasource string) (*Cache, error) {
+	conn, err := sql.Open(driver, datasource)
+	if err != nil {
+		return nil, err
+	}
+	cache := &Cache{
+		conn: conn,
+	}
+	return cache, cache.sanityCheck()
+}
+
+func (c *Cache) Get(key string) ([]byte, error) {
+	var (
+		value     []byte
+		expiresAt *time.Time
+	)
+	err := c.conn.QueryRow(`SELECT value, expires_at FROM registry_cache WHERE key = $1`, key).Scan(&value, &expiresAt)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil, registry.ErrCacheMiss
+	case err != nil:
+		return nil, err
+	case expiresAt != nil && !time.Now().Before(*expiresAt):
+		return nil, registry.ErrCacheMiss
+	}
+	return value, nil
+}
+
+func (c *Cache) Set(key string, value []byte, expiry time.Duration) error {
+	var expiresAt interface{}
+	if expiry > 0 {
+		expiresAt = time.Now().UTC().Add(expiry)
+	}
+	tx, err := c.conn.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM registry_cache WHERE key = $1`, key)
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO registry_cache (key, value, expires_at) VALUES ($1, $2, $3)`,
+			key, value, expiresAt)
+	}
+	if err == nil && atomic.AddUint64(&c.sets, 1)%purgeEvery == 0 {
+		_, err = tx.Exec(`DELETE FROM registry_cache WHERE expires_at < $1`, time.Now().UTC())
+	}
+	return finish(tx, err)
+}
+
+func (c *Cache) sanityCheck() error {
+	_, err := c.conn.Query(`SELECT key, value, expires_at FROM registry_cache LIMIT 1`)
+	if err != nil {
+		return errors.Wrap(err, "failed sanity check for registry_cache table")
+	}
+	return nil
+}
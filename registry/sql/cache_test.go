@@ -0,0 +1,50 @@
+package sql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux/registry"
+)
+
+func TestCache(t *testing.T) {
+	cache, err := NewCache("ql", newDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.Get("missing"); err != registry.ErrCacheMiss {
+		t.Fatalf("expected cache miss, got %v", err)
+	}
+
+	if err := cache.Set("key", []byte("value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set("key", []byte("newer value"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	value, err := cache.Get("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "newer value" {
+		t.Errorf("expected %q, got %q", "newer value", string(value))
+	}
+
+	// No expiry means it's kept
+	if err := cache.Set("forever", []byte("value"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Get("forever"); err != nil {
+		t.Error(err)
+	}
+
+	// Expired entries are misses
+	if err := cache.Set("expired", []byte("value"), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := cache.Get("expired"); err != registry.ErrCacheMiss {
+		t.Errorf("expected cache miss for expired entry, got %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+package sql
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	_ "github.com/cznic/ql/driver"
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/registry"
+)
+
+// Index is a registry.Index kept in a SQL database.
+type Index struct {
+	conn *sql.DB
+}
+
+func New(driver, datasource string) (*Index, error) {
+	conn, err := sql.Open(driver, datasource)
+	if err != nil {
+		return nil, err
+	}
+	index := &Index{
+		conn: conn,
+	}
+	return index, index.sanityCheck()
+}
+
+func (index *Index) Repositories(inst flux.InstanceID) ([]string, error) {
+	rows, err := index.conn.Query(`SELECT repository FROM registry_repositories
+                                   WHERE instance_id = $1
+                                   ORDER BY repository`, string(inst))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var repos []string
+	for rows.Next() {
+		var repo string
+		if err = rows.Scan(&repo); err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+	return repos, rows.Err()
+}
+
+func (index *Index) GetRepository(inst flux.InstanceID, repository string) (registry.IndexedRepository, error) {
+	repo := registry.IndexedRepository{Repository: repository}
+	err := index.conn.QueryRow(`SELECT scanned_at, error FROM registry_repositories
+                                WHERE instance_id = $1 AND repository = $2`,
+		string(inst), repository).Scan(&repo.ScannedAt, &repo.Error)
+	switch err {
+	case nil:
+		break
+	case sql.ErrNoRows:
+		return repo, nil
+	default:
+		return repo, err
+	}
+
+	rows, err := index.conn.Query(`SELECT tag, info, fetched_at FROM registry_images
+                                   WHERE instance_id = $1 AND repository = $2
+                                   ORDER BY tag`, string(inst), repository)
+	if err != nil {
+		return repo, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			image   registry.IndexedImage
+			infoStr string
+		)
+		if err = rows.Scan(&image.Tag, &infoStr, &image.FetchedAt); err != nil {
+			return repo, err
+		}
+		if err = json.Unmarshal([]byte(infoStr), &image.Info); err != nil {
+			return repo, errors.Wrapf(err, "decoding image info for tag %s", image.Tag)
+		}
+		repo.Images = append(repo.Images, image)
+	}
+	return repo, rows.Err()
+}
+
+func (index *Index) PutRepository(inst flux.InstanceID, repo registry.IndexedRepository) error {
+	tx, err := index.conn.Begin()
+	if err != nil {
+		return err
+	}
+	err = deleteRepository(tx, inst, repo.Repository)
+	if err == nil {
+		_, err = tx.Exec(`INSERT INTO registry_repositories (instance_id, repository, scanned_at, error)
+                          VALUES ($1, $2, $3, $4)`,
+			string(inst), repo.Repository, repo.ScannedAt, repo.Error)
+	}
+	for _, image := range repo.Images {
+		if err != nil {
+			break
+		}
+		var infoBytes []byte
+		if infoBytes, err = json.Marshal(image.Info); err != nil {
+			break
+		}
+		_, err = tx.Exec(`INSERT INTO registry_images (instance_id, repository, tag, info, fetched_at)
+                          VALUES ($1, $2, $3, $4, $5)`,
+			string(inst), repo.Repository, image.Tag, string(infoBytes), image.FetchedAt)
+	}
+	return finish(tx, err)
+}
+
+func (index *Index) DeleteRepository(inst flux.InstanceID, repository string) error {
+	tx, err := index.conn.Begin()
+	if err != nil {
+		return err
+	}
+	return finish(tx, deleteRepository(tx, inst, repository))
+}
+
+// ---
+
+func deleteRepository(tx *sql.Tx, inst flux.InstanceID, repository string) error {
+	_, err := tx.Exec(`DELETE FROM registry_images WHERE instance_id = $1 AND repository = $2`,
+		string(inst), repository)
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM registry_repositories WHERE instance_id = $1 AND repository = $2`,
+			string(inst), repository)
+	}
+	return err
+}
+
+// finish commits the transaction if all went well, and rolls it back
+// otherwise.
+func finish(tx *sql.Tx, err error) error {
+	if err != nil {
+		if err2 := tx.Rollback(); err2 != nil {
+			return errors.Wrapf(err, "transaction rollback failed: %s", err2)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+func (index *Index) sanityCheck() error {
+	_, err := index.conn.Query(`SELECT instance_id, repository, scanned_at, error FROM registry_repositories LIMIT 1`)
+	if err != nil {
+		return errors.Wrap(err, "failed sanity check for registry_repositories table")
+	}
+	_, err = index.conn.Query(`SELECT instance_id, repository, tag, info, fetched_at FROM registry_images LIMIT 1`)
+	if err != nil {
+		return errors.Wrap(err, "failed sanity check for registry_images table")
+	}
+	return nil
+}
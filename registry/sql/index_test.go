@@ -0,0 +1,147 @@
+package sql
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/db"
+	"github.com/weaveworks/flux/registry"
+)
+
+// newDB makes a migrated database, and gives its source name.
+func newDB(t *testing.T) string {
+	f, err := ioutil.TempFile("", "fluxy-testdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbsource := "file://" + f.Name()
+	if _, err = db.Migrate(dbsource, "../../db/migrations"); err != nil {
+		t.Fatal(err)
+	}
+	return dbsource
+}
+
+func newIndex(t *testing.T) *Index {
+	index, err := New("ql", newDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
+func TestIndex_PutGet(t *testing.T) {
+	index := newIndex(t)
+	inst := flux.InstanceID("floaty-womble-abc123")
+
+	unscanned, err := index.GetRepository(inst, "index.docker.io/weaveworks/helloworld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !unscanned.ScannedAt.IsZero() || len(unscanned.Images) > 0 {
+		t.Fatalf("expected nothing indexed, got %#v", unscanned)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	repo := registry.IndexedRepository{
+		Repository: "index.docker.io/weaveworks/helloworld",
+		ScannedAt:  now,
+		Images: []registry.IndexedImage{
+			{
+				Tag: "master-a000001",
+				Info: registry.ImageInfo{
+					Digest:    "sha256:abc",
+					CreatedAt: now.Add(-time.Hour),
+					Labels:    map[string]string{"org.label-schema.vcs-ref": "a000001"},
+				},
+				FetchedAt: now,
+			},
+			{
+				Tag:       "master-a000002",
+				Info:      registry.ImageInfo{Digest: "sha256:def"},
+				FetchedAt: now.Add(-time.Minute),
+			},
+		},
+	}
+	if err = index.PutRepository(inst, repo); err != nil {
+		t.Fatal(err)
+	}
+	got, err := index.GetRepository(inst, repo.Repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ScannedAt.Equal(repo.ScannedAt) {
+		t.Errorf("expected scanned at %s, got %s", repo.ScannedAt, got.ScannedAt)
+	}
+	if len(got.Images) != len(repo.Images) {
+		t.Fatalf("expected %d images, got %#v", len(repo.Images), got.Images)
+	}
+	for i := range repo.Images {
+		expected, actual := repo.Images[i], got.Images[i]
+		if expected.Tag != actual.Tag || !expected.FetchedAt.Equal(actual.FetchedAt) {
+			t.Errorf("expected %#v, got %#v", expected, actual)
+		}
+		if expected.Info.Digest != actual.Info.Digest ||
+			!expected.Info.CreatedAt.Equal(actual.Info.CreatedAt) ||
+			!reflect.DeepEqual(expected.Info.Labels, actual.Info.Labels) {
+			t.Errorf("expected info %#v, got %#v", expected.Info, actual.Info)
+		}
+	}
+
+	// Putting it again replaces what was there
+	repo.Images = repo.Images[:1]
+	repo.Error = "unauthorized"
+	if err = index.PutRepository(inst, repo); err != nil {
+		t.Fatal(err)
+	}
+	got, err = index.GetRepository(inst, repo.Repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Images) != 1 || got.Error != repo.Error {
+		t.Errorf("expected one image and an error, got %#v", got)
+	}
+}
+
+func TestIndex_RepositoriesDelete(t *testing.T) {
+	index := newIndex(t)
+	inst := flux.InstanceID("floaty-womble-abc123")
+	other := flux.InstanceID("other-instance")
+
+	for _, put := range []struct {
+		inst flux.InstanceID
+		repo string
+	}{
+		{inst, "quay.io/weaveworks/b"},
+		{inst, "quay.io/weaveworks/a"},
+		{other, "quay.io/weaveworks/c"},
+	} {
+		if err := index.PutRepository(put.inst, registry.IndexedRepository{
+			Repository: put.repo,
+			ScannedAt:  time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repos, err := index.Repositories(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"quay.io/weaveworks/a", "quay.io/weaveworks/b"}; !reflect.DeepEqual(expected, repos) {
+		t.Errorf("expected %v, got %v", expected, repos)
+	}
+
+	if err = index.DeleteRepository(inst, "quay.io/weaveworks/a"); err != nil {
+		t.Fatal(err)
+	}
+	repos, err = index.Repositories(inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"quay.io/weaveworks/b"}; !reflect.DeepEqual(expected, repos) {
+		t.Errorf("expected %v, got %v", expected, repos)
+	}
+}
@@ -0,0 +1,90 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// conditionalTagLister is implemented by clients that can ask the
+// registry to list tags only if they have changed since it gave the
+// ETag, so a cached listing can be checked cheaply.
+type conditionalTagLister interface {
+	// TagsIfChanged gives the tags and the new ETag, and whether
+	// they've changed; if they haven't, no tags are returned.
+	TagsIfChanged(repository, etag string) (tags []string, newETag string, changed bool, err error)
+}
+
+func (h herokuWrapper) TagsIfChanged(repository, etag string) ([]string, string, bool, error) {
+	return manifestFetcher{
+		client:     h.Registry.Client,
+		baseURL:    h.Registry.URL,
+		repository: repository,
+	}.tags(etag)
+}
+
+type tagsResponse struct {
+	Tags []string `json:"tags"`
+}
+
+// The URL of the next page of results, in a header like
+// `Link: </v2/foo/bar/tags/list?last=x&n=100>; rel="next"`
+var nextLink = regexp.MustCompile(`^\s*<([^>]+)>\s*;\s*rel="?next"?`)
+
+// tags lists the tags in the repository, following the pages of
+// results. If the etag is given and the first page hasn't changed,
+// it's assumed none have, and nothing more is fetched.
+func (f manifestFetcher) tags(etag string) ([]string, string, bool, error) {
+	base := strings.TrimSuffix(f.baseURL, "/")
+	next := base + "/v2/" + f.repository + "/tags/list"
+	var (
+		tags    []string
+		newETag string
+	)
+	for first := true; next != ""; first = false {
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if first && etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		res, err := f.client.Do(req)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if first && res.StatusCode == http.StatusNotModified {
+			res.Body.Close()
+			return nil, etag, false, nil
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, "", false, StatusError{URL: next, StatusCode: res.StatusCode, Status: res.Status}
+		}
+		if first {
+			newETag = res.Header.Get("ETag")
+		}
+		var page tagsResponse
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, "", false, errors.Wrap(err, "decoding tags")
+		}
+		tags = append(tags, page.Tags...)
+
+		next = ""
+		if m := nextLink.FindStringSubmatch(res.Header.Get("Link")); m != nil {
+			u, err := url.Parse(m[1])
+			if err != nil {
+				return nil, "", false, errors.Wrap(err, "parsing link to next page of tags")
+			}
+			// The link is usually relative to the registry
+			next = res.Request.URL.ResolveReference(u).String()
+		}
+	}
+	return tags, newETag, true, nil
+}
@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+)
+
+// Where webhooks can come from, each of which has its own payload.
+const (
+	WebhookDockerHub = "dockerhub"
+	WebhookQuay      = "quay"
+	WebhookGeneric   = "generic"
+)
+
+var ErrUnknownWebhookSource = errors.New("unknown webhook source")
+
+// Push is what a registry tells us in a webhook: that images have
+// been pushed to a repository, with the tags given.
+type Push struct {
+	Repository string   `json:"repository"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// ParseWebhook decodes the payload of a webhook from the source
+// given into a Push. The repository is given in the same form as
+// `flux.ImageID.Repository()`, so it can be compared with the images
+// in running services.
+//
+// The generic payload is just a Push as JSON, e.g.,
+//
+//   {"repository": "quay.io/foo/bar", "tags": ["v1.0.2"]}
+//
+func ParseWebhook(source string, body io.Reader) (Push, error) {
+	var push Push
+	switch source {
+	case WebhookDockerHub:
+		var payload struct {
+			PushData struct {
+				Tag string `json:"tag"`
+			} `json:"push_data"`
+			Repository struct {
+				RepoName string `json:"repo_name"`
+			} `json:"repository"`
+		}
+		if err := json.NewDecoder(body).Decode(&payload); err != nil {
+			return push, errors.Wrap(err, "decoding Docker Hub webhook")
+		}
+		push.Repository = payload.Repository.RepoName
+		if payload.PushData.Tag != "" {
+			push.Tags = []string{payload.PushData.Tag}
+		}
+	case WebhookQuay:
+		var payload struct {
+			DockerURL   string   `json:"docker_url"`
+			UpdatedTags []string `json:"updated_tags"`
+		}
+		if err := json.NewDecoder(body).Decode(&payload); err != nil {
+			return push, errors.Wrap(err, "decoding Quay webhook")
+		}
+		push.Repository = payload.DockerURL
+		push.Tags = payload.UpdatedTags
+	case WebhookGeneric:
+		if err := json.NewDecoder(body).Decode(&push); err != nil {
+			return push, errors.Wrap(err, "decoding webhook")
+		}
+	default:
+		return push, errors.Wrapf(ErrUnknownWebhookSource, "%q; expected one of %s", source, strings.Join([]string{WebhookDockerHub, WebhookQuay, WebhookGeneric}, ", "))
+	}
+
+	if push.Repository == "" {
+		return push, errors.New("no repository given in webhook")
+	}
+	id, err := flux.ParseImageID(push.Repository)
+	if err != nil {
+		return push, errors.Wrapf(err, "parsing repository %q", push.Repository)
+	}
+	push.Repository = id.Repository()
+	return push, nil
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWebhook(t *testing.T) {
+	for _, x := range []struct {
+		source  string
+		payload string
+		push    Push
+	}{
+		{
+			WebhookDockerHub,
+			`{"push_data": {"tag": "v1.0.2", "pusher": "someone"}, "repository": {"repo_name": "weaveworks/helloworld", "namespace": "weaveworks"}}`,
+			Push{Repository: "weaveworks/helloworld", Tags: []string{"v1.0.2"}},
+		},
+		{
+			WebhookDockerHub,
+			`{"push_data": {"tag": "3.4"}, "repository": {"repo_name": "library/nats"}}`,
+			Push{Repository: "nats", Tags: []string{"3.4"}},
+		},
+		{
+			WebhookQuay,
+			`{"repository": "weaveworks/helloworld", "docker_url": "quay.io/weaveworks/helloworld", "updated_tags": ["master-a000001", "latest"]}`,
+			Push{Repository: "quay.io/weaveworks/helloworld", Tags: []string{"master-a000001", "latest"}},
+		},
+		{
+			WebhookGeneric,
+			`{"repository": "registry.example.com/team/app"}`,
+			Push{Repository: "registry.example.com/team/app"},
+		},
+	} {
+		push, err := ParseWebhook(x.source, strings.NewReader(x.payload))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", x.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(push, x.push) {
+			t.Errorf("%s: expected %#v, got %#v", x.source, x.push, push)
+		}
+	}
+}
+
+func TestParseWebhook_Errors(t *testing.T) {
+	for _, x := range []struct {
+		source  string
+		payload string
+	}{
+		{"gitlab", `{"repository": "foo/bar"}`},
+		{WebhookGeneric, `not json`},
+		{WebhookGeneric, `{"tags": ["v1"]}`},
+		{WebhookQuay, `{"docker_url": "a/b/c/d"}`},
+	} {
+		if _, err := ParseWebhook(x.source, strings.NewReader(x.payload)); err == nil {
+			t.Errorf("expected error from %s webhook %s", x.source, x.payload)
+		}
+	}
+}
@@ -38,6 +38,61 @@ const (
 
 type ServiceReleaseStatus string
 
+// The states a release needing approval can be in.
+const (
+	ApprovalPending  = "pending-approval"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// Approval is a single approval (or rejection) of a release.
+type Approval struct {
+	User    string    `json:"user"`
+	Message string    `json:"message,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// ReleaseApproval records how a release that needs approving before
+// it's carried out is getting on.
+type ReleaseApproval struct {
+	Required  int        `json:"required"`
+	Approvals []Approval `json:"approvals,omitempty"`
+	Rejection *Approval  `json:"rejection,omitempty"`
+	// Once approved, the release that carries out the changes
+	ReleaseID ReleaseID `json:"releaseID,omitempty"`
+}
+
+func (a ReleaseApproval) State() string {
+	switch {
+	case a.Rejection != nil:
+		return ApprovalRejected
+	case len(a.Approvals) >= a.Required:
+		return ApprovalApproved
+	default:
+		return ApprovalPending
+	}
+}
+
+// ApprovedBy says whether the user given has already approved the
+// release.
+func (a ReleaseApproval) ApprovedBy(user string) bool {
+	for _, approval := range a.Approvals {
+		if approval.User == user {
+			return true
+		}
+	}
+	return false
+}
+
+// ReleasePullRequest records the pull request a release was proposed
+// in, for instances that release by pull request rather than pushing
+// to the config repo's branch.
+type ReleasePullRequest struct {
+	Branch string `json:"branch"`
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+}
+
 type ReleaseID string
 
 func NewReleaseID() ReleaseID {
@@ -48,10 +103,41 @@ func NewReleaseID() ReleaseID {
 type ReleaseCause struct {
 	Message string
 	User    string
+	// If the release is a promotion of a release in another
+	// instance, which release that was.
+	PromotedFrom *PromotionLink `json:",omitempty"`
+}
+
+// PromotionLink refers to a release in another instance, so that
+// releases promoted from one instance to another can be related.
+type PromotionLink struct {
+	Instance InstanceID `json:"instance"`
+	// The name given to the instance in its promotion config, if
+	// any.
+	Name    string    `json:"name,omitempty"`
+	Release ReleaseID `json:"release"`
+}
+
+func (l PromotionLink) String() string {
+	name := l.Name
+	if name == "" {
+		name = string(l.Instance)
+	}
+	return fmt.Sprintf("%s release %s", name, l.Release)
 }
 
 const UserAutomated = "<automated>"
 
+// UserPromoted is the user given for releases promoted from another
+// instance automatically. Unlike automated releases, these still need
+// approval if the instance requires it.
+const UserPromoted = "<promoted>"
+
+// UserScheduled is the user given for releases carried out regularly,
+// according to a schedule in the instance config. These need approval
+// if the instance requires it.
+const UserScheduled = "<scheduled>"
+
 // Release describes a release
 type Release struct {
 	ID        ReleaseID            `json:"id"`
@@ -75,6 +161,8 @@ type ReleaseSpec struct {
 	ImageSpec    ImageSpec
 	Kind         ReleaseKind
 	Excludes     []ServiceID
+	// If given, only services in these namespaces are released
+	Namespaces []string `json:",omitempty"`
 }
 
 // ReleaseType gives a one-word description of the release, mainly
@@ -0,0 +1,79 @@
+package release
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+)
+
+var ErrPlanChanged = flux.UserConfigProblem{&flux.BaseError{
+	Help: `The release no longer does what was approved.
+
+Between the release being approved and being carried out, something
+changed: perhaps a newer image was pushed, a service was updated by
+another release, or the config repo was changed. So as not to release
+something nobody approved, nothing has been done.
+
+You can post the release again, and it will need approving again.
+`,
+	Err: errors.New("release differs from the plan that was approved"),
+}}
+
+// needsApproval says whether the release of the updates given must
+// wait for approval, according to the instance config. Releases made
+// by automation are not held for approval; if a service is
+// automated, that is taken as approval of whatever it is updated to.
+func needsApproval(inst *instance.Instance, cause flux.ReleaseCause, updates []*ServiceUpdate) (int, error) {
+	if cause.User == flux.UserAutomated {
+		return 0, nil
+	}
+	conf, err := inst.GetConfig()
+	if err != nil {
+		return 0, errors.Wrap(err, "getting config to check for approvals")
+	}
+	var ids []flux.ServiceID
+	for _, update := range updates {
+		ids = append(ids, update.ServiceID)
+	}
+	if !conf.Settings.Release.NeedsApproval(ids) {
+		return 0, nil
+	}
+	return conf.Settings.Release.Approvals, nil
+}
+
+// checkApprovedPlan makes sure that a release being carried out after
+// approval would make the same changes as were approved.
+func checkApprovedPlan(plan, results flux.ReleaseResult) error {
+	for id, planned := range plan {
+		if planned.Status != flux.ReleaseStatusPending {
+			continue
+		}
+		result, ok := results[id]
+		if !ok || result.Status != flux.ReleaseStatusPending {
+			return errors.Wrapf(ErrPlanChanged, "service %s would no longer be updated", id)
+		}
+		if !reflect.DeepEqual(planned.PerContainer, result.PerContainer) {
+			return errors.Wrapf(ErrPlanChanged, "service %s would be updated differently", id)
+		}
+	}
+	for id, result := range results {
+		if result.Status != flux.ReleaseStatusPending {
+			continue
+		}
+		if planned, ok := plan[id]; !ok || planned.Status != flux.ReleaseStatusPending {
+			return errors.Wrapf(ErrPlanChanged, "service %s would also be updated", id)
+		}
+	}
+	return nil
+}
+
+func approvalsNeeded(n int) string {
+	if n == 1 {
+		return "1 approval"
+	}
+	return fmt.Sprintf("%d approvals", n)
+}
@@ -0,0 +1,142 @@
+package release
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+)
+
+func TestCheckApprovedPlan(t *testing.T) {
+	newImageID, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000002")
+	newerImageID, _ := flux.ParseImageID("quay.io/weaveworks/helloworld:master-a000003")
+	pending := func(target flux.ImageID) flux.ServiceResult {
+		return flux.ServiceResult{
+			Status: flux.ReleaseStatusPending,
+			PerContainer: []flux.ContainerUpdate{
+				{Container: "helloworld", Current: oldImageID, Target: target},
+			},
+		}
+	}
+	skipped := flux.ServiceResult{Status: flux.ReleaseStatusSkipped, Error: ImageUpToDate}
+
+	plan := flux.ReleaseResult{
+		hwSvcID:            pending(newImageID),
+		"default/sidecars": skipped,
+	}
+
+	for _, x := range []struct {
+		name    string
+		results flux.ReleaseResult
+		ok      bool
+	}{
+		{"same", flux.ReleaseResult{hwSvcID: pending(newImageID), "default/sidecars": skipped}, true},
+		{"skipped service missing", flux.ReleaseResult{hwSvcID: pending(newImageID)}, true},
+		{"newer image", flux.ReleaseResult{hwSvcID: pending(newerImageID)}, false},
+		{"no longer updated", flux.ReleaseResult{hwSvcID: skipped}, false},
+		{"another service updated", flux.ReleaseResult{hwSvcID: pending(newImageID), "default/sidecars": pending(newImageID)}, false},
+	} {
+		err := checkApprovedPlan(plan, x.results)
+		if x.ok && err != nil {
+			t.Errorf("%s: unexpected error: %s", x.name, err)
+		}
+		if !x.ok && errors.Cause(err) != ErrPlanChanged {
+			t.Errorf("%s: expected ErrPlanChanged, got %v", x.name, err)
+		}
+	}
+}
+
+func TestApprovedRelease(t *testing.T) {
+	var applied []platform.ServiceDefinition
+	mockPlatform := &platform.MockPlatform{
+		AllServicesAnswer:  allSvcs,
+		SomeServicesAnswer: []platform.Service{hwSvc},
+		ApplyArgTest: func(defs []platform.ServiceDefinition) error {
+			applied = append(applied, defs...)
+			return nil
+		},
+	}
+	mockConfig := &instance.MockConfigurer{
+		Config: instance.Config{
+			Settings: flux.UnsafeInstanceConfig{
+				Release: flux.ReleaseConfig{
+					VerifyTimeout: "0s",
+					Approvals:     1,
+				},
+			},
+		},
+	}
+	releaser, cleanup := setup(t, instance.Instance{
+		Platform: mockPlatform,
+		Registry: mockRegistry,
+		Config:   mockConfig,
+	})
+	defer cleanup()
+
+	spec := flux.ReleaseSpec{
+		ServiceSpecs: []flux.ServiceSpec{hwSvcSpec},
+		ImageSpec:    flux.ImageSpecLatest,
+		Kind:         flux.ReleaseKindExecute,
+	}
+	cause := flux.ReleaseCause{User: "alice"}
+	run := func(params jobs.ReleaseJobParams) (*jobs.Job, flux.ReleaseResult, error) {
+		job := &jobs.Job{ID: "release", Params: params}
+		var results flux.ReleaseResult
+		_, err := releaser.release(context.Background(), flux.InstanceID("doesn't matter"), job, func(string, ...interface{}) {}, func(r flux.ReleaseResult) {
+			results = r
+		})
+		return job, results, err
+	}
+
+	// The release is worked out, then held until it's approved
+	held, plan, err := run(jobs.ReleaseJobParams{ReleaseSpec: spec, Cause: cause})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !held.Params.(jobs.ReleaseJobParams).PendingApproval() {
+		t.Fatal("expected release to be held for approval")
+	}
+	if plan[hwSvcID].Status != flux.ReleaseStatusPending {
+		t.Fatalf("expected %s to be planned, got %#v", hwSvcID, plan[hwSvcID])
+	}
+	if len(applied) != 0 {
+		t.Fatalf("expected nothing to be applied before approval, got %#v", applied)
+	}
+
+	// If the release would now do something other than what was
+	// approved, it fails
+	changed := flux.ReleaseResult{}
+	for id, result := range plan {
+		changed[id] = result
+	}
+	changed[hwSvcID] = flux.ServiceResult{
+		Status: flux.ReleaseStatusPending,
+		PerContainer: []flux.ContainerUpdate{
+			{Container: "helloworld", Current: oldImageID, Target: sidecarImageID},
+		},
+	}
+	_, _, err = run(jobs.ReleaseJobParams{ReleaseSpec: spec, Cause: cause, Approved: "held", ApprovedPlan: changed})
+	if errors.Cause(err) != ErrPlanChanged {
+		t.Errorf("expected ErrPlanChanged, got %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected nothing to be applied when the plan has changed, got %#v", applied)
+	}
+
+	// Otherwise, it's carried out without asking again
+	_, results, err := run(jobs.ReleaseJobParams{ReleaseSpec: spec, Cause: cause, Approved: "held", ApprovedPlan: plan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[hwSvcID].Status != flux.ReleaseStatusSuccess {
+		t.Errorf("expected %s to be released, got %#v", hwSvcID, results[hwSvcID])
+	}
+	if len(applied) != 1 || applied[0].ServiceID != hwSvcID {
+		t.Errorf("expected %s to be applied, got %#v", hwSvcID, applied)
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/pkg/errors"
+
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/instance"
 	"github.com/weaveworks/flux/platform/kubernetes"
 )
@@ -15,6 +18,7 @@ import (
 const (
 	Locked         = "locked"
 	NotIncluded    = "not included"
+	OtherNamespace = "in another namespace"
 	Excluded       = "excluded"
 	DifferentImage = "a different image"
 	NotInCluster   = "not running in cluster"
@@ -22,6 +26,10 @@ const (
 	ImageUpToDate  = "image(s) up to date"
 )
 
+// pushAttempts is how many times to try pushing changes, rebasing
+// them between attempts, before giving up.
+const pushAttempts = 3
+
 type ReleaseContext struct {
 	Instance   *instance.Instance
 	WorkingDir string
@@ -52,14 +60,75 @@ func (rc *ReleaseContext) RepoPath() string {
 	return filepath.Join(rc.WorkingDir, rc.Instance.ConfigRepo().Path)
 }
 
-func (rc *ReleaseContext) PushChanges(updates []*ServiceUpdate, spec *flux.ReleaseSpec) error {
+func (rc *ReleaseContext) PushChanges(updates []*ServiceUpdate, spec *flux.ReleaseSpec, logStatus statusFn) error {
 	err := writeUpdates(updates)
 	if err != nil {
 		return err
 	}
 
 	commitMsg := commitMessageFromReleaseSpec(spec)
-	return rc.CommitAndPush(commitMsg)
+	return rc.commitAndPushRebasing(commitMsg, func(conflicted bool) error {
+		if conflicted {
+			return remakeUpdates(updates)
+		}
+		return rc.rereadUpdates(updates)
+	}, logStatus)
+}
+
+// PushChangesToBranch commits the changes and pushes them to a branch
+// of their own, rather than the config repo's branch, so they can be
+// proposed in a pull request.
+func (rc *ReleaseContext) PushChangesToBranch(updates []*ServiceUpdate, spec *flux.ReleaseSpec, branch string) error {
+	if err := writeUpdates(updates); err != nil {
+		return err
+	}
+	repo := rc.Instance.ConfigRepo()
+	if err := repo.Commit(rc.WorkingDir, commitMessageFromReleaseSpec(spec)); err != nil {
+		return err
+	}
+	return repo.PushBranch(rc.WorkingDir, branch)
+}
+
+// commitAndPushRebasing commits and pushes the changes in the working
+// copy. If the push is rejected because someone else has pushed in
+// the meantime, the commit is rebased onto theirs and pushed again.
+// After any rebase, `rebased` is called, so that whatever was kept of
+// the files before can be brought up to date with theirs; if the
+// commit didn't rebase cleanly, it's told so, and must make the
+// changes afresh on top of theirs.
+func (rc *ReleaseContext) commitAndPushRebasing(msg string, rebased func(conflicted bool) error, logStatus statusFn) error {
+	repo := rc.Instance.ConfigRepo()
+	if err := repo.Commit(rc.WorkingDir, msg); err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err := repo.Push(rc.WorkingDir)
+		if err != git.ErrPushRejected || attempt == pushAttempts {
+			return err
+		}
+
+		logStatus("Push rejected because the branch has moved on; rebasing onto it.")
+		switch err = repo.Rebase(rc.WorkingDir); err {
+		case nil:
+			if err = rebased(false); err != nil {
+				return err
+			}
+		case git.ErrRebaseConflict:
+			logStatus("Changes conflict with those made upstream; making them again.")
+			if err = rebased(true); err != nil {
+				return err
+			}
+			if err = repo.Commit(rc.WorkingDir, msg); err == git.ErrNoChanges {
+				logStatus("Changes had already been made upstream; nothing to push.")
+				return nil
+			} else if err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+		logStatus("Pushing changes (attempt %d of %d).", attempt+1, pushAttempts)
+	}
 }
 
 func writeUpdates(updates []*ServiceUpdate) error {
@@ -75,9 +144,69 @@ func writeUpdates(updates []*ServiceUpdate) error {
 	return nil
 }
 
+// remakeUpdates makes the container updates again, to the manifests
+// as they are now in the working copy, and writes them out.
+func remakeUpdates(updates []*ServiceUpdate) error {
+	for _, update := range updates {
+		def, err := ioutil.ReadFile(update.ManifestPath)
+		if err != nil {
+			return errors.Wrapf(err, "reading manifest for %s", update.ServiceID)
+		}
+		update.PreviousManifestBytes = def
+		name := update.ControllerName
+		for _, c := range update.Updates {
+			if def, name, _, err = updatePodController(def, update.ControllerKind, name, c.Target); err != nil {
+				return errors.Wrapf(err, "updating manifest for %s", update.ServiceID)
+			}
+		}
+		update.ManifestBytes = def
+	}
+	return writeUpdates(updates)
+}
+
+// rereadUpdates reads the manifests again after the commit making the
+// updates has been rebased, since they may now include changes made
+// upstream as well. The previous manifests are those upstream, from
+// before the commit.
+func (rc *ReleaseContext) rereadUpdates(updates []*ServiceUpdate) error {
+	for _, update := range updates {
+		def, err := ioutil.ReadFile(update.ManifestPath)
+		if err != nil {
+			return errors.Wrapf(err, "reading manifest for %s", update.ServiceID)
+		}
+		path, err := filepath.Rel(rc.WorkingDir, update.ManifestPath)
+		if err != nil {
+			return err
+		}
+		previous, err := git.FileAtRevision(rc.WorkingDir, "HEAD^", path)
+		if err != nil {
+			return errors.Wrapf(err, "reading previous manifest for %s", update.ServiceID)
+		}
+		update.ManifestBytes, update.PreviousManifestBytes = def, previous
+	}
+	return nil
+}
+
+// updatePodController changes the image used by a pod controller in
+// the manifest given. Doing so can rename the controller (see
+// kubernetes.UpdatePodController), so it returns the controller's
+// name afterwards, to find it by for any further changes.
+func updatePodController(def []byte, kind, name string, target flux.ImageID) ([]byte, string, kubernetes.ManifestDiff, error) {
+	def, diff, err := kubernetes.UpdatePodController(def, kind, name, target)
+	if err != nil {
+		return nil, name, nil, err
+	}
+	for _, change := range diff {
+		if change.Path == "metadata.name" {
+			name = change.New
+		}
+	}
+	return def, name, diff, nil
+}
+
 func (rc *ReleaseContext) Clean() {
 	if rc.WorkingDir != "" {
-		os.RemoveAll(rc.WorkingDir)
+		rc.Instance.ConfigRepo().Clean(rc.WorkingDir)
 	}
 }
 
@@ -89,7 +218,7 @@ func (rc *ReleaseContext) Clean() {
 // in the slice will have higher priority (they are run first).
 func (rc *ReleaseContext) SelectServices(results flux.ReleaseResult, logStatus statusFn, filters ...ServiceFilter) ([]*ServiceUpdate, error) {
 	// Get services defined in repository
-	defined, err := rc.FindDefinedServices()
+	defined, err := rc.FindDefinedServices(logStatus)
 	if err != nil {
 		return nil, err
 	}
@@ -165,32 +294,60 @@ func (s *ServiceUpdate) filter(filters ...ServiceFilter) flux.ServiceResult {
 	return flux.ServiceResult{}
 }
 
-func (rc *ReleaseContext) FindDefinedServices() ([]*ServiceUpdate, error) {
-	services, err := kubernetes.FindDefinedServices(rc.RepoPath())
+// FindDefinedServices finds the services defined in the repo, and
+// the file defining each one's pod controller, which is what gets
+// updated. Problems with individual files are reported, but
+// otherwise ignored.
+func (rc *ReleaseContext) FindDefinedServices(logStatus statusFn) ([]*ServiceUpdate, error) {
+	services, warnings, err := kubernetes.ParseServices(rc.RepoPath())
 	if err != nil {
 		return nil, err
 	}
+	for _, w := range warnings {
+		logStatus("Warning: skipping file %s: %s", rc.relativePath(w.Path), w.Err)
+	}
 
 	var defined []*ServiceUpdate
-	for id, paths := range services {
-		switch len(paths) {
-		case 1:
-			def, err := ioutil.ReadFile(paths[0])
-			if err != nil {
-				return nil, err
+	for id, files := range services {
+		switch {
+		case len(files.Controllers) == 0:
+			// Nothing we can update
+			continue
+		case len(files.Controllers) > 1:
+			return nil, fmt.Errorf("multiple resource files found for service %s: %s", id, strings.Join(files.Controllers, ", "))
+		case len(files.PodControllers) > 1:
+			var names []string
+			for _, c := range files.PodControllers {
+				names = append(names, c.Kind+" "+c.Name)
 			}
-			defined = append(defined, &ServiceUpdate{
-				ServiceID:     id,
-				ManifestPath:  paths[0],
-				ManifestBytes: def,
-			})
-		default:
-			return nil, fmt.Errorf("multiple resource files found for service %s: %s", id, strings.Join(paths, ", "))
+			return nil, fmt.Errorf("multiple pod controllers found for service %s in %s: %s", id, files.Controllers[0], strings.Join(names, ", "))
+		}
+		controller := files.PodControllers[0]
+		def, err := ioutil.ReadFile(controller.Path)
+		if err != nil {
+			return nil, err
 		}
+		defined = append(defined, &ServiceUpdate{
+			ServiceID:             id,
+			ManifestPath:          controller.Path,
+			ManifestBytes:         def,
+			ControllerKind:        controller.Kind,
+			ControllerName:        controller.Name,
+			PreviousManifestBytes: def,
+		})
 	}
 	return defined, nil
 }
 
+// relativePath gives a path in the working clone relative to the
+// config in the repo, for reporting.
+func (rc *ReleaseContext) relativePath(path string) string {
+	if rel, err := filepath.Rel(rc.RepoPath(), path); err == nil {
+		return rel
+	}
+	return path
+}
+
 type ServiceFilter interface {
 	Filter(ServiceUpdate) flux.ServiceResult
 }
@@ -254,6 +411,25 @@ func (f *IncludeFilter) Filter(u ServiceUpdate) flux.ServiceResult {
 	}
 }
 
+// NamespaceFilter lets through only services in the namespaces
+// given.
+type NamespaceFilter struct {
+	Namespaces []string
+}
+
+func (f *NamespaceFilter) Filter(u ServiceUpdate) flux.ServiceResult {
+	namespace, _ := u.ServiceID.Components()
+	for _, ns := range f.Namespaces {
+		if namespace == ns {
+			return flux.ServiceResult{}
+		}
+	}
+	return flux.ServiceResult{
+		Status: flux.ReleaseStatusIgnored,
+		Error:  OtherNamespace,
+	}
+}
+
 type LockedFilter struct {
 	IDs []flux.ServiceID
 }
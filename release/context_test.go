@@ -2,6 +2,7 @@ package release
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -42,6 +43,132 @@ func TestCloneCommitAndPush(t *testing.T) {
 	}
 }
 
+func TestCommitAndPushRebasing(t *testing.T) {
+	r, cleanup := setupRepo(t)
+	defer cleanup()
+	inst := &instance.Instance{Repo: r}
+
+	var names []string
+	for name, _ := range testdata.Files {
+		names = append(names, name)
+	}
+
+	// writeAndPush makes a change in a fresh clone, and pushes it, as
+	// though someone else got there first.
+	writeAndPush := func(name, content string) {
+		other := NewReleaseContext(inst)
+		defer other.Clean()
+		if err := other.CloneRepo(); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(other.WorkingDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := other.CommitAndPush("Someone else's change"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logged []string
+	logStatus := func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+
+	// A change to another file rebases cleanly
+	ctx := NewReleaseContext(inst)
+	defer ctx.Clean()
+	if err := ctx.CloneRepo(); err != nil {
+		t.Fatal(err)
+	}
+	writeAndPush(names[0], "theirs")
+	if err := ioutil.WriteFile(filepath.Join(ctx.WorkingDir, names[1]), []byte("ours"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var rebased bool
+	err := ctx.commitAndPushRebasing("Our change", func(conflicted bool) error {
+		if conflicted {
+			t.Error("did not expect to remake changes that rebase cleanly")
+		}
+		rebased = true
+		return nil
+	}, logStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rebased {
+		t.Error("expected to be told of the rebase")
+	}
+	if len(logged) != 2 {
+		t.Errorf("expected the rebase and second attempt to be logged, got %q", logged)
+	}
+
+	// A change to the same file has to be made again
+	logged = nil
+	ctx = NewReleaseContext(inst)
+	defer ctx.Clean()
+	if err := ctx.CloneRepo(); err != nil {
+		t.Fatal(err)
+	}
+	writeAndPush(names[1], "theirs again")
+	path := filepath.Join(ctx.WorkingDir, names[1])
+	if err := ioutil.WriteFile(path, []byte("ours again"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var remade bool
+	err = ctx.commitAndPushRebasing("Our change", func(conflicted bool) error {
+		remade = conflicted
+		return ioutil.WriteFile(path, []byte("ours, remade"), 0644)
+	}, logStatus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !remade {
+		t.Error("expected conflicting change to be remade")
+	}
+	if len(logged) != 3 {
+		t.Errorf("expected the rebase, conflict, and second attempt to be logged, got %q", logged)
+	}
+}
+
+func TestRereadUpdates(t *testing.T) {
+	r, cleanup := setupRepo(t)
+	defer cleanup()
+	ctx := NewReleaseContext(&instance.Instance{Repo: r})
+	defer ctx.Clean()
+	if err := ctx.CloneRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	for name = range testdata.Files {
+		break
+	}
+	path := filepath.Join(ctx.WorkingDir, name)
+	update := &ServiceUpdate{
+		ServiceID:             "default/service",
+		ManifestPath:          path,
+		ManifestBytes:         []byte("ours"),
+		PreviousManifestBytes: []byte("before"),
+	}
+	// As though our change had been rebased onto someone else's
+	if err := ioutil.WriteFile(path, []byte("theirs and ours"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.CommitAndPush("Rebased change"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ctx.rereadUpdates([]*ServiceUpdate{update}); err != nil {
+		t.Fatal(err)
+	}
+	if string(update.ManifestBytes) != "theirs and ours" {
+		t.Errorf("expected manifest as rebased, got %q", update.ManifestBytes)
+	}
+	if string(update.PreviousManifestBytes) != testdata.Files[name] {
+		t.Errorf("expected previous manifest from upstream, got %q", update.PreviousManifestBytes)
+	}
+}
+
 func setupRepo(t *testing.T) (git.Repo, func()) {
 	newDir, cleanup := testdata.TempDir(t)
 
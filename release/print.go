@@ -25,7 +25,11 @@ func PrintResults(out io.Writer, results flux.ReleaseResult, verbose bool) {
 			extraLines = append(extraLines, result.Error)
 		}
 		for _, update := range result.PerContainer {
-			extraLines = append(extraLines, fmt.Sprintf("%s: %s -> %s", update.Container, update.Current.FullID(), update.Target.Tag))
+			target := update.Target.Tag
+			if update.Target.Pinned() {
+				target += "@" + update.Target.Digest
+			}
+			extraLines = append(extraLines, fmt.Sprintf("%s: %s -> %s", update.Container, update.Current.FullID(), target))
 		}
 
 		var inline string
@@ -23,8 +23,8 @@ func TestPrintResults(t *testing.T) {
 					PerContainer: []flux.ContainerUpdate{
 						{
 							Container: "helloworld",
-							Current:   flux.ImageID{"quay.io", "weaveworks", "helloworld", "master-a000002"},
-							Target:    flux.ImageID{"quay.io", "weaveworks", "helloworld", "master-a000001"},
+							Current:   flux.ImageID{Host: "quay.io", Namespace: "weaveworks", Image: "helloworld", Tag: "master-a000002"},
+							Target:    flux.ImageID{Host: "quay.io", Namespace: "weaveworks", Image: "helloworld", Tag: "master-a000001"},
 						},
 					},
 				},
@@ -44,8 +44,8 @@ default/helloworld  pending  helloworld: quay.io/weaveworks/helloworld:master-a0
 					PerContainer: []flux.ContainerUpdate{
 						{
 							Container: "helloworld",
-							Current:   flux.ImageID{"quay.io", "weaveworks", "helloworld", "master-a000002"},
-							Target:    flux.ImageID{"quay.io", "weaveworks", "helloworld", "master-a000001"},
+							Current:   flux.ImageID{Host: "quay.io", Namespace: "weaveworks", Image: "helloworld", Tag: "master-a000002"},
+							Target:    flux.ImageID{Host: "quay.io", Namespace: "weaveworks", Image: "helloworld", Tag: "master-a000001"},
 						},
 					},
 				},
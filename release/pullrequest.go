@@ -0,0 +1,272 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/integrations/github"
+	"github.com/weaveworks/flux/jobs"
+)
+
+const (
+	// How often to check whether a release's pull request has been
+	// merged, if the instance config doesn't say otherwise.
+	DefaultPullRequestPollInterval = time.Minute
+
+	// Releases made by pull request push their changes to a branch
+	// named with this prefix and the release ID.
+	pullRequestBranchPrefix = "flux-release-"
+
+	// The branch pull requests are opened against, if the git config
+	// doesn't give one.
+	defaultBaseBranch = "master"
+)
+
+var ErrPullRequestClosed = flux.UserConfigProblem{&flux.BaseError{
+	Help: `The pull request proposing the release was closed without being merged.
+
+Nothing has been released. If you still want to release the changes,
+you can post the release again, and it will open another pull request.
+`,
+	Err: errors.New("pull request closed without being merged"),
+}}
+
+// PullRequester opens pull requests against the config repo, says
+// whether they've been merged, and tidies them away afterwards. The
+// GitHub client in integrations/github is one.
+type PullRequester interface {
+	CreatePullRequest(ownerName, repoName, head, base, title, body string) (int, string, error)
+	PullRequestState(ownerName, repoName string, number int) (string, error)
+	ClosePullRequest(ownerName, repoName string, number int) error
+	DeleteBranch(ownerName, repoName, branch string) error
+}
+
+func pullRequestPollInterval(conf *flux.PullRequestConfig) (time.Duration, error) {
+	if conf.PollInterval == "" {
+		return DefaultPullRequestPollInterval, nil
+	}
+	interval, err := time.ParseDuration(conf.PollInterval)
+	if err != nil {
+		return DefaultPullRequestPollInterval, errors.Wrapf(err, "parsing pull request poll interval %q", conf.PollInterval)
+	}
+	if interval <= 0 {
+		return DefaultPullRequestPollInterval, fmt.Errorf("pull request poll interval %q is not positive", conf.PollInterval)
+	}
+	return interval, nil
+}
+
+// `proposeRelease` pushes the changes to a branch of their own, and
+// opens a pull request to merge them into the config repo's branch,
+// describing the release. It returns a jobs.WaitError, so the job
+// waits for the pull request to be merged (see `releaseMerged`).
+func (r *Releaser) proposeRelease(rc *ReleaseContext, job *jobs.Job, updates []*ServiceUpdate, spec *flux.ReleaseSpec, results flux.ReleaseResult, conf flux.UnsafeInstanceConfig, logStatus statusFn) error {
+	ownerName, repoName, err := github.RepoFromURL(conf.Git.URL)
+	if err != nil {
+		return errors.Wrap(err, "releasing by pull request")
+	}
+	interval, err := pullRequestPollInterval(conf.Release.PullRequest)
+	if err != nil {
+		logStatus("Using default pull request poll interval of %s: %s", interval, err)
+	}
+	base := conf.Git.Branch
+	if base == "" {
+		base = defaultBaseBranch
+	}
+
+	branch := pullRequestBranchPrefix + string(job.ID)
+	logStatus("Pushing changes to branch %s.", branch)
+	timer := NewStageTimer("push_changes")
+	err = rc.PushChangesToBranch(updates, spec, branch)
+	timer.ObserveDuration()
+	if err != nil {
+		return err
+	}
+
+	logStatus("Opening pull request to merge %s into %s.", branch, base)
+	client := r.pullRequests(conf.Release.PullRequest.Token)
+	number, url, err := client.CreatePullRequest(ownerName, repoName, branch, base, commitMessageFromReleaseSpec(spec), pullRequestBody(job, results))
+	if err != nil {
+		if err := client.DeleteBranch(ownerName, repoName, branch); err != nil {
+			logStatus("Error deleting branch %s: %s", branch, err)
+		}
+		return errors.Wrap(err, "opening pull request")
+	}
+
+	params := job.Params.(jobs.ReleaseJobParams)
+	params.PullRequest = &flux.ReleasePullRequest{
+		Branch: branch,
+		Number: number,
+		URL:    url,
+	}
+	job.Params = params
+	logStatus("Opened pull request %s; the release will be carried out once it is merged.", url)
+	return waitForPullRequest(params.PullRequest, interval)
+}
+
+// `releaseMerged` carries out a release proposed in a pull request,
+// once the pull request has been merged. Until then, it returns a
+// jobs.WaitError, so the job is handled again later to check again.
+// Once the release is finished with, one way or another, the pull
+// request is closed if it wasn't merged, and its branch deleted.
+func (r *Releaser) releaseMerged(ctx context.Context, instanceID flux.InstanceID, job *jobs.Job, logStatus statusFn, report resultFn) ([]jobs.Job, error) {
+	pr := job.Params.(jobs.ReleaseJobParams).PullRequest
+	inst, err := r.instancer.Get(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	inst.Logger = log.NewContext(inst.Logger).With("release-id", string(job.ID))
+
+	conf, err := inst.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting config to check pull request")
+	}
+	prConf := conf.Settings.Release.PullRequest
+	if prConf == nil {
+		return nil, fmt.Errorf("releasing by pull request is no longer configured, so cannot check whether %s has been merged", pr.URL)
+	}
+	interval, _ := pullRequestPollInterval(prConf)
+	ownerName, repoName, err := github.RepoFromURL(conf.Settings.Git.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "checking pull request")
+	}
+
+	client := r.pullRequests(prConf.Token)
+	state, err := client.PullRequestState(ownerName, repoName, pr.Number)
+	if err != nil {
+		if github.IsTransient(err) {
+			// Keep waiting, but say why
+			return nil, &jobs.WaitError{
+				Reason: fmt.Sprintf("Error checking pull request %s: %s", pr.URL, err),
+				After:  interval,
+			}
+		}
+		// e.g., the token has been revoked; this won't go away by
+		// itself, so give up, and try to tidy up.
+		finishPullRequest(client, ownerName, repoName, pr, false, logStatus)
+		return nil, errors.Wrapf(err, "checking pull request %s", pr.URL)
+	}
+	if state == github.PullRequestOpen {
+		return nil, waitForPullRequest(pr, interval)
+	}
+	defer func() {
+		finishPullRequest(client, ownerName, repoName, pr, state == github.PullRequestMerged, logStatus)
+	}()
+	if state == github.PullRequestClosed {
+		return nil, errors.Wrap(ErrPullRequestClosed, pr.URL)
+	}
+	logStatus("Pull request %s has been merged.", pr.URL)
+
+	// This is the last point at which the release can be cancelled
+	// without leaving things half done.
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rc := NewReleaseContext(inst)
+	defer rc.Clean()
+	logStatus("Cloning git repository.")
+	if err = rc.CloneRepo(); err != nil {
+		return nil, err
+	}
+
+	results, _ := job.Result.(flux.ReleaseResult)
+	if results == nil {
+		results = flux.ReleaseResult{}
+	}
+	updates, err := mergedUpdates(rc, results, logStatus)
+	if err != nil {
+		return nil, err
+	}
+	spec := job.Params.(jobs.ReleaseJobParams).Spec()
+	return applyRelease(rc, instanceID, job, updates, &spec, results, logStatus, report)
+}
+
+// `mergedUpdates` gives the updates to apply once a release's pull
+// request has been merged: the definitions of the services it was to
+// update, as they are now in the repo. These may differ from what was
+// proposed, if the pull request was changed before being merged.
+func mergedUpdates(rc *ReleaseContext, results flux.ReleaseResult, logStatus statusFn) ([]*ServiceUpdate, error) {
+	defined, err := rc.FindDefinedServices(logStatus)
+	if err != nil {
+		return nil, err
+	}
+	var updates []*ServiceUpdate
+	for _, update := range defined {
+		result, ok := results[update.ServiceID]
+		if !ok || result.Status != flux.ReleaseStatusPending {
+			continue
+		}
+		update.Updates = result.PerContainer
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// finishPullRequest tidies up after a release proposed in a pull
+// request: unless the pull request was merged, it's closed, and
+// either way its branch is deleted. This doesn't change how the
+// release went, so errors are only reported.
+func finishPullRequest(client PullRequester, ownerName, repoName string, pr *flux.ReleasePullRequest, merged bool, logStatus statusFn) {
+	if !merged {
+		if err := client.ClosePullRequest(ownerName, repoName, pr.Number); err != nil {
+			logStatus("Error closing pull request %s: %s", pr.URL, err)
+		}
+	}
+	if err := client.DeleteBranch(ownerName, repoName, pr.Branch); err != nil {
+		logStatus("Error deleting branch %s: %s", pr.Branch, err)
+	}
+}
+
+// CancelPullRequest closes the pull request proposing a release, and
+// deletes its branch, for when the release is cancelled while waiting
+// for the pull request to be merged.
+func CancelPullRequest(inst *instance.Instance, pr *flux.ReleasePullRequest) error {
+	conf, err := inst.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "getting config to close pull request")
+	}
+	prConf := conf.Settings.Release.PullRequest
+	if prConf == nil {
+		return fmt.Errorf("releasing by pull request is no longer configured, so cannot close %s", pr.URL)
+	}
+	ownerName, repoName, err := github.RepoFromURL(conf.Settings.Git.URL)
+	if err != nil {
+		return errors.Wrap(err, "closing pull request")
+	}
+	finishPullRequest(github.NewGithubClient(prConf.Token), ownerName, repoName, pr, false, func(format string, args ...interface{}) {
+		inst.Log("err", fmt.Sprintf(format, args...))
+	})
+	return nil
+}
+
+func waitForPullRequest(pr *flux.ReleasePullRequest, interval time.Duration) error {
+	return &jobs.WaitError{
+		Reason: fmt.Sprintf("Waiting for pull request %s to be merged.", pr.URL),
+		After:  interval,
+	}
+}
+
+// pullRequestBody describes the release, for the pull request
+// proposing it.
+func pullRequestBody(job *jobs.Job, results flux.ReleaseResult) string {
+	cause := job.Params.(jobs.ReleaseJobParams).Cause
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "Release %s", job.ID)
+	if cause.User != "" {
+		fmt.Fprintf(&body, " by %s", cause.User)
+	}
+	if cause.Message != "" {
+		fmt.Fprintf(&body, ": %s", cause.Message)
+	}
+	fmt.Fprint(&body, "\n\n```\n")
+	PrintResults(&body, results, false)
+	fmt.Fprint(&body, "```\n\nFlux will carry out the release once this pull request is merged.\n")
+	return body.String()
+}
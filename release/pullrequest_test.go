@@ -0,0 +1,210 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/http/httperror"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/integrations/github"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+)
+
+type mockPullRequester struct {
+	head, base, body string
+	state            string
+	stateErr         error
+	closed           bool
+	deleted          []string
+}
+
+func (m *mockPullRequester) CreatePullRequest(ownerName, repoName, head, base, title, body string) (int, string, error) {
+	if ownerName != "o" || repoName != "r" {
+		return 0, "", errors.Errorf("expected pull request for o/r, got %s/%s", ownerName, repoName)
+	}
+	m.head, m.base, m.body = head, base, body
+	return 1, "https://github.com/o/r/pull/1", nil
+}
+
+func (m *mockPullRequester) PullRequestState(ownerName, repoName string, number int) (string, error) {
+	if number != 1 {
+		return "", errors.Errorf("expected pull request 1, got %d", number)
+	}
+	return m.state, m.stateErr
+}
+
+func (m *mockPullRequester) ClosePullRequest(ownerName, repoName string, number int) error {
+	if number != 1 {
+		return errors.Errorf("expected pull request 1, got %d", number)
+	}
+	m.closed = true
+	return nil
+}
+
+func (m *mockPullRequester) DeleteBranch(ownerName, repoName, branch string) error {
+	m.deleted = append(m.deleted, branch)
+	return nil
+}
+
+func TestReleaseByPullRequest(t *testing.T) {
+	var applied []platform.ServiceDefinition
+	mockPlatform := &platform.MockPlatform{
+		SomeServicesAnswer: []platform.Service{hwSvc},
+		ApplyArgTest: func(defs []platform.ServiceDefinition) error {
+			applied = defs
+			return nil
+		},
+	}
+	mockConfig := &instance.MockConfigurer{
+		Config: instance.Config{
+			Settings: flux.UnsafeInstanceConfig{
+				Git: flux.GitConfig{
+					URL:    "git@github.com:o/r",
+					Branch: "master",
+				},
+				Release: flux.ReleaseConfig{
+					VerifyTimeout: "0s",
+					PullRequest:   &flux.PullRequestConfig{Token: "token"},
+				},
+			},
+		},
+	}
+	releaser, cleanup := setup(t, instance.Instance{
+		Platform: mockPlatform,
+		Registry: mockRegistry,
+		Config:   mockConfig,
+	})
+	defer cleanup()
+	pullRequests := &mockPullRequester{state: github.PullRequestOpen}
+	releaser.pullRequests = func(token string) PullRequester {
+		if token != "token" {
+			t.Errorf("expected the configured token, got %q", token)
+		}
+		return pullRequests
+	}
+	repoURL := mockConfigRepoURL(t, releaser)
+
+	job := &jobs.Job{
+		ID: "job",
+		Params: jobs.ReleaseJobParams{
+			ReleaseSpec: flux.ReleaseSpec{
+				ServiceSpecs: []flux.ServiceSpec{hwSvcSpec},
+				ImageSpec:    flux.ImageSpecLatest,
+				Kind:         flux.ReleaseKindExecute,
+			},
+		},
+	}
+	release := func() error {
+		_, err := releaser.release(context.Background(), flux.InstanceID("instance"), job, func(string, ...interface{}) {}, func(r flux.ReleaseResult) {
+			job.Result = r
+		})
+		return err
+	}
+	expectWaiting := func(when string) {
+		if err := release(); err == nil {
+			t.Fatalf("%s: expected release to wait, but it finished", when)
+		} else if _, ok := errors.Cause(err).(*jobs.WaitError); !ok {
+			t.Fatalf("%s: expected release to wait, got %v", when, err)
+		}
+	}
+
+	// The changes are pushed to a branch, and a pull request opened
+	// for them, rather than being applied
+	masterBefore := gitRevParse(t, repoURL, "master")
+	expectWaiting("opening pull request")
+	pr := job.Params.(jobs.ReleaseJobParams).PullRequest
+	if pr == nil || pr.Number != 1 || pr.Branch != "flux-release-job" {
+		t.Fatalf("expected pull request to be recorded, got %+v", pr)
+	}
+	if pullRequests.head != pr.Branch || pullRequests.base != "master" {
+		t.Errorf("expected pull request from %s into master, got from %s into %s", pr.Branch, pullRequests.head, pullRequests.base)
+	}
+	if !strings.Contains(pullRequests.body, string(hwSvcID)) {
+		t.Errorf("expected pull request to describe the release, got:\n%s", pullRequests.body)
+	}
+	if gitRevParse(t, repoURL, "master") != masterBefore {
+		t.Error("expected master not to have been pushed to")
+	}
+	if applied != nil {
+		t.Error("did not expect changes to be applied before pull request is merged")
+	}
+
+	// Until the pull request is merged, the release keeps waiting,
+	// including if GitHub can't be reached for the moment
+	expectWaiting("pull request still open")
+	pullRequests.stateErr = errors.New("dial tcp: connection refused")
+	expectWaiting("GitHub unreachable")
+	pullRequests.stateErr = nil
+	if pullRequests.closed || len(pullRequests.deleted) > 0 {
+		t.Error("did not expect pull request to be tidied away while waiting")
+	}
+
+	// Once it's merged, the release is carried out
+	gitIn(t, repoURL, "update-ref", "refs/heads/master", "refs/heads/"+pr.Branch)
+	pullRequests.state = github.PullRequestMerged
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].ServiceID != hwSvcID || !bytes.Contains(applied[0].NewDefinition, []byte(newImageID.String())) {
+		t.Errorf("expected merged definition of %s to be applied, got %+v", hwSvcID, applied)
+	}
+	if result := job.Result.(flux.ReleaseResult)[hwSvcID]; result.Status != flux.ReleaseStatusSuccess {
+		t.Errorf("expected %s to be released, got %+v", hwSvcID, result)
+	}
+	if pullRequests.closed || len(pullRequests.deleted) != 1 || pullRequests.deleted[0] != pr.Branch {
+		t.Errorf("expected branch %s to be deleted, and merged pull request left alone; got closed %v, deleted %v", pr.Branch, pullRequests.closed, pullRequests.deleted)
+	}
+
+	// A release whose pull request is closed unmerged fails
+	pullRequests.state, pullRequests.deleted = github.PullRequestClosed, nil
+	if err := release(); errors.Cause(err) != ErrPullRequestClosed {
+		t.Errorf("expected release to fail as pull request was closed, got %v", err)
+	}
+	if len(pullRequests.deleted) != 1 {
+		t.Errorf("expected branch to be deleted once release failed, got %v", pullRequests.deleted)
+	}
+
+	// A release whose pull request can't be checked, for a reason
+	// that won't go away by itself, fails, and the pull request is
+	// closed
+	pullRequests.state, pullRequests.closed, pullRequests.deleted = github.PullRequestOpen, false, nil
+	pullRequests.stateErr = &httperror.APIError{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized"}
+	if err := release(); err == nil {
+		t.Error("expected release to fail when refused by GitHub")
+	} else if _, ok := errors.Cause(err).(*jobs.WaitError); ok {
+		t.Errorf("expected release to fail when refused by GitHub, but it's waiting: %v", err)
+	}
+	if !pullRequests.closed || len(pullRequests.deleted) != 1 {
+		t.Errorf("expected pull request to be closed and branch deleted once release failed, got closed %v, deleted %v", pullRequests.closed, pullRequests.deleted)
+	}
+}
+
+func mockConfigRepoURL(t *testing.T, releaser *Releaser) string {
+	inst, err := releaser.instancer.Get(flux.InstanceID("instance"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return inst.ConfigRepo().URL
+}
+
+func gitRevParse(t *testing.T, dir, rev string) string {
+	return strings.TrimSpace(gitIn(t, dir, "rev-parse", rev))
+}
+
+func gitIn(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
@@ -1,8 +1,8 @@
 package release
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"strings"
 	"time"
 
@@ -11,12 +11,16 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/integrations/github"
 	"github.com/weaveworks/flux/jobs"
 	fluxmetrics "github.com/weaveworks/flux/metrics"
 	"github.com/weaveworks/flux/notifications"
 	"github.com/weaveworks/flux/platform"
 	"github.com/weaveworks/flux/platform/kubernetes"
+	"github.com/weaveworks/flux/promote"
+	"github.com/weaveworks/flux/registry"
 )
 
 const FluxServiceName = "fluxsvc"
@@ -24,6 +28,10 @@ const FluxDaemonName = "fluxd"
 
 type Releaser struct {
 	instancer instance.Instancer
+	// Gives a client for opening pull requests, for instances that
+	// release by pull request; a field so it can be replaced in
+	// tests.
+	pullRequests func(token string) PullRequester
 }
 
 func NewReleaser(
@@ -31,6 +39,9 @@ func NewReleaser(
 ) *Releaser {
 	return &Releaser{
 		instancer: instancer,
+		pullRequests: func(token string) PullRequester {
+			return github.NewGithubClient(token)
+		},
 	}
 }
 
@@ -40,6 +51,10 @@ type ServiceUpdate struct {
 	ManifestPath  string
 	ManifestBytes []byte
 	Updates       []flux.ContainerUpdate
+	// The definition as it was in the repo, so we can roll back to it
+	PreviousManifestBytes []byte
+	// The pod controller in the manifest, as it was found there
+	ControllerKind, ControllerName string
 }
 
 // These represent the side-effects that calculating and applying the
@@ -48,7 +63,7 @@ type ServiceUpdate struct {
 type statusFn func(string, ...interface{})
 type resultFn func(resultSoFar flux.ReleaseResult)
 
-func (r *Releaser) Handle(job *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
+func (r *Releaser) Handle(ctx context.Context, job *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
 	logStatus := func(format string, args ...interface{}) {
 		status := fmt.Sprintf(format, args...)
 		job.Status = status
@@ -65,10 +80,25 @@ func (r *Releaser) Handle(job *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, e
 	// is a bit awkward; but we can factor it out once we have a less
 	// coupled way of dealing with release notifications (e.g., as a
 	// job itself).
-	return r.release(job.Instance, job, logStatus, updateResult)
+	return r.release(ctx, job.Instance, job, logStatus, updateResult)
+}
+
+// Retryable says whether a release that failed with the error given
+// is worth trying again. Only errors that happen before anything has
+// been changed, and that are likely to go away -- someone else
+// pushing to the repo at the same time, or the registry having
+// trouble -- count.
+func (r *Releaser) Retryable(_ *jobs.Job, err error) bool {
+	return errors.Cause(err) == git.ErrPushRejected || registry.IsServerError(err)
 }
 
-func (r *Releaser) release(instanceID flux.InstanceID, job *jobs.Job, logStatus statusFn, report resultFn) (_ []jobs.Job, err error) {
+func (r *Releaser) release(ctx context.Context, instanceID flux.InstanceID, job *jobs.Job, logStatus statusFn, report resultFn) (_ []jobs.Job, err error) {
+	// A release proposed in a pull request has been calculated
+	// already, and is waiting for the pull request to be merged.
+	if job.Params.(jobs.ReleaseJobParams).PullRequest != nil {
+		return r.releaseMerged(ctx, instanceID, job, logStatus, report)
+	}
+
 	spec := job.Params.(jobs.ReleaseJobParams).Spec()
 	defer func(started time.Time) {
 		releaseDuration.With(
@@ -139,21 +169,72 @@ func (r *Releaser) release(instanceID flux.InstanceID, job *jobs.Job, logStatus
 		return nil, nil
 	}
 
+	// If this is carrying out an approved release, it must do what
+	// was approved; otherwise, it may need approving before going
+	// any further.
+	params := job.Params.(jobs.ReleaseJobParams)
+	if params.Approved != "" {
+		logStatus("Checking the release is as approved in release %s.", params.Approved)
+		if err = checkApprovedPlan(params.ApprovedPlan, results); err != nil {
+			return nil, err
+		}
+	} else {
+		var required int
+		required, err = needsApproval(rc.Instance, params.Cause, updates)
+		if err != nil {
+			return nil, err
+		}
+		if required > 0 {
+			params.Approval = &flux.ReleaseApproval{Required: required}
+			job.Params = params
+			logStatus("Release needs %s before it is carried out; waiting for approval.", approvalsNeeded(required))
+			return nil, nil
+		}
+	}
+
+	// This is the last point at which the release can be cancelled
+	// without leaving things half done.
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if spec.ImageSpec != flux.ImageSpecNone {
+		var conf instance.Config
+		if conf, err = rc.Instance.GetConfig(); err != nil {
+			return nil, errors.Wrap(err, "getting config to push changes")
+		}
+		if conf.Settings.Release.PullRequest != nil {
+			return nil, r.proposeRelease(rc, job, updates, &spec, results, conf.Settings, logStatus)
+		}
+
 		logStatus("Pushing changes.")
 		timer = NewStageTimer("push_changes")
-		err = rc.PushChanges(updates, &spec)
+		err = rc.PushChanges(updates, &spec, logStatus)
 		timer.ObserveDuration()
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	return applyRelease(rc, instanceID, job, updates, &spec, results, logStatus, report)
+}
+
+// `applyRelease` applies the updates to the platform, then sees the
+// release through: verifying the rollout, sending notifications,
+// recording the release in the history, and giving any promotions to
+// follow on from it.
+func applyRelease(rc *ReleaseContext, instanceID flux.InstanceID, job *jobs.Job, updates []*ServiceUpdate, spec *flux.ReleaseSpec, results flux.ReleaseResult, logStatus statusFn, report resultFn) ([]jobs.Job, error) {
 	logStatus("Applying changes.")
-	timer = NewStageTimer("apply_changes")
+	timer := NewStageTimer("apply_changes")
 	applyErr := applyChanges(rc.Instance, updates, results)
 	timer.ObserveDuration()
 
+	verifyErr := verifyRelease(rc, updates, spec, results, logStatus)
+	if applyErr == nil {
+		applyErr = verifyErr
+	}
+	report(results)
+
 	status := flux.ReleaseStatusSuccess
 	if applyErr != nil {
 		status = flux.ReleaseStatusFailed
@@ -183,12 +264,91 @@ func (r *Releaser) release(instanceID flux.InstanceID, job *jobs.Job, logStatus
 
 	// Log the event into the history
 	timer = NewStageTimer("log_event")
-	err = logEvent(rc.Instance, notifyErr, release)
+	err := logEvent(rc.Instance, notifyErr, release)
 	timer.ObserveDuration()
 
 	report(results)
 
-	return nil, err
+	// Promote successful releases to other instances, if so
+	// configured.
+	var promotions []jobs.Job
+	if status == flux.ReleaseStatusSuccess {
+		promotions, err = promotionJobs(rc.Instance, instanceID, release, err, logStatus)
+	}
+	return promotions, err
+}
+
+// `promotionJobs` gives the jobs promoting the release to other
+// instances, according to the promotion config. Promotions that
+// can't be scheduled are logged and skipped, since the release has
+// been applied by now. It returns the origin error, if that was
+// non-nil, otherwise any problem getting the config.
+func promotionJobs(inst *instance.Instance, instanceID flux.InstanceID, release flux.Release, originErr error, logStatus statusFn) ([]jobs.Job, error) {
+	conf, err := inst.GetConfig()
+	if err != nil {
+		if originErr == nil {
+			return nil, errors.Wrap(err, "getting config for promotions")
+		}
+		return nil, originErr
+	}
+	promotions, err := promote.Jobs(instanceID, conf.Settings.Promotion, release)
+	if err != nil {
+		logStatus("Skipping promotions: %s", err)
+	}
+	for _, job := range promotions {
+		params := job.Params.(jobs.PromoteJobParams)
+		logStatus("Will promote to %s at %s.", params.To, job.ScheduledAt.Format(time.RFC3339))
+	}
+	return promotions, originErr
+}
+
+// `verifyRelease` waits for the services that were updated to become
+// ready, if the instance is so configured, and rolls back those that
+// don't if asked to. It returns an error if any services failed.
+func verifyRelease(rc *ReleaseContext, updates []*ServiceUpdate, spec *flux.ReleaseSpec, results flux.ReleaseResult, logStatus statusFn) error {
+	conf, err := rc.Instance.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "getting config to verify release")
+	}
+	timeout, err := verifyTimeout(conf.Settings)
+	if err != nil {
+		logStatus("Using the default verify timeout of %s: %s", timeout, err)
+	}
+	if timeout == 0 {
+		return nil
+	}
+
+	logStatus("Verifying rollout.")
+	timer := NewStageTimer("verify_rollout")
+	failed := verifyRollout(rc.Instance, updates, results, timeout, logStatus)
+	timer.ObserveDuration()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, update := range failed {
+		ids = append(ids, string(update.ServiceID))
+	}
+	failedErr := fmt.Errorf("services %s: %s", NotReady, strings.Join(ids, ", "))
+
+	// Rolling back only makes sense if we changed the definitions,
+	// and can only be done by pushing to the branch, which releasing
+	// by pull request is meant to avoid.
+	if conf.Settings.Release.Rollback && spec.ImageSpec != flux.ImageSpecNone {
+		if conf.Settings.Release.PullRequest != nil {
+			logStatus("Not rolling back, since releases are made by pull request.")
+			return failedErr
+		}
+		timer = NewStageTimer("rollback")
+		err = rollback(rc, failed, results, logStatus)
+		timer.ObserveDuration()
+		if err != nil {
+			logStatus("Error rolling back: %s", err)
+			return errors.Wrapf(failedErr, "rolling back: %s", err)
+		}
+	}
+	return failedErr
 }
 
 // `logEvent` expects the result of applying updates, and records an event in
@@ -300,6 +460,11 @@ func filters(spec *flux.ReleaseSpec, rc *ReleaseContext) ([]ServiceFilter, error
 		filtList = append(filtList, incFilt)
 	}
 
+	// Namespace filter
+	if len(spec.Namespaces) > 0 {
+		filtList = append(filtList, &NamespaceFilter{spec.Namespaces})
+	}
+
 	// Exclude filter
 	if len(spec.Excludes) > 0 {
 		exFilt := &ExcludeFilter{spec.Excludes}
@@ -330,16 +495,30 @@ func calculateImageUpdates(inst *instance.Instance, candidates []*ServiceUpdate,
 	// Compile an `ImageMap` of all relevant images
 	var images instance.ImageMap
 	var err error
+	// When releasing the latest images, each service's tag filter
+	// applies; a specific image is released regardless.
+	filters := map[flux.ServiceID]flux.TagFilter{}
+	// A specific image asked for by digest is released pinned, even
+	// where the current image isn't.
+	var pin bool
 
 	switch spec.ImageSpec {
 	case flux.ImageSpecNone:
 		images = instance.ImageMap{}
 	case flux.ImageSpecLatest:
 		images, err = CollectAvailableImages(inst, candidates)
+		if err == nil {
+			var conf instance.Config
+			conf, err = inst.GetConfig()
+			for id, service := range conf.Services {
+				filters[id] = service.TagFilter
+			}
+		}
 	default:
 		var image flux.ImageID
 		image, err = spec.ImageSpec.AsID()
 		if err == nil {
+			pin = image.Pinned()
 			images, err = inst.ExactImages([]flux.ImageID{image})
 		}
 	}
@@ -367,6 +546,7 @@ func calculateImageUpdates(inst *instance.Instance, candidates []*ServiceUpdate,
 		// for the purpose of filtering the output.
 		ignoredOrSkipped := flux.ReleaseStatusIgnored
 		var containerUpdates []flux.ContainerUpdate
+		controllerName := update.ControllerName
 
 		for _, container := range containers {
 			currentImageID, err := flux.ParseImageID(container.Image)
@@ -376,28 +556,33 @@ func calculateImageUpdates(inst *instance.Instance, candidates []*ServiceUpdate,
 				return nil, err
 			}
 
-			latestImage := images.LatestImage(currentImageID.Repository())
+			latestImage := images.LatestImage(currentImageID.Repository(), filters[update.ServiceID])
 			if latestImage == nil {
 				ignoredOrSkipped = flux.ReleaseStatusUnknown
 				continue
 			}
 
-			if currentImageID == latestImage.ID {
+			targetImageID := instance.ReleaseTarget(currentImageID, latestImage.ID, pin)
+			if currentImageID == targetImageID {
 				ignoredOrSkipped = flux.ReleaseStatusSkipped
 				continue
 			}
 
-			update.ManifestBytes, err = kubernetes.UpdatePodController(update.ManifestBytes, latestImage.ID, ioutil.Discard)
+			var diff kubernetes.ManifestDiff
+			update.ManifestBytes, controllerName, diff, err = updatePodController(update.ManifestBytes, update.ControllerKind, controllerName, targetImageID)
 			if err != nil {
 				logStatus("Failed on service %s: %s", update.ServiceID, err.Error())
 				return nil, err
 			}
+			for _, change := range diff {
+				logStatus("Changing %s in %s: %s", update.ServiceID, update.ManifestPath, change)
+			}
 
-			logStatus("Will update %s container %s: %s -> %s", update.ServiceID, container.Name, currentImageID, latestImage.ID.Tag)
+			logStatus("Will update %s container %s: %s -> %s", update.ServiceID, container.Name, currentImageID, targetImageID)
 			containerUpdates = append(containerUpdates, flux.ContainerUpdate{
 				Container: container.Name,
 				Current:   currentImageID,
-				Target:    latestImage.ID,
+				Target:    targetImageID,
 			})
 		}
 
@@ -439,5 +624,9 @@ func commitMessageFromReleaseSpec(spec *flux.ReleaseSpec) string {
 	for _, s := range spec.ServiceSpecs {
 		services = append(services, strings.Trim(s.String(), "<>"))
 	}
-	return fmt.Sprintf("Release %s to %s", image, strings.Join(services, ", "))
+	msg := fmt.Sprintf("Release %s to %s", image, strings.Join(services, ", "))
+	if len(spec.Namespaces) > 0 {
+		msg += " in " + strings.Join(spec.Namespaces, ", ")
+	}
+	return msg
 }
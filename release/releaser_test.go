@@ -1,13 +1,17 @@
 package release
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/history"
 	"github.com/weaveworks/flux/instance"
 	"github.com/weaveworks/flux/jobs"
@@ -392,7 +396,7 @@ func Test_ImageStatus(t *testing.T) {
 
 func testRelease(t *testing.T, releaser *Releaser, name string, spec flux.ReleaseSpec, expected flux.ReleaseResult) {
 	results := flux.ReleaseResult{}
-	moreJobs, err := releaser.release(flux.InstanceID("doesn't matter"),
+	moreJobs, err := releaser.release(context.Background(), flux.InstanceID("doesn't matter"),
 		&jobs.Job{
 			Params: jobs.ReleaseJobParams{
 				ReleaseSpec: spec,
@@ -418,3 +422,21 @@ func testRelease(t *testing.T, releaser *Releaser, name string, spec flux.Releas
 		t.Errorf("%s - expected:\n%#v, got:\n%#v", name, expected, results)
 	}
 }
+
+func TestReleaser_Retryable(t *testing.T) {
+	releaser := NewReleaser(nil)
+	for _, tst := range []struct {
+		err       error
+		retryable bool
+	}{
+		{errors.Wrap(git.ErrPushRejected, "pushing changes"), true},
+		{errors.Wrap(registry.StatusError{StatusCode: 503, Status: "503 Service Unavailable"}, "fetching image metadata"), true},
+		{registry.StatusError{StatusCode: 401, Status: "401 Unauthorized"}, false},
+		{git.PushError("git@example.com:repo", errors.New("permission denied")), false},
+		{fmt.Errorf("services %s: default/helloworld", NotReady), false},
+	} {
+		if got := releaser.Retryable(&jobs.Job{}, tst.err); got != tst.retryable {
+			t.Errorf("%v: expected retryable to be %v, got %v", tst.err, tst.retryable, got)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package release
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/notifications"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+const (
+	// How long to wait for released services to become ready, if
+	// the instance config doesn't say otherwise. Instances that
+	// don't want to wait can set the timeout to "0s".
+	DefaultVerifyTimeout = 5 * time.Minute
+
+	NotReady   = "did not become ready"
+	RolledBack = "rolled back"
+)
+
+// How often to ask the platform about the services being rolled out;
+// a variable so tests needn't wait.
+var verifyInterval = 5 * time.Second
+
+var ErrRollbackConflict = flux.UserConfigProblem{&flux.BaseError{
+	Help: `A release could not be rolled back, because the definitions of the
+services it changed were changed again upstream while it was being
+verified.
+
+Rolling back would have undone those changes too, so nothing has
+been put back, either in the repo or in the cluster. Check what is
+running, and release the images you want.
+`,
+	Err: errors.New("service definitions changed upstream while verifying release; not rolling back"),
+}}
+
+func verifyTimeout(conf flux.UnsafeInstanceConfig) (time.Duration, error) {
+	if conf.Release.VerifyTimeout == "" {
+		return DefaultVerifyTimeout, nil
+	}
+	timeout, err := time.ParseDuration(conf.Release.VerifyTimeout)
+	if err != nil {
+		return DefaultVerifyTimeout, errors.Wrapf(err, "parsing release verify timeout %q", conf.Release.VerifyTimeout)
+	}
+	return timeout, nil
+}
+
+// verifyRollout waits for each service that was applied successfully
+// to become ready, and marks those that don't become ready in the
+// time given as failed. It returns the updates for the failed
+// services.
+func verifyRollout(inst *instance.Instance, updates []*ServiceUpdate, results flux.ReleaseResult, timeout time.Duration, logStatus statusFn) []*ServiceUpdate {
+	pending := map[flux.ServiceID]*ServiceUpdate{}
+	for _, update := range updates {
+		// We won't necessarily be around to see ourselves updated
+		_, serviceName := update.ServiceID.Components()
+		if serviceName == FluxServiceName || serviceName == FluxDaemonName {
+			continue
+		}
+		if results[update.ServiceID].Status == flux.ReleaseStatusSuccess {
+			pending[update.ServiceID] = update
+		}
+	}
+
+	lastStatus := map[flux.ServiceID]string{}
+	deadline := time.Now().Add(timeout)
+	for len(pending) > 0 {
+		var ids []flux.ServiceID
+		for id := range pending {
+			ids = append(ids, id)
+		}
+		services, err := inst.GetServices(ids)
+		if err != nil {
+			// Possibly transient; keep trying until we run out of time
+			logStatus("Error checking rollout status: %s", err)
+		}
+		for _, service := range services {
+			switch service.Status {
+			case kubernetes.StatusReady:
+				logStatus("Service %s is ready.", service.ID)
+				delete(pending, service.ID)
+			case "":
+				// Older daemons don't report a status
+				logStatus("Cannot verify rollout of %s, as no status is reported.", service.ID)
+				delete(pending, service.ID)
+			default:
+				lastStatus[service.ID] = service.Status
+			}
+		}
+		if len(pending) == 0 || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(verifyInterval)
+	}
+
+	var failed []*ServiceUpdate
+	for id, update := range pending {
+		status, ok := lastStatus[id]
+		if !ok {
+			status = kubernetes.StatusUnknown
+		}
+		logStatus("Service %s %s within %s (%s).", id, NotReady, timeout, status)
+		results[id] = flux.ServiceResult{
+			Status:       flux.ReleaseStatusFailed,
+			Error:        fmt.Sprintf("%s within %s (%s)", NotReady, timeout, status),
+			PerContainer: results[id].PerContainer,
+		}
+		failed = append(failed, update)
+	}
+	return failed
+}
+
+// rollback puts back the previous definitions of the services given,
+// both in the repo and in the platform, and records that it has done
+// so in the history.
+func rollback(rc *ReleaseContext, failed []*ServiceUpdate, results flux.ReleaseResult, logStatus statusFn) error {
+	var (
+		reverts []*ServiceUpdate
+		defs    []platform.ServiceDefinition
+		ids     []flux.ServiceID
+		names   []string
+	)
+	for _, update := range failed {
+		reverts = append(reverts, &ServiceUpdate{
+			ServiceID:      update.ServiceID,
+			ManifestPath:   update.ManifestPath,
+			ManifestBytes:  update.PreviousManifestBytes,
+			ControllerKind: update.ControllerKind,
+			ControllerName: update.ControllerName,
+		})
+		defs = append(defs, platform.ServiceDefinition{
+			ServiceID:     update.ServiceID,
+			NewDefinition: update.PreviousManifestBytes,
+		})
+		ids = append(ids, update.ServiceID)
+		names = append(names, string(update.ServiceID))
+	}
+
+	logStatus("Rolling back %s.", strings.Join(names, ", "))
+	if err := writeUpdates(reverts); err != nil {
+		return errors.Wrap(err, "writing previous definitions")
+	}
+	err := rc.commitAndPushRebasing(fmt.Sprintf("Revert release of %s, which %s", strings.Join(names, ", "), NotReady), func(conflicted bool) error {
+		if conflicted {
+			// Putting back the whole of the previous definitions
+			// would undo whatever else has been changed.
+			return ErrRollbackConflict
+		}
+		return rc.rereadUpdates(reverts)
+	}, logStatus)
+	if err != nil && err != git.ErrNoChanges {
+		return errors.Wrap(err, "pushing previous definitions")
+	}
+	// Apply what's been pushed, which includes any changes made
+	// upstream in the meantime
+	for i, revert := range reverts {
+		defs[i].NewDefinition = revert.ManifestBytes
+	}
+
+	applyErr := rc.Instance.PlatformApply(defs)
+	for _, id := range ids {
+		if applyErr != nil {
+			if err, ok := applyErr.(platform.ApplyError); !ok || err[id] != nil {
+				continue
+			}
+		}
+		result := results[id]
+		result.Error += "; " + RolledBack
+		results[id] = result
+	}
+
+	now := time.Now().UTC()
+	logLevel := flux.LogLevelWarn
+	if applyErr != nil {
+		logLevel = flux.LogLevelError
+	}
+	event := flux.Event{
+		ServiceIDs: ids,
+		Type:       flux.EventRollback,
+		StartedAt:  now,
+		EndedAt:    now,
+		LogLevel:   logLevel,
+	}
+	if err := rc.Instance.LogEvent(event); err != nil {
+		return errors.Wrap(err, "logging rollback event")
+	}
+	cfg, err := rc.Instance.GetConfig()
+	if err == nil {
+		err = notifications.Event(cfg, event)
+	}
+	if err != nil {
+		logStatus("Error sending notifications: %s", err)
+	}
+	return applyErr
+}
@@ -0,0 +1,223 @@
+package release
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/platform/kubernetes"
+	"github.com/weaveworks/flux/platform/kubernetes/testdata"
+)
+
+func Test_VerifyRollout(t *testing.T) {
+	defer func(interval time.Duration) {
+		verifyInterval = interval
+	}(verifyInterval)
+	verifyInterval = 0
+	readyID := flux.ServiceID("default/ready")
+	stuckID := flux.ServiceID("default/stuck")
+	cronID := flux.ServiceID("default/backup")
+	inst := &instance.Instance{
+		Platform: &platform.MockPlatform{
+			SomeServicesAnswer: []platform.Service{
+				{ID: readyID, Status: kubernetes.StatusReady},
+				{ID: stuckID, Status: "0 out of 1 available"},
+				// A CronJob is ready as soon as it's applied, even if
+				// it has jobs running
+				{ID: cronID, Status: kubernetes.StatusReady},
+			},
+		},
+		Logger: log.NewNopLogger(),
+	}
+	updates := []*ServiceUpdate{
+		{ServiceID: readyID},
+		{ServiceID: stuckID},
+		{ServiceID: cronID, ControllerKind: "CronJob", ControllerName: "backup"},
+	}
+	results := flux.ReleaseResult{
+		readyID: flux.ServiceResult{Status: flux.ReleaseStatusSuccess},
+		stuckID: flux.ServiceResult{Status: flux.ReleaseStatusSuccess},
+		cronID:  flux.ServiceResult{Status: flux.ReleaseStatusSuccess},
+	}
+
+	failed := verifyRollout(inst, updates, results, 0, func(string, ...interface{}) {})
+	if len(failed) != 1 || failed[0].ServiceID != stuckID {
+		t.Fatalf("expected only %s to fail, got %#v", stuckID, failed)
+	}
+	for _, id := range []flux.ServiceID{readyID, cronID} {
+		if results[id].Status != flux.ReleaseStatusSuccess {
+			t.Errorf("expected %s to be successful, got %q", id, results[id].Status)
+		}
+	}
+	if results[stuckID].Status != flux.ReleaseStatusFailed {
+		t.Errorf("expected %s to have failed, got %q", stuckID, results[stuckID].Status)
+	}
+}
+
+type recordedEvents []flux.Event
+
+func (r *recordedEvents) LogEvent(e flux.Event) error {
+	*r = append(*r, e)
+	return nil
+}
+
+func Test_Rollback(t *testing.T) {
+	repo, cleanup := setupRepo(t)
+	defer cleanup()
+	var (
+		applied []platform.ServiceDefinition
+		events  recordedEvents
+	)
+	inst := &instance.Instance{
+		Platform: &platform.MockPlatform{
+			ApplyArgTest: func(defs []platform.ServiceDefinition) error {
+				applied = append(applied, defs...)
+				return nil
+			},
+		},
+		Config:      &instance.MockConfigurer{instance.Config{}, nil},
+		Repo:        repo,
+		Logger:      log.NewNopLogger(),
+		EventWriter: &events,
+	}
+	logStatus := func(string, ...interface{}) {}
+
+	var names []string
+	for name := range testdata.Files {
+		names = append(names, name)
+	}
+	serviceID := flux.ServiceID("default/helloworld")
+
+	// writeAndPush changes a file in a fresh clone, and pushes it, as
+	// though someone else did so while the release was verified.
+	writeAndPush := func(name, content string) {
+		other := NewReleaseContext(inst)
+		defer other.Clean()
+		if err := other.CloneRepo(); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(other.WorkingDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := other.CommitAndPush("Someone else's change"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// release pushes a change to the service's file, returning the
+	// update as the releaser would have it.
+	release := func(rc *ReleaseContext, content string) *ServiceUpdate {
+		if err := rc.CloneRepo(); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(rc.WorkingDir, names[0])
+		previous, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.CommitAndPush("Release"); err != nil {
+			t.Fatal(err)
+		}
+		return &ServiceUpdate{
+			ServiceID:             serviceID,
+			ManifestPath:          path,
+			ManifestBytes:         []byte(content),
+			PreviousManifestBytes: previous,
+		}
+	}
+
+	failedResults := func() flux.ReleaseResult {
+		return flux.ReleaseResult{
+			serviceID: flux.ServiceResult{Status: flux.ReleaseStatusFailed, Error: NotReady},
+		}
+	}
+
+	// A rollback that rebases cleanly onto other changes puts back,
+	// and applies, the previous definition
+	rc := NewReleaseContext(inst)
+	defer rc.Clean()
+	update := release(rc, "released")
+	writeAndPush(names[1], "someone else's")
+	results := failedResults()
+	if err := rollback(rc, []*ServiceUpdate{update}, results, logStatus); err != nil {
+		t.Fatal(err)
+	}
+
+	check := NewReleaseContext(inst)
+	defer check.Clean()
+	if err := check.CloneRepo(); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{
+		names[0]: testdata.Files[names[0]],
+		names[1]: "someone else's",
+	} {
+		content, err := ioutil.ReadFile(filepath.Join(check.WorkingDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("expected %s to be pushed as %q, got %q", name, expected, content)
+		}
+	}
+	subject, err := exec.Command("git", "-C", check.WorkingDir, "log", "-1", "--format=%s").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(subject), "Revert release of "+string(serviceID)) {
+		t.Errorf("expected a revert commit, got %q", subject)
+	}
+
+	if len(applied) != 1 || applied[0].ServiceID != serviceID || string(applied[0].NewDefinition) != testdata.Files[names[0]] {
+		t.Errorf("expected the previous definition of %s to be applied, got %#v", serviceID, applied)
+	}
+	if !strings.HasSuffix(results[serviceID].Error, RolledBack) {
+		t.Errorf("expected result to say the service was %s, got %q", RolledBack, results[serviceID].Error)
+	}
+	if len(events) != 1 || events[0].Type != flux.EventRollback || len(events[0].ServiceIDs) != 1 || events[0].ServiceIDs[0] != serviceID {
+		t.Errorf("expected a rollback event for %s, got %#v", serviceID, events)
+	}
+
+	// A rollback that conflicts with another change leaves that
+	// change, and the platform, alone
+	applied, events = nil, nil
+	rc = NewReleaseContext(inst)
+	defer rc.Clean()
+	update = release(rc, "released again")
+	writeAndPush(names[0], "someone else's fix")
+	err = rollback(rc, []*ServiceUpdate{update}, failedResults(), logStatus)
+	if errors.Cause(err) != ErrRollbackConflict {
+		t.Errorf("expected %v, got %v", ErrRollbackConflict, err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected nothing to be applied, got %#v", applied)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no rollback event, got %#v", events)
+	}
+
+	check = NewReleaseContext(inst)
+	defer check.Clean()
+	if err := check.CloneRepo(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(check.WorkingDir, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "someone else's fix" {
+		t.Errorf("expected the conflicting change to be kept, got %q", content)
+	}
+}
@@ -0,0 +1,27 @@
+package flux
+
+import (
+	"testing"
+)
+
+func TestReleaseApproval_State(t *testing.T) {
+	a := ReleaseApproval{Required: 2}
+	if a.State() != ApprovalPending {
+		t.Errorf("expected %q, got %q", ApprovalPending, a.State())
+	}
+	a.Approvals = append(a.Approvals, Approval{User: "alice"})
+	if !a.ApprovedBy("alice") || a.ApprovedBy("bob") {
+		t.Errorf("expected to be approved by alice only")
+	}
+	if a.State() != ApprovalPending {
+		t.Errorf("expected %q after one approval, got %q", ApprovalPending, a.State())
+	}
+	a.Approvals = append(a.Approvals, Approval{User: "bob"})
+	if a.State() != ApprovalApproved {
+		t.Errorf("expected %q after two approvals, got %q", ApprovalApproved, a.State())
+	}
+	a.Rejection = &Approval{User: "carol"}
+	if a.State() != ApprovalRejected {
+		t.Errorf("expected %q once rejected, got %q", ApprovalRejected, a.State())
+	}
+}
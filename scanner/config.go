@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/registry"
+)
+
+// Config collects the parameters to the scanner. All fields are
+// mandatory, except Interval, which defaults to DefaultInterval.
+type Config struct {
+	Jobs       jobs.JobReadPusher
+	InstanceDB instance.DB
+	Instancer  instance.Instancer
+	Index      registry.Index
+	Logger     log.Logger
+	// How often to scan each instance's repositories
+	Interval time.Duration
+}
+
+// Validate returns an error if the config is underspecified.
+func (cfg Config) Validate() error {
+	var errs []string
+	if cfg.Jobs == nil {
+		errs = append(errs, "job queue not supplied")
+	}
+	if cfg.InstanceDB == nil {
+		errs = append(errs, "instance configuration DB not supplied")
+	}
+	if cfg.Instancer == nil {
+		errs = append(errs, "instancer not supplied")
+	}
+	if cfg.Index == nil {
+		errs = append(errs, "image index not supplied")
+	}
+	if cfg.Logger == nil {
+		errs = append(errs, "logger not supplied")
+	}
+	if cfg.Interval < 0 {
+		errs = append(errs, "negative scan interval")
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
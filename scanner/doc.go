@@ -0,0 +1,9 @@
+// Package scanner keeps an index of the images in the repositories
+// each instance uses. It scans the registries in the background,
+// listing the tags in each repository and fetching the metadata for
+// new tags (and, a few at a time, for tags it hasn't looked at in a
+// while), so that listing images and checking automated services can
+// be served from the index rather than going to the registries each
+// time. When told of a push to a repository, it scans that repository
+// straight away.
+package scanner
@@ -0,0 +1,350 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/automator"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/registry"
+)
+
+const (
+	// DefaultInterval is how often each instance's repositories are
+	// scanned, if not configured.
+	DefaultInterval = 5 * time.Minute
+
+	// How often to check for instances that need scanning
+	scanCycle = 60 * time.Second
+
+	// Tags can be moved to another image, so the metadata for each
+	// is fetched again after a while; but only a few on each scan,
+	// so that scanning a big repository doesn't use up our share of
+	// requests to the registry.
+	imageRefreshAge     = 6 * time.Hour
+	maxRefreshesPerScan = 20
+)
+
+// Scanner keeps the image index up to date.
+type Scanner struct {
+	cfg Config
+}
+
+// New creates a new scanner.
+func New(cfg Config) (*Scanner, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Interval == 0 {
+		cfg.Interval = DefaultInterval
+	}
+	return &Scanner{
+		cfg: cfg,
+	}, nil
+}
+
+func (s *Scanner) Start(errorLogger log.Logger) {
+	s.scanAll(errorLogger)
+	tick := time.Tick(scanCycle)
+	for range tick {
+		s.scanAll(errorLogger)
+	}
+}
+
+func (s *Scanner) scanAll(errorLogger log.Logger) {
+	insts, err := s.cfg.InstanceDB.All()
+	if err != nil {
+		errorLogger.Log("err", err)
+		return
+	}
+	for _, inst := range insts {
+		_, err := s.cfg.Jobs.PutJob(inst.ID, scanJob(inst.ID, time.Now()))
+		if err != nil && err != jobs.ErrJobAlreadyQueued {
+			errorLogger.Log("err", errors.Wrapf(err, "queueing registry scan job"))
+		}
+	}
+}
+
+func (s *Scanner) Handle(_ context.Context, j *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
+	logger := log.NewContext(s.cfg.Logger).With("job", j.ID)
+	switch j.Method {
+	case jobs.RegistryScanJob:
+		params := j.Params.(jobs.RegistryScanJobParams)
+		if params.Repository != "" {
+			return s.handleRepositoryScanJob(logger, j, updater)
+		}
+		return s.handleScanJob(logger, j, updater)
+	default:
+		return nil, jobs.ErrUnknownJobMethod
+	}
+}
+
+// handleScanJob scans all the repositories used by the instance's
+// services, and forgets those no longer used.
+func (s *Scanner) handleScanJob(logger log.Logger, job *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
+	started := time.Now().UTC()
+	followUps := []jobs.Job{scanJob(job.Instance, started.Add(s.cfg.Interval))}
+	params := job.Params.(jobs.RegistryScanJobParams)
+
+	inst, err := s.cfg.Instancer.Get(params.InstanceID)
+	if err != nil {
+		return followUps, errors.Wrap(err, "getting job instance")
+	}
+
+	logInJob := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		job.Log = append(job.Log, msg)
+		updater.UpdateJob(*job)
+	}
+
+	services, err := inst.GetAllServices("")
+	if err != nil {
+		return followUps, errors.Wrap(err, "getting services")
+	}
+	inUse := repositoriesUsed(logInJob, services)
+
+	indexed, err := s.cfg.Index.Repositories(params.InstanceID)
+	if err != nil {
+		return followUps, errors.Wrap(err, "listing indexed repositories")
+	}
+	for _, name := range indexed {
+		if _, ok := inUse[name]; ok {
+			continue
+		}
+		if err := s.cfg.Index.DeleteRepository(params.InstanceID, name); err != nil {
+			return followUps, errors.Wrapf(err, "removing %s from index", name)
+		}
+		logInJob("%s is no longer used; removed from index", name)
+	}
+
+	names := make([]string, 0, len(inUse))
+	for name := range inUse {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var failed int
+	for _, name := range names {
+		if err := s.scanRepository(inst, params.InstanceID, inUse[name], nil); err != nil {
+			// One registry being unavailable is no reason not to
+			// scan the others.
+			logInJob("error scanning %s: %s", name, err)
+			failed++
+		}
+	}
+	logInJob("scanned %d repositories, %d with errors", len(names), failed)
+	return followUps, nil
+}
+
+// handleRepositoryScanJob scans a single repository, if it's one
+// that's indexed, then checks the automated services if asked to.
+func (s *Scanner) handleRepositoryScanJob(logger log.Logger, job *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
+	params := job.Params.(jobs.RegistryScanJobParams)
+	var followUps []jobs.Job
+	if params.Automate {
+		followUps = append(followUps, automator.RepositoryJob(params.InstanceID, params.Repository, time.Now()))
+	}
+
+	repo, err := registry.ParseRepository(params.Repository)
+	if err != nil {
+		return followUps, errors.Wrapf(err, "parsing repository %q", params.Repository)
+	}
+	existing, err := s.cfg.Index.GetRepository(params.InstanceID, repo.String())
+	if err != nil {
+		return followUps, errors.Wrap(err, "reading index")
+	}
+	// If it's not indexed, it's not used (or won't be until the
+	// next full scan), so there's nothing to update.
+	if existing.ScannedAt.IsZero() {
+		return followUps, nil
+	}
+
+	inst, err := s.cfg.Instancer.Get(params.InstanceID)
+	if err != nil {
+		return followUps, errors.Wrap(err, "getting job instance")
+	}
+	return followUps, s.scanRepository(inst, params.InstanceID, repo, params.Tags)
+}
+
+// scanRepository lists the tags in the repository, and fetches the
+// metadata for any new tags, those given in refetch, and a few of
+// those that haven't been fetched in a while; then records the
+// result in the index. What we knew about the tags not fetched is
+// kept.
+func (s *Scanner) scanRepository(inst *instance.Instance, instID flux.InstanceID, repo registry.Repository, refetch []string) error {
+	now := time.Now().UTC()
+	existing, err := s.cfg.Index.GetRepository(instID, repo.String())
+	if err != nil {
+		return errors.Wrap(err, "reading index")
+	}
+
+	tags, err := inst.Registry.GetTags(repo)
+	if err != nil {
+		// Keep what we had, but mark it as failed, so it's not
+		// used in place of asking the registry.
+		existing.Repository = repo.String()
+		existing.ScannedAt = now
+		existing.Error = err.Error()
+		if err := s.cfg.Index.PutRepository(instID, existing); err != nil {
+			return errors.Wrap(err, "updating index")
+		}
+		return errors.Wrap(err, "listing tags")
+	}
+
+	fetched, fetchErr := inst.Registry.GetImages(repo, tagsToFetch(existing.Images, tags, refetch, now))
+	scanned := registry.IndexedRepository{
+		Repository: repo.String(),
+		ScannedAt:  now,
+		Images:     mergeImages(existing.Images, tags, fetched, now),
+	}
+	if fetchErr != nil {
+		scanned.Error = fetchErr.Error()
+	}
+	if err := s.cfg.Index.PutRepository(instID, scanned); err != nil {
+		return errors.Wrap(err, "updating index")
+	}
+	return errors.Wrap(fetchErr, "fetching image metadata")
+}
+
+// tagsToFetch decides which of the tags to fetch the metadata for:
+// all those we don't know about, all those in refetch, and the few
+// we fetched longest ago, if that's longer than imageRefreshAge.
+func tagsToFetch(known []registry.IndexedImage, tags, refetch []string, now time.Time) []string {
+	present := map[string]bool{}
+	for _, tag := range tags {
+		present[tag] = true
+	}
+	wanted := map[string]bool{}
+	for _, tag := range refetch {
+		if present[tag] {
+			wanted[tag] = true
+		}
+	}
+
+	knownTags := map[string]bool{}
+	var stale []registry.IndexedImage
+	for _, image := range known {
+		knownTags[image.Tag] = true
+		if present[image.Tag] && !wanted[image.Tag] && now.Sub(image.FetchedAt) > imageRefreshAge {
+			stale = append(stale, image)
+		}
+	}
+	for _, tag := range tags {
+		if !knownTags[tag] {
+			wanted[tag] = true
+		}
+	}
+	sort.Sort(byFetchedAt(stale))
+	for i := 0; i < len(stale) && i < maxRefreshesPerScan; i++ {
+		wanted[stale[i].Tag] = true
+	}
+
+	toFetch := make([]string, 0, len(wanted))
+	for _, tag := range tags {
+		if wanted[tag] {
+			toFetch = append(toFetch, tag)
+		}
+	}
+	return toFetch
+}
+
+// mergeImages gives the index entries for the tags listed, using the
+// images just fetched where there are any, and what was known
+// otherwise. Tags that have gone are dropped, as are new tags we
+// failed to fetch.
+func mergeImages(known []registry.IndexedImage, tags []string, fetched []flux.Image, now time.Time) []registry.IndexedImage {
+	byTag := map[string]registry.IndexedImage{}
+	for _, image := range known {
+		byTag[image.Tag] = image
+	}
+	for _, image := range fetched {
+		byTag[image.Tag] = registry.IndexImage(image, now)
+	}
+	var merged []registry.IndexedImage
+	for _, tag := range tags {
+		if image, ok := byTag[tag]; ok {
+			merged = append(merged, image)
+		}
+	}
+	return merged
+}
+
+// repositoriesUsed gives the repositories of the images used by the
+// services, indexed by their canonical name.
+func repositoriesUsed(logInJob func(string, ...interface{}), services []platform.Service) map[string]registry.Repository {
+	repos := map[string]registry.Repository{}
+	for _, service := range services {
+		for _, container := range service.ContainersOrNil() {
+			id, err := flux.ParseImageID(container.Image)
+			if err != nil {
+				logInJob("error parsing image in service %s container %s (%q): %s", service.ID, container.Name, container.Image, err)
+				continue
+			}
+			repo, err := registry.ParseRepository(id.Repository())
+			if err != nil {
+				logInJob("error parsing repository %s: %s", id.Repository(), err)
+				continue
+			}
+			repos[repo.String()] = repo
+		}
+	}
+	return repos
+}
+
+type byFetchedAt []registry.IndexedImage
+
+func (is byFetchedAt) Len() int           { return len(is) }
+func (is byFetchedAt) Swap(i, j int)      { is[i], is[j] = is[j], is[i] }
+func (is byFetchedAt) Less(i, j int) bool { return is[i].FetchedAt.Before(is[j].FetchedAt) }
+
+func scanJob(instanceID flux.InstanceID, at time.Time) jobs.Job {
+	return jobs.Job{
+		Queue: jobs.RegistryScanJob,
+		// Key stops us getting two jobs for the same instance
+		Key: strings.Join([]string{
+			jobs.RegistryScanJob,
+			string(instanceID),
+		}, "|"),
+		Method:   jobs.RegistryScanJob,
+		Priority: jobs.PriorityBackground,
+		Params: jobs.RegistryScanJobParams{
+			InstanceID: instanceID,
+		},
+		ScheduledAt: at.UTC(),
+	}
+}
+
+// RepositoryJob gives a job that scans, straight away, just the
+// repository given, fetching the tags given again, and then (if
+// automate is true) checks the automated services using it.
+func RepositoryJob(instanceID flux.InstanceID, repository string, tags []string, automate bool, now time.Time) jobs.Job {
+	sortedTags := append([]string(nil), tags...)
+	sort.Strings(sortedTags)
+	return jobs.Job{
+		Queue: jobs.RegistryScanJob,
+		// Key stops us getting two jobs for the same push, if
+		// there's a flurry of notifications
+		Key: strings.Join(append([]string{
+			jobs.RegistryScanJob,
+			string(instanceID),
+			repository,
+		}, sortedTags...), "|"),
+		Method:   jobs.RegistryScanJob,
+		Priority: jobs.PriorityInteractive,
+		Params: jobs.RegistryScanJobParams{
+			InstanceID: instanceID,
+			Repository: repository,
+			Tags:       tags,
+			Automate:   automate,
+		},
+		ScheduledAt: now.UTC(),
+	}
+}
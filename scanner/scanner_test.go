@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/registry"
+)
+
+func TestTagsToFetch(t *testing.T) {
+	now := time.Now()
+	known := []registry.IndexedImage{
+		{Tag: "fresh", FetchedAt: now.Add(-time.Minute)},
+		{Tag: "stale", FetchedAt: now.Add(-2 * imageRefreshAge)},
+		{Tag: "pushed", FetchedAt: now.Add(-time.Minute)},
+		{Tag: "gone", FetchedAt: now.Add(-2 * imageRefreshAge)},
+	}
+	tags := []string{"fresh", "new", "stale", "pushed"}
+	toFetch := tagsToFetch(known, tags, []string{"pushed", "notthere"}, now)
+	if expected := []string{"new", "stale", "pushed"}; !reflect.DeepEqual(expected, toFetch) {
+		t.Errorf("expected %v, got %v", expected, toFetch)
+	}
+}
+
+func TestTagsToFetch_LimitsRefreshes(t *testing.T) {
+	now := time.Now()
+	var (
+		known []registry.IndexedImage
+		tags  []string
+	)
+	for i := 0; i < maxRefreshesPerScan*2; i++ {
+		tag := string('a' + rune(i))
+		tags = append(tags, tag)
+		// Later tags were fetched longer ago
+		known = append(known, registry.IndexedImage{
+			Tag:       tag,
+			FetchedAt: now.Add(-imageRefreshAge - time.Duration(i)*time.Minute),
+		})
+	}
+	toFetch := tagsToFetch(known, tags, nil, now)
+	if expected := tags[maxRefreshesPerScan:]; !reflect.DeepEqual(expected, toFetch) {
+		t.Errorf("expected the %d fetched longest ago %v, got %v", maxRefreshesPerScan, expected, toFetch)
+	}
+}
+
+func TestScanRepository(t *testing.T) {
+	instID := flux.InstanceID("instance")
+	repo, err := registry.ParseRepository("quay.io/weaveworks/helloworld")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now().Add(-time.Hour).UTC()
+	image := func(tag, digest string) flux.Image {
+		img, err := flux.ParseImage("quay.io/weaveworks/helloworld:"+tag, &created)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img.Digest = digest
+		return img
+	}
+
+	index := registry.NewMemIndex()
+	scan := func(images []flux.Image, refetch []string) error {
+		s := &Scanner{cfg: Config{Index: index}}
+		inst := instance.New(nil, registry.NewMockRegistry(images, nil), nil, git.Repo{}, log.NewNopLogger(), nil, nil)
+		return s.scanRepository(inst, instID, repo, refetch)
+	}
+	digests := func() map[string]string {
+		indexed, err := index.GetRepository(instID, repo.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indexed.Error != "" {
+			t.Fatalf("unexpected error in index: %s", indexed.Error)
+		}
+		ds := map[string]string{}
+		for _, img := range indexed.Images {
+			ds[img.Tag] = img.Info.Digest
+		}
+		return ds
+	}
+
+	if err := scan([]flux.Image{image("v1", "sha256:1"), image("v2", "sha256:2")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"v1": "sha256:1", "v2": "sha256:2"}; !reflect.DeepEqual(expected, digests()) {
+		t.Errorf("expected %v, got %v", expected, digests())
+	}
+
+	// v1 has moved, v2 has gone, and v3 has appeared; we'll only
+	// notice v1 moving if we're told to fetch it again.
+	moved := []flux.Image{image("v1", "sha256:1a"), image("v3", "sha256:3")}
+	if err := scan(moved, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"v1": "sha256:1", "v3": "sha256:3"}; !reflect.DeepEqual(expected, digests()) {
+		t.Errorf("expected %v, got %v", expected, digests())
+	}
+	if err := scan(moved, []string{"v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"v1": "sha256:1a", "v3": "sha256:3"}; !reflect.DeepEqual(expected, digests()) {
+		t.Errorf("expected %v, got %v", expected, digests())
+	}
+
+	// What's indexed is served as if from the registry
+	reg := registry.NewIndexedRegistry(instID, index, time.Minute, registry.NewMockRegistry(nil, nil))
+	images, err := reg.GetRepository(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 {
+		t.Fatalf("expected two images from the index, got %#v", images)
+	}
+	for _, img := range images {
+		if img.CreatedAt == nil || !img.CreatedAt.Equal(created) {
+			t.Errorf("expected %s to have been created at %s, got %v", img.ImageID, created, img.CreatedAt)
+		}
+	}
+}
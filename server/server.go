@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"strings"
 	"sync/atomic"
@@ -10,11 +11,16 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/automator"
 	"github.com/weaveworks/flux/git"
 	"github.com/weaveworks/flux/instance"
 	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/notifications"
 	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/promote"
 	"github.com/weaveworks/flux/registry"
+	"github.com/weaveworks/flux/release"
+	"github.com/weaveworks/flux/scanner"
 )
 
 const (
@@ -23,14 +29,69 @@ const (
 
 	serviceLocked   = "Service locked."
 	serviceUnlocked = "Service unlocked."
+
+	// How often to look at the job store for updates to a job being
+	// followed, in case it's being worked on by another process.
+	// This is also what keeps the heartbeat fresh, so it should be
+	// well under the five seconds fluxctl allows.
+	followRecheckPeriod = 2 * time.Second
 )
 
+var ErrWebhookSecret = flux.UserConfigProblem{&flux.BaseError{
+	Help: `The registry webhook was refused.
+
+Webhooks must supply the secret given as "webhookSecret" in the
+registry section of the instance config, as the "secret" query
+parameter of the webhook URL. If there is no secret in the config,
+webhooks are turned off; set one with
+
+    fluxctl set-config --file=flux.conf
+`,
+	Err: errors.New("webhook secret is missing or incorrect"),
+}}
+
+var ErrNotPendingApproval = flux.UserConfigProblem{&flux.BaseError{
+	Help: `The release is not waiting for approval.
+
+Only releases that need approval, according to the "approvals" and
+"approvalNamespaces" settings in the release section of the instance
+config, can be approved or rejected; and only until they have been
+approved or rejected. You can see the state of a release with
+
+    fluxctl check-release --release-id=<id>
+`,
+	Err: errors.New("release is not pending approval"),
+}}
+
+var ErrApprovalUser = flux.UserConfigProblem{&flux.BaseError{
+	Help: `Approvals must each come from a different, named user.
+
+If you are logged in, the user you are logged in as is used.
+Otherwise, give the user approving the release with --user (the
+default is your username). Make sure that user has not already
+approved it.
+`,
+	Err: errors.New("approval has no user, or the user has already approved"),
+}}
+
+var ErrSelfApproval = flux.UserConfigProblem{&flux.BaseError{
+	Help: `A release cannot be approved by the user who asked for it.
+
+Approvals are there so that someone else checks a release before it is
+carried out. Ask another user to approve it.
+`,
+	Err: errors.New("release cannot be approved by the user who requested it"),
+}}
+
 type Server struct {
 	version     string
 	instancer   instance.Instancer
 	config      instance.DB
 	messageBus  platform.MessageBus
 	jobs        jobs.JobStore
+	hub         *jobs.Hub
+	cache       registry.CacheBackend // may be nil, if registry caching is off
+	promoter    *promote.Promoter
 	logger      log.Logger
 	maxPlatform chan struct{} // semaphore for concurrent calls to the platform
 	connected   int32
@@ -42,6 +103,9 @@ func New(
 	config instance.DB,
 	messageBus platform.MessageBus,
 	jobs jobs.JobStore,
+	hub *jobs.Hub,
+	cache registry.CacheBackend,
+	promoter *promote.Promoter,
 	logger log.Logger,
 ) *Server {
 	connectedDaemons.Set(0)
@@ -51,6 +115,9 @@ func New(
 		config:      config,
 		messageBus:  messageBus,
 		jobs:        jobs,
+		hub:         hub,
+		cache:       cache,
+		promoter:    promoter,
 		logger:      logger,
 		maxPlatform: make(chan struct{}, 8),
 	}
@@ -72,11 +139,16 @@ func (s *Server) Status(inst flux.InstanceID) (res flux.Status, err error) {
 	if err != nil {
 		return res, errors.Wrapf(err, "getting config for %s", inst)
 	}
-	res.Git.Configured = config.Settings.Git.URL != "" && config.Settings.Git.Key != ""
+	gitConf := config.Settings.Git
+	res.Git.Configured = gitConf.URL != "" && (gitConf.Key != "" || gitConf.Username != "")
+	res.Git.SyncedRevision = config.SyncedRevision
 
-	if _, err := helper.ConfigRepo().Clone(); err != nil {
+	repo := helper.ConfigRepo()
+	if path, err := repo.Clone(); err != nil {
 		// Remove \r, so it prints as a yaml block
 		res.Git.Error = strings.Replace(err.Error(), "\r", "", -1)
+	} else {
+		repo.Clean(path)
 	}
 
 	res.Fluxsvc = flux.FluxsvcStatus{Version: s.version}
@@ -153,11 +225,17 @@ func (s *Server) ListImages(inst flux.InstanceID, spec flux.ServiceSpec) (res []
 		return nil, errors.Wrap(err, "getting images for services")
 	}
 
+	config, err := helper.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+
 	for _, service := range services {
 		containers := containersWithAvailable(service, images)
 		res = append(res, flux.ImageStatus{
 			ID:         service.ID,
 			Containers: containers,
+			TagFilter:  config.Services[service.ID].TagFilter,
 		})
 	}
 
@@ -217,22 +295,30 @@ func (s *Server) History(inst flux.InstanceID, spec flux.ServiceSpec, before tim
 	return res, nil
 }
 
-func (s *Server) Automate(instID flux.InstanceID, service flux.ServiceID) error {
+func (s *Server) Automate(instID flux.InstanceID, service flux.ServiceID, filter flux.TagFilter) error {
 	inst, err := s.instancer.Get(instID)
 	if err != nil {
 		return err
 	}
 	now := time.Now().UTC()
-	if err := inst.LogEvent(flux.Event{
+	event := flux.Event{
 		ServiceIDs: []flux.ServiceID{service},
 		Type:       flux.EventAutomate,
 		StartedAt:  now,
 		EndedAt:    now,
 		LogLevel:   flux.LogLevelInfo,
-	}); err != nil {
+	}
+	if filter != flux.TagFilterNone {
+		event.Message = fmt.Sprintf("Automated: %s (tags matching %s)", service, filter)
+	}
+	if err := inst.LogEvent(event); err != nil {
+		return err
+	}
+	if err := recordAutomated(inst, service, true, filter); err != nil {
 		return err
 	}
-	return recordAutomated(inst, service, true)
+	notify(inst, event)
+	return nil
 }
 
 func (s *Server) Deautomate(instID flux.InstanceID, service flux.ServiceID) error {
@@ -241,26 +327,50 @@ func (s *Server) Deautomate(instID flux.InstanceID, service flux.ServiceID) erro
 		return err
 	}
 	now := time.Now().UTC()
-	if err := inst.LogEvent(flux.Event{
+	event := flux.Event{
 		ServiceIDs: []flux.ServiceID{service},
 		Type:       flux.EventDeautomate,
 		StartedAt:  now,
 		EndedAt:    now,
 		LogLevel:   flux.LogLevelInfo,
-	}); err != nil {
+	}
+	if err := inst.LogEvent(event); err != nil {
 		return err
 	}
-	return recordAutomated(inst, service, false)
+	if err := recordAutomated(inst, service, false, flux.TagFilterNone); err != nil {
+		return err
+	}
+	notify(inst, event)
+	return nil
+}
+
+// notify announces an event to the instance's notifiers. Notifiers
+// can be slow to answer, so this is done in the background rather
+// than holding up the API call; and failing to announce something
+// shouldn't make it fail, so errors are just logged.
+func notify(inst *instance.Instance, event flux.Event) {
+	cfg, err := inst.GetConfig()
+	if err != nil {
+		inst.Log("event", event.Type, "err", errors.Wrap(err, "getting config to send notifications"))
+		return
+	}
+	go func() {
+		if err := notifications.Event(cfg, event); err != nil {
+			inst.Log("event", event.Type, "err", errors.Wrap(err, "sending notifications"))
+		}
+	}()
 }
 
-func recordAutomated(inst *instance.Instance, service flux.ServiceID, automated bool) error {
+func recordAutomated(inst *instance.Instance, service flux.ServiceID, automated bool, filter flux.TagFilter) error {
 	return inst.UpdateConfig(func(conf instance.Config) (instance.Config, error) {
 		if serviceConf, found := conf.Services[service]; found {
 			serviceConf.Automated = automated
+			serviceConf.TagFilter = filter
 			conf.Services[service] = serviceConf
 		} else if automated {
 			conf.Services[service] = instance.ServiceConfig{
 				Automated: true,
+				TagFilter: filter,
 			}
 		}
 		return conf, nil
@@ -273,16 +383,21 @@ func (s *Server) Lock(instID flux.InstanceID, service flux.ServiceID) error {
 		return err
 	}
 	now := time.Now().UTC()
-	if err := inst.LogEvent(flux.Event{
+	event := flux.Event{
 		ServiceIDs: []flux.ServiceID{service},
 		Type:       flux.EventLock,
 		StartedAt:  now,
 		EndedAt:    now,
 		LogLevel:   flux.LogLevelInfo,
-	}); err != nil {
+	}
+	if err := inst.LogEvent(event); err != nil {
 		return err
 	}
-	return recordLock(inst, service, true)
+	if err := recordLock(inst, service, true); err != nil {
+		return err
+	}
+	notify(inst, event)
+	return nil
 }
 
 func (s *Server) Unlock(instID flux.InstanceID, service flux.ServiceID) error {
@@ -291,16 +406,21 @@ func (s *Server) Unlock(instID flux.InstanceID, service flux.ServiceID) error {
 		return err
 	}
 	now := time.Now().UTC()
-	if err := inst.LogEvent(flux.Event{
+	event := flux.Event{
 		ServiceIDs: []flux.ServiceID{service},
 		Type:       flux.EventUnlock,
 		StartedAt:  now,
 		EndedAt:    now,
 		LogLevel:   flux.LogLevelInfo,
-	}); err != nil {
+	}
+	if err := inst.LogEvent(event); err != nil {
+		return err
+	}
+	if err := recordLock(inst, service, false); err != nil {
 		return err
 	}
-	return recordLock(inst, service, false)
+	notify(inst, event)
+	return nil
 }
 
 func recordLock(inst *instance.Instance, service flux.ServiceID, locked bool) error {
@@ -320,12 +440,22 @@ func recordLock(inst *instance.Instance, service flux.ServiceID, locked bool) er
 	return nil
 }
 
+// PostRelease queues a release, to be carried out straight away or,
+// if it's given a time, then.
 func (s *Server) PostRelease(inst flux.InstanceID, params jobs.ReleaseJobParams) (jobs.JobID, error) {
+	// Only promotions can say they are promotions, and only the
+	// automator makes recurring releases
+	params.Cause.PromotedFrom = nil
+	params.Schedule = ""
+	if !params.At.IsZero() {
+		params.At = params.At.UTC()
+	}
 	return s.jobs.PutJob(inst, jobs.Job{
-		Queue:    jobs.ReleaseJob,
-		Method:   jobs.ReleaseJob,
-		Priority: jobs.PriorityInteractive,
-		Params:   params,
+		Queue:       jobs.ReleaseJob,
+		Method:      jobs.ReleaseJob,
+		Priority:    jobs.PriorityInteractive,
+		Params:      params,
+		ScheduledAt: params.At,
 	})
 }
 
@@ -340,6 +470,298 @@ func (s *Server) GetRelease(inst flux.InstanceID, id jobs.JobID) (jobs.Job, erro
 	return j, err
 }
 
+// ApproveRelease records an approval of a release that's waiting for
+// approval. Once it has enough approvals, another release is posted
+// to carry out the changes, and its ID returned.
+func (s *Server) ApproveRelease(inst flux.InstanceID, id jobs.JobID, approval flux.Approval) (jobs.JobID, error) {
+	var releaseID jobs.JobID
+	err := s.changePendingRelease(inst, id, func(job *jobs.Job, params *jobs.ReleaseJobParams, store jobs.JobReadPusher) error {
+		releaseID = "" // in case this is another go
+		if approval.User == "" || params.Approval.ApprovedBy(approval.User) {
+			return ErrApprovalUser
+		}
+		if approval.User == params.Cause.User {
+			return ErrSelfApproval
+		}
+
+		approval.At = time.Now().UTC()
+		params.Approval.Approvals = append(params.Approval.Approvals, approval)
+		status := fmt.Sprintf("Approved by %s (%d of %d).", approval.User, len(params.Approval.Approvals), params.Approval.Required)
+		job.Log = append(job.Log, status)
+
+		if params.Approval.State() == flux.ApprovalApproved {
+			plan, _ := job.Result.(flux.ReleaseResult)
+			var err error
+			releaseID, err = store.PutJob(inst, jobs.Job{
+				Queue:    jobs.ReleaseJob,
+				Method:   jobs.ReleaseJob,
+				Priority: jobs.PriorityInteractive,
+				Params: jobs.ReleaseJobParams{
+					ReleaseSpec:  params.ReleaseSpec,
+					Cause:        params.Cause,
+					Approved:     id,
+					ApprovedPlan: plan,
+				},
+			})
+			if err != nil {
+				return errors.Wrap(err, "posting approved release")
+			}
+			params.Approval.ReleaseID = flux.ReleaseID(releaseID)
+			status = fmt.Sprintf("Approved; carrying out the release as %s.", releaseID)
+			job.Log = append(job.Log, status)
+		}
+		job.Status = status
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return releaseID, nil
+}
+
+// RejectRelease stops a release that's waiting for approval from
+// going any further.
+func (s *Server) RejectRelease(inst flux.InstanceID, id jobs.JobID, rejection flux.Approval) error {
+	return s.changePendingRelease(inst, id, func(job *jobs.Job, params *jobs.ReleaseJobParams, _ jobs.JobReadPusher) error {
+		if rejection.User == "" {
+			return ErrApprovalUser
+		}
+		rejection.At = time.Now().UTC()
+		params.Approval.Rejection = &rejection
+		job.Status = fmt.Sprintf("Rejected by %s.", rejection.User)
+		job.Log = append(job.Log, job.Status)
+		return nil
+	})
+}
+
+// CancelRelease stops a release from going any further. If it's
+// already running, it stops at the next point it safely can. If it's
+// waiting for its pull request to be merged, the pull request is
+// closed.
+func (s *Server) CancelRelease(inst flux.InstanceID, id jobs.JobID) error {
+	if _, err := s.GetRelease(inst, id); err != nil {
+		return err
+	}
+	if err := s.jobs.CancelJob(inst, id); err != nil {
+		return err
+	}
+
+	// If the release was being worked on, it'll tidy up after
+	// itself; otherwise, it's been cancelled outright, and it's up to
+	// us.
+	job, err := s.GetRelease(inst, id)
+	if err != nil {
+		return errors.Wrap(err, "getting cancelled release")
+	}
+	pr := job.Params.(jobs.ReleaseJobParams).PullRequest
+	if !job.Done || pr == nil {
+		return nil
+	}
+	helper, err := s.instancer.Get(inst)
+	if err != nil {
+		return errors.Wrapf(err, "getting instance")
+	}
+	if err := release.CancelPullRequest(helper, pr); err != nil {
+		helper.Log("err", errors.Wrapf(err, "closing pull request %s for cancelled release", pr.URL))
+	}
+	return nil
+}
+
+// ListJobs gives the instance's jobs matching the filter, most
+// recent first.
+func (s *Server) ListJobs(inst flux.InstanceID, filter jobs.JobFilter) ([]jobs.Job, error) {
+	return s.jobs.ListJobs(inst, filter)
+}
+
+// FollowJob sends the job as it is now, then again each time it
+// changes, until it's done. Updates made by workers in this process
+// come straight from the hub; the job store is looked at regularly
+// for the rest.
+func (s *Server) FollowJob(inst flux.InstanceID, id jobs.JobID, updates chan<- jobs.Job, stop <-chan struct{}) error {
+	published, unsubscribe := s.hub.Subscribe(id)
+	defer unsubscribe()
+
+	getJob := func() (jobs.Job, error) {
+		job, err := s.jobs.GetJob(inst, id)
+		// These aren't filled in when fetching a job
+		job.Instance, job.ID = inst, id
+		return job, err
+	}
+	job, err := getJob()
+	if err != nil {
+		return err
+	}
+
+	recheck := time.NewTicker(followRecheckPeriod)
+	defer recheck.Stop()
+	for {
+		select {
+		case updates <- job:
+		case <-stop:
+			return nil
+		}
+		if job.Done {
+			return nil
+		}
+
+		select {
+		case update := <-published:
+			if update.Instance != inst {
+				continue
+			}
+			// The times are kept by the job store, and a finished
+			// job's are only known once it's been stored; so for
+			// those, and for anything else, go by the job store.
+			if update.Done {
+				if job, err = getJob(); err != nil {
+					return err
+				}
+				continue
+			}
+			update.ScheduledAt, update.Submitted, update.Claimed, update.Heartbeat, update.Finished =
+				job.ScheduledAt, job.Submitted, job.Claimed, job.Heartbeat, job.Finished
+			job = update
+		case <-recheck.C:
+			if job, err = getJob(); err != nil {
+				return err
+			}
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// How many times to try changing a release that's pending approval,
+// if others are approving or rejecting it at the same time.
+const changeReleaseAttempts = 3
+
+// changePendingRelease makes a change to a release that's waiting for
+// approval, e.g., approving it. The release is fetched and changed
+// in one go, and if someone else changes it at the same time, it's
+// fetched and changed again; so each change sees those made before
+// it, and none are lost.
+func (s *Server) changePendingRelease(inst flux.InstanceID, id jobs.JobID, change func(*jobs.Job, *jobs.ReleaseJobParams, jobs.JobReadPusher) error) error {
+	var err error
+	for i := 0; i < changeReleaseAttempts; i++ {
+		err = s.jobs.ChangeJob(inst, id, func(job *jobs.Job, store jobs.JobReadPusher) error {
+			if job.Method != jobs.ReleaseJob {
+				return fmt.Errorf("job is not a release")
+			}
+			params := job.Params.(jobs.ReleaseJobParams)
+			if !job.Done || !params.PendingApproval() {
+				return ErrNotPendingApproval
+			}
+			if err := change(job, &params, store); err != nil {
+				return err
+			}
+			job.Params = params
+			return nil
+		})
+		if err != jobs.ErrJobChanged {
+			break
+		}
+	}
+	if err == jobs.ErrJobChanged {
+		return errors.Wrap(err, "release changed while being approved or rejected; try again")
+	}
+	return err
+}
+
+// Promote promotes the most recent successful release in the instance
+// promoted from to the instance promoted to, following the promotion
+// edge between them. The instance asking must be one or the other;
+// if `from` is empty, it's taken to be the instance asking. It
+// returns the IDs of the releases queued in the instance promoted to.
+func (s *Server) Promote(instID flux.InstanceID, from, to string, cause flux.ReleaseCause) ([]jobs.JobID, error) {
+	conf, err := s.config.GetConfig(instID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting instance config")
+	}
+
+	source, edge := instID, to
+	if from != "" && !promotionName(instID, conf.Settings.Promotion, from) {
+		// Then this must be the instance promoted to, asking for a
+		// promotion from one of those it accepts promotions from.
+		if !promotionName(instID, conf.Settings.Promotion, to) {
+			return nil, errors.Wrapf(promote.ErrNoPromotionEdge, "neither %s nor %s is this instance", from, to)
+		}
+		source, edge = "", string(instID)
+		for _, id := range conf.Settings.Promotion.AcceptFrom {
+			sourceConf, err := s.config.GetConfig(id)
+			if err != nil {
+				return nil, errors.Wrapf(err, "getting config for instance %s", id)
+			}
+			if promotionName(id, sourceConf.Settings.Promotion, from) {
+				source = id
+				break
+			}
+		}
+		if source == "" {
+			return nil, errors.Wrapf(promote.ErrPromotionNotAccepted, "promoting from %s", from)
+		}
+	}
+
+	helper, err := s.instancer.Get(source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting instance")
+	}
+	release, err := promote.LatestRelease(helper)
+	if err != nil {
+		return nil, err
+	}
+	cause.PromotedFrom = nil
+	params := promote.Params(source, edge, release, cause)
+	return s.promoter.Promote(params, jobs.PriorityInteractive, func(string, ...interface{}) {})
+}
+
+// promotionName says whether the name given refers to the instance
+// with the ID and promotion config given.
+func promotionName(id flux.InstanceID, conf flux.PromotionConfig, name string) bool {
+	return name == string(id) || (conf.Name != "" && name == conf.Name)
+}
+
+// ImagePushed is called when a registry tells us, via a webhook, that
+// images have been pushed to a repository. It forgets what we know
+// about the repository, and checks the automated services that use it
+// straight away, rather than waiting for the next regular check.
+func (s *Server) ImagePushed(instID flux.InstanceID, secret string, push registry.Push) error {
+	config, err := s.config.GetConfig(instID)
+	if err != nil {
+		return errors.Wrapf(err, "getting config for %s", instID)
+	}
+	expected := config.Settings.Registry.WebhookSecret
+	if expected == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) != 1 {
+		return ErrWebhookSecret
+	}
+
+	if s.cache != nil {
+		repo, err := registry.ParseRepository(push.Repository)
+		if err != nil {
+			return errors.Wrapf(err, "parsing repository %q", push.Repository)
+		}
+		if err := registry.InvalidateRepository(s.cache, repo); err != nil {
+			// Not fatal; we'll see new tags within a minute
+			// regardless, since tags aren't cached for long
+			s.logger.Log("method", "ImagePushed", "err", errors.Wrapf(err, "invalidating cache for %s", push.Repository))
+		}
+	}
+
+	var automated bool
+	for _, service := range config.Services {
+		if service.Policy() == flux.PolicyAutomated {
+			automated = true
+			break
+		}
+	}
+	// Bring the image index up to date first, so that the automated
+	// services are checked against the image just pushed.
+	_, err = s.jobs.PutJob(instID, scanner.RepositoryJob(instID, push.Repository, push.Tags, automated, time.Now()))
+	if err != nil && err != jobs.ErrJobAlreadyQueued {
+		return errors.Wrap(err, "queueing registry scan job")
+	}
+	return nil
+}
+
 func (s *Server) GetConfig(instID flux.InstanceID) (flux.InstanceConfig, error) {
 	fullConfig, err := s.config.GetConfig(instID)
 	if err != nil {
@@ -354,7 +776,22 @@ func (s *Server) SetConfig(instID flux.InstanceID, updates flux.UnsafeInstanceCo
 	if _, err := registry.CredentialsFromConfig(updates); err != nil {
 		return errors.Wrap(err, "invalid registry credentials")
 	}
-	return s.config.UpdateConfig(instID, applyConfigUpdates(updates))
+	if _, err := updates.Git.HostKeys(); err != nil {
+		return errors.Wrap(err, "invalid git known hosts")
+	}
+	if err := validateVerifyTimeout(updates.Release.VerifyTimeout); err != nil {
+		return err
+	}
+	if err := validateSchedules(instID, updates.Release.Schedules); err != nil {
+		return err
+	}
+	if err := validatePromotions(updates.Promotion); err != nil {
+		return err
+	}
+	if err := s.config.UpdateConfig(instID, applyConfigUpdates(updates)); err != nil {
+		return err
+	}
+	return s.cancelStaleSchedules(instID, updates.Release.Schedules)
 }
 
 func (s *Server) PatchConfig(instID flux.InstanceID, patch flux.ConfigPatch) error {
@@ -371,7 +808,101 @@ func (s *Server) PatchConfig(instID flux.InstanceID, patch flux.ConfigPatch) err
 	if _, err := registry.CredentialsFromConfig(patchedConfig); err != nil {
 		return errors.Wrap(err, "invalid registry credentials")
 	}
-	return s.config.UpdateConfig(instID, applyConfigUpdates(patchedConfig))
+	if _, err := patchedConfig.Git.HostKeys(); err != nil {
+		return errors.Wrap(err, "invalid git known hosts")
+	}
+	if err := validateVerifyTimeout(patchedConfig.Release.VerifyTimeout); err != nil {
+		return err
+	}
+	if err := validateSchedules(instID, patchedConfig.Release.Schedules); err != nil {
+		return err
+	}
+	if err := validatePromotions(patchedConfig.Promotion); err != nil {
+		return err
+	}
+	if err := s.config.UpdateConfig(instID, applyConfigUpdates(patchedConfig)); err != nil {
+		return err
+	}
+	return s.cancelStaleSchedules(instID, patchedConfig.Release.Schedules)
+}
+
+// validateSchedules checks that the recurring releases in the config
+// can be carried out, so that mistakes are found when setting the
+// config rather than when the release is due.
+func validateSchedules(inst flux.InstanceID, schedules []flux.ReleaseSchedule) error {
+	names := map[string]bool{}
+	for _, schedule := range schedules {
+		if schedule.Name == "" {
+			return errors.New("invalid release schedule: every schedule needs a name")
+		}
+		if names[schedule.Name] {
+			return errors.Errorf("invalid release schedule: there is more than one schedule named %q", schedule.Name)
+		}
+		names[schedule.Name] = true
+		if _, err := automator.ScheduledReleaseJob(inst, schedule, time.Now()); err != nil {
+			return errors.Wrapf(err, "invalid release schedule %q", schedule.Name)
+		}
+	}
+	return nil
+}
+
+// validateVerifyTimeout checks that the time releases wait for
+// services to become ready is a duration, if it's given at all.
+func validateVerifyTimeout(timeout string) error {
+	if timeout == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return errors.Wrap(err, "invalid release verify timeout")
+	}
+	if d < 0 {
+		return errors.Errorf("invalid release verify timeout: %q is negative", timeout)
+	}
+	return nil
+}
+
+// validatePromotions checks that each promotion has a soak time that
+// can be used, so that releases aren't left to find out afterwards.
+func validatePromotions(promotion flux.PromotionConfig) error {
+	for _, edge := range promotion.To {
+		soak, err := edge.Soak()
+		if err != nil {
+			return errors.Wrapf(err, "invalid soak time for promotion to %s", edge.Instance)
+		}
+		if soak < 0 {
+			return errors.Errorf("invalid soak time for promotion to %s: %q is negative", edge.Instance, edge.SoakTime)
+		}
+	}
+	return nil
+}
+
+// cancelStaleSchedules cancels the releases waiting for schedules
+// that have since been changed or removed. The automator queues
+// releases for changed schedules afresh.
+func (s *Server) cancelStaleSchedules(inst flux.InstanceID, schedules []flux.ReleaseSchedule) error {
+	current := map[string]bool{}
+	for _, schedule := range schedules {
+		current[automator.ScheduleKey(inst, schedule)] = true
+	}
+	waiting, err := s.jobs.ListJobs(inst, jobs.JobFilter{
+		Method: jobs.ReleaseJob,
+		State:  jobs.JobQueued,
+		Limit:  jobs.MaxListLimit,
+	})
+	if err != nil {
+		return errors.Wrap(err, "finding scheduled releases")
+	}
+	for _, job := range waiting {
+		params, ok := job.Params.(jobs.ReleaseJobParams)
+		if !ok || params.Schedule == "" || current[job.Key] {
+			continue
+		}
+		if err := s.jobs.CancelJob(inst, job.ID); err != nil && err != jobs.ErrJobFinished {
+			return errors.Wrapf(err, "cancelling release for schedule %q", params.Schedule)
+		}
+	}
+	return nil
 }
 
 func applyConfigUpdates(updates flux.UnsafeInstanceConfig) instance.UpdateFunc {
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/db"
+	"github.com/weaveworks/flux/jobs"
+)
+
+const testInstance = flux.InstanceID("instance")
+
+func newJobStore(t *testing.T) *jobs.DatabaseStore {
+	f, err := ioutil.TempFile("", "fluxy-testdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbsource := "file://" + f.Name()
+	if _, err = db.Migrate(dbsource, "../db/migrations"); err != nil {
+		t.Fatal(err)
+	}
+	store, err := jobs.NewDatabaseStore("ql", dbsource, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// heldRelease puts a release asked for by `user`, and has it worked
+// out and held for the number of approvals given, as the releaser
+// would.
+func heldRelease(t *testing.T, store jobs.JobStore, user string, required int, plan flux.ReleaseResult) jobs.JobID {
+	id, err := store.PutJob(testInstance, jobs.Job{
+		Queue:  jobs.ReleaseJob,
+		Method: jobs.ReleaseJob,
+		Params: jobs.ReleaseJobParams{
+			ReleaseSpec: flux.ReleaseSpec{
+				ServiceSpecs: []flux.ServiceSpec{flux.ServiceSpecAll},
+				ImageSpec:    flux.ImageSpecLatest,
+				Kind:         flux.ReleaseKindExecute,
+			},
+			Cause: flux.ReleaseCause{User: user},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := store.NextJob([]string{jobs.ReleaseJob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := job.Params.(jobs.ReleaseJobParams)
+	params.Approval = &flux.ReleaseApproval{Required: required}
+	job.Params = params
+	job.Result = plan
+	job.Done, job.Success = true, true
+	if err := store.UpdateJob(job); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func queuedReleases(t *testing.T, store jobs.JobStore) []jobs.Job {
+	queued, err := store.ListJobs(testInstance, jobs.JobFilter{Method: jobs.ReleaseJob, State: jobs.JobQueued})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queued
+}
+
+func TestApproveRelease(t *testing.T) {
+	store := newJobStore(t)
+	s := New("test", nil, nil, nil, store, nil, nil, nil, log.NewNopLogger())
+
+	plan := flux.ReleaseResult{
+		"default/helloworld": flux.ServiceResult{Status: flux.ReleaseStatusPending},
+	}
+	id := heldRelease(t, store, "alice", 2, plan)
+
+	for _, x := range []struct {
+		user string
+		err  error
+	}{
+		{"", ErrApprovalUser},
+		{"alice", ErrSelfApproval},
+		{"bob", nil},
+		{"bob", ErrApprovalUser},
+	} {
+		releaseID, err := s.ApproveRelease(testInstance, id, flux.Approval{User: x.user})
+		if err != x.err {
+			t.Errorf("approval by %q: expected error %v, got %v", x.user, x.err, err)
+		}
+		if releaseID != "" {
+			t.Errorf("approval by %q: expected no release before enough approvals, got %s", x.user, releaseID)
+		}
+	}
+	if queued := queuedReleases(t, store); len(queued) != 0 {
+		t.Fatalf("expected no release to be queued before enough approvals, got %d", len(queued))
+	}
+
+	// The last approval needed queues the release that carries out
+	// the plan
+	releaseID, err := s.ApproveRelease(testInstance, id, flux.Approval{User: "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if releaseID == "" {
+		t.Fatal("expected a release to be queued once approved")
+	}
+	queued := queuedReleases(t, store)
+	if len(queued) != 1 || queued[0].ID != releaseID {
+		t.Fatalf("expected release %s to be queued, got %#v", releaseID, queued)
+	}
+	params := queued[0].Params.(jobs.ReleaseJobParams)
+	if params.Approved != id {
+		t.Errorf("expected queued release to be approved by %s, got %q", id, params.Approved)
+	}
+	if !reflect.DeepEqual(params.ApprovedPlan, plan) {
+		t.Errorf("expected queued release to carry the approved plan %#v, got %#v", plan, params.ApprovedPlan)
+	}
+	if params.Cause.User != "alice" {
+		t.Errorf("expected queued release to be attributed to alice, got %q", params.Cause.User)
+	}
+
+	held, err := store.GetJob(testInstance, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approval := held.Params.(jobs.ReleaseJobParams).Approval
+	if len(approval.Approvals) != 2 || approval.ReleaseID != flux.ReleaseID(releaseID) {
+		t.Errorf("expected two approvals and release %s recorded, got %#v", releaseID, approval)
+	}
+
+	// Once approved, it can't be approved (or rejected) again
+	if _, err := s.ApproveRelease(testInstance, id, flux.Approval{User: "dave"}); err != ErrNotPendingApproval {
+		t.Errorf("expected %v, got %v", ErrNotPendingApproval, err)
+	}
+	if err := s.RejectRelease(testInstance, id, flux.Approval{User: "dave"}); err != ErrNotPendingApproval {
+		t.Errorf("expected %v, got %v", ErrNotPendingApproval, err)
+	}
+	if queued := queuedReleases(t, store); len(queued) != 1 {
+		t.Errorf("expected only the one release to be queued, got %d", len(queued))
+	}
+}
+
+func TestRejectRelease(t *testing.T) {
+	store := newJobStore(t)
+	s := New("test", nil, nil, nil, store, nil, nil, nil, log.NewNopLogger())
+
+	id := heldRelease(t, store, "alice", 1, flux.ReleaseResult{})
+
+	if err := s.RejectRelease(testInstance, id, flux.Approval{}); err != ErrApprovalUser {
+		t.Errorf("expected %v for rejection without a user, got %v", ErrApprovalUser, err)
+	}
+	if err := s.RejectRelease(testInstance, id, flux.Approval{User: "bob", Message: "not during the freeze"}); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := store.GetJob(testInstance, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State() != jobs.JobRejected {
+		t.Errorf("expected release to be %s, got %s", jobs.JobRejected, job.State())
+	}
+	rejection := job.Params.(jobs.ReleaseJobParams).Approval.Rejection
+	if rejection == nil || rejection.User != "bob" || rejection.Message != "not during the freeze" {
+		t.Errorf("expected rejection by bob to be recorded, got %#v", rejection)
+	}
+
+	// Once rejected, there's nothing to approve or reject
+	if _, err := s.ApproveRelease(testInstance, id, flux.Approval{User: "carol"}); err != ErrNotPendingApproval {
+		t.Errorf("expected %v, got %v", ErrNotPendingApproval, err)
+	}
+	if err := s.RejectRelease(testInstance, id, flux.Approval{User: "carol"}); err != ErrNotPendingApproval {
+		t.Errorf("expected %v, got %v", ErrNotPendingApproval, err)
+	}
+	if queued := queuedReleases(t, store); len(queued) != 0 {
+		t.Errorf("expected no release to be queued after a rejection, got %d", len(queued))
+	}
+
+	// Nor is there in a release that hasn't been worked out yet
+	queuedID, err := store.PutJob(testInstance, jobs.Job{
+		Queue:  jobs.ReleaseJob,
+		Method: jobs.ReleaseJob,
+		Params: jobs.ReleaseJobParams{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ApproveRelease(testInstance, queuedID, flux.Approval{User: "carol"}); err != ErrNotPendingApproval {
+		t.Errorf("expected %v for a queued release, got %v", ErrNotPendingApproval, err)
+	}
+}
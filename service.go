@@ -36,6 +36,10 @@ type InstanceID string
 
 const InstanceIDHeaderKey = "X-Scope-OrgID"
 
+// The authenticating proxy in front of fluxsvc says which user made a
+// request with this header.
+const UserIDHeaderKey = "X-Scope-UserID"
+
 const DefaultInstanceID = "<default-instance-id>"
 
 type ServiceID string // "default/helloworld"
@@ -210,6 +214,7 @@ func ImageSpecFromID(id ImageID) ImageSpec {
 type ImageStatus struct {
 	ID         ServiceID
 	Containers []Container
+	TagFilter  TagFilter `json:",omitempty"`
 }
 
 // Policy is an string, denoting the current deployment policy of a service,
@@ -286,4 +291,6 @@ type FluxdStatus struct {
 type GitStatus struct {
 	Configured bool   `json:"configured" yaml:"configured"`
 	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+	// The commit last synced to the platform, if syncing is enabled
+	SyncedRevision string `json:"syncedRevision,omitempty" yaml:"syncedRevision,omitempty"`
 }
@@ -0,0 +1,6 @@
+// Package sync keeps the platform in sync with the config repo. For
+// each instance that has syncing enabled, it looks for new commits on
+// the configured branch, and applies the resources whose files have
+// changed since the last commit synced -- and deletes those whose
+// files have been removed -- by asking the platform to `Sync`.
+package sync
@@ -0,0 +1,277 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/notifications"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/platform/kubernetes"
+)
+
+const (
+	syncCycle = 60 * time.Second
+)
+
+// Syncer applies changes in the config repo to the platform.
+type Syncer struct {
+	cfg Config
+}
+
+// New creates a new syncer.
+func New(cfg Config) (*Syncer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &Syncer{
+		cfg: cfg,
+	}, nil
+}
+
+func (s *Syncer) Start(errorLogger log.Logger) {
+	s.checkAll(errorLogger)
+	tick := time.Tick(syncCycle)
+	for range tick {
+		s.checkAll(errorLogger)
+	}
+}
+
+func (s *Syncer) checkAll(errorLogger log.Logger) {
+	insts, err := s.cfg.InstanceDB.All()
+	if err != nil {
+		errorLogger.Log("err", err)
+		return
+	}
+	for _, inst := range insts {
+		if !syncEnabled(inst.Config) {
+			continue
+		}
+
+		_, err := s.cfg.Jobs.PutJob(inst.ID, syncJob(inst.ID, time.Now()))
+		if err != nil && err != jobs.ErrJobAlreadyQueued {
+			errorLogger.Log("err", errors.Wrapf(err, "queueing sync job"))
+		}
+	}
+}
+
+func syncEnabled(config instance.Config) bool {
+	return config.Settings.Sync.Enabled && config.Settings.Git.URL != ""
+}
+
+func (s *Syncer) Handle(_ context.Context, j *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
+	logger := log.NewContext(s.cfg.Logger).With("job", j.ID)
+	switch j.Method {
+	case jobs.SyncJob:
+		return s.handleSyncJob(logger, j, updater)
+	default:
+		return nil, jobs.ErrUnknownJobMethod
+	}
+}
+
+func (s *Syncer) handleSyncJob(logger log.Logger, job *jobs.Job, updater jobs.JobUpdater) ([]jobs.Job, error) {
+	started := time.Now().UTC()
+	followUps := []jobs.Job{syncJob(job.Instance, started)}
+	params := job.Params.(jobs.SyncJobParams)
+
+	config, err := s.cfg.InstanceDB.GetConfig(params.InstanceID)
+	if err != nil {
+		return followUps, errors.Wrap(err, "getting instance config")
+	}
+
+	// Syncing has been turned off; don't check again.
+	if !syncEnabled(config) {
+		return nil, nil
+	}
+
+	inst, err := s.cfg.Instancer.Get(params.InstanceID)
+	if err != nil {
+		return followUps, errors.Wrap(err, "getting job instance")
+	}
+
+	logInJob := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		job.Log = append(job.Log, msg)
+		updater.UpdateJob(*job)
+	}
+
+	// Most of the time there's nothing new, so look before going to
+	// the trouble of getting a working copy.
+	repo := inst.ConfigRepo()
+	head, err := repo.BranchHead()
+	if err != nil {
+		return followUps, errors.Wrap(err, "getting head of branch")
+	}
+	if head == config.SyncedRevision {
+		return followUps, nil
+	}
+
+	// We need the history to compare with the last revision synced
+	path, err := repo.CloneWithHistory()
+	if err != nil {
+		return followUps, errors.Wrap(err, "cloning repo")
+	}
+	defer repo.Clean(path)
+
+	// The branch may have moved on again since we looked
+	head, err = git.HeadRevision(path)
+	if err != nil {
+		return followUps, errors.Wrap(err, "getting HEAD revision")
+	}
+	if head == config.SyncedRevision {
+		return followUps, nil
+	}
+
+	since := config.SyncedRevision
+	if since != "" && !git.HasRevision(path, since) {
+		logInJob("last synced revision %s is not in the repo; applying all files", since)
+		since = ""
+	}
+	changed, deleted, err := git.ChangedFiles(path, repo.Path, since, head)
+	if err != nil {
+		return followUps, errors.Wrap(err, "finding changed files")
+	}
+
+	metadata := flux.SyncEventMetadata{
+		Revision: head,
+	}
+	var actions []platform.SyncAction
+	for _, file := range deleted {
+		if !isManifest(file) {
+			continue
+		}
+		def, err := git.FileAtRevision(path, since, file)
+		if err != nil {
+			return followUps, errors.Wrapf(err, "reading deleted file %s", file)
+		}
+		actions = append(actions, platform.SyncAction{
+			ResourceID: file,
+			Delete:     def,
+		})
+		metadata.Deleted = append(metadata.Deleted, file)
+	}
+	for _, file := range changed {
+		if !isManifest(file) {
+			continue
+		}
+		def, err := ioutil.ReadFile(filepath.Join(path, file))
+		if err != nil {
+			return followUps, errors.Wrapf(err, "reading file %s", file)
+		}
+		actions = append(actions, platform.SyncAction{
+			ResourceID: file,
+			Apply:      def,
+		})
+		metadata.Applied = append(metadata.Applied, file)
+	}
+
+	logInJob("syncing revision %s: %d files to apply, %d to delete", head, len(metadata.Applied), len(metadata.Deleted))
+	logLevel := flux.LogLevelInfo
+	if len(actions) > 0 {
+		syncErr := inst.PlatformSync(platform.SyncDef{Actions: actions})
+		switch syncErr := syncErr.(type) {
+		case nil:
+			break
+		case platform.SyncError:
+			// Some resources failed; record that, but carry on, since
+			// trying again won't help until there's another commit.
+			logLevel = flux.LogLevelError
+			metadata.Errors = map[string]string{}
+			for file, err := range syncErr {
+				logInJob("error syncing %s: %s", file, err)
+				metadata.Errors[file] = err.Error()
+			}
+		default:
+			// Nothing was synced (e.g., the daemon is not connected),
+			// so try again next time.
+			return followUps, errors.Wrap(syncErr, "syncing platform")
+		}
+	}
+
+	if err := inst.UpdateConfig(func(conf instance.Config) (instance.Config, error) {
+		conf.SyncedRevision = head
+		return conf, nil
+	}); err != nil {
+		return followUps, errors.Wrap(err, "recording synced revision")
+	}
+
+	event := flux.Event{
+		ServiceIDs: servicesDefinedIn(logger, path, metadata.Applied),
+		Type:       flux.EventSync,
+		StartedAt:  started,
+		EndedAt:    time.Now().UTC(),
+		LogLevel:   logLevel,
+		Metadata:   metadata,
+	}
+	if err := inst.LogEvent(event); err != nil {
+		return followUps, errors.Wrap(err, "logging sync event")
+	}
+	if err := notifications.Event(config, event); err != nil {
+		logInJob("error sending notifications: %s", err)
+	}
+	return followUps, nil
+}
+
+func isManifest(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// servicesDefinedIn gives the IDs of the services defined in the files
+// (relative to the top of the repo at path) given. This is only used
+// to label the sync event, so failures are logged rather than
+// returned.
+func servicesDefinedIn(logger log.Logger, path string, files []string) []flux.ServiceID {
+	if len(files) == 0 {
+		return nil
+	}
+	defined, _, err := kubernetes.ParseServices(path)
+	if err != nil {
+		logger.Log("err", errors.Wrap(err, "finding services in synced files"))
+		return nil
+	}
+	inFiles := map[string]bool{}
+	for _, file := range files {
+		inFiles[filepath.Join(path, file)] = true
+	}
+	var ids []flux.ServiceID
+	for id, defn := range defined {
+		for _, p := range append([]string{defn.Service}, defn.Controllers...) {
+			if inFiles[filepath.Clean(p)] {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func syncJob(instanceID flux.InstanceID, now time.Time) jobs.Job {
+	return jobs.Job{
+		Queue: jobs.SyncJob,
+		// Key stops us getting two jobs for the same instance
+		Key: strings.Join([]string{
+			jobs.SyncJob,
+			string(instanceID),
+		}, "|"),
+		Method:   jobs.SyncJob,
+		Priority: jobs.PriorityBackground,
+		Params: jobs.SyncJobParams{
+			InstanceID: instanceID,
+		},
+		ScheduledAt: now.UTC().Add(syncCycle),
+	}
+}
@@ -0,0 +1,182 @@
+package sync
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/weaveworks/flux"
+	"github.com/weaveworks/flux/git"
+	"github.com/weaveworks/flux/history"
+	"github.com/weaveworks/flux/instance"
+	"github.com/weaveworks/flux/jobs"
+	"github.com/weaveworks/flux/platform"
+	"github.com/weaveworks/flux/platform/kubernetes/testdata"
+)
+
+var instanceID = flux.InstanceID("instance")
+
+// mockDB serves the config of the one instance, from its configurer.
+type mockDB struct {
+	*instance.MockConfigurer
+}
+
+func (db mockDB) GetConfig(_ flux.InstanceID) (instance.Config, error) {
+	return db.Get()
+}
+
+func (db mockDB) UpdateConfig(_ flux.InstanceID, update instance.UpdateFunc) error {
+	return db.Update(update)
+}
+
+func (db mockDB) All() ([]instance.NamedConfig, error) {
+	return nil, nil
+}
+
+type mockUpdater struct{}
+
+func (mockUpdater) UpdateJob(jobs.Job) error               { return nil }
+func (mockUpdater) Heartbeat(jobs.JobID) error             { return nil }
+func (mockUpdater) RetryJob(jobs.Job, time.Duration) error { return nil }
+
+// setup gives a syncer for an instance with sync turned on, whose
+// config repo has the test files in it; the working copy it was
+// pushed from, to make further commits; and the actions synced so far.
+func setup(t *testing.T) (*Syncer, string, *[]platform.SyncAction, func()) {
+	dir, cleanup := testdata.TempDir(t)
+	upstream := filepath.Join(dir, "upstream")
+	work := filepath.Join(dir, "work")
+	gitIn(t, dir, "init", "-q", "--bare", upstream)
+	gitIn(t, dir, "init", "-q", work)
+	if err := testdata.WriteTestFiles(work); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	commitAndPush(t, work, upstream, "Initial revision")
+
+	var synced []platform.SyncAction
+	config := &instance.MockConfigurer{
+		Config: instance.Config{
+			Settings: flux.UnsafeInstanceConfig{
+				Git:  flux.GitConfig{URL: upstream, Branch: "master"},
+				Sync: flux.SyncConfig{Enabled: true},
+			},
+		},
+	}
+	events := history.NewMock()
+	inst := &instance.Instance{
+		Platform: &platform.MockPlatform{
+			SyncArgTest: func(def platform.SyncDef) error {
+				synced = append(synced, def.Actions...)
+				return nil
+			},
+		},
+		Config:      config,
+		Repo:        git.Repo{URL: upstream, Branch: "master"},
+		Logger:      log.NewNopLogger(),
+		EventReader: events,
+		EventWriter: events,
+	}
+	// Only the handler is used, so there's no need for a job queue
+	syncer := &Syncer{cfg: Config{
+		InstanceDB: mockDB{config},
+		Instancer:  &instance.MockInstancer{inst, nil},
+		Logger:     log.NewNopLogger(),
+	}}
+	return syncer, work, &synced, cleanup
+}
+
+func runSync(t *testing.T, syncer *Syncer) {
+	job := &jobs.Job{
+		Instance: instanceID,
+		Method:   jobs.SyncJob,
+		Params:   jobs.SyncJobParams{InstanceID: instanceID},
+	}
+	followUps, err := syncer.Handle(context.Background(), job, mockUpdater{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(followUps) != 1 || followUps[0].Method != jobs.SyncJob {
+		t.Errorf("expected another sync to be scheduled, got %#v", followUps)
+	}
+}
+
+func TestSync_AppliesChangedFiles(t *testing.T) {
+	syncer, work, synced, cleanup := setup(t)
+	defer cleanup()
+
+	// The first sync applies everything
+	runSync(t, syncer)
+	var applied []string
+	for _, action := range *synced {
+		applied = append(applied, action.ResourceID)
+	}
+	var expected []string
+	for name := range testdata.Files {
+		expected = append(expected, name)
+	}
+	sort.Strings(applied)
+	sort.Strings(expected)
+	if strings.Join(applied, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected all files to be applied, got %v", applied)
+	}
+
+	// After that, only what has changed
+	*synced = nil
+	changed := expected[0]
+	if err := ioutil.WriteFile(filepath.Join(work, changed), []byte(testdata.Files[changed]+"\n# changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commitAndPush(t, work, "", "Change a file")
+	runSync(t, syncer)
+	if len(*synced) != 1 || (*synced)[0].ResourceID != changed || (*synced)[0].Apply == nil {
+		t.Errorf("expected only %s to be applied, got %+v", changed, *synced)
+	}
+}
+
+func TestSync_SkipsWhenUnchanged(t *testing.T) {
+	syncer, _, synced, cleanup := setup(t)
+	defer cleanup()
+
+	runSync(t, syncer)
+	conf, err := syncer.cfg.InstanceDB.GetConfig(instanceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.SyncedRevision == "" {
+		t.Fatal("expected synced revision to be recorded")
+	}
+
+	*synced = nil
+	runSync(t, syncer)
+	if len(*synced) != 0 {
+		t.Errorf("expected nothing to be synced when nothing has changed, got %+v", *synced)
+	}
+}
+
+// commitAndPush commits everything in the working copy, and pushes it
+// to master upstream (or wherever it was pushed to last, if upstream
+// is empty).
+func commitAndPush(t *testing.T, work, upstream, msg string) {
+	gitIn(t, work, "add", "--all")
+	gitIn(t, work, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", msg)
+	if upstream != "" {
+		gitIn(t, work, "remote", "add", "origin", upstream)
+	}
+	gitIn(t, work, "push", "-q", "origin", "HEAD:refs/heads/master")
+}
+
+func gitIn(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, out)
+	}
+}
@@ -0,0 +1,344 @@
+package flux
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TagFilterNone = TagFilter("")
+
+	tagFilterSemver = "semver"
+	tagFilterGlob   = "glob"
+	tagFilterRegexp = "regexp"
+)
+
+var ErrInvalidTagFilter = errors.New("invalid tag filter")
+
+// TagFilter restricts which tags of an image are considered for
+// automated (and "latest") releases of a service. It has the form
+// `<kind>:<pattern>`, where kind is one of
+//
+//   - semver, e.g., `semver:~1.4` or `semver:>=1.2.0, <2`
+//   - glob, e.g., `glob:prod-*`
+//   - regexp, e.g., `regexp:^v\d+`
+//
+// The empty TagFilter matches every tag.
+type TagFilter string
+
+func ParseTagFilter(s string) (TagFilter, error) {
+	f := TagFilter(s)
+	if f == TagFilterNone {
+		return f, nil
+	}
+	kind, pattern := f.Components()
+	var err error
+	switch kind {
+	case tagFilterSemver:
+		_, err = parseSemverConstraints(pattern)
+	case tagFilterGlob:
+		_, err = path.Match(pattern, "")
+	case tagFilterRegexp:
+		_, err = regexp.Compile(pattern)
+	default:
+		return "", errors.Wrapf(ErrInvalidTagFilter, "unknown kind %q; expected one of semver, glob or regexp", kind)
+	}
+	if err != nil {
+		return "", errors.Wrapf(ErrInvalidTagFilter, "%s pattern %q: %s", kind, pattern, err)
+	}
+	return f, nil
+}
+
+func (f TagFilter) Components() (kind, pattern string) {
+	toks := strings.SplitN(string(f), ":", 2)
+	if len(toks) != 2 {
+		return toks[0], ""
+	}
+	return toks[0], toks[1]
+}
+
+func (f TagFilter) String() string {
+	return string(f)
+}
+
+// Matches reports whether the tag given passes the filter. A filter
+// that cannot be parsed matches nothing.
+func (f TagFilter) Matches(tag string) bool {
+	if f == TagFilterNone {
+		return true
+	}
+	kind, pattern := f.Components()
+	switch kind {
+	case tagFilterSemver:
+		cs, err := parseSemverConstraints(pattern)
+		if err != nil {
+			return false
+		}
+		v, err := parseSemver(tag)
+		if err != nil {
+			return false
+		}
+		return cs.matches(v)
+	case tagFilterGlob:
+		ok, err := path.Match(pattern, tag)
+		return err == nil && ok
+	case tagFilterRegexp:
+		ok, err := regexp.MatchString(pattern, tag)
+		return err == nil && ok
+	}
+	return false
+}
+
+// Newer reports whether tag a should be preferred to tag b, assuming
+// both match the filter. Only semver filters impose an order of their
+// own; for everything else, the caller should fall back on the
+// creation time of the images.
+func (f TagFilter) Newer(a, b string) bool {
+	if kind, _ := f.Components(); kind != tagFilterSemver {
+		return false
+	}
+	va, erra := parseSemver(a)
+	vb, errb := parseSemver(b)
+	if erra != nil || errb != nil {
+		return false
+	}
+	return va.compare(vb) > 0
+}
+
+// ---
+
+type semver struct {
+	major, minor, patch int64
+	pre                 []string
+}
+
+// parseSemver parses a tag like `v1.4.2-rc.1+build5`. The leading v,
+// and the minor and patch numbers, are optional.
+func parseSemver(s string) (semver, error) {
+	v, given, err := parsePartialSemver(s)
+	if err == nil && given == 0 {
+		err = errors.New("no version number")
+	}
+	return v, err
+}
+
+// parsePartialSemver parses a version that may have components
+// missing or wildcarded (`1.4`, `1.x`, `1.4.*`), returning how many
+// components were given.
+func parsePartialSemver(s string) (semver, int, error) {
+	var v semver
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.Index(s, "+"); i > -1 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i > -1 {
+		if s[i+1:] == "" {
+			return v, 0, errors.Errorf("empty pre-release in %q", s)
+		}
+		v.pre = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	if s == "" {
+		return v, 0, errors.New("empty version")
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, 0, errors.Errorf("too many components in %q", s)
+	}
+	nums := []*int64{&v.major, &v.minor, &v.patch}
+	given := 0
+	for i, p := range parts {
+		if p == "x" || p == "X" || p == "*" {
+			break
+		}
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || n < 0 {
+			return v, 0, errors.Errorf("invalid version number %q", p)
+		}
+		*nums[i] = n
+		given++
+	}
+	return v, given, nil
+}
+
+func (v semver) compare(w semver) int {
+	for _, d := range []int64{v.major - w.major, v.minor - w.minor, v.patch - w.patch} {
+		switch {
+		case d < 0:
+			return -1
+		case d > 0:
+			return 1
+		}
+	}
+	// A version without a pre-release sorts after one with
+	switch {
+	case len(v.pre) == 0 && len(w.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(w.pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(w.pre); i++ {
+		if c := comparePreRelease(v.pre[i], w.pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.pre) < len(w.pre):
+		return -1
+	case len(v.pre) > len(w.pre):
+		return 1
+	}
+	return 0
+}
+
+func comparePreRelease(a, b string) int {
+	na, erra := strconv.ParseInt(a, 10, 64)
+	nb, errb := strconv.ParseInt(b, 10, 64)
+	switch {
+	case erra == nil && errb == nil:
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	case erra == nil: // numeric identifiers sort first
+		return -1
+	case errb == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// bump gives the lowest version above all those that agree with v in
+// the first `given` components.
+func (v semver) bump(given int) semver {
+	switch given {
+	case 1:
+		return semver{major: v.major + 1}
+	case 2:
+		return semver{major: v.major, minor: v.minor + 1}
+	}
+	return semver{major: v.major, minor: v.minor, patch: v.patch + 1}
+}
+
+type semverConstraint struct {
+	op string
+	v  semver
+}
+
+type semverConstraints []semverConstraint
+
+// parseSemverConstraints parses a list of comparisons (separated by
+// commas or spaces), all of which must hold, into a list of simple
+// bounds. It understands `=`, `<`, `<=`, `>`, `>=`, and the tilde
+// (`~1.4`, meaning `>=1.4.0, <1.5.0`) and caret (`^1.4`, meaning
+// `>=1.4.0, <2.0.0`) ranges. A bare partial version like `1.4` is
+// treated like `1.4.x`.
+func parseSemverConstraints(s string) (semverConstraints, error) {
+	var cs semverConstraints
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	if len(fields) == 0 {
+		return nil, errors.New("empty constraint")
+	}
+	for _, field := range fields {
+		i := strings.IndexFunc(field, func(r rune) bool {
+			return !strings.ContainsRune("<>=~^", r)
+		})
+		if i == -1 {
+			return nil, errors.Errorf("operator without version in %q", field)
+		}
+		op := field[:i]
+		v, given, err := parsePartialSemver(field[i:])
+		if err != nil {
+			return nil, err
+		}
+		if given == 0 { // a wildcard, e.g., `*` or `x`
+			if op != "" && op != "=" {
+				return nil, errors.Errorf("wildcard with operator in %q", field)
+			}
+			continue
+		}
+		switch op {
+		case "", "=":
+			if given == 3 {
+				cs = append(cs, semverConstraint{"=", v})
+				continue
+			}
+			cs = append(cs, semverConstraint{">=", v}, semverConstraint{"<", v.bump(given)})
+		case "~":
+			upper := v.bump(2)
+			if given == 1 {
+				upper = v.bump(1)
+			}
+			cs = append(cs, semverConstraint{">=", v}, semverConstraint{"<", upper})
+		case "^":
+			upper := v.bump(1)
+			switch {
+			case v.major == 0 && v.minor == 0 && given == 3:
+				upper = v.bump(3)
+			case v.major == 0 && given >= 2:
+				upper = v.bump(2)
+			}
+			cs = append(cs, semverConstraint{">=", v}, semverConstraint{"<", upper})
+		case ">", "<=":
+			// `>1.4` means above anything 1.4.x, and `<=1.4`
+			// includes all of 1.4.x
+			if given < 3 {
+				op = map[string]string{">": ">=", "<=": "<"}[op]
+				v = v.bump(given)
+			}
+			cs = append(cs, semverConstraint{op, v})
+		case ">=", "<":
+			cs = append(cs, semverConstraint{op, v})
+		default:
+			return nil, errors.Errorf("unknown operator %q", op)
+		}
+	}
+	return cs, nil
+}
+
+func (cs semverConstraints) matches(v semver) bool {
+	// Pre-releases only match if they are explicitly asked for, and
+	// then only for the same version
+	if len(v.pre) > 0 {
+		asked := false
+		for _, c := range cs {
+			if len(c.v.pre) > 0 && c.v.major == v.major && c.v.minor == v.minor && c.v.patch == v.patch {
+				asked = true
+			}
+		}
+		if !asked {
+			return false
+		}
+	}
+	for _, c := range cs {
+		cmp := v.compare(c.v)
+		var ok bool
+		switch c.op {
+		case "=":
+			ok = cmp == 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package flux
+
+import (
+	"testing"
+)
+
+func TestTagFilter_Matches(t *testing.T) {
+	for _, x := range []struct {
+		filter  string
+		matches []string
+		misses  []string
+	}{
+		{"", []string{"latest", "v1.4.2", "debug-abc123"}, nil},
+		{"semver:~1.4", []string{"1.4.0", "v1.4.2", "1.4"}, []string{"1.5.0", "1.3.9", "1.4.3-rc1", "debug-abc123", "latest"}},
+		{"semver:^1.4", []string{"1.4.0", "1.9.1"}, []string{"2.0.0", "1.3.0", "2.0.0-rc1"}},
+		{"semver:^0.4.2", []string{"0.4.2", "0.4.9"}, []string{"0.5.0", "0.4.1"}},
+		{"semver:>=1.2.0, <2", []string{"1.2.0", "1.99.0"}, []string{"2.0.0", "1.1.9"}},
+		{"semver:>1.4", []string{"1.5.0"}, []string{"1.4.9"}},
+		{"semver:<=1.4", []string{"1.4.9", "0.1.0"}, []string{"1.5.0"}},
+		{"semver:1.x", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{"semver:*", []string{"0.0.1", "10.0.0"}, []string{"1.0.0-beta", "prod"}},
+		{"semver:2.0.0-rc1", []string{"2.0.0-rc1"}, []string{"2.0.0-rc2", "2.0.0"}},
+		{"glob:prod-*", []string{"prod-1", "prod-"}, []string{"staging-1", "prod"}},
+		{`regexp:^v\d+`, []string{"v1", "v1.4.2"}, []string{"1.4.2", "latest"}},
+		{"nonsense:foo", nil, []string{"foo"}},
+	} {
+		f := TagFilter(x.filter)
+		for _, tag := range x.matches {
+			if !f.Matches(tag) {
+				t.Errorf("expected %q to match tag %q", x.filter, tag)
+			}
+		}
+		for _, tag := range x.misses {
+			if f.Matches(tag) {
+				t.Errorf("expected %q not to match tag %q", x.filter, tag)
+			}
+		}
+	}
+}
+
+func TestTagFilter_Parse(t *testing.T) {
+	for _, good := range []string{"", "semver:~1.4", "semver:>=1.0 <2.0", "glob:prod-*", `regexp:^v\d+`} {
+		if _, err := ParseTagFilter(good); err != nil {
+			t.Errorf("expected %q to parse, got %s", good, err)
+		}
+	}
+	for _, bad := range []string{"prod-*", "semver:", "semver:~foo", "semver:>=*", "glob:[", "regexp:(", "foo:bar"} {
+		if _, err := ParseTagFilter(bad); err == nil {
+			t.Errorf("expected %q to fail to parse", bad)
+		}
+	}
+}
+
+func TestTagFilter_Newer(t *testing.T) {
+	semver := TagFilter("semver:*")
+	if !semver.Newer("1.10.0", "1.9.0") {
+		t.Error("expected 1.10.0 to be newer than 1.9.0")
+	}
+	if semver.Newer("1.0.0-rc1", "1.0.0") {
+		t.Error("expected pre-release not to be newer than release")
+	}
+	if TagFilter("glob:*").Newer("1.10.0", "1.9.0") {
+		t.Error("expected glob filter not to impose an order")
+	}
+}